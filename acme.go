@@ -4,13 +4,29 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/user"
 	"strconv"
 	"strings"
-
-	"9fans.net/go/acme"
+	"unicode"
 )
 
+// acmeWin is the subset of the methods of *acme.Win used by godef,
+// implemented separately on Plan 9, where acme's files are mounted
+// in the name space rather than reached through plan9port.
+type acmeWin interface {
+	Ctl(format string, args ...interface{}) error
+	Read(file string, b []byte) (int, error)
+	ReadAll(file string) ([]byte, error)
+	ReadAddr() (q0, q1 int, err error)
+	Write(file string, b []byte) (int, error)
+	CloseFiles()
+}
+
+// acmeWinInfo describes an open acme window.
+type acmeWinInfo struct {
+	ID   int
+	Name string
+}
+
 type acmeFile struct {
 	name       string
 	body       []byte
@@ -24,7 +40,13 @@ func acmeCurrentFile() (*acmeFile, error) {
 		return nil, err
 	}
 	defer win.CloseFiles()
-	_, _, err = win.ReadAddr() // make sure address file is already open.
+	return readAcmeFile(win)
+}
+
+// readAcmeFile returns the file in win, with the offset of the
+// identifier selected by dot, converted from acme's rune offsets.
+func readAcmeFile(win acmeWin) (*acmeFile, error) {
+	_, _, err := win.ReadAddr() // make sure address file is already open.
 	if err != nil {
 		return nil, fmt.Errorf("cannot read address: %v", err)
 	}
@@ -32,7 +54,7 @@ func acmeCurrentFile() (*acmeFile, error) {
 	if err != nil {
 		return nil, fmt.Errorf("cannot set addr=dot: %v", err)
 	}
-	q0, _, err := win.ReadAddr()
+	q0, q1, err := win.ReadAddr()
 	if err != nil {
 		return nil, fmt.Errorf("cannot read address: %v", err)
 	}
@@ -40,6 +62,7 @@ func acmeCurrentFile() (*acmeFile, error) {
 	if err != nil {
 		return nil, fmt.Errorf("cannot read body: %v", err)
 	}
+	q0 = selectionOffset([]rune(string(body)), q0, q1)
 	tagb, err := win.ReadAll("tag")
 	if err != nil {
 		return nil, fmt.Errorf("cannot read tag: %v", err)
@@ -62,7 +85,7 @@ func acmeCurrentFile() (*acmeFile, error) {
 // We would use win.ReadAll except for a bug in acme
 // where it crashes when reading trying to read more
 // than the negotiated 9P message size.
-func readBody(win *acme.Win) ([]byte, error) {
+func readBody(win acmeWin) ([]byte, error) {
 	var body []byte
 	buf := make([]byte, 8000)
 	for {
@@ -78,81 +101,162 @@ func readBody(win *acme.Win) ([]byte, error) {
 	return body, nil
 }
 
-func acmeCurrentWin() (*acme.Win, error) {
-	winid := os.Getenv("winid")
-	if winid == "" {
-		return nil, fmt.Errorf("$winid not set - not running inside acme?")
+// acmeDirtyFiles returns the bodies of all acme windows holding Go
+// files with unsaved changes, keyed by file name, so that they
+// can be used as overlays when loading packages.
+func acmeDirtyFiles() (map[string][]byte, error) {
+	wins, err := acmeWindows()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list acme windows: %v", err)
 	}
-	id, err := strconv.Atoi(winid)
+	files := make(map[string][]byte)
+	for _, info := range wins {
+		if !strings.HasSuffix(info.Name, ".go") {
+			continue
+		}
+		win, err := openAcmeWin(info.ID)
+		if err != nil {
+			continue
+		}
+		dirty, err := isDirty(win)
+		if err == nil && dirty {
+			if body, err := readBody(win); err == nil {
+				files[info.Name] = body
+			}
+		}
+		win.CloseFiles()
+	}
+	return files, nil
+}
+
+// isDirty reports whether the window has unsaved changes,
+// as indicated by the fifth field of its ctl file.
+func isDirty(win acmeWin) (bool, error) {
+	ctl, err := win.ReadAll("ctl")
 	if err != nil {
-		return nil, fmt.Errorf("invalid $winid %q", winid)
+		return false, err
+	}
+	f := strings.Fields(string(ctl))
+	if len(f) < 5 {
+		return false, fmt.Errorf("short ctl file %q", ctl)
 	}
-	if err := setNameSpace(); err != nil {
+	return f[4] == "1", nil
+}
+
+// acmeCurrentWin opens the window named by the -winid flag,
+// or by $winid if that is not given.
+func acmeCurrentWin() (acmeWin, error) {
+	id, err := acmeWinID()
+	if err != nil {
 		return nil, err
 	}
-	win, err := acme.Open(id, nil)
+	win, err := openAcmeWin(id)
 	if err != nil {
 		return nil, fmt.Errorf("cannot open acme window: %v", err)
 	}
 	return win, nil
 }
 
-func runeOffset2ByteOffset(b []byte, off int) int {
-	r := 0
-	for i, _ := range string(b) {
-		if r == off {
-			return i
-		}
-		r++
+// acmeWinID returns the id of the window named by the -winid
+// flag, or by $winid if that is not given.
+func acmeWinID() (int, error) {
+	if *winidFlag > 0 {
+		return *winidFlag, nil
 	}
-	return len(b)
-}
-
-func setNameSpace() error {
-	if ns := os.Getenv("NAMESPACE"); ns != "" {
-		return nil
+	winid := os.Getenv("winid")
+	if winid == "" {
+		return 0, fmt.Errorf("$winid not set - not running inside acme?")
 	}
-	ns, err := nsFromDisplay()
+	id, err := strconv.Atoi(winid)
 	if err != nil {
-		return fmt.Errorf("cannot get name space: %v", err)
+		return 0, fmt.Errorf("invalid $winid %q", winid)
 	}
-	os.Setenv("NAMESPACE", ns)
-	return nil
+	return id, nil
 }
 
-// taken from src/lib9/getns.c
-// This should go into goplan9/plan9/client.
-func nsFromDisplay() (string, error) {
-	disp := os.Getenv("DISPLAY")
-	if disp == "" {
-		// original code had heuristic for OS X here;
-		// we'll just assume that and fail anyway if it
-		// doesn't work.
-		disp = ":0.0"
-	}
-	// canonicalize: xxx:0.0 => xxx:0
-	if i := strings.LastIndex(disp, ":"); i >= 0 {
-		if strings.HasSuffix(disp, ".0") {
-			disp = disp[:len(disp)-2]
+// acmeShow replaces the body of the window named name, creating
+// the window if there is none, with text.
+func acmeShow(name string, text []byte) error {
+	wins, err := acmeWindows()
+	if err != nil {
+		return fmt.Errorf("cannot list acme windows: %v", err)
+	}
+	var win acmeWin
+	for _, info := range wins {
+		if info.Name == name {
+			if win, err = openAcmeWin(info.ID); err != nil {
+				return fmt.Errorf("cannot open acme window: %v", err)
+			}
+			break
+		}
+	}
+	if win == nil {
+		if win, err = newAcmeWin(); err != nil {
+			return fmt.Errorf("cannot create acme window: %v", err)
+		}
+		if err := win.Ctl("name %s", name); err != nil {
+			return err
 		}
 	}
+	defer win.CloseFiles()
+	return showText(win, text)
+}
 
-	// turn /tmp/launch/:0 into _tmp_launch_:0 (OS X 10.5)
-	disp = strings.Replace(disp, "/", "_", -1)
+// showText replaces the body of win with text, leaving the
+// window clean and showing its start.
+func showText(win acmeWin, text []byte) error {
+	if _, err := win.Write("addr", []byte(",")); err != nil {
+		return err
+	}
+	if _, err := win.Write("data", text); err != nil {
+		return err
+	}
+	if _, err := win.Write("addr", []byte("#0")); err != nil {
+		return err
+	}
+	if err := win.Ctl("dot=addr"); err != nil {
+		return err
+	}
+	if err := win.Ctl("show"); err != nil {
+		return err
+	}
+	return win.Ctl("clean")
+}
 
-	u, err := user.Current()
-	if err != nil {
-		return "", fmt.Errorf("cannot get current user name: %v", err)
+// selectionOffset returns the rune offset of the identifier to
+// resolve when the runes between q0 and q1 are selected: the last
+// identifier in the selection, so that sweeping a selector such
+// as http.Get resolves Get, or q0 if the selection is empty or
+// holds no identifier.
+func selectionOffset(body []rune, q0, q1 int) int {
+	if q1 > len(body) {
+		q1 = len(body)
 	}
-	ns := fmt.Sprintf("/tmp/ns.%s.%s", u.Username, disp)
-	_, err = os.Stat(ns)
-	if os.IsNotExist(err) {
-		return "", fmt.Errorf("no name space directory found")
+	end := q1
+	for end > q0 && !isIdentRune(body[end-1]) {
+		end--
 	}
-	if err != nil {
-		return "", fmt.Errorf("cannot stat name space directory: %v", err)
+	start := end
+	for start > q0 && isIdentRune(body[start-1]) {
+		start--
+	}
+	if start == end {
+		return q0
+	}
+	return start
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func runeOffset2ByteOffset(b []byte, off int) int {
+	r := 0
+	for i, _ := range string(b) {
+		if r == off {
+			return i
+		}
+		r++
 	}
-	// heuristics for checking permissions and owner of name space
-	// directory omitted.
-	return ns, nil
+	return len(b)
 }
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// acmeDir is where acme serves its files on Plan 9.
+var acmeDir = "/mnt/acme"
+
+// plan9Win is an acme window accessed through the files
+// acme mounts in the name space.
+type plan9Win struct {
+	dir   string
+	files map[string]*os.File
+}
+
+// openAcmeWin opens the acme window with the given id.
+// Tests replace it, as they do acmeWindows.
+var openAcmeWin = func(id int) (acmeWin, error) {
+	dir := fmt.Sprintf("%s/%d", acmeDir, id)
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	return &plan9Win{dir: dir, files: make(map[string]*os.File)}, nil
+}
+
+// newAcmeWin creates a new acme window. The new window's id
+// is the first field of the ctl file opened to create it.
+func newAcmeWin() (acmeWin, error) {
+	ctl, err := os.OpenFile(acmeDir+"/new/ctl", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	var id int
+	if _, err := fmt.Fscan(ctl, &id); err != nil {
+		ctl.Close()
+		return nil, fmt.Errorf("cannot read new window id: %v", err)
+	}
+	return &plan9Win{
+		dir:   fmt.Sprintf("%s/%d", acmeDir, id),
+		files: map[string]*os.File{"ctl": ctl},
+	}, nil
+}
+
+// acmeWindows lists the open acme windows, as recorded in acme's
+// index file: each line holds the window id, four numeric fields
+// and the tag, whose first word is the window name.
+var acmeWindows = func() ([]acmeWinInfo, error) {
+	f, err := os.Open(acmeDir + "/index")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var infos []acmeWinInfo
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		id, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		infos = append(infos, acmeWinInfo{id, fields[5]})
+	}
+	return infos, scanner.Err()
+}
+
+// file returns the named window file, opening it if necessary.
+// Files are kept open, since acme resets the address when the
+// addr file is opened afresh.
+func (w *plan9Win) file(name string) (*os.File, error) {
+	if f := w.files[name]; f != nil {
+		return f, nil
+	}
+	f, err := os.OpenFile(w.dir+"/"+name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	w.files[name] = f
+	return f, nil
+}
+
+func (w *plan9Win) Ctl(format string, args ...interface{}) error {
+	f, err := w.file("ctl")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, format+"\n", args...)
+	return err
+}
+
+func (w *plan9Win) Read(file string, b []byte) (int, error) {
+	f, err := w.file(file)
+	if err != nil {
+		return 0, err
+	}
+	return f.Read(b)
+}
+
+func (w *plan9Win) ReadAll(file string) ([]byte, error) {
+	f, err := w.file(file)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(f)
+}
+
+func (w *plan9Win) ReadAddr() (q0, q1 int, err error) {
+	f, err := w.file("addr")
+	if err != nil {
+		return 0, 0, err
+	}
+	buf := make([]byte, 40)
+	n, err := f.ReadAt(buf, 0)
+	if n == 0 && err != nil {
+		return 0, 0, err
+	}
+	if _, err := fmt.Sscan(string(buf[:n]), &q0, &q1); err != nil {
+		return 0, 0, fmt.Errorf("cannot parse address %q: %v", buf[:n], err)
+	}
+	return q0, q1, nil
+}
+
+func (w *plan9Win) Write(file string, b []byte) (int, error) {
+	f, err := w.file(file)
+	if err != nil {
+		return 0, err
+	}
+	return f.Write(b)
+}
+
+func (w *plan9Win) CloseFiles() {
+	for name, f := range w.files {
+		f.Close()
+		delete(w.files, name)
+	}
+}
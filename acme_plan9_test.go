@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPlan9Acme(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"index": "          1          32          13           0           0 /usr/glenda/x.go Del Snarf | Look \n" +
+			"          2          29           5           1           0 /usr/glenda/ Del Snarf | Look \n",
+		"1/addr": "         13          15",
+		"1/tag":  "/usr/glenda/x.go Del Snarf | Look ",
+		"1/ctl":  "",
+	})
+	defer func(d string) { acmeDir = d }(acmeDir)
+	acmeDir = dir
+	wins, err := acmeWindows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []acmeWinInfo{{1, "/usr/glenda/x.go"}, {2, "/usr/glenda/"}}
+	if !reflect.DeepEqual(wins, want) {
+		t.Errorf("got windows %+v, want %+v", wins, want)
+	}
+	win, err := openAcmeWin(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer win.CloseFiles()
+	if q0, q1, err := win.ReadAddr(); err != nil || q0 != 13 || q1 != 15 {
+		t.Errorf("got address %d,%d, %v, want 13,15", q0, q1, err)
+	}
+	if tag, err := win.ReadAll("tag"); err != nil || string(tag) != "/usr/glenda/x.go Del Snarf | Look " {
+		t.Errorf("got tag %q, %v", tag, err)
+	}
+	if err := win.Ctl("name %s", "+godef"); err != nil {
+		t.Fatal(err)
+	}
+	win.CloseFiles()
+	if ctl, _ := ioutil.ReadFile(filepath.Join(dir, "1", "ctl")); string(ctl) != "name +godef\n" {
+		t.Errorf("got ctl %q", ctl)
+	}
+	if _, err := openAcmeWin(3); !os.IsNotExist(err) {
+		t.Errorf("opening a missing window: got %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSelectionOffset(t *testing.T) {
+	body := []rune("x := http.Get(url) // héllo\n")
+	for _, test := range []struct {
+		q0, q1 int
+		want   int
+	}{
+		{5, 5, 5},    // empty selection
+		{5, 13, 10},  // http.Get
+		{5, 14, 10},  // http.Get(
+		{5, 9, 5},    // http
+		{13, 14, 13}, // (
+		{22, 27, 22}, // héllo
+		{22, 100, 22},
+	} {
+		if got := selectionOffset(body, test.q0, test.q1); got != test.want {
+			t.Errorf("selectionOffset(%d, %d) = %d, want %d", test.q0, test.q1, got, test.want)
+		}
+	}
+}
+
+// fakeAcmeWin is an acme window held in memory. Reading the addr
+// file gives the address written to it last, as with "addr=dot".
+type fakeAcmeWin struct {
+	files  map[string][]byte
+	addr   [2]int
+	ctl    []string
+	writes []string // file:data for each write
+	read   int      // offset of the next read of body
+}
+
+func (w *fakeAcmeWin) Ctl(format string, args ...interface{}) error {
+	w.ctl = append(w.ctl, fmt.Sprintf(format, args...))
+	return nil
+}
+
+func (w *fakeAcmeWin) Read(file string, b []byte) (int, error) {
+	if w.read >= len(w.files[file]) {
+		return 0, io.EOF
+	}
+	n := copy(b, w.files[file][w.read:])
+	w.read += n
+	return n, nil
+}
+
+func (w *fakeAcmeWin) ReadAll(file string) ([]byte, error) {
+	return w.files[file], nil
+}
+
+func (w *fakeAcmeWin) ReadAddr() (q0, q1 int, err error) {
+	return w.addr[0], w.addr[1], nil
+}
+
+func (w *fakeAcmeWin) Write(file string, b []byte) (int, error) {
+	w.writes = append(w.writes, file+":"+string(b))
+	return len(b), nil
+}
+
+func (w *fakeAcmeWin) CloseFiles() {}
+
+func TestReadAcmeFile(t *testing.T) {
+	body := "package x\n\nvar héllo, wörld = 1, 2\n"
+	for _, test := range []struct {
+		q0, q1     int
+		wantOffset int
+	}{
+		{15, 15, 15}, // héllo, before any multibyte rune
+		{22, 22, 23}, // wörld, after é
+		{15, 27, 23}, // the last identifier of a selection
+		{100, 100, len(body)},
+	} {
+		win := &fakeAcmeWin{
+			files: map[string][]byte{
+				"body": []byte(body),
+				"tag":  []byte("/src/x/x.go Del Snarf | Look Get"),
+			},
+			addr: [2]int{test.q0, test.q1},
+		}
+		f, err := readAcmeFile(win)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.name != "/src/x/x.go" || string(f.body) != body {
+			t.Errorf("%d,%d: got file %q holding %q", test.q0, test.q1, f.name, f.body)
+		}
+		if f.offset != test.wantOffset {
+			t.Errorf("%d,%d: got offset %d, want %d", test.q0, test.q1, f.offset, test.wantOffset)
+		}
+	}
+}
+
+func TestShowText(t *testing.T) {
+	def := &definition{
+		Pos:  token.Position{Filename: "/src/x/x.go", Line: 3, Column: 6},
+		Type: "type T struct{A int}",
+		Members: []member{
+			{"A int", token.Position{Filename: "/src/x/x.go", Line: 3, Column: 16}},
+		},
+	}
+	listing := acmeListing(def.Pos, def, encodingBytes)
+	text := "/src/x/x.go:3:6\ntype T struct{A int}\n\tA int\n\t\t/src/x/x.go:3:16\n"
+	if string(listing) != text {
+		t.Errorf("got listing %q, want %q", listing, text)
+	}
+	win := &fakeAcmeWin{}
+	if err := showText(win, listing); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"addr:,", "data:" + text, "addr:#0"}; !reflect.DeepEqual(win.writes, want) {
+		t.Errorf("got writes %q, want %q", win.writes, want)
+	}
+	if want := []string{"dot=addr", "show", "clean"}; !reflect.DeepEqual(win.ctl, want) {
+		t.Errorf("got ctl messages %q, want %q", win.ctl, want)
+	}
+}
+
+func TestAcmeWinID(t *testing.T) {
+	defer func(id int) { *winidFlag = id }(*winidFlag)
+	defer os.Setenv("winid", os.Getenv("winid"))
+	for _, test := range []struct {
+		flag int
+		env  string
+		want int // 0 for an error
+	}{
+		{0, "7", 7},
+		{12, "7", 12}, // -winid takes precedence
+		{12, "", 12},
+		{0, "", 0},
+		{0, "seven", 0},
+	} {
+		*winidFlag = test.flag
+		os.Setenv("winid", test.env)
+		id, err := acmeWinID()
+		if test.want == 0 {
+			if err == nil {
+				t.Errorf("-winid %d, $winid %q: got window %d, want an error", test.flag, test.env, id)
+			}
+			continue
+		}
+		if err != nil || id != test.want {
+			t.Errorf("-winid %d, $winid %q: got %d, %v, want %d", test.flag, test.env, id, err, test.want)
+		}
+	}
+}
+
+func TestIsDirty(t *testing.T) {
+	for _, test := range []struct {
+		ctl   string
+		dirty bool
+		err   bool
+	}{
+		{"          3          32        1120           0           1         619 /mnt/font/Go-Regular/13a/font 26 ", true, false},
+		{"          3          32        1120           0           0         619 /mnt/font/Go-Regular/13a/font 26 ", false, false},
+		{"          3          32        1120 ", false, true},
+	} {
+		win := &fakeAcmeWin{files: map[string][]byte{"ctl": []byte(test.ctl)}}
+		dirty, err := isDirty(win)
+		if test.err {
+			if err == nil {
+				t.Errorf("ctl %q: got no error", test.ctl)
+			}
+			continue
+		}
+		if err != nil || dirty != test.dirty {
+			t.Errorf("ctl %q: got %v, %v, want %v", test.ctl, dirty, err, test.dirty)
+		}
+	}
+}
+
+func TestAcmeDirtyFiles(t *testing.T) {
+	defer func(f func() ([]acmeWinInfo, error)) { acmeWindows = f }(acmeWindows)
+	defer func(f func(int) (acmeWin, error)) { openAcmeWin = f }(openAcmeWin)
+	ctl := func(dirty string) []byte {
+		return []byte("1 32 1120 0 " + dirty + " 619 /mnt/font/Go-Regular/13a/font 26 ")
+	}
+	wins := map[int]*fakeAcmeWin{
+		1: {files: map[string][]byte{"ctl": ctl("1"), "body": []byte("package x // dirty\n")}},
+		2: {files: map[string][]byte{"ctl": ctl("0"), "body": []byte("package x // clean\n")}},
+		3: {files: map[string][]byte{"ctl": ctl("1"), "body": []byte("not Go\n")}},
+		4: {files: map[string][]byte{"ctl": []byte("short")}},
+	}
+	acmeWindows = func() ([]acmeWinInfo, error) {
+		return []acmeWinInfo{
+			{1, "/src/x/dirty.go"},
+			{2, "/src/x/clean.go"},
+			{3, "/src/x/README"},
+			{4, "/src/x/short.go"},
+			{5, "/src/x/gone.go"},
+		}, nil
+	}
+	openAcmeWin = func(id int) (acmeWin, error) {
+		if win := wins[id]; win != nil {
+			return win, nil
+		}
+		return nil, fmt.Errorf("no window %d", id)
+	}
+	files, err := acmeDirtyFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]byte{"/src/x/dirty.go": []byte("package x // dirty\n")}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("got overlays %q, want %q", files, want)
+	}
+}
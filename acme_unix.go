@@ -0,0 +1,95 @@
+//go:build !plan9
+// +build !plan9
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+
+	"9fans.net/go/acme"
+)
+
+// openAcmeWin opens the acme window with the given id
+// through plan9port. Tests replace it, as they do acmeWindows.
+var openAcmeWin = func(id int) (acmeWin, error) {
+	if err := setNameSpace(); err != nil {
+		return nil, err
+	}
+	return acme.Open(id, nil)
+}
+
+// newAcmeWin creates a new acme window through plan9port.
+func newAcmeWin() (acmeWin, error) {
+	if err := setNameSpace(); err != nil {
+		return nil, err
+	}
+	return acme.New()
+}
+
+// acmeWindows lists the open acme windows.
+var acmeWindows = func() ([]acmeWinInfo, error) {
+	if err := setNameSpace(); err != nil {
+		return nil, err
+	}
+	wins, err := acme.Windows()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]acmeWinInfo, len(wins))
+	for i, w := range wins {
+		infos[i] = acmeWinInfo{w.ID, w.Name}
+	}
+	return infos, nil
+}
+
+func setNameSpace() error {
+	if ns := os.Getenv("NAMESPACE"); ns != "" {
+		return nil
+	}
+	ns, err := nsFromDisplay()
+	if err != nil {
+		return fmt.Errorf("cannot get name space: %v", err)
+	}
+	os.Setenv("NAMESPACE", ns)
+	return nil
+}
+
+// taken from src/lib9/getns.c
+// This should go into goplan9/plan9/client.
+func nsFromDisplay() (string, error) {
+	disp := os.Getenv("DISPLAY")
+	if disp == "" {
+		// original code had heuristic for OS X here;
+		// we'll just assume that and fail anyway if it
+		// doesn't work.
+		disp = ":0.0"
+	}
+	// canonicalize: xxx:0.0 => xxx:0
+	if i := strings.LastIndex(disp, ":"); i >= 0 {
+		if strings.HasSuffix(disp, ".0") {
+			disp = disp[:len(disp)-2]
+		}
+	}
+
+	// turn /tmp/launch/:0 into _tmp_launch_:0 (OS X 10.5)
+	disp = strings.Replace(disp, "/", "_", -1)
+
+	u, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("cannot get current user name: %v", err)
+	}
+	ns := fmt.Sprintf("/tmp/ns.%s.%s", u.Username, disp)
+	_, err = os.Stat(ns)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("no name space directory found")
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot stat name space directory: %v", err)
+	}
+	// heuristics for checking permissions and owner of name space
+	// directory omitted.
+	return ns, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/rogpeppe/godef/godef"
+	"golang.org/x/tools/go/packages"
+)
+
+// identDef is the NDJSON record written by -all-idents for
+// each identifier in a file.
+type identDef struct {
+	Name       string  `json:"name"`
+	Line       int     `json:"line"`
+	Column     int     `json:"column"`
+	Offset     int     `json:"offset"`
+	Definition jsonPos `json:"definition"`
+	Type       string  `json:"type,omitempty"`
+}
+
+// allIdents writes to w the definition of every identifier in the
+// named file, one JSON object per line, loading its package once.
+// Identifiers with no definition in source, such as predeclared
+// types, are omitted.
+func allIdents(ctx context.Context, w io.Writer, filename string, src []byte) error {
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	if *noExecFlag {
+		return &queryError{exitLoad, errNoExec}
+	}
+	cfg := &packages.Config{
+		Context: ctx,
+		Mode:    packages.LoadSyntax,
+		Tests:   godef.IsTest(filename, src),
+	}
+	if src != nil {
+		cfg.Overlay = map[string][]byte{
+			filename: src,
+		}
+	}
+	pkgs, err := packages.Load(cfg, "file="+filename)
+	if err != nil {
+		return err
+	}
+	pkg, file := findFile(pkgs, filename)
+	if file == nil {
+		return fmt.Errorf("There must be at least one package that contains the file")
+	}
+	enc := json.NewEncoder(w)
+	var encErr error
+	ast.Inspect(file, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok || encErr != nil {
+			return encErr == nil
+		}
+		// Prefer uses to definitions so that embedded fields
+		// lead to their type, as for a single query.
+		obj := pkg.TypesInfo.Uses[id]
+		if obj == nil {
+			obj = pkg.TypesInfo.Defs[id]
+		}
+		if obj == nil || !obj.Pos().IsValid() {
+			return true
+		}
+		pos := pkg.Fset.Position(id.Pos())
+		d := identDef{
+			Name:       id.Name,
+			Line:       pos.Line,
+			Column:     pos.Column,
+			Offset:     pos.Offset,
+			Definition: newJSONPos(pkg.Fset.Position(obj.Pos())),
+		}
+		if *tflag {
+			d.Type = godef.TypeString(obj, qualifier)
+		}
+		encErr = enc.Encode(&d)
+		return true
+	})
+	return encErr
+}
+
+// findFile returns the first of pkgs to contain the named file,
+// along with the file's syntax tree.
+func findFile(pkgs []*packages.Package, filename string) (*packages.Package, *ast.File) {
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Syntax {
+			if sameFile(pkg.Fset.Position(f.Pos()).Filename, filename) {
+				return pkg, f
+			}
+		}
+	}
+	return nil, nil
+}
+
+func sameFile(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ia, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	ib, err := os.Stat(b)
+	return err == nil && os.SameFile(ia, ib)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAllIdents(t *testing.T) {
+	src := "package x\n\ntype T struct{ A int }\n\nfunc F(t T) int { return t.A }\n"
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module x\n",
+		"x.go":   src,
+	})
+	defer func(t bool) { *tflag = t }(*tflag)
+	*tflag = true
+	var buf bytes.Buffer
+	if err := allIdents(context.Background(), &buf, filepath.Join(dir, "x.go"), nil); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var d identDef
+		if err := dec.Decode(&d); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(src[d.Offset:], d.Name) || filepath.Base(d.Definition.Filename) != "x.go" {
+			t.Errorf("%s at offset %d: bad record %+v", d.Name, d.Offset, d)
+		}
+		got = append(got, fmt.Sprintf("%s %d:%d -> %d:%d %s", d.Name, d.Line, d.Column, d.Definition.Line, d.Definition.Column, d.Type))
+	}
+	// The package name and the predeclared int have no definition.
+	want := []string{
+		"T 3:6 -> 3:6 type T struct{A int}",
+		"A 3:16 -> 3:16 A int",
+		"F 5:6 -> 5:6 F func(t T) int",
+		"t 5:8 -> 5:8 t T",
+		"T 5:10 -> 3:6 type T struct{A int}",
+		"t 5:26 -> 5:8 t T",
+		"A 5:28 -> 3:16 A int",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// runBatch answers one query for each line read from r, printing
+// each result as it would be printed for a single query. A line
+// is either file:offset or a JSON object with the same fields as
+// the parameters of an -rpc request.
+func runBatch(ctx context.Context, r io.Reader, jobs int) error {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return runQueries(ctx, lines, jobs, parseBatchQuery)
+}
+
+// runQueries answers the query described by each of inputs, as
+// parsed by parse, printing the results in order. An input that
+// parse rejects but that names a symbol, such as fmt.Println or
+// a name in the current package, is resolved as such. Loaded packages are shared between queries,
+// and queries on different directories are answered concurrently
+// by up to jobs workers.
+func runQueries(ctx context.Context, inputs []string, jobs int, parse func(dir, input string) (*query, error)) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	// Queries in the same directory most likely need the same
+	// package, so answer them in turn by the same worker to
+	// avoid loading it more than once.
+	type result struct {
+		def  *definition
+		err  error
+		done chan struct{}
+	}
+	results := make([]result, len(inputs))
+	var groups [][]int
+	groupOf := make(map[string]int)
+	for i, input := range inputs {
+		results[i].done = make(chan struct{})
+		key := ""
+		if q, err := parse(dir, input); err == nil {
+			key = filepath.Dir(q.Filename)
+		}
+		g, ok := groupOf[key]
+		if !ok {
+			g = len(groups)
+			groupOf[key] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	cache := newPackageCache()
+	go runJobs(len(groups), jobs, func(g int) {
+		for _, i := range groups[g] {
+			r := &results[i]
+			r.def, r.err = answerInput(ctx, cache, dir, inputs[i], parse)
+			close(r.done)
+		}
+	})
+
+	failed := 0
+	for i := range results {
+		r := &results[i]
+		<-r.done
+		if r.err != nil {
+			failed++
+			batchError(inputs[i], r.err)
+			continue
+		}
+		if err := done(r.def); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d queries failed", failed, len(inputs))
+	}
+	return nil
+}
+
+func answerInput(ctx context.Context, cache *packageCache, dir, input string, parse func(dir, input string) (*query, error)) (*definition, error) {
+	q, err := parse(dir, input)
+	if err != nil {
+		if strings.Contains(input, ":") {
+			return nil, err
+		}
+		return answerSymbol(ctx, input)
+	}
+	return cache.answer(ctx, q)
+}
+
+// runJobs calls f for each integer in [0, n), using at most
+// jobs concurrent goroutines, and waits for them all to finish.
+func runJobs(n, jobs int, f func(i int)) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for j := 0; j < jobs && j < n; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				f(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+}
+
+// parseBatchQuery parses a single line of -batch input.
+func parseBatchQuery(dir, line string) (*query, error) {
+	var p rpcParams
+	if strings.HasPrefix(line, "{") {
+		if err := json.Unmarshal([]byte(line), &p); err != nil {
+			return nil, err
+		}
+	} else {
+		i := strings.LastIndex(line, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("want file:offset")
+		}
+		off, err := strconv.Atoi(strings.TrimPrefix(line[i+1:], "#"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset %q", line[i+1:])
+		}
+		if *encodingFlag != encodingBytes {
+			// The offset counts units of -offset-encoding, as for -o.
+			content, err := ioutil.ReadFile(abs(dir, pathMapFlag.toLocal(line[:i])))
+			if err != nil {
+				return nil, err
+			}
+			if off, err = byteOffset(content, off, *encodingFlag); err != nil {
+				return nil, err
+			}
+		}
+		p.Filename, p.Offset = line[:i], off
+	}
+	if p.Filename == "" {
+		return nil, fmt.Errorf("no filename specified")
+	}
+	q := p.query(dir)
+	q.Type, q.Members, q.AllMembers = *tflag || p.All, *aflag || *Aflag || p.All, *Aflag || p.All
+	return q, nil
+}
+
+// parseArgQuery parses a command line argument of one of the
+// forms accepted by parseFileAddress.
+func parseArgQuery(dir, arg string) (*query, error) {
+	addr, ok := parseFileAddress(arg)
+	if !ok {
+		return nil, fmt.Errorf("want file:line:col, file:line or file:#offset")
+	}
+	content, err := ioutil.ReadFile(abs(dir, pathMapFlag.toLocal(addr.filename)))
+	if err != nil {
+		return nil, err
+	}
+	var off int
+	if addr.line > 0 {
+		off, err = lineColOffset(content, addr.line, addr.col, *encodingFlag)
+	} else {
+		off, err = byteOffset(content, addr.offset, *encodingFlag)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p := rpcParams{Filename: addr.filename, Offset: off}
+	q := p.query(dir)
+	q.Type, q.Members, q.AllMembers = *tflag, *aflag || *Aflag, *Aflag
+	return q, nil
+}
+
+// batchError reports the failure of the query on the given line.
+// With -json, the error is written to standard output in place
+// of the result so that results can still be matched to queries.
+func batchError(line string, err error) {
+	if !*jsonFlag {
+		logf(levelWarn, "%s: %v", line, err)
+		return
+	}
+	data, _ := json.Marshal(struct {
+		Query string `json:"query"`
+		Error string `json:"error"`
+	}{line, err.Error()})
+	fmt.Printf("%s\n", data)
+}
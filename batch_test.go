@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBatchQuery(t *testing.T) {
+	dir := filepath.FromSlash("/work")
+	for _, test := range []struct {
+		line     string
+		filename string
+		offset   int
+		err      bool
+	}{
+		{"a.go:12", "a.go", 12, false},
+		{"a.go:#12", "a.go", 12, false},
+		{`{"filename": "b.go", "offset": 7}`, "b.go", 7, false},
+		{"a.go", "", 0, true},
+		{"a.go:x", "", 0, true},
+		{`{"offset": 7}`, "", 0, true},
+	} {
+		q, err := parseBatchQuery(dir, test.line)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected error", test.line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.line, err)
+			continue
+		}
+		if want := filepath.Join(dir, test.filename); q.Filename != want || q.Offset != test.offset {
+			t.Errorf("%q: got %s:%d, want %s:%d", test.line, q.Filename, q.Offset, want, test.offset)
+		}
+	}
+}
+
+func TestParseBatchQueryEncoding(t *testing.T) {
+	defer func(enc string) { *encodingFlag = enc }(*encodingFlag)
+	*encodingFlag = encodingRunes
+	src := "package x\n\nvar héllo, x int\n"
+	dir := writeTree(t, map[string]string{"a.go": src})
+	// In runes, x is at 22; in bytes, at 23.
+	q, err := parseBatchQuery(dir, "a.go:22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Index(src, "x int"); q.Offset != want {
+		t.Errorf("got offset %d, want %d", q.Offset, want)
+	}
+}
+
+func TestRunQueriesArgs(t *testing.T) {
+	src := "package x\n\ntype T int\n\nfunc F() T { return 0 }\n\nvar v = F()\n"
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module x\n",
+		"x.go":   src,
+	})
+	// Each argument is answered in turn, whatever its form.
+	stdout, stderr, code := runGodef(t, dir, "", nil, "x.go:7:9", fmt.Sprintf("x.go:#%d", strings.Index(src, "T {")), "F")
+	if code != 0 {
+		t.Fatalf("exit status %d: %s", code, stderr)
+	}
+	want := fmt.Sprintf("%[1]s:5:6\n%[1]s:3:6\n%[1]s:5:6\n", filepath.Join(dir, "x.go"))
+	if stdout != want {
+		t.Errorf("got %q, want %q", stdout, want)
+	}
+}
+
+func TestBatchJobs(t *testing.T) {
+	const src = "package p\n\ntype T0 int\ntype T1 int\ntype T2 int\n\nvar v0 T0\nvar v1 T1\nvar v2 T2\n"
+	pkgs := []string{"a", "b", "c", "d"}
+	tree := map[string]string{"go.mod": "module m\n"}
+	for _, p := range pkgs {
+		tree[p+"/p.go"] = src
+	}
+	dir := writeTree(t, tree)
+	type result struct {
+		Filename string
+		Line     int
+		Query    string
+		Error    string
+	}
+	// Queries on each package are interleaved with those on the
+	// others, each resolving a different type, and one fails.
+	var lines []string
+	var want []result
+	for i := 0; i < 3; i++ {
+		for _, p := range pkgs {
+			if p == "c" && i == 1 {
+				lines = append(lines, "c/missing.go:3")
+				want = append(want, result{Query: "c/missing.go:3"})
+				continue
+			}
+			off := strings.Index(src, fmt.Sprintf("v%d T", i)) + len("v0 ")
+			lines = append(lines, fmt.Sprintf("%s/p.go:%d", p, off))
+			want = append(want, result{Filename: filepath.Join(dir, p, "p.go"), Line: 3 + i})
+		}
+	}
+	stdout, stderr, code := runGodef(t, dir, strings.Join(lines, "\n"), nil, "-batch", "-jobs", "4", "-json")
+	if code != exitFailure {
+		t.Errorf("got exit status %d, want %d; stderr: %s", code, exitFailure, stderr)
+	}
+	var got []result
+	dec := json.NewDecoder(strings.NewReader(stdout))
+	for dec.More() {
+		var r result
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		if r.Error != "" {
+			// The message depends on the go command.
+			r.Error = ""
+		} else if r.Query != "" {
+			t.Errorf("query %s failed without an error", r.Query)
+		}
+		got = append(got, r)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got results\n%+v\nwant\n%+v", got, want)
+	}
+}
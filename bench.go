@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rogpeppe/godef/godef"
+	"golang.org/x/tools/go/packages"
+)
+
+// benchResult summarizes the repeated runs of a query by one engine.
+type benchResult struct {
+	Engine   string         `json:"engine"`
+	Runs     int            `json:"runs"`
+	Failures int            `json:"failures"`
+	Pos      token.Position `json:"-"`
+	Err      string         `json:"error,omitempty"`
+
+	// Latencies, in milliseconds.
+	Min    float64 `json:"minMs"`
+	Median float64 `json:"medianMs"`
+	P90    float64 `json:"p90Ms"`
+	Max    float64 `json:"maxMs"`
+	Mean   float64 `json:"meanMs"`
+
+	Allocs int64 `json:"allocsPerRun"`
+	Bytes  int64 `json:"bytesPerRun"`
+}
+
+func benchMain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	filename := fs.String("f", "", "file holding the identifier")
+	offset := fs.Int("o", -1, "byte offset of the identifier")
+	n := fs.Int("n", 10, "number of times to run the query with each engine")
+	jsonOut := fs.Bool("json", false, "print a JSON object for each engine")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: godef bench -f file -o offset [-n count] [-json]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *filename == "" || *offset < 0 || *n < 1 || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	*filename = abs(dir, pathMapFlag.toLocal(*filename))
+	engines := []struct {
+		name  string
+		query func() (token.Position, error)
+	}{{
+		godef.EnginePackages,
+		func() (token.Position, error) {
+			r, err := godef.Query(ctx, godef.Options{
+				Config:   &packages.Config{Dir: dir},
+				Filename: *filename,
+				Offset:   *offset,
+				Strict:   true,
+			})
+			if err != nil {
+				return token.Position{}, err
+			}
+			return r.Position, nil
+		},
+	}, {
+		godef.EngineParser,
+		func() (token.Position, error) {
+			fset, obj, err := godef.LookupSyntax(*filename, nil, *offset)
+			if err != nil {
+				return token.Position{}, err
+			}
+			return godef.Position(fset, obj), nil
+		},
+	}}
+	var results []*benchResult
+	for _, e := range engines {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		logf(levelInfo, "running %d queries with the %s engine", *n, e.name)
+		results = append(results, runBench(e.name, *n, e.query))
+	}
+	if *jsonOut {
+		for _, r := range results {
+			data, err := json.Marshal(struct {
+				*benchResult
+				Pos jsonPos `json:"position"`
+			}{r, newHostPos(r.Pos)})
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s\n", data)
+		}
+		return nil
+	}
+	return writeBench(os.Stdout, results)
+}
+
+// runBench runs query n times, recording its latency and allocations.
+func runBench(engine string, n int, query func() (token.Position, error)) *benchResult {
+	r := &benchResult{Engine: engine, Runs: n}
+	var before, after runtime.MemStats
+	// Collect the garbage of any previous engine so
+	// that it does not count against this one.
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	times := make([]time.Duration, 0, n)
+	for i := 0; i < n; i++ {
+		start := time.Now()
+		pos, err := query()
+		times = append(times, time.Since(start))
+		if err != nil {
+			r.Failures++
+			r.Err = err.Error()
+			continue
+		}
+		r.Pos = pos
+	}
+	runtime.ReadMemStats(&after)
+	r.Allocs = int64(after.Mallocs-before.Mallocs) / int64(n)
+	r.Bytes = int64(after.TotalAlloc-before.TotalAlloc) / int64(n)
+	r.summarize(times)
+	return r
+}
+
+// summarize sets the latency statistics of r from the given times.
+func (r *benchResult) summarize(times []time.Duration) {
+	if len(times) == 0 {
+		return
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	ms := func(d time.Duration) float64 {
+		return float64(d.Microseconds()) / 1000
+	}
+	var total time.Duration
+	for _, t := range times {
+		total += t
+	}
+	r.Min = ms(times[0])
+	r.Median = ms(times[len(times)/2])
+	r.P90 = ms(times[(len(times)*9)/10])
+	r.Max = ms(times[len(times)-1])
+	r.Mean = ms(total / time.Duration(len(times)))
+}
+
+// writeBench writes a table of the results to w.
+func writeBench(w io.Writer, results []*benchResult) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "engine\truns\tfailed\tmin\tmedian\tp90\tmax\tmean\tallocs/run\tbytes/run\t\n")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.3fms\t%.3fms\t%.3fms\t%.3fms\t%.3fms\t%d\t%d\t\n",
+			r.Engine, r.Runs, r.Failures, r.Min, r.Median, r.P90, r.Max, r.Mean, r.Allocs, r.Bytes)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, r := range results {
+		if r.Err != "" {
+			fmt.Fprintf(w, "%s: %s\n", r.Engine, r.Err)
+			continue
+		}
+		pos := r.Pos
+		pos.Filename = outputName(pos.Filename)
+		fmt.Fprintf(w, "%s: %v\n", r.Engine, pos)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBenchSummarize(t *testing.T) {
+	var times []time.Duration
+	for i := 10; i >= 1; i-- {
+		times = append(times, time.Duration(i)*time.Millisecond)
+	}
+	var r benchResult
+	r.summarize(times)
+	if r.Min != 1 || r.Median != 6 || r.P90 != 10 || r.Max != 10 || r.Mean != 5.5 {
+		t.Errorf("got min %v, median %v, p90 %v, max %v, mean %v; want 1, 6, 10, 10, 5.5", r.Min, r.Median, r.P90, r.Max, r.Mean)
+	}
+}
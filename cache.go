@@ -0,0 +1,562 @@
+package main
+
+import (
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	debugpkg "runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rogpeppe/godef/godef"
+	"golang.org/x/tools/go/packages"
+)
+
+// packageCache holds fully parsed and type-checked packages so that
+// long-running modes can answer repeated queries without reloading.
+// Unlike the one-shot path, cached packages keep all function bodies,
+// so that any position within them can be resolved.
+type packageCache struct {
+	mu   sync.Mutex
+	pkgs map[string]*cacheEntry // keyed by absolute file name
+}
+
+type cacheEntry struct {
+	pkg    *packages.Package
+	config string          // hash of the configuration used to load pkg
+	loaded time.Time       // when pkg was loaded
+	deps   time.Time       // when pkg's dependencies were loaded
+	dirs   map[string]bool // directories of pkg and all its dependencies
+
+	// base hashes the configuration without the overlays of the
+	// package's own files, and sums holds the hashes of the contents
+	// of those files as loaded, so that a change confined to one
+	// of them can be rechecked without reloading the package.
+	base string
+	sums map[string][32]byte
+}
+
+var hugeFileFlag = flag.String("hugefile", "1MiB", "`size` from which files in cached packages have only the function body holding the query type-checked (0 for none)")
+
+// hugeFile holds the size set by -hugefile in bytes, or zero if
+// every file is type-checked in full. Files that large are mostly
+// generated, such as protocol buffer or bindata files, and type
+// checking all their function bodies can take seconds.
+var hugeFile int64 = 1 << 20
+
+func checkHugeFileFlag() error {
+	size, err := parseSize(*hugeFileFlag)
+	if err != nil {
+		return &queryError{exitUsage, fmt.Errorf("invalid -hugefile value: %v", err)}
+	}
+	hugeFile = size
+	return nil
+}
+
+func newPackageCache() *packageCache {
+	return &packageCache{pkgs: make(map[string]*cacheEntry)}
+}
+
+// get returns the package containing filename, loading it with
+// a copy of cfg if it is not already cached, or if the cached
+// copy was loaded with a different configuration or its files
+// have changed on disk since.
+func (c *packageCache) get(cfg *packages.Config, filename string) (*packages.Package, error) {
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	config := configHash(cfg)
+	c.mu.Lock()
+	e := c.pkgs[filename]
+	c.mu.Unlock()
+	if e != nil && e.config == config && !e.stale() {
+		return e.pkg, nil
+	}
+	if e != nil {
+		if ne := e.recheck(cfg, filename, config); ne != nil {
+			c.store(ne, filename)
+			return ne.pkg, nil
+		}
+	}
+	if *noExecFlag {
+		return nil, &queryError{exitLoad, errNoExec}
+	}
+	c.shed()
+	// The lock is not held while loading, so that queries on
+	// other packages can proceed concurrently.
+	lcfg := loadConfig(cfg)
+	lcfg.Tests = godef.IsTest(filename, cfg.Overlay[filename])
+	loaded := time.Now()
+	lpkgs, err := packages.Load(&lcfg, "file="+filename)
+	if err != nil {
+		return nil, &queryError{exitLoad, err}
+	}
+	if lcfg.Context != nil && lcfg.Context.Err() != nil {
+		// The packages may be incomplete, so must not be cached.
+		return nil, &queryError{exitLoad, lcfg.Context.Err()}
+	}
+	if len(lpkgs) < 1 {
+		return nil, &queryError{exitLoad, fmt.Errorf("There must be at least one package that contains the file")}
+	}
+	e = newCacheEntry(cfg, lpkgs[0], config, loaded)
+	c.store(e, filename)
+	return e.pkg, nil
+}
+
+// warm loads the packages matching patterns with a copy of cfg,
+// not including their tests, and caches them as get would. It
+// returns the number of packages cached.
+func (c *packageCache) warm(cfg *packages.Config, patterns []string) (int, error) {
+	if *noExecFlag {
+		return 0, &queryError{exitLoad, errNoExec}
+	}
+	c.shed()
+	lcfg := loadConfig(cfg)
+	loaded := time.Now()
+	lpkgs, err := packages.Load(&lcfg, patterns...)
+	if err != nil {
+		return 0, &queryError{exitLoad, err}
+	}
+	if lcfg.Context != nil && lcfg.Context.Err() != nil {
+		return 0, &queryError{exitLoad, lcfg.Context.Err()}
+	}
+	config := configHash(cfg)
+	n := 0
+	for _, pkg := range lpkgs {
+		if len(pkg.Syntax) == 0 {
+			continue
+		}
+		c.store(newCacheEntry(cfg, pkg, config, loaded))
+		n++
+	}
+	return n, nil
+}
+
+// loadConfig returns a copy of cfg for loading packages to cache.
+// The function bodies of huge files are dropped; lookupObject
+// checks the one holding a query when it is made.
+func loadConfig(cfg *packages.Config) packages.Config {
+	lcfg := *cfg
+	lcfg.Mode = packages.LoadSyntax
+	ctx := lcfg.Context
+	lcfg.ParseFile = func(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+		// Stop parsing once the context is done.
+		if ctx != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return parseCached(fset, filename, src, -1)
+	}
+	return lcfg
+}
+
+// parseCached parses a file for a cached package. If the file is
+// huge, the function bodies not holding the given offset are dropped.
+func parseCached(fset *token.FileSet, filename string, src []byte, offset int) (*ast.File, error) {
+	f, err := parser.ParseFile(fset, filename, src, parser.AllErrors|parser.ParseComments)
+	if f != nil && isHuge(len(src)) {
+		pos := token.NoPos
+		if tf := fset.File(f.Pos()); tf != nil && offset >= 0 && offset <= tf.Size() {
+			pos = tf.Pos(offset)
+		}
+		godef.TrimBodies(f, pos)
+	}
+	return f, err
+}
+
+// isHuge reports whether a file of the given size is huge,
+// as set by -hugefile.
+func isHuge(size int) bool {
+	return hugeFile > 0 && int64(size) >= hugeFile
+}
+
+// newCacheEntry returns an entry holding pkg, loaded
+// at the given time with cfg, whose hash is config.
+func newCacheEntry(cfg *packages.Config, pkg *packages.Package, config string, loaded time.Time) *cacheEntry {
+	e := &cacheEntry{
+		pkg:    pkg,
+		config: config,
+		loaded: loaded,
+		deps:   loaded,
+		dirs:   make(map[string]bool),
+	}
+	addDirs(e.dirs, e.pkg, make(map[*packages.Package]bool))
+	e.sum(cfg)
+	return e
+}
+
+// store caches e under the names of its files and
+// any other names given.
+func (c *packageCache) store(e *cacheEntry, names ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, name := range e.files() {
+		c.pkgs[name] = e
+	}
+	for _, name := range names {
+		c.pkgs[name] = e
+	}
+}
+
+// invalidate discards all cached packages. Any change to a file
+// may affect the packages that import it, so everything goes.
+func (c *packageCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pkgs = make(map[string]*cacheEntry)
+}
+
+// shed discards all cached packages, with their syntax trees, if
+// memory use is near the -memlimit, so that loading another package
+// is less likely to exceed it. Packages in use by other queries are
+// freed once those queries finish.
+func (c *packageCache) shed() {
+	if !nearMemLimit() {
+		return
+	}
+	c.mu.Lock()
+	entries := make(map[*cacheEntry]bool)
+	for _, e := range c.pkgs {
+		entries[e] = true
+	}
+	c.pkgs = make(map[string]*cacheEntry)
+	c.mu.Unlock()
+	logf(levelInfo, "memory use is near -memlimit; discarded %d cached packages", len(entries))
+	debugpkg.FreeOSMemory()
+}
+
+// invalidateFiles discards the cached packages that may be affected
+// by changes to the named files: those whose own directory or whose
+// dependencies' directories contain one of the files. A change to a
+// go.mod or go.sum file may affect anything, so it discards everything.
+func (c *packageCache) invalidateFiles(names []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, name := range names {
+		base := filepath.Base(name)
+		if base == "go.mod" || base == "go.sum" {
+			c.pkgs = make(map[string]*cacheEntry)
+			return
+		}
+	}
+	for key, e := range c.pkgs {
+		for _, name := range names {
+			if _, ok := e.sums[name]; ok {
+				// The package's own files are checked
+				// against sums when it is next used.
+				continue
+			}
+			if e.dirs[filepath.Dir(name)] {
+				delete(c.pkgs, key)
+				break
+			}
+		}
+	}
+}
+
+// addDirs adds the directories holding the files of pkg
+// and its transitive dependencies to dirs.
+func addDirs(dirs map[string]bool, pkg *packages.Package, seen map[*packages.Package]bool) {
+	if seen[pkg] {
+		return
+	}
+	seen[pkg] = true
+	for _, name := range pkg.GoFiles {
+		if name, err := filepath.Abs(name); err == nil {
+			dirs[filepath.Dir(name)] = true
+		}
+	}
+	for _, imp := range pkg.Imports {
+		addDirs(dirs, imp, seen)
+	}
+}
+
+// files returns the absolute names of the files in the entry's package.
+func (e *cacheEntry) files() []string {
+	var names []string
+	for _, f := range e.pkg.Syntax {
+		if tf := e.pkg.Fset.File(f.Pos()); tf != nil {
+			if name, err := filepath.Abs(tf.Name()); err == nil {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// stale reports whether any file in the entry's package
+// has been modified or removed since it was loaded.
+func (e *cacheEntry) stale() bool {
+	for _, name := range e.files() {
+		info, err := os.Stat(name)
+		if err != nil || info.ModTime().After(e.loaded) {
+			return true
+		}
+	}
+	return false
+}
+
+// stamps returns the stamps of the files that answers from the
+// cached package containing filename depend on, as packageStamps
+// returns them, or nil if the package is not cached or any of
+// those files has changed since it was loaded.
+func (c *packageCache) stamps(filename string) map[string]fileStamp {
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil
+	}
+	c.mu.Lock()
+	e := c.pkgs[filename]
+	c.mu.Unlock()
+	if e == nil {
+		return nil
+	}
+	files, ok := packageStamps(e.pkg)
+	if !ok {
+		return nil
+	}
+	own := make(map[string]bool)
+	for _, name := range e.files() {
+		own[name] = true
+	}
+	for name, s := range files {
+		// The package's own files may have been rechecked
+		// since its dependencies were loaded.
+		since := e.deps
+		if own[name] {
+			since = e.loaded
+		}
+		if !s.ModTime.Before(since) {
+			return nil
+		}
+	}
+	return files
+}
+
+// sum records the hashes that recheck needs to tell which of
+// the entry's files have changed since it was loaded. Packages
+// using cgo are not recorded, as their files are preprocessed.
+func (e *cacheEntry) sum(cfg *packages.Config) {
+	if len(e.pkg.CompiledGoFiles) != len(e.pkg.GoFiles) || e.pkg.TypesInfo == nil {
+		return
+	}
+	sums := make(map[string][32]byte)
+	for _, name := range e.files() {
+		src, err := readContents(cfg, name)
+		if err != nil {
+			return
+		}
+		sums[name] = sha256.Sum256(src)
+	}
+	e.sums = sums
+	e.base = configHashExcept(cfg, sums)
+}
+
+// recheck returns a copy of the entry brought up to date with
+// the configuration cfg (whose hash is config) by re-parsing
+// and re-type-checking filename alone against the package's
+// cached dependencies. It returns nil if anything other than the
+// contents of filename has changed, or if the new contents import
+// a package that the cached one did not, in which case the package
+// must be reloaded.
+func (e *cacheEntry) recheck(cfg *packages.Config, filename, config string) *cacheEntry {
+	if e.sums == nil || configHashExcept(cfg, e.sums) != e.base {
+		return nil
+	}
+	if ctx := cfg.Context; ctx != nil && ctx.Err() != nil {
+		return nil
+	}
+	loaded := time.Now()
+	var src []byte
+	for name, sum := range e.sums {
+		data, err := readContents(cfg, name)
+		if err != nil {
+			return nil
+		}
+		if sha256.Sum256(data) == sum {
+			continue
+		}
+		if name != filename {
+			return nil
+		}
+		src = data
+	}
+	pkg := e.pkg
+	if src != nil {
+		pkg = recheckFile(pkg, filename, src, -1)
+		if pkg == nil {
+			return nil
+		}
+		logf(levelDebug, "rechecked %s without reloading package %s", filename, pkg.PkgPath)
+	}
+	ne := &cacheEntry{
+		pkg:    pkg,
+		config: config,
+		loaded: loaded,
+		deps:   e.deps,
+		dirs:   e.dirs,
+		base:   e.base,
+		sums:   make(map[string][32]byte),
+	}
+	for name, sum := range e.sums {
+		ne.sums[name] = sum
+	}
+	if src != nil {
+		ne.sums[filename] = sha256.Sum256(src)
+	}
+	return ne
+}
+
+// recheckFile returns a copy of pkg with the file filename replaced
+// by the given source and the package type-checked again, or nil if
+// that cannot be done without reloading the package. The file set
+// and dependencies of pkg are shared with the copy. If the file is
+// huge, only its function body holding offset is checked.
+func recheckFile(pkg *packages.Package, filename string, src []byte, offset int) *packages.Package {
+	i := fileIndex(pkg, filename)
+	if i < 0 {
+		return nil
+	}
+	f, _ := parseCached(pkg.Fset, filename, src, offset)
+	if f == nil || f.Name.Name != pkg.Syntax[i].Name.Name {
+		return nil
+	}
+	for _, spec := range f.Imports {
+		path := strings.Trim(spec.Path.Value, "`\"")
+		if path != "unsafe" && pkg.Imports[path] == nil {
+			return nil
+		}
+	}
+	syntax := append([]*ast.File(nil), pkg.Syntax...)
+	syntax[i] = f
+	info := &types.Info{
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Implicits:  make(map[ast.Node]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		Scopes:     make(map[ast.Node]*types.Scope),
+	}
+	conf := &types.Config{
+		Importer: importerFunc(func(path string) (*types.Package, error) {
+			if path == "unsafe" {
+				return types.Unsafe, nil
+			}
+			if imp := pkg.Imports[path]; imp != nil && imp.Types != nil {
+				return imp.Types, nil
+			}
+			return nil, fmt.Errorf("no package %q", path)
+		}),
+		// Errors are reported by the full load; like it,
+		// carry on to type-check as much as possible.
+		Error: func(error) {},
+		Sizes: types.SizesFor("gc", buildContext(filepath.Dir(filename)).GOARCH),
+	}
+	tpkg := types.NewPackage(pkg.PkgPath, pkg.Name)
+	types.NewChecker(conf, pkg.Fset, tpkg, info).Files(syntax)
+	npkg := *pkg
+	npkg.Syntax = syntax
+	npkg.Types = tpkg
+	npkg.TypesInfo = info
+	return &npkg
+}
+
+// fileIndex returns the index in pkg.Syntax of the file with
+// the given absolute name, or -1 if there is none.
+func fileIndex(pkg *packages.Package, filename string) int {
+	for i, f := range pkg.Syntax {
+		if tf := pkg.Fset.File(f.Pos()); tf != nil {
+			if name, err := filepath.Abs(tf.Name()); err == nil && name == filename {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+// readContents returns the contents of the named file as
+// the package loader would see them under cfg.
+func readContents(cfg *packages.Config, name string) ([]byte, error) {
+	if src, ok := cfg.Overlay[name]; ok {
+		return src, nil
+	}
+	return ioutil.ReadFile(name)
+}
+
+// configHash returns a key identifying the parts of cfg
+// that affect the result of loading a package.
+func configHash(cfg *packages.Config) string {
+	return configHashExcept(cfg, nil)
+}
+
+// configHashExcept is like configHash but leaves out
+// the overlays of the files in skip.
+func configHashExcept(cfg *packages.Config, skip map[string][32]byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "dir %q\n", cfg.Dir)
+	for _, s := range cfg.Env {
+		fmt.Fprintf(h, "env %q\n", s)
+	}
+	for _, s := range cfg.BuildFlags {
+		fmt.Fprintf(h, "flag %q\n", s)
+	}
+	names := make([]string, 0, len(cfg.Overlay))
+	for name := range cfg.Overlay {
+		if _, ok := skip[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "overlay %q %x\n", name, sha256.Sum256(cfg.Overlay[name]))
+	}
+	return string(h.Sum(nil))
+}
+
+// lookupObject finds the object referred to at the given offset
+// of filename within the already loaded package pkg, which was
+// loaded with cfg, taking a word in a comment or string literal
+// as an expression if words is set. If filename is huge, its
+// function body holding offset is type-checked first.
+func lookupObject(cfg *packages.Config, pkg *packages.Package, filename string, offset int, words bool) (*token.FileSet, types.Object, error) {
+	if filename, err := filepath.Abs(filename); err == nil {
+		if i := fileIndex(pkg, filename); i >= 0 && isHuge(pkg.Fset.File(pkg.Syntax[i].Pos()).Size()) {
+			if src, err := readContents(cfg, filename); err == nil {
+				if fpkg := recheckFile(pkg, filename, src, offset); fpkg != nil {
+					pkg = fpkg
+				}
+			}
+		}
+	}
+	obj, err := godef.Lookup(pkg, filename, offset)
+	if gerr, ok := err.(*godef.Error); ok && gerr.Kind == godef.ErrorNoIdent {
+		// The offset may be on a doc link in a comment or,
+		// if words is set, any word in a comment or string.
+		if src, rerr := readContents(cfg, filename); rerr == nil {
+			if lobj, lerr := godef.LookupDocLink(pkg, filename, src, offset); lerr == nil {
+				obj, err = lobj, nil
+			} else if words {
+				if lobj, lerr := godef.LookupWord(pkg, filename, src, offset); lerr == nil {
+					obj, err = lobj, nil
+				}
+			}
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return pkg.Fset, obj, nil
+}
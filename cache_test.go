@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/go/packages"
+)
+
+func TestInvalidateFiles(t *testing.T) {
+	dir := filepath.FromSlash
+	a := &cacheEntry{dirs: map[string]bool{dir("/m/a"): true}}
+	ab := &cacheEntry{dirs: map[string]bool{dir("/m/a"): true, dir("/m/b"): true}}
+	c := newPackageCache()
+	c.pkgs = map[string]*cacheEntry{
+		"/m/a/a.go": a,
+		"/m/b/b.go": ab,
+	}
+	c.invalidateFiles([]string{dir("/m/b/new.go")})
+	if c.pkgs["/m/a/a.go"] != a {
+		t.Errorf("package a was discarded by a change to b")
+	}
+	if c.pkgs["/m/b/b.go"] != nil {
+		t.Errorf("package b was not discarded by a change to b")
+	}
+	c.invalidateFiles([]string{dir("/m/go.mod")})
+	if len(c.pkgs) != 0 {
+		t.Errorf("packages remain after go.mod change")
+	}
+}
+
+func TestRecheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godef-recheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"go.mod": "module x\n",
+		"a.go":   "package x\n\nfunc A() int { return B }\n",
+		"b.go":   "package x\n\nconst B = 1\n",
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")
+	c := newPackageCache()
+	cfg := &packages.Config{Dir: dir, Overlay: map[string][]byte{}}
+	pkg, err := c.get(cfg, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syntaxOf := func(pkg *packages.Package, filename string) interface{} {
+		for _, f := range pkg.Syntax {
+			if pkg.Fset.File(f.Pos()).Name() == filename {
+				return f
+			}
+		}
+		t.Fatalf("no syntax for %s", filename)
+		return nil
+	}
+	cfg.Overlay[a] = []byte("package x\n\nfunc A() int { return C }\n\nconst C = B\n")
+	npkg, err := c.get(cfg, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if npkg == pkg {
+		t.Fatalf("package was not updated after a change to a.go")
+	}
+	if syntaxOf(npkg, b) != syntaxOf(pkg, b) {
+		t.Errorf("b.go was parsed again after a change to a.go")
+	}
+	if npkg.Types.Scope().Lookup("C") == nil {
+		t.Errorf("rechecked package does not declare C")
+	}
+	if obj := npkg.Types.Scope().Lookup("B"); obj == nil || obj.Pos() != pkg.Types.Scope().Lookup("B").Pos() {
+		t.Errorf("B moved after a change to a.go")
+	}
+	// A change to another file too needs a full reload.
+	cfg.Overlay[b] = []byte("package x\n\nconst B = 2\n")
+	cfg.Overlay[a] = []byte("package x\n\nfunc A() int { return B }\n")
+	rpkg, err := c.get(cfg, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if syntaxOf(rpkg, b) == syntaxOf(npkg, b) {
+		t.Errorf("package was not reloaded after changes to both files")
+	}
+}
+
+func TestHugeFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godef-huge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := "package x\n\nfunc A() { a := 1; _ = a }\n\nfunc B() { b := 2; _ = b }\n"
+	x := filepath.Join(dir, "x.go")
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module x\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(x, []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer func(size int64) { hugeFile = size }(hugeFile)
+	hugeFile = int64(len(src))
+	c := newPackageCache()
+	cfg := &packages.Config{Dir: dir}
+	pkg, err := c.get(cfg, x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := range pkg.TypesInfo.Defs {
+		if id.Name == "a" || id.Name == "b" {
+			t.Errorf("body defining %s was type-checked when loading", id.Name)
+		}
+	}
+	offset := strings.LastIndex(src, "b")
+	fset, obj, err := lookupObject(cfg, pkg, x, offset, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fset.Position(obj.Pos()).Offset, strings.Index(src, "b :="); obj.Name() != "b" || got != want {
+		t.Errorf("got %s at offset %d, want b at %d", obj.Name(), got, want)
+	}
+}
+
+func TestWarm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godef-warm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"go.mod":  "module x\n",
+		"x.go":    "package x\n",
+		"y/y.go":  "package y\n",
+		"y/y2.go": "package y\n",
+	}
+	for name, src := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := newPackageCache()
+	cfg := &packages.Config{Dir: dir}
+	n, err := c.warm(cfg, []string{"./..."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("warmed %d packages, want 2", n)
+	}
+	y := c.pkgs[filepath.Join(dir, "y", "y.go")]
+	if y == nil || c.pkgs[filepath.Join(dir, "y", "y2.go")] != y {
+		t.Fatalf("package y is not cached under its files")
+	}
+	pkg, err := c.get(cfg, filepath.Join(dir, "y", "y2.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg != y.pkg {
+		t.Errorf("package y was loaded again after warming")
+	}
+}
+
+func TestShed(t *testing.T) {
+	c := newPackageCache()
+	c.pkgs = map[string]*cacheEntry{"/m/a/a.go": {}}
+	c.shed()
+	if len(c.pkgs) != 1 {
+		t.Errorf("packages discarded with no memory limit")
+	}
+	defer func(limit int64) { memLimit = limit }(memLimit)
+	memLimit = 1
+	c.shed()
+	if len(c.pkgs) != 0 {
+		t.Errorf("packages remain with memory use beyond the limit")
+	}
+}
+
+func TestResultCacheKey(t *testing.T) {
+	rc := newResultCache()
+	q := &query{Filename: "/m/x.go", Src: []byte("package x\n"), Offset: 8}
+	k1, ok := rc.key(q)
+	if !ok {
+		t.Fatalf("no key for query with source")
+	}
+	k2, _ := rc.key(&query{Filename: "/m/x.go", Src: []byte("package x\n"), Offset: 8})
+	if k1 != k2 {
+		t.Errorf("identical queries have different keys")
+	}
+	if k, _ := rc.key(&query{Filename: "/m/x.go", Src: []byte("package x\n"), Offset: 8, Timeout: time.Second}); k != k1 {
+		t.Errorf("the timeout of a query changes its key")
+	}
+	for _, q := range []*query{
+		{Filename: "/m/x.go", Src: []byte("package y\n"), Offset: 8},
+		{Filename: "/m/x.go", Src: []byte("package x\n"), Offset: 9},
+		{Filename: "/m/x.go", Src: []byte("package x\n"), Offset: 8, Type: true},
+		{Filename: "/m/x.go", Src: []byte("package x\n"), Offset: 8, Candidates: true},
+		{Filename: "/m/x.go", Src: []byte("package x\n"), Offset: 8, Exclude: []string{"*_test.go"}},
+		{Filename: "/m/x.go", Src: []byte("package x\n"), Offset: 8, Overlay: map[string][]byte{"/m/y.go": nil}},
+	} {
+		if k, _ := rc.key(q); k == k1 {
+			t.Errorf("query %+v has the same key as the original", q)
+		}
+	}
+	if _, ok := rc.key(&query{Filename: filepath.Join("testdata", "nonexistent.go")}); ok {
+		t.Errorf("got key for query on a missing file")
+	}
+	// The disk cache must tell queries with different
+	// exclude patterns apart too.
+	ctx := context.Background()
+	if resultKey(ctx, q) == resultKey(ctx, &query{Filename: "/m/x.go", Src: []byte("package x\n"), Offset: 8, Exclude: []string{"*_test.go"}}) {
+		t.Errorf("exclude patterns do not change the disk cache key")
+	}
+}
+
+func TestResultCacheOptions(t *testing.T) {
+	xsrc := "package x\n\n// F is used by v.\nfunc F() {}\n\nvar v = F\n"
+	gensrc := "// Code generated by hand. DO NOT EDIT.\n\npackage x\n\nfunc G() {}\n\nvar w = G\n"
+	dir := writeTree(t, map[string]string{
+		"go.mod":      "module x\n",
+		"x.go":        xsrc,
+		"x_other.go":  "// +build ignore\n\npackage x\n\nfunc F() {}\n",
+		"x_test.go":   "package x_test\n\nfunc F() {}\n",
+		"gen.go":      gensrc,
+		"gen_stub.go": "// +build ignore\n\npackage x\n\nfunc G() {}\n",
+	})
+	c := newPackageCache()
+	results := newResultCache()
+	// Each query is made of the same caches, so an answer
+	// cached for one must not be served to the next.
+	for _, test := range []struct {
+		name string
+		at   string
+		set  func(q *query)
+		want string
+	}{
+		{"plain", "= F", func(*query) {}, "x.go:4"},
+		{"candidates", "= F", func(q *query) { q.Candidates = true }, "x.go:4 1 resolved x.go:4 2 test x_test.go:3 3 build x_other.go:5"},
+		{"plain again", "= F", func(*query) {}, "x.go:4"},
+		{"variants", "= F", func(q *query) { q.Variants = true }, "x.go:4 1 resolved x.go:4 2 build x_other.go:5"},
+		{"candidates again", "= F", func(q *query) { q.Candidates = true }, "x.go:4 1 resolved x.go:4 2 test x_test.go:3 3 build x_other.go:5"},
+		{"plain after variants", "= F", func(*query) {}, "x.go:4"},
+		{"words", "F is", func(q *query) { q.Words = true }, "x.go:4"},
+		{"no words", "F is", func(*query) {}, "error"},
+		{"exclude", "= F", func(q *query) { q.Candidates, q.Exclude = true, []string{"*_test.go"} }, "x.go:4 1 resolved x.go:4 2 build x_other.go:5"},
+		{"generated", "= G", func(q *query) { q.Candidates = true }, "gen.go:5 1 resolved gen.go:5 2 build gen_stub.go:5"},
+		{"prefer handwritten", "= G", func(q *query) { q.Candidates, q.PreferHandwritten = true, true }, "gen.go:5 1 build gen_stub.go:5 2 resolved gen.go:5"},
+	} {
+		filename, src := "x.go", xsrc
+		if strings.Contains(test.at, "G") {
+			filename, src = "gen.go", gensrc
+		}
+		q := &query{
+			Dir:      dir,
+			Filename: filepath.Join(dir, filename),
+			Offset:   strings.Index(src, test.at) + strings.IndexAny(test.at, "FG"),
+		}
+		test.set(q)
+		def, err := results.answer(context.Background(), c, q)
+		if err != nil {
+			if test.want != "error" {
+				t.Errorf("%s: %v", test.name, err)
+			}
+			continue
+		}
+		got := fmt.Sprintf("%s:%d", filepath.Base(def.Pos.Filename), def.Pos.Line)
+		for _, cand := range def.Candidates {
+			got += fmt.Sprintf(" %d %s %s:%d", cand.Rank, cand.Reason, filepath.Base(cand.Pos.Filename), cand.Pos.Line)
+		}
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestResultCacheStale(t *testing.T) {
+	xsrc := "package x\n\nvar v = C\n"
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module x\n\ngo 1.16\n",
+		"x.go":   xsrc,
+		"c.go":   "package x\n\nconst C = 1\n",
+	})
+	c := newPackageCache()
+	results := newResultCache()
+	q := &query{Dir: dir, Filename: filepath.Join(dir, "x.go"), Offset: strings.Index(xsrc, "C")}
+	def, err := results.answer(context.Background(), c, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.Base(def.Pos.Filename); got != "c.go" {
+		t.Fatalf("got definition in %s, want c.go", got)
+	}
+	if len(results.defs) != 1 {
+		t.Fatalf("got %d cached results, want 1", len(results.defs))
+	}
+	// Move C to another file of the package. The queried file is
+	// unchanged, and no watcher reports the change, so only the
+	// stamps of the package's files tell that the answer is stale.
+	if err := ioutil.WriteFile(filepath.Join(dir, "c.go"), []byte("package x\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "d.go"), []byte("package x\n\nconst C = 1\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	def, err = results.answer(context.Background(), c, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.Base(def.Pos.Filename); got != "d.go" {
+		t.Errorf("got definition in %s after it moved, want d.go", got)
+	}
+}
+
+func TestRemoteErrorKind(t *testing.T) {
+	xsrc := "package x\n\n// F is used by v.\nfunc F() {}\n\nvar v = F\n"
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module x\n",
+		"x.go":   xsrc,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr := filepath.Join(dir, "d.sock")
+	go serveDaemon(ctx, "unix", addr, dir, nil)
+	q := &query{
+		Dir:      dir,
+		Filename: filepath.Join(dir, "x.go"),
+		Offset:   strings.Index(xsrc, "is used"),
+		Strict:   true,
+	}
+	var err error
+	for i := 0; i < 50; i++ {
+		if _, err = remoteQuery("unix", addr, q); err == nil || !strings.HasPrefix(err.Error(), "cannot connect") {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err == nil {
+		t.Fatalf("query of a comment succeeded")
+	}
+	if code := exitCode(err); code != exitNoIdent {
+		t.Errorf("got exit code %d for %v, want %d", code, err, exitNoIdent)
+	}
+}
+
+func TestDaemonAddr(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"go.mod":    "module x\n",
+		"sub/x.go":  "package sub\n",
+		"other/y.z": "",
+	})
+	for _, test := range []struct {
+		spec, dir     string
+		network, addr string
+	}{
+		{"unix:/tmp/g.sock", dir, "unix", "/tmp/g.sock"},
+		{"tcp:localhost:7000", dir, "tcp", "localhost:7000"},
+		{"", filepath.Join(dir, "sub"), "unix", defaultSocket(dir)},
+		{"auto", dir, "unix", defaultSocket(dir)},
+		{"localhost", dir, "", ""},
+		{"udp:localhost:7000", dir, "", ""},
+	} {
+		network, addr, err := daemonAddr(test.spec, test.dir)
+		if test.network == "" {
+			if err == nil {
+				t.Errorf("%q: got %s:%s, want an error", test.spec, network, addr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+			continue
+		}
+		if network != test.network || addr != test.addr {
+			t.Errorf("%q: got %s:%s, want %s:%s", test.spec, network, addr, test.network, test.addr)
+		}
+	}
+	// Each workspace has its own socket.
+	if defaultSocket(dir) == defaultSocket(filepath.Join(dir, "other")) {
+		t.Errorf("workspaces %s and %s share a socket", dir, filepath.Join(dir, "other"))
+	}
+}
+
+func TestCancelled(t *testing.T) {
+	xsrc := "package x\n\nfunc F() {}\n\nvar v = F\n"
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module x\n",
+		"x.go":   xsrc,
+	})
+	q := &query{
+		Dir:      dir,
+		Filename: filepath.Join(dir, "x.go"),
+		Offset:   strings.LastIndex(xsrc, "F"),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := newPackageCache()
+	// A cancelled query fails rather than falling back,
+	// and caches no partly loaded package.
+	if def, err := c.answer(ctx, q); err == nil {
+		t.Errorf("cancelled query succeeded with %v", def.Pos)
+	}
+	if len(c.pkgs) != 0 {
+		t.Errorf("cancelled query cached %d packages", len(c.pkgs))
+	}
+	tq := *q
+	tq.Timeout = time.Nanosecond
+	if _, err := c.answerTimeout(context.Background(), &tq); !isTimeout(err) {
+		t.Errorf("timed out query: got %v, want a timeout", err)
+	}
+	if def, err := c.answer(context.Background(), q); err != nil || def.Pos.Line != 3 {
+		t.Errorf("query after cancellation: got %v, %v", def, err)
+	}
+	if _, err := buildIndex(ctx, dir, []string{"./..."}, 1, nil); err == nil {
+		t.Errorf("cancelled indexing succeeded")
+	}
+}
+
+func isTimeout(err error) bool {
+	_, ok := err.(*timeoutError)
+	return ok
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// capabilitiesVersion is the version of the format printed by
+// godef capabilities. It changes only when existing fields change
+// meaning; new fields may be added without changing it.
+const capabilitiesVersion = 1
+
+// capabilities describes what this godef binary supports,
+// so that editor plugins can detect features.
+type capabilities struct {
+	Version         int                 `json:"version"`
+	Commands        []capabilityCommand `json:"commands"`
+	Flags           []capabilityFlag    `json:"flags"`
+	Queries         []string            `json:"queries"`
+	Formats         []string            `json:"formats"`
+	OffsetEncodings []string            `json:"offsetEncodings"`
+	Protocols       []capabilityProto   `json:"protocols"`
+}
+
+type capabilityCommand struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type capabilityFlag struct {
+	Name    string `json:"name"`
+	Usage   string `json:"usage"`
+	Default string `json:"default,omitempty"`
+	Bool    bool   `json:"bool,omitempty"`
+}
+
+// capabilityProto describes a protocol spoken by godef,
+// such as -rpc or godef serve -lsp.
+type capabilityProto struct {
+	Name    string   `json:"name"`
+	Version string   `json:"version,omitempty"`
+	Methods []string `json:"methods"`
+}
+
+func capabilitiesMain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("capabilities", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: godef capabilities\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	data, err := json.MarshalIndent(getCapabilities(), "", "\t")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", data)
+	return nil
+}
+
+func getCapabilities() *capabilities {
+	c := &capabilities{
+		Version: capabilitiesVersion,
+		Queries: []string{
+			"offset", "line", "addr", "file-address", "symbol",
+			"stdin", "acme", "batch", "all-idents",
+		},
+		Formats:         []string{"text", "json", "kakoune", "helix"},
+		OffsetEncodings: []string{encodingBytes, encodingRunes, encodingUTF16},
+		Protocols: []capabilityProto{
+			{"rpc", "2.0", []string{"definition", "type", "members"}},
+			{"lsp", "", []string{"textDocument/definition", "textDocument/hover"}},
+			{"http", "", []string{"/definition", "/hover", "/members"}},
+		},
+	}
+	for _, cmd := range commands {
+		c.Commands = append(c.Commands, capabilityCommand{cmd.name, cmd.short})
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		_, usage := flag.UnquoteUsage(f)
+		c.Flags = append(c.Flags, capabilityFlag{
+			Name:    f.Name,
+			Usage:   usage,
+			Default: f.DefValue,
+			Bool:    isBoolFlag(f),
+		})
+	})
+	return c
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestCapabilities(t *testing.T) {
+	c := getCapabilities()
+	found := false
+	for _, cmd := range c.Commands {
+		found = found || cmd.Name == "capabilities"
+	}
+	if !found {
+		t.Errorf("capabilities command not listed in %v", c.Commands)
+	}
+	defer func(f string) { *formatFlag = f }(*formatFlag)
+	for _, f := range c.Formats {
+		if f == "text" || f == "json" {
+			continue
+		}
+		*formatFlag = f
+		if err := checkFormatFlag(); err != nil {
+			t.Errorf("listed format %q is not accepted: %v", f, err)
+		}
+	}
+	for _, enc := range c.OffsetEncodings {
+		if err := checkEncoding(enc); err != nil {
+			t.Errorf("listed offset encoding %q is not accepted: %v", enc, err)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func completionMain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("completion", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: godef completion bash|zsh|fish\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	return writeCompletion(os.Stdout, fs.Arg(0))
+}
+
+// writeCompletion writes a completion script for the named shell,
+// covering the subcommands and the flags of the main command.
+func writeCompletion(w io.Writer, shell string) error {
+	var flags []*flag.Flag
+	flag.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, f)
+	})
+	switch shell {
+	case "bash":
+		writeBashCompletion(w, flags)
+	case "zsh":
+		writeZshCompletion(w, flags)
+	case "fish":
+		writeFishCompletion(w, flags)
+	default:
+		return fmt.Errorf("unsupported shell %q (want bash, zsh or fish)", shell)
+	}
+	return nil
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface {
+		IsBoolFlag() bool
+	})
+	return ok && b.IsBoolFlag()
+}
+
+func commandNames() string {
+	var names []string
+	for _, c := range commands {
+		names = append(names, c.name)
+	}
+	return strings.Join(names, " ")
+}
+
+func writeBashCompletion(w io.Writer, flags []*flag.Flag) {
+	var names, valued []string
+	for _, f := range flags {
+		names = append(names, "-"+f.Name)
+		if !isBoolFlag(f) {
+			valued = append(valued, "-"+f.Name)
+		}
+	}
+	fmt.Fprintf(w, `# bash completion for godef
+_godef() {
+	local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+	if [ "$COMP_CWORD" -eq 1 ] && [[ $cur != -* ]]; then
+		COMPREPLY=($(compgen -W "%s" -- "$cur") $(compgen -f -- "$cur"))
+		return
+	fi
+	case " %s " in
+	*" $prev "*)
+		COMPREPLY=($(compgen -f -- "$cur"))
+		return
+		;;
+	esac
+	case $cur in
+	-*) COMPREPLY=($(compgen -W "%s" -- "$cur")) ;;
+	*) COMPREPLY=($(compgen -f -- "$cur")) ;;
+	esac
+}
+complete -o filenames -F _godef godef
+`, commandNames(), strings.Join(valued, " "), strings.Join(names, " "))
+}
+
+func writeZshCompletion(w io.Writer, flags []*flag.Flag) {
+	fmt.Fprintf(w, "#compdef godef\n\n_arguments \\\n")
+	for _, f := range flags {
+		name, usage := flag.UnquoteUsage(f)
+		arg := ""
+		if !isBoolFlag(f) {
+			arg = ":" + zshEscape(name) + ":_files"
+		}
+		fmt.Fprintf(w, "\t'-%s[%s]%s' \\\n", f.Name, zshEscape(usage), arg)
+	}
+	var cmds []string
+	for _, c := range commands {
+		cmds = append(cmds, c.name+"\\:"+zshEscape(strings.Replace(c.short, " ", "\\ ", -1)))
+	}
+	fmt.Fprintf(w, "\t'1::command:((%s))' \\\n", strings.Join(cmds, " "))
+	fmt.Fprintf(w, "\t'*:file:_files'\n")
+}
+
+// zshEscape escapes s for use within a single-quoted
+// _arguments specification.
+func zshEscape(s string) string {
+	return strings.NewReplacer(
+		"'", `'\''`,
+		"[", `\[`,
+		"]", `\]`,
+		":", `\:`,
+	).Replace(s)
+}
+
+func writeFishCompletion(w io.Writer, flags []*flag.Flag) {
+	fmt.Fprintf(w, "# fish completion for godef\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "complete -c godef -n __fish_use_subcommand -a %s -d %s\n", c.name, fishQuote(c.short))
+	}
+	for _, f := range flags {
+		req := ""
+		if !isBoolFlag(f) {
+			req = " -r"
+		}
+		_, usage := flag.UnquoteUsage(f)
+		fmt.Fprintf(w, "complete -c godef -o %s%s -d %s\n", f.Name, req, fishQuote(usage))
+	}
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteCompletion(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		var buf bytes.Buffer
+		if err := writeCompletion(&buf, shell); err != nil {
+			t.Fatalf("%s: %v", shell, err)
+		}
+		script := buf.String()
+		for _, want := range []string{"strict", "offset-encoding", "xref", "completion"} {
+			if !strings.Contains(script, want) {
+				t.Errorf("%s completion does not mention %q", shell, want)
+			}
+		}
+	}
+	if err := writeCompletion(&bytes.Buffer{}, "csh"); err == nil {
+		t.Errorf("expected error for unsupported shell")
+	}
+}
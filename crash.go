@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"runtime"
+
+	"github.com/rogpeppe/godef/godef"
+)
+
+var crashDumpFlag = flag.String("crash-dump", "", "if resolution panics, write a JSON crash report to this `file`")
+
+// crashReport is the JSON form of a crash report,
+// as written by the -crash-dump flag.
+type crashReport struct {
+	Error     string   `json:"error"`
+	Filename  string   `json:"filename"`
+	Offset    int      `json:"offset"`
+	Stack     string   `json:"stack"`
+	GoVersion string   `json:"goVersion"`
+	GOOS      string   `json:"goos"`
+	GOARCH    string   `json:"goarch"`
+	Args      []string `json:"args"`
+}
+
+// reportCrash reports the details of err if it is a panic:
+// its stack is printed with -vv, and the -crash-dump flag
+// causes a report to be written.
+func reportCrash(err error) {
+	perr, ok := err.(*godef.PanicError)
+	if !ok {
+		return
+	}
+	logf(levelDebug, "%s", perr.Stack)
+	if *crashDumpFlag == "" {
+		return
+	}
+	if err := writeCrashReport(*crashDumpFlag, perr); err != nil {
+		logf(levelWarn, "cannot write crash report: %v", err)
+		return
+	}
+	logf(levelWarn, "crash report written to %s", *crashDumpFlag)
+}
+
+func writeCrashReport(filename string, perr *godef.PanicError) error {
+	data, err := json.MarshalIndent(&crashReport{
+		Error:     perr.Error(),
+		Filename:  perr.Filename,
+		Offset:    perr.Offset,
+		Stack:     string(perr.Stack),
+		GoVersion: runtime.Version(),
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+		Args:      os.Args,
+	}, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(data, '\n'), 0666)
+}
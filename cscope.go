@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+func cscopeMain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("cscope", flag.ExitOnError)
+	out := fs.String("o", "cscope.out", "write the database to this file")
+	tests := fs.Bool("tests", false, "include test files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: godef cscope [-o file] [-tests] [packages]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	idx, err := collectRefs(ctx, dir, patterns, *tests)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(*out, cscopeDatabase(idx, dir), 0666)
+}
+
+// cscopeMark returns the cscope mark for an occurrence,
+// or 0 if it is an unmarked reference.
+func cscopeMark(occ *refOcc) byte {
+	sym := occ.Symbol
+	if !occ.Def {
+		if sym.Kind == "func" || sym.Kind == "method" {
+			return '`' // function call
+		}
+		return 0
+	}
+	switch sym.Kind {
+	case "func", "method":
+		return '$'
+	case "type":
+		return 't'
+	case "field":
+		return 'm'
+	}
+	if sym.local {
+		return 'l'
+	}
+	return 'g'
+}
+
+// cscopeDatabase returns idx as an uncompressed cscope
+// cross-reference database for the directory dir.
+func cscopeDatabase(idx *refIndex, dir string) []byte {
+	var body bytes.Buffer
+	var names []string
+	for _, f := range idx.Files {
+		content, err := ioutil.ReadFile(f.Filename)
+		if err != nil {
+			continue
+		}
+		name := relPath(dir, f.Filename)
+		names = append(names, name)
+		fmt.Fprintf(&body, "\t@%s\n\n", name)
+		ends := make(map[int]bool)
+		for _, line := range f.FuncEnds {
+			ends[line] = true
+		}
+		occs := f.Occs
+		lines := bytes.Split(content, []byte("\n"))
+		for i, text := range lines {
+			lineNo := i + 1
+			var lineOccs []*refOcc
+			for len(occs) > 0 && occs[0].Pos.Line == lineNo {
+				lineOccs = append(lineOccs, occs[0])
+				occs = occs[1:]
+			}
+			if len(lineOccs) == 0 && !ends[lineNo] {
+				continue
+			}
+			fmt.Fprintf(&body, "%d ", lineNo)
+			col := 0
+			for _, occ := range lineOccs {
+				start := occ.Pos.Column - 1
+				end := start + len(occ.Symbol.Name)
+				if start < col || end > len(text) {
+					continue
+				}
+				body.WriteString(cscopeText(text[col:start]))
+				body.WriteString("\n")
+				if mark := cscopeMark(occ); mark != 0 {
+					body.WriteString("\t")
+					body.WriteByte(mark)
+				}
+				body.WriteString(occ.Symbol.Name)
+				body.WriteString("\n")
+				col = end
+			}
+			body.WriteString(cscopeText(text[col:]))
+			body.WriteString("\n")
+			if ends[lineNo] {
+				body.WriteString("\t}\n\n")
+			}
+			body.WriteString("\n")
+		}
+	}
+	body.WriteString("\t@\n")
+
+	// The header records the offset of the trailer, which lists
+	// the source directories, include directories and files.
+	header := fmt.Sprintf("cscope 15 %s -c %010d\n", dir, 0)
+	trailerOffset := len(header) + body.Len()
+	header = fmt.Sprintf("cscope 15 %s -c %010d\n", dir, trailerOffset)
+	var db bytes.Buffer
+	db.WriteString(header)
+	db.Write(body.Bytes())
+	size := 0
+	for _, name := range names {
+		size += len(name) + 1
+	}
+	fmt.Fprintf(&db, "1\n.\n0\n%d\n%d\n", len(names), size)
+	for _, name := range names {
+		fmt.Fprintf(&db, "%s\n", name)
+	}
+	return db.Bytes()
+}
+
+// cscopeText returns non-symbol text with runs of white space
+// collapsed to a single space, as cscope itself does, so that
+// it cannot be mistaken for a mark.
+func cscopeText(text []byte) string {
+	return strings.Join(strings.Fields(string(text)), " ")
+}
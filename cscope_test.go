@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func TestCscopeDatabase(t *testing.T) {
+	idx, dir := loadRefs(t)
+	db := cscopeDatabase(idx, dir)
+	header := fmt.Sprintf("cscope 15 %s -c ", dir)
+	if !bytes.HasPrefix(db, []byte(header)) {
+		t.Fatalf("database does not start with %q: %q", header, db)
+	}
+	offset, err := strconv.Atoi(string(db[len(header) : len(header)+10]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset > len(db) || string(db[offset:]) != "1\n.\n0\n1\n5\nx.go\n" {
+		t.Errorf("trailer at offset %d is not the list of x.go", offset)
+	}
+	body := db[:offset]
+	for _, want := range []string{
+		"\t@x.go\n",
+		// Definitions of a type and a field.
+		"3 type\n\ttT\nstruct{\n\tmA\nint }\n",
+		"\t$M\n",  // definition of a method
+		"\t`M\n",  // call of a method
+		"\t}\n\n", // end of a function
+		"\t@\n",
+	} {
+		if !bytes.Contains(body, []byte(want)) {
+			t.Errorf("database has no %q in\n%s", want, body)
+		}
+	}
+}
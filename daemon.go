@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rogpeppe/godef/godef"
+	"golang.org/x/tools/go/packages"
+)
+
+// query is a single definition request, as sent by a client
+// to a daemon.
+type query struct {
+	Dir               string
+	Filename          string
+	Src               []byte            `json:",omitempty"`
+	Overlay           map[string][]byte `json:",omitempty"`
+	Offset            int
+	Type              bool
+	Members           bool
+	AllMembers        bool
+	Strict            bool
+	Words             bool `json:",omitempty"`
+	Guess             bool `json:",omitempty"`
+	Candidates        bool `json:",omitempty"`
+	PreferHandwritten bool `json:",omitempty"`
+	Variants          bool `json:",omitempty"`
+
+	// Exclude holds the patterns of files to ignore,
+	// as for godef.Options.Exclude.
+	Exclude []string `json:",omitempty"`
+
+	// Timeout, if not zero, limits the time the daemon
+	// spends answering the query.
+	Timeout time.Duration `json:",omitempty"`
+
+	// Warm, if not empty, holds package patterns for the
+	// daemon to load and cache, rather than a definition
+	// request.
+	Warm []string `json:",omitempty"`
+}
+
+// options returns the options of the library query
+// that answers q.
+func (q *query) options() godef.Options {
+	return godef.Options{
+		Filename:          q.Filename,
+		Src:               q.Src,
+		Offset:            q.Offset,
+		Type:              q.Type,
+		Members:           q.Type && q.Members,
+		AllMembers:        q.AllMembers,
+		Strict:            q.Strict,
+		NoExec:            *noExecFlag,
+		Words:             q.Words,
+		Guess:             q.Guess,
+		Candidates:        q.Candidates,
+		PreferHandwritten: q.PreferHandwritten,
+		Variants:          q.Variants,
+		Exclude:           q.Exclude,
+		Events:            logEvent,
+	}
+}
+
+// reply is a daemon's answer to a query.
+type reply struct {
+	Def    *definition `json:",omitempty"`
+	Warmed int         `json:",omitempty"` // number of packages cached by a Warm query
+	Error  string      `json:",omitempty"`
+
+	// Kind classifies Error if the query failed with a
+	// *godef.Error, so that the client exits as it would
+	// have had it answered the query itself.
+	Kind godef.ErrorKind `json:",omitempty"`
+}
+
+// daemonAddr returns the network and address named by spec, which
+// is of the form unix:/path or tcp:host:port. If spec is empty or
+// "auto", the address is a unix socket specific to the module
+// containing dir, so that each workspace can have its own daemon.
+func daemonAddr(spec, dir string) (network, addr string, err error) {
+	if spec == "" || spec == "auto" {
+		return "unix", defaultSocket(moduleRoot(dir)), nil
+	}
+	i := strings.Index(spec, ":")
+	if i < 0 {
+		return "", "", fmt.Errorf("invalid daemon address %q (want unix:/path or tcp:host:port)", spec)
+	}
+	switch network := spec[:i]; network {
+	case "unix", "tcp":
+		return network, spec[i+1:], nil
+	}
+	return "", "", fmt.Errorf("unsupported network in daemon address %q", spec)
+}
+
+// defaultSocket returns the name of the unix socket used to talk
+// to the daemon for the module rooted at root.
+func defaultSocket(root string) string {
+	h := sha256.Sum256([]byte(root))
+	return filepath.Join(os.TempDir(), fmt.Sprintf("godef-%d-%x.sock", os.Getuid(), h[:6]))
+}
+
+// moduleRoot returns the directory containing the go.mod file
+// that governs dir, or the empty string if there is none.
+func moduleRoot(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		if info, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil && !info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// serveDaemon listens on the given address, answering queries
+// from a cache of loaded packages until ctx is done. Cached
+// packages are discarded when files under root change, other
+// than those that the exclude patterns match.
+func serveDaemon(ctx context.Context, network, addr, root string, exclude []string) error {
+	if c, err := net.Dial(network, addr); err == nil {
+		c.Close()
+		return fmt.Errorf("a daemon is already listening on %s", addr)
+	}
+	if network == "unix" {
+		// Remove any socket left behind by a daemon that died.
+		os.Remove(addr)
+	}
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	cache := newPackageCache()
+	results := newResultCache()
+	go watchTree(ctx, root, exclude, func(names []string) {
+		cache.invalidateFiles(names)
+		results.invalidate()
+	})
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			var q query
+			var r reply
+			if err := json.NewDecoder(conn).Decode(&q); err != nil {
+				r.Error = fmt.Sprintf("cannot decode query: %v", err)
+			} else if len(q.Warm) > 0 {
+				cfg := &packages.Config{Context: ctx, Dir: q.Dir}
+				if r.Warmed, err = cache.warm(cfg, q.Warm); err != nil {
+					r.Error = err.Error()
+				}
+			} else if def, err := results.answer(ctx, cache, &q); err != nil {
+				r.Error = err.Error()
+				var gerr *godef.Error
+				if errors.As(err, &gerr) {
+					r.Kind = gerr.Kind
+				}
+			} else {
+				r.Def = def
+			}
+			json.NewEncoder(conn).Encode(&r)
+		}()
+	}
+}
+
+// resultCache holds the answers to queries already made of a
+// daemon, keyed by the contents of the queried file and the
+// options of the query, so that editors that repeat the same
+// query are answered without resolving anything again. Each
+// answer is kept with the stamps of the files it was computed
+// from, as for the disk cache, and is used only while none of
+// them has changed, as files may change before the watcher
+// reports them.
+//
+// At most maxResults answers are kept; when there are more,
+// the cache starts again.
+type resultCache struct {
+	mu   sync.Mutex
+	defs map[string]*resultEntry
+}
+
+// resultEntry is an answer held by a resultCache.
+type resultEntry struct {
+	def   *definition
+	files map[string]fileStamp
+}
+
+const maxResults = 10000
+
+func newResultCache() *resultCache {
+	return &resultCache{defs: make(map[string]*resultEntry)}
+}
+
+// answer answers q from the cache if possible, and
+// otherwise from c, caching the result.
+func (rc *resultCache) answer(ctx context.Context, c *packageCache, q *query) (*definition, error) {
+	key, ok := rc.key(q)
+	if ok {
+		rc.mu.Lock()
+		e := rc.defs[key]
+		rc.mu.Unlock()
+		if e != nil && stampsCurrent(e.files) {
+			logf(levelDebug, "%s:#%d: cached result", q.Filename, q.Offset)
+			return e.def, nil
+		}
+	}
+	def, err := c.answerTimeout(ctx, q)
+	// Fallbacks may be caused by transient failures,
+	// so only definitions from loaded packages are kept.
+	if err != nil || !ok || def.Engine != godef.EnginePackages {
+		return def, err
+	}
+	if files := c.stamps(q.Filename); files != nil {
+		rc.mu.Lock()
+		if len(rc.defs) >= maxResults {
+			rc.defs = make(map[string]*resultEntry)
+		}
+		rc.defs[key] = &resultEntry{def, files}
+		rc.mu.Unlock()
+	}
+	return def, err
+}
+
+// key returns the key under which the answer to q is cached,
+// reporting false if the queried file cannot be read. Every field
+// of q that can change the answer is part of the key.
+func (rc *resultCache) key(q *query) (string, bool) {
+	src := q.Src
+	if src == nil {
+		var err error
+		if src, err = ioutil.ReadFile(q.Filename); err != nil {
+			return "", false
+		}
+	}
+	k := *q
+	k.Src, k.Timeout, k.Warm = nil, 0, nil
+	h := sha256.New()
+	fmt.Fprintf(h, "%x\n", sha256.Sum256(src))
+	json.NewEncoder(h).Encode(&k)
+	return string(h.Sum(nil)), true
+}
+
+// invalidate discards all cached answers.
+func (rc *resultCache) invalidate() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.defs = make(map[string]*resultEntry)
+}
+
+// answerTimeout is like answer, but gives up if q takes
+// longer than q.Timeout.
+func (c *packageCache) answerTimeout(ctx context.Context, q *query) (*definition, error) {
+	if q.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.Timeout)
+		defer cancel()
+	}
+	def, err := c.answer(ctx, q)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return nil, &timeoutError{q.Timeout}
+	}
+	return def, err
+}
+
+// answer resolves q using cached packages where possible.
+func (c *packageCache) answer(ctx context.Context, q *query) (_ *definition, err error) {
+	// A panic must not take down a server that is answering
+	// other queries too.
+	defer godef.RecoverPanic(q.Filename, q.Offset, &err)
+	cfg := &packages.Config{
+		Context: ctx,
+		Dir:     q.Dir,
+		Overlay: q.Overlay,
+	}
+	if q.Src != nil {
+		cfg.Overlay = map[string][]byte{
+			q.Filename: q.Src,
+		}
+		for name, data := range q.Overlay {
+			if name != q.Filename {
+				cfg.Overlay[name] = data
+			}
+		}
+	}
+	if alt, desc := godef.AlternateConfig(cfg, q.Filename, q.Src); alt != nil {
+		logEvent(godef.Event{Kind: godef.EventBuildConfig, Filename: q.Filename, Config: desc})
+		cfg = alt
+	}
+	opts := q.options()
+	fset, obj, err := c.lookup(cfg, q.Filename, q.Offset, q.Words)
+	if err != nil {
+		if q.Strict || ctx.Err() != nil {
+			return nil, err
+		}
+		r, err := godef.Fallback(ctx, opts, err)
+		if err != nil {
+			return nil, err
+		}
+		return newDefinition(r), nil
+	}
+	r := godef.Describe(fset, obj, opts)
+	r.Engine = godef.EnginePackages
+	godef.AddCandidates(r, opts)
+	return newDefinition(r), nil
+}
+
+func (c *packageCache) lookup(cfg *packages.Config, filename string, offset int, words bool) (*token.FileSet, types.Object, error) {
+	pkg, err := c.get(cfg, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lookupObject(cfg, pkg, filename, offset, words)
+}
+
+// remoteQuery sends q to the daemon listening on the given address.
+func remoteQuery(network, addr string, q *query) (*definition, error) {
+	r, err := callDaemon(network, addr, q)
+	if err != nil {
+		return nil, err
+	}
+	return r.Def, nil
+}
+
+// callDaemon sends q to the daemon listening on the given
+// address and returns its reply.
+func callDaemon(network, addr string, q *query) (*reply, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to daemon: %v", err)
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(q); err != nil {
+		return nil, fmt.Errorf("cannot send query: %v", err)
+	}
+	var r reply
+	if err := json.NewDecoder(conn).Decode(&r); err != nil {
+		return nil, fmt.Errorf("cannot read reply: %v", err)
+	}
+	if r.Error != "" {
+		if r.Kind != 0 {
+			return nil, &godef.Error{Kind: r.Kind, Err: errors.New(r.Error)}
+		}
+		return nil, fmt.Errorf("%s", r.Error)
+	}
+	return &r, nil
+}
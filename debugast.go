@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+var debugASTFlag = flag.String("debug-ast", "", "print the syntax tree of the file (\"file\") or the nodes enclosing the identifier (\"path\") instead of resolving it")
+
+// checkDebugASTFlag checks the value of the -debug-ast flag.
+func checkDebugASTFlag() error {
+	switch *debugASTFlag {
+	case "", "file", "path":
+		return nil
+	}
+	return &queryError{exitUsage, fmt.Errorf("invalid -debug-ast value %q (want file or path)", *debugASTFlag)}
+}
+
+// debugAST parses the named file, whose contents are src if not
+// nil, and writes its syntax tree to w. In "path" mode, only the
+// nodes enclosing the byte offset are written, outermost first.
+func debugAST(w io.Writer, filename string, src []byte, offset int, mode string) error {
+	fset := token.NewFileSet()
+	var data interface{}
+	if src != nil {
+		data = src
+	}
+	f, err := parser.ParseFile(fset, filename, data, parser.ParseComments)
+	if f == nil {
+		return &queryError{exitLoad, err}
+	}
+	if err != nil {
+		// Show what could be parsed, as that may explain the error.
+		logf(levelWarn, "%v", err)
+	}
+	if mode == "file" {
+		return ast.Fprint(w, fset, f, ast.NotNilFilter)
+	}
+	tfile := fset.File(f.Pos())
+	if offset > tfile.Size() {
+		return &queryError{exitNoIdent, fmt.Errorf("cursor %d is beyond end of file %s (%d)", offset, filename, tfile.Size())}
+	}
+	pos := tfile.Pos(offset)
+	path, _ := astutil.PathEnclosingInterval(f, pos, pos)
+	for i := len(path) - 1; i >= 0; i-- {
+		n := path[i]
+		start, end := fset.Position(n.Pos()), fset.Position(n.End())
+		fmt.Fprintf(w, "%s%T %d:%d-%d:%d%s\n", strings.Repeat("\t", len(path)-1-i), n, start.Line, start.Column, end.Line, end.Column, nodeDetail(n))
+	}
+	return nil
+}
+
+// nodeDetail returns a short description of the
+// contents of n, for the nodes where it helps.
+func nodeDetail(n ast.Node) string {
+	switch n := n.(type) {
+	case *ast.Ident:
+		return " " + n.Name
+	case *ast.BasicLit:
+		return " " + n.Value
+	case *ast.FuncDecl:
+		return " " + n.Name.Name
+	case *ast.TypeSpec:
+		return " " + n.Name.Name
+	case *ast.SelectorExpr:
+		return " ." + n.Sel.Name
+	}
+	return ""
+}
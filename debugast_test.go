@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDebugASTPath(t *testing.T) {
+	src := "package p\n\nfunc f() {\n\tg.h(1)\n}\n"
+	var buf bytes.Buffer
+	if err := debugAST(&buf, "p.go", []byte(src), strings.Index(src, "h("), "path"); err != nil {
+		t.Fatal(err)
+	}
+	want := `*ast.File 1:1-5:2
+	*ast.FuncDecl 3:1-5:2 f
+		*ast.BlockStmt 3:10-5:2
+			*ast.ExprStmt 4:2-4:8
+				*ast.CallExpr 4:2-4:8
+					*ast.SelectorExpr 4:2-4:5 .h
+						*ast.Ident 4:4-4:5 h
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rogpeppe/godef/godef"
+)
+
+var quietFlag = flag.Bool("q", false, "print no warnings, only results and fatal errors")
+var verboseFlag = flag.Bool("v", false, "print progress information to stderr")
+var veryVerboseFlag = flag.Bool("vv", false, "print detailed debugging information to stderr")
+
+// Diagnostic levels, as passed to logf.
+const (
+	levelWarn  = 0 // shown unless -q is given
+	levelInfo  = 1 // shown with -v
+	levelDebug = 2 // shown with -vv
+)
+
+// verbosity returns the highest diagnostic level to print.
+func verbosity() int {
+	switch {
+	case *veryVerboseFlag:
+		return levelDebug
+	case *verboseFlag || *debug:
+		return levelInfo
+	case *quietFlag:
+		return levelWarn - 1
+	}
+	return levelWarn
+}
+
+// logf prints a diagnostic at the given level to stderr, so that
+// standard output carries only results.
+func logf(level int, format string, args ...interface{}) {
+	if level <= verbosity() {
+		fmt.Fprintf(os.Stderr, "godef: "+format+"\n", args...)
+	}
+}
+
+// logEvent logs the progress of a query made through the godef
+// package, with load timings and fallbacks shown by -v and the
+// details by -vv.
+func logEvent(e godef.Event) {
+	level := levelDebug
+	switch e.Kind {
+	case godef.EventLoaded, godef.EventFallback, godef.EventBuildConfig:
+		level = levelInfo
+	}
+	logf(level, "%v", e)
+}
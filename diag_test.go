@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerbosity(t *testing.T) {
+	src := "package x\n\nfunc F() {}\n\nvar v = F\n\nfunc g() { F2 := 1; _ = F2 }\n\nvar w = F2\n"
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module x\n",
+		"x.go":   src,
+	})
+	f := fmt.Sprint(strings.LastIndex(src, "F\n"))
+	f2 := fmt.Sprint(strings.LastIndex(src, "F2"))
+	for _, test := range []struct {
+		args   []string
+		stdout string
+		stderr []string // substrings of stderr, which is empty if nil
+	}{
+		{[]string{"-f", "x.go", "-o", f}, "x.go:3:6", nil},
+		{[]string{"-v", "-f", "x.go", "-o", f}, "x.go:3:6", []string{"godef: loaded", "resolved by packages"}},
+		{[]string{"-vv", "-f", "x.go", "-o", f}, "x.go:3:6", []string{"godef: loaded", "resolved by packages", "godef: parsed"}},
+		{[]string{"-guess", "-f", "x.go", "-o", f2}, "x.go:7:12", []string{"guessed"}},
+		{[]string{"-q", "-guess", "-f", "x.go", "-o", f2}, "x.go:7:12", nil},
+	} {
+		stdout, stderr, code := runGodef(t, dir, "", nil, test.args...)
+		name := "godef " + strings.Join(test.args, " ")
+		if code != 0 {
+			t.Errorf("%s: exit status %d: %s", name, code, stderr)
+			continue
+		}
+		// Diagnostics never appear among the results.
+		if want := filepath.Join(dir, test.stdout) + "\n"; stdout != want {
+			t.Errorf("%s: got output %q, want %q", name, stdout, want)
+		}
+		if test.stderr == nil && stderr != "" {
+			t.Errorf("%s: got diagnostics %q, want none", name, stderr)
+		}
+		for _, s := range test.stderr {
+			if !strings.Contains(stderr, s) {
+				t.Errorf("%s: got diagnostics %q, want %q among them", name, stderr, s)
+			}
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// cacheEnv lists the go environment variables that can
+// change the result of loading a package.
+var cacheEnv = []string{
+	"GOPATH", "GOROOT", "GOFLAGS", "GOOS", "GOARCH",
+	"GO111MODULE", "GOPROXY", "CGO_ENABLED",
+	"GOMODCACHE", "GOWORK", "GOEXPERIMENT",
+}
+
+// diskEntry is a result cached on disk, along with the stamps of all
+// the files and directories it was computed from. The entry is valid
+// only while none of them has changed.
+type diskEntry struct {
+	Def   *definition
+	Files map[string]fileStamp
+}
+
+// resultKey returns the key under which the answer to q is cached.
+func resultKey(ctx context.Context, q *query) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", runtime.Version())
+	for _, v := range goEnvVars(ctx, q.Dir) {
+		fmt.Fprintf(h, "%q\n", v)
+	}
+	json.NewEncoder(h).Encode(q)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// resultCacheDir returns the directory holding cached results.
+func resultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "godef", "results"), nil
+}
+
+// cachedResult returns the cached result for key,
+// or nil if there is none or it is out of date.
+func cachedResult(key string) *definition {
+	dir, err := resultCacheDir()
+	if err != nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, key))
+	if err != nil {
+		return nil
+	}
+	var e diskEntry
+	if err := json.Unmarshal(data, &e); err != nil || e.Def == nil {
+		return nil
+	}
+	if !stampsCurrent(e.Files) {
+		return nil
+	}
+	return e.Def
+}
+
+// cacheResult stores def under key, recording the state of
+// pkg's files and those of its dependencies. Failures are
+// ignored: the cache is only an optimization.
+func cacheResult(key string, def *definition, pkg *packages.Package) {
+	dir, err := resultCacheDir()
+	if err != nil {
+		return
+	}
+	files, ok := packageStamps(pkg)
+	if !ok {
+		return
+	}
+	e := diskEntry{
+		Def:   def,
+		Files: files,
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return
+	}
+	// Write atomically so that concurrent invocations
+	// never see a partially written entry.
+	f, err := ioutil.TempFile(dir, "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return
+	}
+	if err := os.Rename(f.Name(), filepath.Join(dir, key)); err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// packageStamps returns the stamps of the files that an answer
+// computed from pkg depends on: the directories of pkg and its
+// dependencies, the Go files in them, and the go.mod and go.sum files
+// of their modules. It reports false if a directory cannot be read.
+func packageStamps(pkg *packages.Package) (map[string]fileStamp, bool) {
+	files := make(map[string]fileStamp)
+	dirs := make(map[string]bool)
+	addDirs(dirs, pkg, make(map[*packages.Package]bool))
+	for d := range dirs {
+		// A directory's stamp changes when files are added or removed.
+		addStamp(files, d)
+		infos, err := ioutil.ReadDir(d)
+		if err != nil {
+			return nil, false
+		}
+		for _, info := range infos {
+			if filepath.Ext(info.Name()) == ".go" {
+				addStamp(files, filepath.Join(d, info.Name()))
+			}
+		}
+		if root := moduleRoot(d); root != "" {
+			addStamp(files, filepath.Join(root, "go.mod"))
+			addStamp(files, filepath.Join(root, "go.sum"))
+		}
+	}
+	return files, true
+}
+
+// stampsCurrent reports whether none of the files
+// has changed since their stamps were taken.
+func stampsCurrent(files map[string]fileStamp) bool {
+	for name, stamp := range files {
+		if s, ok := statFile(name); !ok || !s.same(stamp) {
+			return false
+		}
+		if stamp.Sum != nil {
+			if sum, err := contentSum(name); err != nil || !bytes.Equal(sum, stamp.Sum) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// recentModTime is how recently a file must have been modified
+// for addStamp to record a hash of its contents too. File systems
+// record modification times coarsely, so a file rewritten soon
+// after it was last modified may keep the same time and size.
+const recentModTime = 2 * time.Second
+
+// addStamp records the stamp of the named file in files.
+func addStamp(files map[string]fileStamp, name string) {
+	s, ok := statFile(name)
+	if !ok {
+		return
+	}
+	if !s.ModTime.IsZero() && time.Since(s.ModTime) < recentModTime {
+		sum, err := contentSum(name)
+		if err != nil {
+			return
+		}
+		s.Sum = sum
+	}
+	files[name] = s
+}
+
+// contentSum returns a hash of the contents of the named file,
+// or of the names of the files in it if it is a directory.
+func contentSum(name string) ([]byte, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	if info.IsDir() {
+		infos, err := ioutil.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			fmt.Fprintf(h, "%q\n", info.Name())
+		}
+	} else {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(data)
+	}
+	return h.Sum(nil), nil
+}
+
+// statFile returns the stamp of the named file. A missing file
+// has the zero stamp, so that creating it invalidates any entry
+// that recorded its absence.
+func statFile(name string) (fileStamp, bool) {
+	info, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return fileStamp{}, true
+	}
+	if err != nil {
+		return fileStamp{}, false
+	}
+	return fileStamp{ModTime: info.ModTime(), Size: info.Size()}, true
+}
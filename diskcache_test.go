@@ -0,0 +1,74 @@
+package main
+
+import (
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
+
+func TestCachedResult(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"go.mod":     "module m\n",
+		"x/x.go":     "package x\n\nimport \"m/dep\"\n\nvar v = dep.C\n",
+		"dep/dep.go": "package dep\n\nconst C = 1\n",
+	})
+	defer os.Setenv("XDG_CACHE_HOME", os.Getenv("XDG_CACHE_HOME"))
+	os.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	depgo := filepath.Join(dir, "dep", "dep.go")
+	pkg := &packages.Package{
+		GoFiles: []string{filepath.Join(dir, "x", "x.go")},
+		Imports: map[string]*packages.Package{
+			"m/dep": {GoFiles: []string{depgo}},
+		},
+	}
+	def := &definition{Pos: token.Position{Filename: depgo, Line: 3, Column: 7}}
+	for _, test := range []struct {
+		name   string
+		change func() error
+	}{{
+		"edit dependency",
+		func() error {
+			return ioutil.WriteFile(depgo, []byte("package dep\n\nconst C = 2\n"), 0666)
+		},
+	}, {
+		// A rewrite of the same size with the same
+		// modification time is told by the file's contents.
+		"rewrite dependency in place",
+		func() error {
+			info, err := os.Stat(depgo)
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(depgo, []byte("package dep\n\nconst C = 3\n"), 0666); err != nil {
+				return err
+			}
+			return os.Chtimes(depgo, info.ModTime(), info.ModTime())
+		},
+	}, {
+		"add file to dependency",
+		func() error {
+			return ioutil.WriteFile(filepath.Join(dir, "dep", "new.go"), []byte("package dep\n"), 0666)
+		},
+	}, {
+		"edit go.mod",
+		func() error {
+			return ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module m\n\ngo 1.16\n"), 0666)
+		},
+	}} {
+		cacheResult("key", def, pkg)
+		got := cachedResult("key")
+		if got == nil || got.Pos != def.Pos {
+			t.Fatalf("%s: got cached result %+v, want %+v", test.name, got, def)
+		}
+		if err := test.change(); err != nil {
+			t.Fatal(err)
+		}
+		if got := cachedResult("key"); got != nil {
+			t.Errorf("%s: got stale cached result %+v", test.name, got)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/types"
+
+	"github.com/rogpeppe/godef/godef"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+var callsFlag = flag.Bool("calls", false, "list the calls made through interface values to the interface method at the offset, across the current module")
+
+// callsDefinition returns the definition of the interface method at
+// the given offset of filename, with the calls that may dispatch to
+// it as members: the calls of it through values of any interface
+// type holding it, in the packages matching ./... in dir, including
+// their tests.
+func callsDefinition(ctx context.Context, dir, filename string, src []byte, overlay map[string][]byte, offset int) (*definition, error) {
+	res, err := typedObject(ctx, dir, filename, src, overlay, offset)
+	if err != nil {
+		return nil, err
+	}
+	m, _ := res.Object.(*types.Func)
+	var recv *types.Var
+	if m != nil {
+		recv = m.Type().(*types.Signature).Recv()
+	}
+	if recv == nil || !types.IsInterface(recv.Type()) {
+		return nil, &queryError{exitNotFound, fmt.Errorf("%s is not an interface method", res.Object.Name())}
+	}
+	def := describe(res.Fset, m, resolution{engine: godef.EnginePackages}, true, false, false)
+	// The method is known by its position, as the packages are
+	// loaded again and so have objects of their own.
+	target := godef.Position(res.Fset, m)
+	lpkgs, err := packages.Load(&packages.Config{
+		Context: ctx,
+		Dir:     dir,
+		Mode:    packages.LoadSyntax,
+		Tests:   true,
+	}, "./...")
+	if err != nil {
+		return nil, &queryError{exitLoad, err}
+	}
+	seen := make(map[string]bool)
+	for _, pkg := range lpkgs {
+		for _, file := range pkg.Syntax {
+			tf := pkg.Fset.File(file.Pos())
+			if tf == nil || seen[tf.Name()] {
+				// Test variants repeat the files of the package under test.
+				continue
+			}
+			seen[tf.Name()] = true
+			for _, decl := range file.Decls {
+				scope := ""
+				if fd, ok := decl.(*ast.FuncDecl); ok {
+					scope = funcName(fd)
+				}
+				ast.Inspect(decl, func(n ast.Node) bool {
+					call, ok := n.(*ast.CallExpr)
+					if !ok {
+						return true
+					}
+					sel, ok := astutil.Unparen(call.Fun).(*ast.SelectorExpr)
+					if !ok {
+						return true
+					}
+					s := pkg.TypesInfo.Selections[sel]
+					if s == nil || s.Kind() != types.MethodVal || !types.IsInterface(s.Recv()) {
+						return true
+					}
+					if godef.Position(pkg.Fset, s.Obj()) != target {
+						return true
+					}
+					text := types.ExprString(sel)
+					if scope != "" {
+						text = scope + ": " + text
+					}
+					def.Members = append(def.Members, member{Type: text, Pos: pkg.Fset.Position(sel.Sel.Pos())})
+					return true
+				})
+			}
+		}
+	}
+	sortMembers(def.Members)
+	return def, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCallsDefinition(t *testing.T) {
+	xsrc := `package x
+
+type I interface{ M() }
+
+type J interface {
+	I
+	N()
+}
+
+type T struct{}
+
+func (T) M() {}
+
+func F(i I) { i.M() }
+
+func G(j J) { j.M(); j.N() }
+
+func H(t T) { t.M() }
+`
+	ysrc := `package y
+
+import "x"
+
+func Y(i x.I) {
+	f := func() { i.M() }
+	f()
+}
+`
+	files := map[string]string{
+		"go.mod": "module x\n",
+		"x.go":   xsrc,
+		"y/y.go": ysrc,
+	}
+	dir := writeTree(t, files)
+	def, err := callsDefinition(context.Background(), dir, filepath.Join(dir, "x.go"), nil, nil, strings.Index(xsrc, "M()"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range def.Members {
+		got = append(got, m.Type)
+	}
+	want := []string{
+		"F: i.M",
+		"G: j.M",
+		"Y: i.M",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got calls\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if _, err := callsDefinition(context.Background(), dir, filepath.Join(dir, "x.go"), nil, nil, strings.Index(xsrc, "M() {}")); err == nil {
+		t.Errorf("got no error for a concrete method")
+	}
+	if _, err := callsDefinition(context.Background(), dir, filepath.Join(dir, "x.go"), nil, nil, strings.Index(xsrc, "T struct")); err == nil {
+		t.Errorf("got no error for a type")
+	}
+}
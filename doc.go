@@ -8,7 +8,7 @@ Godef prints the source location of definitions in Go programs.
 
 Usage:
 
-	godef [-t] [-a] [-A] [-o offset] [-i] [-f file][-acme] [expr]
+	godef [-t] [-a] [-A] [-o offset] [-i] [-f file] [-acme] [-json] [-strict] [expr]
 
 File specifies the source file in which to evaluate expr.
 Expr must be an identifier or a Go expression
@@ -17,6 +17,142 @@ terminated with a field selector.
 If expr is not given, then offset specifies a location
 within file, which should be within, or adjacent to
 an identifier or field selector.
+Instead of an offset, the location may be given as a one-based
+line and column with the -line and -col flags.
+Alternatively, the file and location may be given together as
+the only argument, in the form file:line:col, file:line or
+file:#offset, as printed by compilers and godef itself:
+
+	godef src/pkg/xml/read.go:384:18
+
+The -addr flag gives the location as a sam address: a line
+number n, a line and rune column n.c, a rune offset #n, or a
+regular expression /re/ (or ?re? to search backwards), optionally
+following another address to search from. A regular expression
+denotes the identifier containing the last character of its match,
+so that
+
+	godef -f x.go -addr '/func Foo/'
+
+finds the definition of Foo.
+
+With no file, an argument of the form pkg.Name or pkg.Type.Member,
+where pkg is an import path, names a declaration directly; the
+package is found as it would be by an import in the current module:
+
+	godef net/http.Client.Do
+
+An import path alone names the package, and godef prints its
+directory; a single name, such as fmt, is taken as a package only
+if the package in the current directory declares nothing by that
+name. With -t, the package clause follows, and with -a, a summary
+of the package's API: its exported declarations, each type followed
+by its exported methods, with their types and positions, read from
+export data where possible. With -A, unexported declarations are
+listed too:
+
+	godef -a net/http
+
+Declarations in the standard library are found from a summary of
+their package's declarations, kept in the godef directory under the
+user's cache directory for each Go version, rather than by loading
+the package, unless -t, -a or -A needs type information; the engine
+is then reported as "summary". A summary is rebuilt whenever any of
+its package's files change.
+
+The -goroot flag names the Go installation, or the standard library
+sources, to use in place of the go command's GOROOT, such as those
+of another toolchain or of TinyGo; the go command in its bin
+directory, if any, is used too. It cannot be combined with -remote,
+as the daemon has its own.
+
+A go.mod file may be queried too: on a module path in a require or
+replace directive, godef prints the directory holding the source that
+the module builds with, which is its replacement, if it has one, or
+its copy in the module cache. The engine is reported as "gomod". With
+-t, the module's path and version follow, along with the position of
+the doc.go file in that directory, if there is one.
+
+In a comment, the offset may be on a doc link, such as [Name],
+[Name.Method], [pkg.Name] or [pkg.Name.Method], where pkg is the
+name or path of a package that the file imports; godef prints the
+position of the declaration it links to. A link to a package alone,
+such as [pkg], leads to the file's import of it.
+
+With -consts, godef prints the named type at the offset, or the type
+of the constant there, followed by every constant of that type, as
+-t prints members: first those in the type's own package, then those
+in the packages of the current directory's ./..., each with its value
+and position. This lists the values of a type used as an enum.
+
+With -methods, godef prints the type at the offset, or the type of
+the value there, followed by every method in its method set, which
+for a type other than an interface is that of a pointer to it. A
+method promoted from an embedded field is marked with the path of
+fields it comes through, and an interface's method with the embedded
+interface that declares it.
+
+With -calls, godef prints the interface method at the offset followed
+by the calls in the packages of the current directory's ./..., and
+their tests, that may dispatch to it: those made through a value of
+its interface, or of any interface embedding it, each with the
+function holding it. Calls on concrete types are not listed.
+
+With -errors, godef prints the error variable at the offset, such as
+a sentinel error, or the function returning an error there, followed
+by the references to it in the packages of the current directory's
+./..., and their tests, through which the error flows: comparisons by
+errors.Is, errors.As, == and !=, wraps by fmt.Errorf with %w, and
+return statements, each with the declaration holding it. References
+that format the error without %w, or store it, are left out.
+
+With -words, an offset elsewhere in a comment or string literal is
+taken as on the word there, such as a function named in a TODO or a
+type named in a struct tag, which is resolved as an expression in
+the scope holding it: a name, followed by any fields or methods, or
+a package name followed by a name in that package.
+
+A file is queried along with its package's tests if its name ends
+in _test.go or its package clause names an external test package,
+so that queries in a test file, including one read from standard
+input, see both the package under test, with helpers such as those
+in export_test.go, and the test package itself.
+
+In a package using cgo, queries work on the package's own files,
+although the go command type checks the files that cgo generates
+from them. A C name, such as C.f, leads to its declaration in the
+preamble of the import of "C", if it can be found there, or else
+to the import itself.
+
+Positions in a module that the current module replaces by a local
+directory are reported in that directory, as that is the code that
+is built and can be edited. With -original, they are reported in
+the module cache copy of the version that it replaces instead, where
+that copy has the same file, and go.mod queries ignore replacements.
+
+A file in the module cache, reached by an earlier jump into a
+dependency, is loaded in the context of the current module if that
+builds the same version of the file's module. Otherwise godef loads
+it in a synthetic module, kept in the godef directory under the
+user's cache directory, that requires just that version, so that
+further jumps resolve as they would when building the dependency.
+
+A plain Name or Type.Member names a declaration in the package in
+the current directory, so that
+
+	cd $pkg && godef SomeFunc
+
+prints the location of SomeFunc.
+
+Several such arguments, and file locations, may be given at once;
+each is resolved in turn, sharing loaded packages, and the results
+are printed in order:
+
+	godef x.go:12:5 y.go:#230 fmt.Println
+
+Offsets, columns given with -col, and the columns printed are
+counted in bytes by default. The -offset-encoding flag selects
+runes (as used by acme) or utf16 (as used by LSP clients) instead.
 
 If the -t flag is given, the type of the expression will
 also be printed. The -a flag causes all the public
@@ -25,12 +161,461 @@ and their location, to be printed also; the -A flag
 prints private members too.
 
 If the -i flag is specified, the source is read
-from standard input, although file must still
-be specified so that other files in the same source
-package may be found.
+from standard input. File names the file being read, so
+that other files in the same source package may be found;
+without it, the source is treated as a new file in the
+package in the current directory.
+
+The GODEFFLAGS environment variable holds a space-separated list of
+flags to apply before those on the command line, as GOFLAGS does for
+the go command; it is not used by subcommands, and may not hold -C.
+For example, to have every query print JSON and fail rather than
+fall back to syntax-only resolution:
+
+	export GODEFFLAGS='-json -strict'
+
+When godef runs somewhere that sees the source under different file
+names from the editor, as in a container with the source bind-mounted,
+the -path-map flag translates between them: with -path-map host=local,
+input file names (from -f, -batch and -rpc) starting with the host
+prefix are rewritten to start with the local prefix, and output file
+names are rewritten back. The flag may be repeated.
+
+The -rel flag prints file names relative to the given directory,
+or to the root of the current module if it is "module", so that
+output is the same on every machine; names outside the directory,
+such as those in the standard library, are printed in full.
+
+File names are printed in a canonical form; on Windows, that means
+backslash separators, an upper-case drive letter and long rather
+than 8.3 names, and file names given to godef are compared in the
+same form, ignoring case. The -slash flag prints forward slashes
+instead, as some Windows editors expect.
+
+File names are printed as the go command reports them, without
+resolving symbolic links; with -resolve-symlinks=on, each printed
+name has its links resolved, giving the file's real location.
+
+The -format flag prints results in a form suited to editors with
+pipe-based integration. With -format=kakoune, godef prints Kakoune
+commands, to be run with evaluate-commands: one opens the
+definition, and with -t, another shows the type and members in an
+info box. With -format=helix, columns count characters, as Helix's
+do, whatever -offset-encoding says.
+
+When standard output is a terminal known to support OSC 8
+hyperlinks, such as iTerm2, kitty or WezTerm, printed positions
+are wrapped in file:// hyperlinks, so that clicking one opens the
+file. The -hyperlink flag overrides the detection: always adds
+hyperlinks regardless, and never omits them.
+
+The -C flag changes to the given directory before doing anything
+else, as with the go command; it must be the first flag, and
+applies to subcommands too:
+
+	godef -C ~/src/other -f x.go -o 123
+	godef -C ~/src/other index
+
+The -timeout flag limits the time taken by a query, or by all the
+queries of -batch; when it expires, any go command run to load
+packages is stopped and godef fails with a "query timed out" error
+rather than falling back to syntax-only resolution. With -remote,
+the limit is passed on to the daemon, which abandons the query
+when it expires, so that it does not go on loading packages that
+nobody is waiting for.
+
+If resolving an identifier panics, godef reports an internal error
+naming the file and offset rather than crashing with a stack trace;
+-vv prints the stack, and the -crash-dump flag writes a JSON report
+holding the stack, position, Go version and command line to the
+given file, for attaching to bug reports. Servers carry on answering
+other queries after such a failure.
+
+The -debug-ast flag prints syntax instead of resolving anything,
+so that parser-level problems can be reported without writing a
+program: -debug-ast=file prints the whole syntax tree of the file,
+and -debug-ast=path prints just the nodes enclosing the given
+position, outermost first, with their extents.
+
+The -trace flag writes an execution trace, for viewing with go tool
+trace, in which the phases of a query appear as regions of a task:
+"read input", "load" (containing a "parse" region for each file, the
+rest of the time being spent type checking), "resolve", "describe",
+"fallback" when syntax-only resolution is used, and "print".
+
+The -stats flag prints a JSON summary of the work done by a query
+to standard error once it has finished, so that latency can be
+tracked over time: the numbers of packages loaded, files parsed and
+bytes of source parsed, the number of results taken from the -cache,
+and the milliseconds spent reading the input, loading, parsing (in
+total, though files are parsed concurrently), resolving, falling
+back to syntax-only resolution and printing, along with the total:
+
+	{"packages":41,"files":12,"bytes":80312,"cacheHits":0,"phasesMs":{"load":312.5,...}}
+
+Godef collects garbage rarely, as queries are short-lived: the
+-gcpercent flag sets the collection target, as GOGC does, overriding
+the default of 1600 (or $GOGC, if set). Lower values reduce memory
+use at the cost of speed; -gcpercent=-1 disables collection
+altogether, which suits one-shot queries on machines with memory to
+spare. The -memlimit flag sets a soft limit on memory use, such as
+4GiB, as GOMEMLIMIT does, beyond which garbage is collected however
+-gcpercent is set. Single queries keep syntax trees only for the
+package holding the identifier, reading its dependencies from
+export data; servers and -batch, which keep loaded packages in
+memory, discard them all when memory use comes within a tenth of
+the limit, rather than loading more and risking being killed.
+
+Single queries type-check only the function body holding the
+identifier. Servers and -batch type-check the packages they keep
+in full, except for files of at least the size given by -hugefile
+(1MiB by default, or 0 to check every file in full), such as
+generated protocol buffer or bindata files: in those, only the
+function body holding each query is type-checked, when the query
+is made.
+
+Standard output carries only results; diagnostics go to standard
+error. The -q flag suppresses warnings, such as those for the
+individual failures of -batch queries, leaving only fatal errors;
+-v reports progress, including which engine resolved the query
+(as does the older -debug flag), and -vv adds details such as
+the errors found in loaded packages.
+
+The bench command runs a query repeatedly with each engine, the
+packages engine and the syntax-only parser engine, and prints the
+latency and allocations of each, so that performance can be compared
+and reported meaningfully:
+
+	godef bench -f x.go -o 1234 -n 100
+
+The completion command prints a completion script for bash, zsh
+or fish, covering godef's flags and commands. For example:
+
+	source <(godef completion bash)
+
+The capabilities command prints a JSON description of the commands,
+flags, query forms, output formats, offset encodings and protocols
+that godef supports, so that editor plugins can detect features
+rather than relying on version numbers. Its "version" field changes
+only when existing fields change meaning.
+
+Programs that want to resolve identifiers without running godef can
+import the package github.com/rogpeppe/godef/godef, whose Query
+function answers the same definition, type and member queries,
+reporting its progress as events that callers can log as they wish.
+
+Godef exits with status 0 on success, 2 if the command line is
+invalid, 3 if there is no identifier at the given position, 4 if the
+identifier's definition cannot be found, 5 if the packages needed
+cannot be loaded or parsed (or the query times out), and 1 on any
+other failure.
+
+If the packages containing file cannot be loaded or type-checked,
+godef falls back to resolving the identifier using only the
+declarations in file itself. The -strict flag disables this fallback.
+Files of a megabyte or more, such as generated ones, are mapped into
+memory rather than copied for this, and are parsed first only as far
+as the declaration holding the identifier, which is usually enough.
+If there is no go command at all, as in minimal containers, godef
+instead parses the other files in file's directory and, for names
+qualified by an import, guesses the directory of the imported package
+from GOROOT, the enclosing module's go.mod file, its vendor directory
+and the module cache, and GOPATH, much as the go command would; it
+warns that it has done so, and reports the engine as "layout". The
+-no-exec flag makes godef resolve identifiers that way even when the
+go command is present, guaranteeing that it runs no other program,
+as some sandboxed editors require; it also makes results independent
+of the build cache, which suits benchmarks. Queries that need the go
+command, such as those naming a package's declaration directly, then
+fail. The engine used is reported in -json output and by the -debug
+flag.
+
+When even the fallback cannot resolve the identifier, as in badly
+broken code, the -guess flag makes godef look for declarations by
+its name alone: those in file itself, nearest first, then those at
+package level in the rest of the package and in dot-imported
+packages. A name qualified by an imported package is looked for in
+that package, and other selectors among the methods and fields of
+the package and of those it imports. Godef prints every candidate,
+most likely first, one per line, warns that they are guesses, and
+reports the engine as "guess". The -strict flag disables guessing
+too.
+
+The -candidates flag lists every declaration the identifier might
+refer to, not only the one that the current build resolves it to:
+declarations of the same package-level name, or of the same method of
+the same type, in the other files of the package's directory,
+including test files and files that the build constraints exclude,
+such as the variants of a function in now_linux.go and now_windows.go.
+Godef prints the candidates one per line, the resolved declaration
+first. In -json and -rpc output, each candidate in "candidates" has
+a "rank", starting at 1 for the likeliest, and a "reason": "resolved",
+"duplicate" for a declaration repeated in the same build, "test" for
+one in a test file or test package unlike the resolved one or vice
+versa, "build" for one excluded by build constraints, or "name" for
+a guess, so that editors can offer a choice. With -prefer-handwritten,
+candidates in files marked as generated, by a "Code generated ... DO
+NOT EDIT." comment, are ranked after the others, so that a hand-written
+variant comes before stringer output for the same method, say; the
+definition printed first is still the one resolved, or for -guess,
+the likeliest hand-written candidate.
+
+The -variants flag lists only the variants of the declaration for
+other build configurations, with the declaration that the current
+configuration resolves to first, each followed by a tab and the build
+constraint of its file, combining those implied by its name with any
+in its header:
+
+	$ godef -variants -f clock.go -o 120
+	/home/user/x/now_linux.go:3:6	linux
+	/home/user/x/now_windows.go:3:6	windows
+
+In -json output, each candidate carries the constraint as
+"constraint".
+
+If the build configuration excludes file itself, as it excludes
+foo_windows.go on Linux, godef loads its package under a configuration
+that includes it, inferred from the file's name and build constraints:
+it changes GOOS and GOARCH, enables cgo or adds the tags that the
+constraints mention, as little as it can, and says what it changed at
+-v. Files that no configuration includes, such as those constrained
+by ignore, are resolved by the fallback as before.
+
+The -exclude and -exclude-common flags, described with the index
+command below, make godef ignore the matching files when it parses
+the files of a package directly rather than loading the package
+with the go command: in the fallbacks, -guess and -candidates. The
+go command itself already ignores testdata directories.
+
+The -why flag explains on standard error how the identifier was
+resolved: the scope its declaration was found in (a block, a
+function, the file, the package or the universe), whether that is
+in the queried file, another file of the same package or an
+imported package, and which engine resolved it. Results are not
+taken from the -cache when -why is given, and the daemon reports
+only the engine.
+
+The -cache flag causes results to be cached on disk, in the godef
+directory under the user's cache directory, so that repeating a query
+does not reload any packages. A cached result is used only if none
+of the files it was computed from, nor the environment, has changed.
+Godef takes its view of the environment, such as GOOS, GOARCH, the
+build tags in GOFLAGS, GOPATH, GOMODCACHE and GOWORK, from the output
+of go env, so that it agrees with the go command even when they are
+set in a GOENV file. That output is cached too, and go env is in any
+case run at most once per directory by each godef process.
+
+Each query made with the -jumps flag records its starting point and
+the definition it found in a jump history in the user's cache
+directory, shared by all invocations. Other queries leave it alone.
+
+	godef back
+
+prints the location before the current one in the history, and
+
+	godef forward
+
+undoes the effect of godef back, so that editors can provide
+go-back navigation. Any query made after going back discards
+the locations ahead of it.
 
 If the -acme flag is given, the offset, file name and contents
-are read from the current acme window.
+are read from the current acme window. The contents of any
+other acme windows with unsaved changes are used in place of
+the corresponding files on disk. The current window is the one
+named by $winid, or by the -winid flag, which implies -acme, so
+that scripts can act on windows other than the focused one.
+If the selection in the window is not empty, the last identifier
+in it is resolved, so that selecting a selector such as http.Get
+and running godef finds Get.
+On Plan 9, acme's files are read directly from /mnt/acme;
+elsewhere they are reached through plan9port. With -plumb as
+well, the definition is sent to the plumber's edit port, so that
+acme opens it directly, rather than being printed. The type and
+member information printed by -t, -a and -A in acme mode goes
+to a +godef window in the current directory, which is reused
+by later queries.
+
+Godef can also run as a long-lived server:
+
+	godef serve -lsp
+
+speaks the language server protocol on standard input and output,
+answering definition and hover requests. Loaded packages are cached
+in memory, and after an edit confined to one document only that
+document is parsed and type-checked again, while
+
+	godef serve -http=:8080
+
+serves the /definition, /hover and /members endpoints over HTTP,
+taking file and offset query parameters (and all=true for /members
+to include unexported members) and returning JSON results of the
+same form as -rpc.
+
+To avoid reloading packages for every query, run
+
+	godef -daemon
+
+which listens on the address given by the -listen flag and keeps
+loaded packages in memory. The daemon watches the Go files of the
+module containing the current directory (or the directory itself
+if there is none), and discards only the packages affected when
+they change; changes to go.mod or go.sum discard everything. It is
+notified of changes by the operating system where it can be; where it
+cannot, such as on Plan 9 or when there are too many directories to
+watch, it scans the tree every two seconds or more, waiting twenty
+times as long as each scan takes. It does
+not watch the directories that the go command ignores, testdata and
+node_modules directories, or the files and directories that -exclude
+matches. When
+only the queried file has changed since its package was loaded, and
+its imports have not, just that file is parsed and type-checked again
+against the package's cached dependencies. The daemon also remembers
+its answers, keyed by the contents of the queried file and the query's
+options, so that editors that repeat a query are answered at once,
+until any file of the queried package or its dependencies changes.
+Queries made with the -remote flag are forwarded to the daemon at
+the given address rather than being answered by the godef process
+itself. Addresses are of the form unix:/path or tcp:host:port.
+The default address, "auto", names a unix socket specific to the
+module containing the current directory (for -daemon) or the
+queried file (for -remote), so that each workspace can have its
+own daemon.
+
+The first query in a large workspace may take seconds while the go
+command builds its dependencies. To do that work ahead of time, run
+
+	godef warm ./...
+
+which loads the named packages (by default ./...), so that the go
+command's build cache holds their dependencies, and summarizes the
+standard library packages they import; with -cache, the output of
+go env is also kept for queries made with -cache. With -remote, the
+packages are instead loaded into the daemon at the given address,
+which keeps them in memory for the queries that follow.
+
+With the -rpc flag, godef reads JSON-RPC 2.0 requests from standard
+input and writes a response for each to standard output, keeping
+loaded packages in memory between requests. The methods are
+"definition", "type" and "members", each taking parameters of
+the form
+
+	{"filename": "x.go", "offset": 123, "src": "...", "overlay": {"y.go": "..."}}
+
+where src and overlay are optional; "members" also accepts
+"all": true to include unexported members.
+
+For scripted use without JSON-RPC, the -batch flag answers one
+query for each line of standard input, printing each result as
+for a single query. A line is either file:offset, with the offset
+counted in the units of -offset-encoding as for -o, or a JSON object
+holding the parameters above; packages are loaded once and shared
+between queries:
+
+	godef -batch -json < queries
+
+Queries on different directories are answered concurrently, by up
+to as many workers as the -jobs flag allows (the number of CPUs by
+default); results are printed in the order of the queries. The
+index command takes a -jobs flag too, limiting the number of files
+it parses at once.
+
+The -all-idents flag resolves every identifier in the named file
+in one pass, printing a JSON object for each on its own line with
+the identifier's name, position and byte offset, and the position
+of its definition (and its type, with -t).
+
+The index command walks the packages of the current module
+(./... by default) and records every declaration in an index
+stored under the user's cache directory. The symbol command then
+looks up declarations by name in the index, without loading any
+packages:
+
+	godef index
+	godef symbol http.Client.Do
+
+Each part of the name may be a glob pattern, as for path.Match. The
+-kind flag restricts the results to the given comma-separated kinds
+of declaration (func, method, type, field, var and const), and the
+-scope flag to packages matching the given comma-separated patterns,
+as the go command matches them, with relative patterns taken from
+the current directory:
+
+	godef symbol -scope=./... -kind=type,func 'http.*Handler*'
+
+Files changed since the index was built are re-indexed as needed,
+as are files added since, if their names and build constraints
+match the current GOOS and GOARCH.
+
+The index and tags commands leave out the files and directories that
+match the glob patterns given by the -exclude flag, which may be
+repeated or given a comma-separated list. A pattern without a slash,
+such as mocks or *_string.go, matches any element of a file's path;
+one with slashes, such as internal/gen, matches as many consecutive
+elements. The -exclude-common flag adds the conventional patterns
+testdata, node_modules and *.gen.go. Files added to the module
+later are left out by the same patterns.
+
+The lsif command writes an LSIF dump of the definitions, hover
+information and references in the given packages (./... by default)
+for consumption by code hosting platforms:
+
+	godef lsif -o dump.lsif ./...
+
+The scip command writes the same information as a SCIP index,
+by default to the file index.scip.
+
+The tags command writes a tags file, compatible with universal-ctags,
+for the given packages (./... by default):
+
+	godef tags -o tags ./...
+
+With the -e flag, it writes an Emacs TAGS file instead.
+The cscope command similarly writes a cscope cross-reference
+database, cscope.out, recording both definitions and references.
+
+The xref command prints, for each package-level symbol defined or
+used by the given packages (the current directory by default), its
+definition followed by every reference to it, each with the name of
+the enclosing top-level declaration. With -json, each symbol is
+printed as a JSON object on its own line:
+
+	godef xref -json ./internal/...
+
+The unused command lists the exported functions, types, variables
+and constants declared in the given packages (./... by default) that
+nothing in them, or their tests, refers to outside the declaration
+itself, as candidates for removal from an API. Declarations in main
+packages, test files and generated files are left out, as are fields.
+Methods, which may be called only through interfaces, are listed too
+with -methods. With -json, each is printed as by xref -json.
+
+The doc command prints the documentation of a declaration, named as
+a symbol such as net/http.Client.Do or given by a file address such
+as x.go:12:6, as go doc and pkg.go.dev show it: the declaration,
+without any function body, followed by its comment and by the
+examples of it in its package's tests. Given a package, it prints
+the package's comment and examples instead:
+
+	godef doc strings.Cut
+
+The imports command lists the imports of the given file, each
+followed by the positions at which the file uses the package, with
+the qualified identifier there, such as fmt.Println, as found by
+type checking the file's package. An import that is never used, and
+is neither a blank import nor the import of "C", is marked unused.
+With -json, each import is printed as a JSON object on its own line.
+
+The graph command prints the part of the current module's import
+graph around the given package (the current directory's by default):
+the packages of the module it imports, directly or not, and those
+that import it, answering "who imports this". Each import is printed
+as a line holding the importing and imported paths, as by go mod
+graph; with -json, each package is printed as a JSON object on its
+own line with its imports and importers, and with -dot, the graph is
+printed for Graphviz:
+
+	godef graph -dot ./internal/store | dot -Tsvg >store.svg
 
 Example:
 
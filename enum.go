@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"github.com/rogpeppe/godef/godef"
+	"golang.org/x/tools/go/packages"
+)
+
+var constsFlag = flag.Bool("consts", false, "list the constants of the named type at the offset, or of the constant's type, across the current module")
+
+// constsDefinition returns the definition of the named type at the
+// given offset of filename, or of the type of the constant there,
+// with the constants of that type as its members: those declared
+// in its own package, and then those in the packages matching ./...
+// in dir, each in order of declaration.
+func constsDefinition(ctx context.Context, dir, filename string, src []byte, overlay map[string][]byte, offset int) (*definition, error) {
+	res, err := typedObject(ctx, dir, filename, src, overlay, offset)
+	if err != nil {
+		return nil, err
+	}
+	tn, ok := res.Object.(*types.TypeName)
+	if c, isConst := res.Object.(*types.Const); isConst {
+		if named, isNamed := c.Type().(*types.Named); isNamed {
+			tn, ok = named.Obj(), true
+		}
+	}
+	if !ok || tn.Pkg() == nil {
+		return nil, &queryError{exitNotFound, fmt.Errorf("%s is not a named type or a constant of one", res.Object.Name())}
+	}
+	def := describe(res.Fset, tn, resolution{engine: godef.EnginePackages}, true, false, false)
+	seen := make(map[string]bool)
+	var consts []member
+	add := func(pkg *types.Package, fset *token.FileSet) {
+		scope := pkg.Scope()
+		for _, name := range scope.Names() {
+			c, ok := scope.Lookup(name).(*types.Const)
+			if !ok || !isTypeName(c.Type(), tn) {
+				continue
+			}
+			pos := godef.Position(fset, c)
+			if seen[pos.String()] {
+				continue
+			}
+			seen[pos.String()] = true
+			consts = append(consts, member{Type: godef.TypeString(c, qualifier), Pos: pos})
+		}
+	}
+	add(tn.Pkg(), res.Fset)
+	sortMembers(consts)
+	own := len(consts)
+	// Only package-level declarations are needed, and they can
+	// come from export data; the packages are loaded from source
+	// only if that fails.
+	cfg := &packages.Config{
+		Context: ctx,
+		Dir:     dir,
+		Mode:    packages.LoadTypes,
+	}
+	lpkgs, err := packages.Load(cfg, "./...")
+	if err == nil && anyErrors(lpkgs) && ctx.Err() == nil {
+		cfg.Mode = packages.LoadSyntax
+		lpkgs, err = packages.Load(cfg, "./...")
+	}
+	if err != nil {
+		logf(levelWarn, "cannot load the packages of the current module: %v", err)
+	}
+	for _, pkg := range lpkgs {
+		if _, ok := pkg.Imports[tn.Pkg().Path()]; ok && pkg.Types != nil {
+			add(pkg.Types, pkg.Fset)
+		}
+	}
+	sortMembers(consts[own:])
+	def.Members = consts
+	return def, nil
+}
+
+// anyErrors reports whether any of pkgs has errors.
+func anyErrors(pkgs []*packages.Package) bool {
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// sortMembers sorts ms by position.
+func sortMembers(ms []member) {
+	sort.SliceStable(ms, func(i, j int) bool {
+		pi, pj := ms[i].Pos, ms[j].Pos
+		if pi.Filename != pj.Filename {
+			return pi.Filename < pj.Filename
+		}
+		return pi.Offset < pj.Offset
+	})
+}
+
+// isTypeName reports whether t is the named type declared by tn,
+// which may come from another load of its package.
+func isTypeName(t types.Type, tn *types.TypeName) bool {
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return false
+	}
+	return named.Obj().Name() == tn.Name() && named.Obj().Pkg().Path() == tn.Pkg().Path()
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConstsDefinition(t *testing.T) {
+	xsrc := "package x\n\ntype Kind int\n\nconst (\n\tA Kind = iota\n\tB\n\tn = 2\n)\n"
+	files := map[string]string{
+		"go.mod": "module x\n",
+		"x.go":   xsrc,
+		"y/y.go": "package y\n\nimport \"x\"\n\nconst C x.Kind = 10\n",
+	}
+	dir := writeTree(t, files)
+	for _, at := range []string{"Kind int", "B\n"} {
+		def, err := constsDefinition(context.Background(), dir, filepath.Join(dir, "x.go"), nil, nil, strings.Index(xsrc, at))
+		if err != nil {
+			t.Fatalf("at %q: %v", at, err)
+		}
+		var got []string
+		for _, m := range def.Members {
+			got = append(got, m.Type)
+		}
+		if want := "const A Kind 0; const B Kind 1; const C Kind 10"; strings.Join(got, "; ") != want {
+			t.Errorf("at %q: got %q, want %q", at, strings.Join(got, "; "), want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/rogpeppe/godef/godef"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+var errorsFlag = flag.Bool("errors", false, "list where the error variable or error-returning function at the offset is compared, wrapped and returned, across the current module")
+
+// errorFlowDefinition returns the definition of the error variable,
+// such as a sentinel error, or function returning an error at the
+// given offset of filename, with the places in the packages matching
+// ./... in dir, including their tests, where the error it holds or
+// returns flows as members: comparisons with errors.Is, errors.As or
+// ==, wraps with %w by fmt.Errorf, and return statements.
+func errorFlowDefinition(ctx context.Context, dir, filename string, src []byte, overlay map[string][]byte, offset int) (*definition, error) {
+	res, err := typedObject(ctx, dir, filename, src, overlay, offset)
+	if err != nil {
+		return nil, err
+	}
+	if !isErrorObject(res.Object) {
+		return nil, &queryError{exitNotFound, fmt.Errorf("%s is not an error variable or a function returning an error", res.Object.Name())}
+	}
+	def := describe(res.Fset, res.Object, resolution{engine: godef.EnginePackages}, true, false, false)
+	idx, err := collectRefs(ctx, dir, []string{"./..."}, true)
+	if err != nil {
+		return nil, &queryError{exitLoad, err}
+	}
+	target := godef.Position(res.Fset, res.Object)
+	fset := token.NewFileSet()
+	files := make(map[string]*ast.File)
+	for _, sym := range idx.Symbols {
+		if sym.Name != res.Object.Name() || sym.Pos.String() != target.String() {
+			continue
+		}
+		for _, ref := range sym.Refs {
+			f, ok := files[ref.Pos.Filename]
+			if !ok {
+				// The index keeps positions only, so the
+				// syntax around each reference is parsed
+				// again.
+				f, _ = parser.ParseFile(fset, ref.Pos.Filename, nil, 0)
+				files[ref.Pos.Filename] = f
+			}
+			if f == nil {
+				continue
+			}
+			tf := fset.File(f.Pos())
+			if ref.Pos.Offset >= tf.Size() {
+				continue
+			}
+			pos := tf.Pos(ref.Pos.Offset)
+			how := errorFlow(f, pos)
+			if how == "" {
+				continue
+			}
+			if ref.Scope != "" {
+				how = ref.Scope + ": " + how
+			}
+			def.Members = append(def.Members, member{Type: how, Pos: ref.Pos})
+		}
+	}
+	sortMembers(def.Members)
+	return def, nil
+}
+
+// isErrorObject reports whether obj is a variable whose type
+// implements error, or a function with such a result.
+func isErrorObject(obj types.Object) bool {
+	errorType := types.Universe.Lookup("error").Type().Underlying().(*types.Interface)
+	switch obj := obj.(type) {
+	case *types.Var:
+		return !obj.IsField() && types.Implements(obj.Type(), errorType)
+	case *types.Func:
+		results := obj.Type().(*types.Signature).Results()
+		for i := 0; i < results.Len(); i++ {
+			if types.Implements(results.At(i).Type(), errorType) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// errorFlow describes how the error denoted by the identifier at pos
+// in f flows: "errors.Is" or "errors.As", or their xerrors forms, for
+// a comparison by one of those functions, "==" or "!=" for a direct
+// comparison, "%w" for a wrap by fmt.Errorf, or "return" for a return
+// statement. It returns the empty string if the error goes elsewhere,
+// or its identity is lost, as when it is formatted without %w.
+func errorFlow(f *ast.File, pos token.Pos) string {
+	nodes, _ := astutil.PathEnclosingInterval(f, pos, pos)
+	for i, n := range nodes {
+		switch n := n.(type) {
+		case *ast.FuncLit, *ast.FuncDecl, *ast.BlockStmt:
+			return ""
+		case *ast.ReturnStmt:
+			return "return"
+		case *ast.BinaryExpr:
+			if n.Op == token.EQL || n.Op == token.NEQ {
+				return n.Op.String()
+			}
+		case *ast.CallExpr:
+			switch name := calledFunc(f, n); name {
+			case "errors.Is", "errors.As", "xerrors.Is", "xerrors.As":
+				return name
+			case "fmt.Errorf", "xerrors.Errorf":
+				arg := -1
+				for j, a := range n.Args {
+					if i > 0 && a == nodes[i-1] {
+						arg = j
+					}
+				}
+				if arg < 1 {
+					return ""
+				}
+				if lit, ok := n.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+					if format, err := strconv.Unquote(lit.Value); err == nil && formatVerb(format, arg-1) == 'w' {
+						return "%w"
+					}
+				}
+				return ""
+			}
+		}
+	}
+	return ""
+}
+
+// calledFunc returns the name, as pkg.Name, of the function in an
+// errors or fmt package called by call, or the empty string if it
+// calls none.
+func calledFunc(f *ast.File, call *ast.CallExpr) string {
+	sel, ok := astutil.Unparen(call.Fun).(*ast.SelectorExpr)
+	if !ok {
+		return ""
+	}
+	x, ok := sel.X.(*ast.Ident)
+	if !ok || x.Obj != nil {
+		return ""
+	}
+	for _, spec := range f.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := path.Base(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if name != x.Name {
+			continue
+		}
+		switch importPath {
+		case "errors", "fmt":
+			return importPath + "." + sel.Sel.Name
+		case "golang.org/x/xerrors":
+			return "xerrors." + sel.Sel.Name
+		}
+	}
+	return ""
+}
+
+// formatVerb returns the verb that formats the argument with the
+// given index in a Printf-style format, or 0 if there is none, or
+// the format uses explicit argument indexes.
+func formatVerb(format string, arg int) rune {
+	n := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		// Skip flags, width and precision, counting any * among
+		// them as an argument of their own.
+		for i++; i < len(format) && strings.IndexByte("+-# 0123456789.*[]", format[i]) >= 0; i++ {
+			switch format[i] {
+			case '[':
+				return 0
+			case '*':
+				n++
+			}
+		}
+		if i == len(format) || format[i] == '%' {
+			continue
+		}
+		if n == arg {
+			return rune(format[i])
+		}
+		n++
+	}
+	return 0
+}
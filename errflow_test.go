@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestErrorFlowDefinition(t *testing.T) {
+	xsrc := `package x
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrGone = errors.New("gone")
+
+func Get(ok bool) error {
+	if !ok {
+		return ErrGone
+	}
+	return nil
+}
+
+func Wrap() error {
+	return fmt.Errorf("%s: %w", "get", ErrGone)
+}
+
+func Flatten() error {
+	return fmt.Errorf("%w: %v", errors.New("other"), ErrGone)
+}
+
+func Check(err error) bool {
+	return errors.Is(err, ErrGone) || err == ErrGone
+}
+
+func Log() {
+	fmt.Println(ErrGone)
+}
+`
+	files := map[string]string{
+		"go.mod": "module x\n",
+		"x.go":   xsrc,
+	}
+	dir := writeTree(t, files)
+	def, err := errorFlowDefinition(context.Background(), dir, filepath.Join(dir, "x.go"), nil, nil, strings.Index(xsrc, "ErrGone"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range def.Members {
+		got = append(got, m.Type)
+	}
+	want := []string{
+		"Get: return",
+		"Wrap: %w",
+		"Check: errors.Is",
+		"Check: ==",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got error flow\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if _, err := errorFlowDefinition(context.Background(), dir, filepath.Join(dir, "x.go"), nil, nil, strings.Index(xsrc, "Log")); err == nil {
+		t.Errorf("got no error for a function returning no error")
+	}
+}
+
+func TestFormatVerb(t *testing.T) {
+	tests := []struct {
+		format string
+		arg    int
+		want   rune
+	}{
+		{"%w", 0, 'w'},
+		{"%s: %w", 1, 'w'},
+		{"%%%v %w", 1, 'w'},
+		{"%*d %w", 2, 'w'},
+		{"%-10s %+v", 1, 'v'},
+		{"%[1]w", 0, 0},
+		{"%v", 1, 0},
+	}
+	for _, test := range tests {
+		if got := formatVerb(test.format, test.arg); got != test.want {
+			t.Errorf("formatVerb(%q, %d) = %q, want %q", test.format, test.arg, got, test.want)
+		}
+	}
+}
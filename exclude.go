@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/rogpeppe/godef/godef"
+)
+
+var excludeFlag globList
+var excludeCommonFlag = flag.Bool("exclude-common", false, "also exclude testdata and node_modules directories and *.gen.go files")
+
+func init() {
+	flag.Var(&excludeFlag, "exclude", "ignore files and directories matching this `glob` when parsing packages directly (may be repeated)")
+}
+
+// globList is a list of glob patterns, set by a flag that may be
+// repeated or given a comma-separated list.
+type globList []string
+
+func (l *globList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *globList) Set(v string) error {
+	for _, pattern := range strings.Split(v, ",") {
+		if pattern != "" {
+			*l = append(*l, pattern)
+		}
+	}
+	return nil
+}
+
+// excludePatterns returns the patterns of the files to ignore,
+// as set by the -exclude and -exclude-common flags.
+func excludePatterns() []string {
+	patterns := append([]string(nil), excludeFlag...)
+	if *excludeCommonFlag {
+		patterns = append(patterns, godef.CommonExcludes...)
+	}
+	return patterns
+}
+
+// addExcludeFlags defines the -exclude and -exclude-common flags
+// of a subcommand in fs.
+func addExcludeFlags(fs *flag.FlagSet) {
+	fs.Var(&excludeFlag, "exclude", "leave out files and directories matching this `glob` (may be repeated)")
+	fs.BoolVar(excludeCommonFlag, "exclude-common", false, "also leave out testdata and node_modules directories and *.gen.go files")
+}
@@ -0,0 +1,43 @@
+package main
+
+import "github.com/rogpeppe/godef/godef"
+
+// Exit statuses. Editors can use these to tell why a query failed
+// without parsing the error message.
+const (
+	exitFailure  = 1 // any other failure
+	exitUsage    = 2 // invalid command line
+	exitNoIdent  = 3 // no identifier at the given position
+	exitNotFound = 4 // the identifier's definition could not be found
+	exitLoad     = 5 // packages could not be loaded or parsed, or the query timed out
+)
+
+// queryError is an error that determines godef's exit status.
+type queryError struct {
+	code int
+	err  error
+}
+
+func (e *queryError) Error() string {
+	return e.err.Error()
+}
+
+// exitCode returns the exit status to use on failing with err.
+func exitCode(err error) int {
+	switch err := err.(type) {
+	case *queryError:
+		return err.code
+	case *godef.Error:
+		switch err.Kind {
+		case godef.ErrorNoIdent:
+			return exitNoIdent
+		case godef.ErrorNotFound:
+			return exitNotFound
+		case godef.ErrorLoad:
+			return exitLoad
+		}
+	case *timeoutError:
+		return exitLoad
+	}
+	return exitFailure
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rogpeppe/godef/godef"
+)
+
+func TestExitCode(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want int
+	}{
+		{errors.New("anything"), exitFailure},
+		{&queryError{exitUsage, errors.New("bad flag")}, exitUsage},
+		{&godef.Error{Kind: godef.ErrorNoIdent, Err: errors.New("no identifier")}, exitNoIdent},
+		{&godef.Error{Kind: godef.ErrorNotFound, Err: errors.New("not found")}, exitNotFound},
+		{&godef.Error{Kind: godef.ErrorLoad, Err: errors.New("cannot load")}, exitLoad},
+		{&timeoutError{time.Second}, exitLoad},
+	} {
+		if got := exitCode(test.err); got != test.want {
+			t.Errorf("exitCode(%#v) = %d, want %d", test.err, got, test.want)
+		}
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	src := "package x\n\n// F is used by v.\nfunc F() {}\n\nvar v = F\n\nvar w = undefined\n"
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module x\n",
+		"x.go":   src,
+	})
+	for _, test := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"-f", "x.go", "-o", fmt.Sprint(strings.Index(src, "F\n"))}, 0},
+		{[]string{"-f", "x.go", "-plumb", "-o", "0"}, exitUsage},
+		{[]string{"-f", "x.go"}, exitUsage},
+		{[]string{"-strict", "-f", "x.go", "-o", fmt.Sprint(strings.Index(src, "is used"))}, exitNoIdent},
+		{[]string{"-f", "x.go", "-line", "99"}, exitNoIdent},
+		{[]string{"-strict", "-f", "x.go", "-o", fmt.Sprint(strings.Index(src, "undefined"))}, exitNotFound},
+		{[]string{"-f", "missing.go", "-line", "1"}, exitLoad},
+	} {
+		_, stderr, code := runGodef(t, dir, "", nil, test.args...)
+		if code != test.want {
+			t.Errorf("godef %s: got exit status %d, want %d; stderr: %s", strings.Join(test.args, " "), code, test.want, stderr)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// checkFormatFlag checks the value of the -format flag.
+func checkFormatFlag() error {
+	switch *formatFlag {
+	case "", "kakoune", "helix":
+	default:
+		return &queryError{exitUsage, fmt.Errorf("unknown -format %q (want kakoune or helix)", *formatFlag)}
+	}
+	if *formatFlag != "" && *jsonFlag {
+		return &queryError{exitUsage, fmt.Errorf("-format and -json cannot be used together")}
+	}
+	return nil
+}
+
+// doneKakoune writes def to w as Kakoune commands, for use as
+//
+//	evaluate-commands %sh{ godef -format=kakoune ... }
+//
+// The first opens the definition; Kakoune columns count bytes,
+// as godef's do. With -t, a second shows the type and members
+// in an info box.
+func doneKakoune(w io.Writer, def *definition) error {
+	fmt.Fprintf(w, "edit -existing %s %d %d\n", kakQuote(outputName(def.Pos.Filename)), def.Pos.Line, def.Pos.Column)
+	if !*tflag {
+		return nil
+	}
+	var buf bytes.Buffer
+	writeType(&buf, def, encodingBytes, false)
+	fmt.Fprintf(w, "info -title godef %s\n", kakQuote(strings.TrimSuffix(buf.String(), "\n")))
+	return nil
+}
+
+// kakQuote quotes s as a single Kakoune word.
+func kakQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
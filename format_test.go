@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"go/token"
+	"testing"
+)
+
+func TestDoneKakoune(t *testing.T) {
+	defer func(t bool) { *tflag = t }(*tflag)
+	def := &definition{
+		Pos:  token.Position{Filename: "/src/it's.go", Line: 3, Column: 7},
+		Type: "type T struct{}",
+	}
+	for _, test := range []struct {
+		t    bool
+		want string
+	}{
+		{false, "edit -existing '/src/it''s.go' 3 7\n"},
+		{true, "edit -existing '/src/it''s.go' 3 7\ninfo -title godef 'type T struct{}'\n"},
+	} {
+		*tflag = test.t
+		var buf bytes.Buffer
+		if err := doneKakoune(&buf, def); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("with -t=%v got %q, want %q", test.t, got, test.want)
+		}
+	}
+}
+
+func TestOutputEncoding(t *testing.T) {
+	defer func(f, e string) { *formatFlag, *encodingFlag = f, e }(*formatFlag, *encodingFlag)
+	*encodingFlag = encodingUTF16
+	*formatFlag = "helix"
+	if got := outputEncoding(); got != encodingRunes {
+		t.Errorf("got encoding %q for helix, want %q", got, encodingRunes)
+	}
+	*formatFlag = ""
+	if got := outputEncoding(); got != encodingUTF16 {
+		t.Errorf("got encoding %q after helix, want %q", got, encodingUTF16)
+	}
+}
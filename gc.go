@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	debugpkg "runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+)
+
+// defaultGCPercent is the garbage collection target used unless
+// GOGC or -gcpercent says otherwise. Queries are short-lived and
+// allocate heavily while type checking, so collecting rarely
+// trades memory for speed.
+const defaultGCPercent = 1600
+
+var gcPercentFlag = flag.Int("gcpercent", defaultGCPercent, "garbage collection target percentage, as for GOGC (-1 disables collection)")
+var memLimitFlag = flag.String("memlimit", "", "soft memory `limit`, such as 4GiB, as for GOMEMLIMIT")
+
+// memLimit holds the limit set by -memlimit in bytes,
+// or zero if there is none.
+var memLimit int64
+
+// setGCDefault sets the default garbage collection target,
+// unless $GOGC is set.
+func setGCDefault() {
+	if os.Getenv("GOGC") == "" {
+		debugpkg.SetGCPercent(defaultGCPercent)
+	}
+}
+
+// setGCFlags applies the -gcpercent and -memlimit flags.
+// The -gcpercent flag takes precedence over $GOGC only when
+// it is given explicitly.
+func setGCFlags() error {
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "gcpercent" {
+			debugpkg.SetGCPercent(*gcPercentFlag)
+		}
+	})
+	if *memLimitFlag == "" {
+		return nil
+	}
+	limit, err := parseSize(*memLimitFlag)
+	if err != nil {
+		return &queryError{exitUsage, fmt.Errorf("invalid -memlimit value: %v", err)}
+	}
+	if err := setMemoryLimit(limit); err != nil {
+		return err
+	}
+	memLimit = limit
+	return nil
+}
+
+// nearMemLimit reports whether the memory used by godef is
+// within a tenth of the -memlimit, so that it should give up
+// memory it can do without rather than risk being killed.
+func nearMemLimit() bool {
+	return memLimit > 0 && memoryUse() > uint64(memLimit)/10*9
+}
+
+// memoryUse returns the memory used by the Go runtime,
+// as counted against its memory limit.
+func memoryUse() uint64 {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
+
+// parseSize parses a size in bytes in the form accepted by
+// GOMEMLIMIT: a number with an optional unit suffix of B,
+// KiB, MiB, GiB or TiB.
+func parseSize(s string) (int64, error) {
+	n := strings.TrimRight(s, "BKMGTi")
+	mult := int64(1)
+	switch s[len(n):] {
+	case "", "B":
+	case "KiB":
+		mult = 1 << 10
+	case "MiB":
+		mult = 1 << 20
+	case "GiB":
+		mult = 1 << 30
+	case "TiB":
+		mult = 1 << 40
+	default:
+		return 0, fmt.Errorf("unknown unit in %q (want B, KiB, MiB, GiB or TiB)", s)
+	}
+	v, err := strconv.ParseInt(n, 10, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("bad size %q", s)
+	}
+	if v > (1<<63-1)/mult {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return v * mult, nil
+}
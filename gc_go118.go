@@ -0,0 +1,12 @@
+//go:build !go1.19
+// +build !go1.19
+
+package main
+
+import "fmt"
+
+// setMemoryLimit reports that memory limits are not supported,
+// as they need Go 1.19 or later.
+func setMemoryLimit(limit int64) error {
+	return fmt.Errorf("-memlimit requires godef to be built with Go 1.19 or later")
+}
@@ -0,0 +1,12 @@
+//go:build go1.19
+// +build go1.19
+
+package main
+
+import debugpkg "runtime/debug"
+
+// setMemoryLimit sets the runtime's soft memory limit.
+func setMemoryLimit(limit int64) error {
+	debugpkg.SetMemoryLimit(limit)
+	return nil
+}
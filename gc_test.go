@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	for _, test := range []struct {
+		s    string
+		want int64
+		ok   bool
+	}{
+		{"1024", 1024, true},
+		{"512B", 512, true},
+		{"4KiB", 4 << 10, true},
+		{"3MiB", 3 << 20, true},
+		{"4GiB", 4 << 30, true},
+		{"1TiB", 1 << 40, true},
+		{"4GB", 0, false},
+		{"GiB", 0, false},
+		{"-1", 0, false},
+		{"x", 0, false},
+		{"9999999999TiB", 0, false},
+	} {
+		got, err := parseSize(test.s)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d, ok %v", test.s, got, err, test.want, test.ok)
+		}
+	}
+}
@@ -2,5 +2,7 @@ module github.com/rogpeppe/godef
 
 require (
 	9fans.net/go v0.0.0-20150709035532-65b8cf069318
+	github.com/fsnotify/fsnotify v1.4.9
+	golang.org/x/sys v0.9.0 // indirect
 	golang.org/x/tools v0.0.0-20181121193951-91f80e683c10
 )
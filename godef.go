@@ -1,40 +1,64 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"go/ast"
 	"go/parser"
 	"go/token"
 	"go/types"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
-	debugpkg "runtime/debug"
 	"runtime/pprof"
 	"runtime/trace"
 	"sort"
 	"strings"
+	"time"
 
-	"golang.org/x/tools/go/ast/astutil"
+	"github.com/rogpeppe/godef/godef"
 	"golang.org/x/tools/go/packages"
-	"golang.org/x/tools/go/types/typeutil"
 )
 
+var chdirFlag = flag.String("C", "", "change to `dir` before doing anything else (must be the first flag)")
 var readStdin = flag.Bool("i", false, "read file from stdin")
-var offset = flag.Int("o", -1, "file offset of identifier in stdin")
+var offset = flag.Int("o", -1, "offset of identifier in the -f file, or in stdin with -i, in units of -offset-encoding (see also -line, -col and -addr)")
+var lineFlag = flag.Int("line", 0, "line of identifier, instead of -o")
+var colFlag = flag.Int("col", 1, "column of identifier on the -line line")
+var addrFlag = flag.String("addr", "", "sam-style address of identifier, such as 120.5 or /func Foo/")
+var encodingFlag = flag.String("offset-encoding", "bytes", "units of -o, -col and output columns: bytes, runes or utf16")
 var debug = flag.Bool("debug", false, "debug mode")
 var tflag = flag.Bool("t", false, "print type information")
 var aflag = flag.Bool("a", false, "print public type and member information")
 var Aflag = flag.Bool("A", false, "print all type and members information")
 var fflag = flag.String("f", "", "Go source filename")
 var acmeFlag = flag.Bool("acme", false, "use current acme window")
+var winidFlag = flag.Int("winid", 0, "use the acme window with this id rather than $winid (implies -acme)")
+var plumbFlag = flag.Bool("plumb", false, "with -acme, send the definition to the plumber rather than printing it")
 var jsonFlag = flag.Bool("json", false, "output location in JSON format (-t flag is ignored)")
+var formatFlag = flag.String("format", "", "output in a form suited to an editor: kakoune or helix")
+var daemonFlag = flag.Bool("daemon", false, "run as a daemon holding loaded packages in memory")
+var remoteFlag = flag.String("remote", "", "forward the query to the daemon at this address (\"auto\" for the default)")
+var listenFlag = flag.String("listen", "auto", "address for -daemon to listen on (unix:/path or tcp:host:port)")
+var rpcFlag = flag.Bool("rpc", false, "answer JSON-RPC requests from stdin on stdout")
+var cacheFlag = flag.Bool("cache", false, "cache results on disk between invocations")
+var strictFlag = flag.Bool("strict", false, "fail rather than fall back to syntax-only resolution")
+var whyFlag = flag.Bool("why", false, "explain on stderr how the identifier was resolved")
+var batchFlag = flag.Bool("batch", false, "answer a file:offset query for each line of stdin")
+var jobsFlag = flag.Int("jobs", runtime.NumCPU(), "maximum number of packages to process concurrently in -batch and index modes")
+var allIdentsFlag = flag.String("all-idents", "", "print the definition of every identifier in this file as NDJSON")
+var timeoutFlag = flag.Duration("timeout", 0, "give up on a query after this long (0 for no limit)")
+var wordsFlag = flag.Bool("words", false, "in a comment or string literal, resolve the word at the offset as an expression")
+var guessFlag = flag.Bool("guess", false, "if nothing resolves the identifier, list the declarations of its name as guesses")
+var candidatesFlag = flag.Bool("candidates", false, "list every declaration the identifier might refer to in other builds, ranked")
+var variantsFlag = flag.Bool("variants", false, "list the declaration's variants for every build configuration, with their build constraints")
+var preferHandwrittenFlag = flag.Bool("prefer-handwritten", false, "rank candidates in generated files after those in hand-written ones")
+var noExecFlag = flag.Bool("no-exec", false, "never run other programs, such as the go command, guessing where packages are instead")
 
 var cpuprofile = flag.String("cpuprofile", "", "write CPU profile to this file")
 var memprofile = flag.String("memprofile", "", "write memory profile to this file")
@@ -43,23 +67,145 @@ var traceFlag = flag.String("trace", "", "write trace log to this file")
 func main() {
 	if err := run(context.Background()); err != nil {
 		fmt.Fprintf(os.Stderr, "godef: %v\n", err)
-		os.Exit(2)
+		reportCrash(err)
+		os.Exit(exitCode(err))
 	}
 }
 
+// command is a godef subcommand, invoked as "godef name [flags] [args]".
+type command struct {
+	name  string
+	short string
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands = []*command{
+	{"back", "go back to the previous location in the jump history", backMain},
+	{"bench", "compare the latency of the resolution engines", benchMain},
+	{"cscope", "write a cscope database for the module", cscopeMain},
+	{"doc", "print the documentation of a declaration or package", docMain},
+	{"forward", "go forward to the next location in the jump history", forwardMain},
+	{"graph", "print the import graph around a package of the module", graphMain},
+	{"imports", "list the imports of a file with their uses", importsMain},
+	{"index", "build a symbol index for the module", indexMain},
+	{"lsif", "export an LSIF dump of the module", lsifMain},
+	{"scip", "export a SCIP index of the module", scipMain},
+	{"serve", "run godef as a server", serveMain},
+	{"symbol", "look up declarations in the symbol index", symbolMain},
+	{"tags", "write a tags file for the module", tagsMain},
+	{"unused", "list exported declarations that nothing in the module refers to", unusedMain},
+	{"warm", "load the module's packages ahead of the first query", warmMain},
+	{"xref", "print the definitions and references of a package's symbols", xrefMain},
+}
+
+func init() {
+	// These commands refer to the list of commands,
+	// so they cannot appear in its initializer.
+	commands = append(commands,
+		&command{"capabilities", "describe the features of this godef as JSON", capabilitiesMain},
+		&command{"completion", "print a shell completion script", completionMain},
+	)
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].name < commands[j].name
+	})
+}
+
+func lookupCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
 func run(ctx context.Context) error {
-	debugpkg.SetGCPercent(1600)
+	setGCDefault()
+	args := os.Args[1:]
+	// As with the go command, -C must come first, so that it
+	// applies to subcommands too.
+	dir := ""
+	if len(args) > 0 && strings.HasPrefix(args[0], "-C=") {
+		dir, args = strings.TrimPrefix(args[0], "-C="), args[1:]
+	} else if len(args) > 1 && args[0] == "-C" {
+		dir, args = args[1], args[2:]
+	}
+	if dir != "" {
+		if err := os.Chdir(dir); err != nil {
+			return err
+		}
+	}
+	if len(args) > 0 {
+		if c := lookupCommand(args[0]); c != nil {
+			return c.run(ctx, args[1:])
+		}
+	}
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "usage: godef [flags] [expr]\n")
+		fmt.Fprintf(os.Stderr, "       godef command [flags] [args]\n")
 		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "commands:\n")
+		for _, c := range commands {
+			fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.short)
+		}
 	}
-	flag.Parse()
-	if flag.NArg() > 1 {
-		flag.Usage()
-		os.Exit(2)
+	// Flags in $GODEFFLAGS come first, so that those on
+	// the command line take precedence.
+	if env := strings.Fields(os.Getenv("GODEFFLAGS")); len(env) > 0 {
+		flag.CommandLine.Parse(env)
+		if flag.NArg() > 0 {
+			return &queryError{exitUsage, fmt.Errorf("GODEFFLAGS may contain only flags, not %q", flag.Arg(0))}
+		}
+	}
+	flag.CommandLine.Parse(args)
+	if *chdirFlag != "" {
+		return &queryError{exitUsage, fmt.Errorf("-C flag must be first on the command line")}
+	}
+	if err := checkSymlinksFlag(); err != nil {
+		return err
 	}
-	if flag.NArg() > 0 {
-		return fmt.Errorf("Expressions not yet supported `%v`", flag.Arg(0))
+	if err := checkHyperlinkFlag(); err != nil {
+		return err
+	}
+	if err := checkFormatFlag(); err != nil {
+		return err
+	}
+	if err := checkDebugASTFlag(); err != nil {
+		return err
+	}
+	if err := checkHugeFileFlag(); err != nil {
+		return err
+	}
+	if err := setGOROOT(); err != nil {
+		return err
+	}
+	if err := setGCFlags(); err != nil {
+		return err
+	}
+	if *winidFlag > 0 {
+		*acmeFlag = true
+	}
+	if *plumbFlag && !*acmeFlag {
+		return &queryError{exitUsage, fmt.Errorf("-plumb requires -acme")}
+	}
+	var qualified string
+	if flag.NArg() > 1 && (*fflag != "" || *acmeFlag) {
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+	if flag.NArg() == 1 {
+		if addr, ok := parseFileAddress(flag.Arg(0)); ok {
+			*fflag = addr.filename
+			if addr.line > 0 {
+				*lineFlag, *colFlag = addr.line, addr.col
+			} else {
+				*offset = addr.offset
+			}
+		} else if *fflag == "" && !*acmeFlag {
+			qualified = flag.Arg(0)
+		} else {
+			return fmt.Errorf("Expressions not yet supported `%v`", flag.Arg(0))
+		}
 	}
 	//TODO: types.Debug = *debug
 
@@ -88,6 +234,9 @@ func run(ctx context.Context) error {
 			trace.Stop()
 			log.Printf("To view the trace, run:\n$ go tool trace view %s", *traceFlag)
 		}()
+		var task *trace.Task
+		ctx, task = trace.NewTask(ctx, "godef")
+		defer task.End()
 	}
 
 	if *memprofile != "" {
@@ -105,12 +254,70 @@ func run(ctx context.Context) error {
 		}()
 	}
 
+	if *daemonFlag {
+		dir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		network, addr, err := daemonAddr(*listenFlag, dir)
+		if err != nil {
+			return err
+		}
+		root := moduleRoot(dir)
+		if root == "" {
+			root = dir
+		}
+		return serveDaemon(ctx, network, addr, root, excludePatterns())
+	}
+	if *rpcFlag {
+		return serveRPC(ctx, os.Stdin, os.Stdout)
+	}
+	if *timeoutFlag > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeoutFlag)
+		defer cancel()
+		// Type checking does not heed the context, so make sure that
+		// godef gives up even when stuck there, allowing a moment for
+		// the context to stop any go command first.
+		watchdog := time.AfterFunc(*timeoutFlag+100*time.Millisecond, func() {
+			fmt.Fprintf(os.Stderr, "godef: %v\n", &timeoutError{*timeoutFlag})
+			os.Exit(exitLoad)
+		})
+		defer watchdog.Stop()
+	}
+
 	*tflag = *tflag || *aflag || *Aflag
+	if *batchFlag {
+		return runBatch(ctx, os.Stdin, *jobsFlag)
+	}
+	if flag.NArg() > 1 {
+		return runQueries(ctx, flag.Args(), *jobsFlag, parseArgQuery)
+	}
+	if *allIdentsFlag != "" {
+		var src []byte
+		if *readStdin {
+			src, _ = ioutil.ReadAll(os.Stdin)
+		}
+		return allIdents(ctx, os.Stdout, *allIdentsFlag, src)
+	}
+	if qualified != "" {
+		def, err := answerSymbol(ctx, qualified)
+		if err != nil {
+			return err
+		}
+		return done(def)
+	}
 	searchpos := *offset
-	filename := *fflag
+	filename := pathMapFlag.toLocal(*fflag)
+	if filename != "" {
+		filename = godef.NormalizePath(filename)
+	}
 
 	var afile *acmeFile
 	var src []byte
+	var overlay map[string][]byte
+	stats := newQueryStats()
+	region := trace.StartRegion(ctx, "read input")
 
 	if *acmeFlag {
 		var err error
@@ -118,266 +325,418 @@ func run(ctx context.Context) error {
 			return fmt.Errorf("%v", err)
 		}
 		filename, src, searchpos = afile.name, afile.body, afile.offset
+		// Use the contents of other unsaved windows too, so that
+		// cross-file queries see the edits in progress.
+		if overlay, err = acmeDirtyFiles(); err != nil {
+			return err
+		}
+	} else if filename == "" && *readStdin {
+		src, _ = ioutil.ReadAll(os.Stdin)
+		var err error
+		if filename, err = stdinFilename(src); err != nil {
+			return err
+		}
 	} else if filename == "" {
-		// TODO if there's no filename, look in the current
-		// directory and do something plausible.
 		return fmt.Errorf("A filename must be specified")
 	} else if *readStdin {
 		src, _ = ioutil.ReadAll(os.Stdin)
 	}
+	if err := checkEncoding(*encodingFlag); err != nil {
+		return err
+	}
+	if !*acmeFlag && (*lineFlag > 0 || *addrFlag != "" || *encodingFlag != encodingBytes && searchpos >= 0) {
+		content := src
+		if content == nil {
+			var err error
+			if content, err = ioutil.ReadFile(filename); err != nil {
+				return &queryError{exitLoad, err}
+			}
+		}
+		var err error
+		if *addrFlag != "" {
+			searchpos, err = samAddress(content, *addrFlag)
+		} else if *lineFlag > 0 {
+			searchpos, err = lineColOffset(content, *lineFlag, *colFlag, *encodingFlag)
+		} else {
+			searchpos, err = byteOffset(content, searchpos, *encodingFlag)
+		}
+		if err != nil {
+			return &queryError{exitNoIdent, err}
+		}
+	}
+	region.End()
+	stats.phase("read", time.Since(stats.start))
+	if *debugASTFlag == "file" {
+		// The whole file is printed, so no offset is needed.
+		return debugAST(os.Stdout, filename, src, searchpos, *debugASTFlag)
+	}
 	if searchpos < 0 {
 		fmt.Fprintf(os.Stderr, "no expression or offset specified\n")
 		flag.Usage()
-		os.Exit(2)
+		os.Exit(exitUsage)
 	}
-	// Load, parse, and type-check the packages named on the command line.
-	cfg := &packages.Config{
-		Context: ctx,
-		Tests:   strings.HasSuffix(filename, "_test.go"),
+	if *debugASTFlag == "path" {
+		return debugAST(os.Stdout, filename, src, searchpos, *debugASTFlag)
 	}
-	fset, obj, err := godef(cfg, filename, src, searchpos)
-	if err != nil {
-		return err
+	if *constsFlag || *methodsFlag || *callsFlag || *errorsFlag {
+		dir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		list := constsDefinition
+		switch {
+		case *methodsFlag:
+			list = methodsDefinition
+		case *callsFlag:
+			list = callsDefinition
+		case *errorsFlag:
+			list = errorFlowDefinition
+		}
+		def, err := list(ctx, dir, filename, src, overlay, searchpos)
+		if err != nil {
+			return err
+		}
+		*tflag = true
+		return done(def)
+	}
+	var def *definition
+	var why []string
+	if filepath.Base(filename) == "go.mod" {
+		var err error
+		if def, err = goModDefinition(ctx, filename, src, searchpos); err != nil {
+			return err
+		}
+	} else if *remoteFlag != "" {
+		q, err := newQuery(filename, src, overlay, searchpos)
+		if err != nil {
+			return err
+		}
+		q.Timeout = *timeoutFlag
+		network, addr, err := daemonAddr(*remoteFlag, filepath.Dir(q.Filename))
+		if err != nil {
+			return err
+		}
+		if def, err = remoteQuery(network, addr, q); err != nil {
+			return err
+		}
+		why = []string{"the daemon does not report scopes"}
+	} else {
+		var key string
+		if *cacheFlag {
+			q, err := newQuery(filename, src, overlay, searchpos)
+			if err != nil {
+				return err
+			}
+			key = resultKey(ctx, q)
+			if !*whyFlag {
+				// A cached result does not record how it was found.
+				def = cachedResult(key)
+			}
+			if def != nil {
+				stats.CacheHits++
+			}
+		}
+		if def == nil {
+			// Load, parse, and type-check the packages named on the command line.
+			dir, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			res, err := queryDependency(ctx, godef.Options{
+				Config: &packages.Config{
+					Dir:     dir,
+					Overlay: overlay,
+				},
+				Filename:          filename,
+				Src:               src,
+				Offset:            searchpos,
+				Type:              *tflag,
+				Members:           *tflag && (*aflag || *Aflag),
+				AllMembers:        *Aflag,
+				Strict:            *strictFlag,
+				NoExec:            *noExecFlag,
+				Words:             *wordsFlag,
+				Guess:             *guessFlag,
+				Candidates:        *candidatesFlag,
+				Exclude:           excludePatterns(),
+				PreferHandwritten: *preferHandwrittenFlag,
+				Variants:          *variantsFlag,
+				Events:            stats.event,
+			})
+			stats.endFallback()
+			if err != nil {
+				if ctx.Err() == context.DeadlineExceeded {
+					return &timeoutError{*timeoutFlag}
+				}
+				return err
+			}
+			def = newDefinition(res)
+			if *whyFlag {
+				why = godef.Explain(res, filename)
+			}
+			if *cacheFlag && res.Package != nil {
+				cacheResult(key, def, res.Package)
+			}
+		}
+	}
+	if def.Engine == godef.EngineLayout && !*noExecFlag {
+		logf(levelWarn, "no go command: packages were found by guessing the layout of the source tree, so the definition may be wrong")
+	}
+	if def.Engine == godef.EngineGuess {
+		logf(levelWarn, "the identifier could not be resolved, so its definition was guessed from its name alone")
+	}
+	if *originalFlag && def.Engine != engineGoMod {
+		originalDefinition(ctx, def)
+	}
+	logf(levelInfo, "%v", resolution{engine: def.Engine, reason: def.Fallback})
+	if *whyFlag {
+		if *remoteFlag != "" {
+			why = append(why, resolution{engine: def.Engine, reason: def.Fallback}.String())
+		}
+		for _, w := range why {
+			fmt.Fprintf(os.Stderr, "why: %s\n", w)
+		}
+	}
+	if !*readStdin || *fflag != "" {
+		// Standard input has no location worth going back to.
+		if err := recordJump(filename, src, searchpos, def.Pos); err != nil {
+			logf(levelWarn, "cannot record jump: %v", err)
+		}
+	}
+	defer trace.StartRegion(ctx, "print").End()
+	if *statsFlag {
+		printStart := time.Now()
+		defer func() {
+			stats.phase("print", time.Since(printStart))
+			if err := stats.write(os.Stderr); err != nil {
+				logf(levelWarn, "cannot write statistics: %v", err)
+			}
+		}()
+	}
+	if *plumbFlag {
+		return plumbDef(def)
 	}
 	// print old source location to facilitate backtracking
 	if *acmeFlag {
 		fmt.Printf("\t%s:#%d\n", afile.name, afile.runeOffset)
 	}
 
-	return done(fset, obj, func(p *types.Package) string {
-		//TODO: this matches existing behaviour, but we can do better.
-		//The previous code had the following TODO in it that now belongs here
-		// TODO print path package when appropriate.
-		// Current issues with using p.n.Pkg:
-		//	- we should actually print the local package identifier
-		//	rather than the package path when possible.
-		//	- p.n.Pkg is non-empty even when
-		//	the type is not relative to the package.
-		return ""
-	})
+	return done(def)
 }
 
-func godef(cfg *packages.Config, filename string, src []byte, searchpos int) (*token.FileSet, types.Object, error) {
-	parser, result := parseFile(filename, searchpos)
-	// Load, parse, and type-check the packages named on the command line.
-	if src != nil {
-		cfg.Overlay = map[string][]byte{
-			filename: src,
-		}
-	}
-	cfg.Mode = packages.LoadSyntax
-	cfg.ParseFile = parser
-	lpkgs, err := packages.Load(cfg, "file="+filename)
+// newQuery returns a query for a daemon, with file names made
+// absolute so that they mean the same thing in the daemon.
+func newQuery(filename string, src []byte, overlay map[string][]byte, searchpos int) (*query, error) {
+	dir, err := os.Getwd()
 	if err != nil {
-		return nil, nil, err
-	}
-	if len(lpkgs) < 1 {
-		return nil, nil, fmt.Errorf("There must be at least one package that contains the file")
-	}
-	// get the node
-	var m match
-	select {
-	case m = <-result:
-	default:
-		return nil, nil, fmt.Errorf("no file found at search pos %d", searchpos)
-	}
-	if m.ident == nil {
-		return nil, nil, fmt.Errorf("Offset %d was not a valid identifier", searchpos)
-	}
-	obj := lpkgs[0].TypesInfo.ObjectOf(m.ident)
-	if obj == nil {
-		return nil, nil, fmt.Errorf("no object")
-	}
-	if m.wasEmbeddedField {
-		// the original position was on the embedded field declaration
-		// so we try to dig out the type and jump to that instead
-		if v, ok := obj.(*types.Var); ok {
-			if n, ok := v.Type().(*types.Named); ok {
-				obj = n.Obj()
-			}
+		return nil, err
+	}
+	q := &query{
+		Dir:               dir,
+		Filename:          abs(dir, filename),
+		Src:               src,
+		Offset:            searchpos,
+		Type:              *tflag,
+		Members:           *aflag || *Aflag,
+		AllMembers:        *Aflag,
+		Strict:            *strictFlag,
+		Words:             *wordsFlag,
+		Guess:             *guessFlag,
+		Candidates:        *candidatesFlag,
+		PreferHandwritten: *preferHandwrittenFlag,
+		Variants:          *variantsFlag,
+		Exclude:           excludePatterns(),
+	}
+	if len(overlay) > 0 {
+		q.Overlay = make(map[string][]byte)
+		for name, data := range overlay {
+			q.Overlay[abs(dir, name)] = data
 		}
 	}
-	return lpkgs[0].Fset, obj, nil
-}
-
-// match returns the ident plus any extra information needed
-type match struct {
-	ident            *ast.Ident
-	wasEmbeddedField bool
+	return q, nil
 }
 
-// parseFile returns a function that can be used as a Parser in packages.Config.
-// It replaces the contents of a file that matches filename with the src.
-// It also drops all function bodies that do not contain the searchpos.
-// It also modifies the filename to be the canonical form that will appear in the fileset.
-func parseFile(filename string, searchpos int) (func(*token.FileSet, string, []byte) (*ast.File, error), chan match) {
-	result := make(chan match, 1)
-	isInputFile := newFileCompare(filename)
-	return func(fset *token.FileSet, fname string, filedata []byte) (*ast.File, error) {
-		isInput := isInputFile(fname)
-		file, err := parser.ParseFile(fset, fname, filedata, 0)
-		if file == nil {
-			return nil, err
-		}
-		pos := token.Pos(-1)
-		if isInput {
-			tfile := fset.File(file.Pos())
-			if tfile == nil {
-				return file, fmt.Errorf("cursor %d is beyond end of file %s (%d)", searchpos, fname, file.End()-file.Pos())
-			}
-			if searchpos > tfile.Size() {
-				return file, fmt.Errorf("cursor %d is beyond end of file %s (%d)", searchpos, fname, tfile.Size())
-			}
-			pos = tfile.Pos(searchpos)
-			m, err := findMatch(file, pos)
-			if err != nil {
-				return nil, err
-			}
-			result <- m
-		}
-		trimAST(file, pos)
-		return file, err
-	}, result
+// typedObject resolves the identifier at the given offset of
+// filename, whose contents are src if not nil, with the other files
+// in overlay, by loading and type-checking its package from dir, as
+// queries that need the object's type information do.
+func typedObject(ctx context.Context, dir, filename string, src []byte, overlay map[string][]byte, offset int) (*godef.Result, error) {
+	res, err := godef.Query(ctx, godef.Options{
+		Config: &packages.Config{
+			Dir:     dir,
+			Overlay: overlay,
+		},
+		Filename: filename,
+		Src:      src,
+		Offset:   offset,
+		Strict:   true,
+		NoExec:   *noExecFlag,
+		Words:    *wordsFlag,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
-func newFileCompare(filename string) func(string) bool {
-	fstat, fstatErr := os.Stat(filename)
-	return func(compare string) bool {
-		if filename == compare {
-			return true
-		}
-		if fstatErr != nil {
-			return false
-		}
-		if s, err := os.Stat(compare); err == nil {
-			return os.SameFile(fstat, s)
-		}
-		return false
+func abs(dir, filename string) string {
+	if filepath.IsAbs(filename) {
+		return filename
 	}
+	return filepath.Join(dir, filename)
 }
 
-func findMatch(f *ast.File, pos token.Pos) (match, error) {
-	m, err := checkMatch(f, pos)
+// stdinFilename returns the name under which source read from
+// standard input without a -f flag is treated: a file in the
+// current directory, so that the source is loaded as part of the
+// package there, named as a test file if src belongs to an
+// external test package.
+func stdinFilename(src []byte) (string, error) {
+	dir, err := os.Getwd()
 	if err != nil {
-		return match{}, err
+		return "", err
 	}
-	if m.ident != nil {
-		return m, nil
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.PackageClauseOnly)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse package clause of standard input: %v", err)
 	}
-	// If the position is not an identifier but immediately follows
-	// an identifier or selector period (as is common when
-	// requesting a completion), use the path to the preceding node.
-	return checkMatch(f, pos-1)
+	name := "godef-stdin.go"
+	if strings.HasSuffix(f.Name.Name, "_test") {
+		name = "godef-stdin_test.go"
+	}
+	return filepath.Join(dir, name), nil
 }
 
-// checkMatch checks a single position for a potential identifier.
-func checkMatch(f *ast.File, pos token.Pos) (match, error) {
-	path, _ := astutil.PathEnclosingInterval(f, pos, pos)
-	result := match{}
-	if path == nil {
-		return result, fmt.Errorf("can't find node enclosing position")
-	}
-	switch node := path[0].(type) {
-	case *ast.Ident:
-		result.ident = node
-	case *ast.SelectorExpr:
-		result.ident = node.Sel
-	}
-	if result.ident != nil {
-		for _, n := range path[1:] {
-			if field, ok := n.(*ast.Field); ok {
-				result.wasEmbeddedField = len(field.Names) == 0
-			}
-		}
+func qualifier(p *types.Package) string {
+	//TODO: this matches existing behaviour, but we can do better.
+	//The previous code had the following TODO in it that now belongs here
+	// TODO print path package when appropriate.
+	// Current issues with using p.n.Pkg:
+	//	- we should actually print the local package identifier
+	//	rather than the package path when possible.
+	//	- p.n.Pkg is non-empty even when
+	//	the type is not relative to the package.
+	return ""
+}
+
+// timeoutError is returned when a query takes longer than
+// the -timeout flag allows.
+type timeoutError struct {
+	timeout time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("query timed out after %v", e.timeout)
+}
+
+// resolution records which engine answered a query,
+// and why the fallback engine was used if it was.
+type resolution struct {
+	engine string
+	reason string
+}
+
+func (r resolution) String() string {
+	if r.reason == "" {
+		return fmt.Sprintf("resolved by %s engine", r.engine)
 	}
-	return result, nil
+	return fmt.Sprintf("resolved by %s engine (%s)", r.engine, r.reason)
 }
 
-func trimAST(file *ast.File, pos token.Pos) {
-	ast.Inspect(file, func(n ast.Node) bool {
-		if n == nil {
-			return false
-		}
-		if pos < n.Pos() || pos >= n.End() {
-			switch n := n.(type) {
-			case *ast.FuncDecl:
-				n.Body = nil
-			case *ast.BlockStmt:
-				n.List = nil
-			case *ast.CaseClause:
-				n.Body = nil
-			case *ast.CommClause:
-				n.Body = nil
-			case *ast.CompositeLit:
-				// Leave elts in place for [...]T
-				// array literals, because they can
-				// affect the expression's type.
-				if !isEllipsisArray(n.Type) {
-					n.Elts = nil
-				}
-			}
-		}
-		return true
+// definition holds the result of a query in a form that
+// can be printed locally or sent between processes.
+type definition struct {
+	Pos      token.Position
+	Type     string   `json:",omitempty"`
+	Members  []member `json:",omitempty"`
+	Engine   string
+	Fallback string `json:",omitempty"`
+
+	// Candidates holds, for a guess or a -candidates query, all
+	// the declarations the identifier might refer to, ranked.
+	Candidates []candidate `json:",omitempty"`
+}
+
+// candidate is a declaration that an identifier might refer to.
+type candidate struct {
+	Pos        token.Position
+	Rank       int
+	Reason     string
+	Constraint string `json:",omitempty"`
+}
+
+// member describes a field or method of a definition's type.
+type member struct {
+	Type string
+	Pos  token.Position
+}
+
+// describe builds the definition of obj. Type information is only
+// computed when withType is set, and members only when withMembers is
+// set, in which case unexported members are included if allMembers is set.
+func describe(fSet *token.FileSet, obj types.Object, res resolution, withType, withMembers, allMembers bool) *definition {
+	r := godef.Describe(fSet, obj, godef.Options{
+		Type:       withType,
+		Members:    withType && withMembers,
+		AllMembers: allMembers,
 	})
+	r.Engine, r.Fallback = res.engine, res.reason
+	return newDefinition(r)
 }
 
-func isEllipsisArray(n ast.Expr) bool {
-	at, ok := n.(*ast.ArrayType)
-	if !ok {
-		return false
-	}
-	_, ok = at.Len.(*ast.Ellipsis)
-	return ok
+// newDefinition returns the definition found by a query.
+func newDefinition(r *godef.Result) *definition {
+	def := &definition{
+		Pos:      r.Position,
+		Type:     r.Type,
+		Engine:   r.Engine,
+		Fallback: r.Fallback,
+	}
+	for _, m := range r.Members {
+		def.Members = append(def.Members, member{Type: m.Type, Pos: m.Position})
+	}
+	def.addCandidates(r.Candidates)
+	return def
 }
 
-func objToPos(fSet *token.FileSet, obj types.Object) token.Position {
-	p := obj.Pos()
-	f := fSet.File(p)
-	pos := f.Position(p)
-	if pos.Column != 1 {
-		return pos
-	}
-	// currently exportdata does not store the column
-	// until it does, we have a hacky fix to attempt to find the name within
-	// the line and patch the column to match
-	named, ok := obj.(interface{ Name() string })
-	if !ok {
-		return pos
-	}
-	in, err := os.Open(f.Name())
-	if err != nil {
-		return pos
+// addCandidates adds cands to the candidates of def.
+func (def *definition) addCandidates(cands []godef.Candidate) {
+	for _, c := range cands {
+		def.Candidates = append(def.Candidates, candidate{Pos: c.Position, Rank: c.Rank, Reason: c.Reason, Constraint: c.Constraint})
 	}
-	for l, scanner := 1, bufio.NewScanner(in); scanner.Scan(); l++ {
-		if l < pos.Line {
-			continue
-		}
-		col := bytes.Index([]byte(scanner.Text()), []byte(named.Name()))
-		if col >= 0 {
-			pos.Column = col + 1
-		}
-		break
-	}
-	return pos
 }
 
-type orderedObjects []types.Object
-
-func (o orderedObjects) Less(i, j int) bool { return o[i].Name() < o[j].Name() }
-func (o orderedObjects) Len() int           { return len(o) }
-func (o orderedObjects) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
+// candidateJSON is the JSON form of a candidate.
+type candidateJSON struct {
+	jsonPos
+	Rank       int    `json:"rank"`
+	Reason     string `json:"reason"`
+	Constraint string `json:"constraint,omitempty"`
+}
 
-func done(fSet *token.FileSet, obj types.Object, q types.Qualifier) error {
-	pos := objToPos(fSet, obj)
+func done(def *definition) error {
+	switch *formatFlag {
+	case "kakoune":
+		return doneKakoune(os.Stdout, def)
+	}
+	enc := outputEncoding()
+	pos := encodeColumn(def.Pos, enc)
+	pos.Filename = outputName(pos.Filename)
 	if *jsonFlag {
 		p := struct {
-			Filename string `json:"filename,omitempty"`
-			Line     int    `json:"line,omitempty"`
-			Column   int    `json:"column,omitempty"`
+			jsonPos
+			Engine     string          `json:"engine,omitempty"`
+			Fallback   string          `json:"fallback,omitempty"`
+			Candidates []candidateJSON `json:"candidates,omitempty"`
 		}{
-			Filename: pos.Filename,
-			Line:     pos.Line,
-			Column:   pos.Column,
+			jsonPos:  newJSONPos(pos),
+			Engine:   def.Engine,
+			Fallback: def.Fallback,
+		}
+		for _, c := range def.Candidates {
+			cpos := encodeColumn(c.Pos, enc)
+			cpos.Filename = outputName(cpos.Filename)
+			p.Candidates = append(p.Candidates, candidateJSON{newJSONPos(cpos), c.Rank, c.Reason, c.Constraint})
 		}
 		jsonStr, err := json.Marshal(p)
 		if err != nil {
@@ -385,74 +744,91 @@ func done(fSet *token.FileSet, obj types.Object, q types.Qualifier) error {
 		}
 		fmt.Printf("%s\n", jsonStr)
 		return nil
+	}
+	// With -variants, each position is followed by
+	// the build constraint of its file, if it has one.
+	constraint := func(p token.Position) string {
+		for _, c := range def.Candidates {
+			if *variantsFlag && c.Pos == p && c.Constraint != "" {
+				return "\t" + c.Constraint
+			}
+		}
+		return ""
+	}
+	links := !*acmeFlag && useHyperlinks()
+	if links {
+		fmt.Printf("%s%s\n", hyperlink(def.Pos, pos.String()), constraint(def.Pos))
 	} else {
-		fmt.Printf("%v\n", pos)
+		fmt.Printf("%v%s\n", pos, constraint(def.Pos))
+	}
+	if len(def.Candidates) > 1 {
+		// The other candidates follow the definition, by rank.
+		for _, c := range def.Candidates {
+			if c.Pos == def.Pos {
+				continue
+			}
+			cpos := encodeColumn(c.Pos, enc)
+			cpos.Filename = outputName(cpos.Filename)
+			if links {
+				fmt.Printf("%s%s\n", hyperlink(c.Pos, cpos.String()), constraint(c.Pos))
+			} else {
+				fmt.Printf("%v%s\n", cpos, constraint(c.Pos))
+			}
+		}
 	}
 	if !*tflag {
 		return nil
 	}
-	fmt.Printf("%s\n", typeStr(obj, q))
-	if *aflag || *Aflag {
-		m := orderedObjects(members(obj))
-		sort.Sort(m)
-		for _, obj := range m {
-			// Ignore unexported members unless Aflag is set.
-			if !*Aflag && !ast.IsExported(obj.Name()) {
-				continue
-			}
-			fmt.Printf("\t%s\n", strings.Replace(typeStr(obj, q), "\n", "\n\t\t", -1))
-			fmt.Printf("\t\t%v\n", posToString(fSet.Position(obj.Pos())))
+	if *acmeFlag {
+		// Errors windows are a poor place for long listings,
+		// so they go in a window of their own.
+		dir, err := os.Getwd()
+		if err != nil {
+			return err
 		}
+		return acmeShow(filepath.Join(dir, "+godef"), acmeListing(pos, def, enc))
 	}
+	writeType(os.Stdout, def, enc, links)
 	return nil
 }
 
-func typeStr(obj types.Object, q types.Qualifier) string {
-	buf := &bytes.Buffer{}
-	switch obj := obj.(type) {
-	case *types.Func:
-		buf.WriteString(obj.Name())
-		buf.WriteString(" ")
-		types.WriteType(buf, obj.Type(), q)
-	case *types.Var:
-		buf.WriteString(obj.Name())
-		buf.WriteString(" ")
-		types.WriteType(buf, obj.Type(), q)
-	case *types.PkgName:
-		fmt.Fprintf(buf, "import (%v %q)", obj.Name(), obj.Imported().Path())
-	case *types.Const:
-		fmt.Fprintf(buf, "const %s ", obj.Name())
-		types.WriteType(buf, obj.Type(), q)
-		if obj.Val() != nil {
-			buf.WriteString(" ")
-			buf.WriteString(obj.Val().String())
-		}
-	case *types.Label:
-		fmt.Fprintf(buf, "label %s ", obj.Name())
-	case *types.TypeName:
-		fmt.Fprintf(buf, "type %s ", obj.Name())
-		types.WriteType(buf, obj.Type().Underlying(), q)
-	default:
-		fmt.Fprintf(buf, "unknown %v [%T] ", obj.Name(), obj)
-		types.WriteType(buf, obj.Type(), q)
-	}
-	return buf.String()
+// acmeListing returns the text of the +godef window for def,
+// printed at pos: the position, then the type and members
+// as writeType writes them, each one a position that can be
+// clicked on.
+func acmeListing(pos token.Position, def *definition, enc string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%v\n", pos)
+	writeType(&buf, def, enc, false)
+	return buf.Bytes()
 }
 
-func members(obj types.Object) []types.Object {
-	var result []types.Object
-	switch typ := obj.Type().Underlying().(type) {
-	case *types.Struct:
-		for i := 0; i < typ.NumFields(); i++ {
-			result = append(result, typ.Field(i))
+// outputEncoding returns the units of the columns that godef
+// prints: those of -offset-encoding, unless the output format
+// requires others.
+func outputEncoding() string {
+	if *formatFlag == "helix" {
+		// Helix counts columns in characters.
+		return encodingRunes
+	}
+	return *encodingFlag
+}
+
+// writeType writes the type of def and its members to w,
+// with each member followed by its position, in columns of
+// the encoding enc, as a hyperlink if links is true.
+func writeType(w io.Writer, def *definition, enc string, links bool) {
+	fmt.Fprintf(w, "%s\n", def.Type)
+	for _, m := range def.Members {
+		fmt.Fprintf(w, "\t%s\n", strings.Replace(m.Type, "\n", "\n\t\t", -1))
+		mpos := encodeColumn(m.Pos, enc)
+		mpos.Filename = outputName(mpos.Filename)
+		text := posToString(mpos)
+		if links {
+			text = hyperlink(m.Pos, text)
 		}
-	default:
-	}
-	mset := typeutil.IntuitiveMethodSet(obj.Type(), nil)
-	for _, m := range mset {
-		result = append(result, m.Obj())
+		fmt.Fprintf(w, "\t\t%s\n", text)
 	}
-	return result
 }
 
 func posToString(pos token.Position) string {
@@ -0,0 +1,328 @@
+package godef
+
+import (
+	"bufio"
+	"bytes"
+	"go/build"
+	"go/build/constraint"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// targets lists the GOARCH values supported with each GOOS, the
+// commonest first, so that an alternate configuration is one that
+// the go command accepts.
+var targets = map[string][]string{
+	"aix":       {"ppc64"},
+	"android":   {"arm64", "amd64", "arm", "386"},
+	"darwin":    {"amd64", "arm64"},
+	"dragonfly": {"amd64"},
+	"freebsd":   {"amd64", "arm64", "386", "arm", "riscv64"},
+	"illumos":   {"amd64"},
+	"ios":       {"arm64", "amd64"},
+	"js":        {"wasm"},
+	"linux":     {"amd64", "arm64", "386", "arm", "loong64", "mips", "mipsle", "mips64", "mips64le", "ppc64", "ppc64le", "riscv64", "s390x"},
+	"netbsd":    {"amd64", "arm64", "386", "arm"},
+	"openbsd":   {"amd64", "arm64", "386", "arm"},
+	"plan9":     {"amd64", "386", "arm"},
+	"solaris":   {"amd64"},
+	"wasip1":    {"wasm"},
+	"windows":   {"amd64", "arm64", "386"},
+}
+
+// AlternateConfig returns a copy of cfg under which filename, whose
+// contents are src if not nil, belongs to the build of its package,
+// if the build configuration of cfg itself excludes it, as the
+// configuration of the host excludes foo_windows.go from a build on
+// Linux. The alternate configuration is inferred from the file's name
+// and build constraints, changing as little as it can: GOOS and
+// GOARCH, preferring the current values and the commonest targets,
+// CGO_ENABLED, and the tags that the constraints mention. It also
+// returns a description of the changes, such as "GOOS=windows". It
+// returns nil if the file is not excluded or no configuration
+// includes it.
+func AlternateConfig(cfg *packages.Config, filename string, src []byte) (*packages.Config, string) {
+	if src == nil {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, ""
+		}
+		src = data
+	}
+	env := cfg.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	ctxt := build.Default
+	for _, kv := range env {
+		switch {
+		case strings.HasPrefix(kv, "GOOS="):
+			ctxt.GOOS = kv[len("GOOS="):]
+		case strings.HasPrefix(kv, "GOARCH="):
+			ctxt.GOARCH = kv[len("GOARCH="):]
+		case strings.HasPrefix(kv, "CGO_ENABLED="):
+			ctxt.CgoEnabled = kv[len("CGO_ENABLED="):] == "1"
+		}
+	}
+	tags, otherFlags := splitTags(cfg.BuildFlags)
+	ctxt.BuildTags = tags
+	ctxt.OpenFile = func(string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(src)), nil
+	}
+	dir, base := filepath.Split(filename)
+	if ok, err := ctxt.MatchFile(dir, base); ok || err != nil {
+		return nil, ""
+	}
+	goos, goarch, cgo := ctxt.GOOS, ctxt.GOARCH, ctxt.CgoEnabled
+	var others []string
+	for o := range targets {
+		others = append(others, o)
+	}
+	sort.Strings(others)
+	var oses []string
+	seen := make(map[string]bool)
+	for _, o := range append([]string{goos, "linux", "darwin", "windows"}, others...) {
+		if !seen[o] {
+			seen[o] = true
+			oses = append(oses, o)
+		}
+	}
+	for _, extra := range tagSets(constraintTags(src)) {
+		ctxt.BuildTags = append(append([]string(nil), tags...), extra...)
+		for _, cgoEnabled := range []bool{cgo, true} {
+			ctxt.CgoEnabled = cgoEnabled
+			for _, targetOS := range oses {
+				for _, arch := range append([]string{goarch}, targets[targetOS]...) {
+					if !supported(targetOS, arch) {
+						continue
+					}
+					ctxt.GOOS, ctxt.GOARCH = targetOS, arch
+					if ok, _ := ctxt.MatchFile(dir, base); !ok {
+						continue
+					}
+					alt := *cfg
+					alt.Env = append([]string(nil), env...)
+					alt.BuildFlags = otherFlags
+					var desc []string
+					if targetOS != goos {
+						alt.Env = append(alt.Env, "GOOS="+targetOS)
+						desc = append(desc, "GOOS="+targetOS)
+					}
+					if arch != goarch {
+						alt.Env = append(alt.Env, "GOARCH="+arch)
+						desc = append(desc, "GOARCH="+arch)
+					}
+					if cgoEnabled != cgo {
+						alt.Env = append(alt.Env, "CGO_ENABLED=1")
+						desc = append(desc, "CGO_ENABLED=1")
+					}
+					if len(ctxt.BuildTags) > 0 {
+						flag := "-tags=" + strings.Join(ctxt.BuildTags, ",")
+						alt.BuildFlags = append(append([]string(nil), otherFlags...), flag)
+						if len(extra) > 0 {
+							desc = append(desc, flag)
+						}
+					}
+					return &alt, strings.Join(desc, " ")
+				}
+			}
+		}
+	}
+	return nil, ""
+}
+
+// tagSets returns the sets of tags to try adding to a build
+// configuration that needs some of tags, the smallest first.
+// Beyond a handful, only none and all of them are tried.
+func tagSets(tags []string) [][]string {
+	if len(tags) > 6 {
+		return [][]string{nil, tags}
+	}
+	var sets [][]string
+	for subset := 0; subset < 1<<uint(len(tags)); subset++ {
+		var set []string
+		for i, tag := range tags {
+			if subset&(1<<uint(i)) != 0 {
+				set = append(set, tag)
+			}
+		}
+		sets = append(sets, set)
+	}
+	sort.SliceStable(sets, func(i, j int) bool {
+		return len(sets[i]) < len(sets[j])
+	})
+	return sets
+}
+
+// supported reports whether the go command supports building
+// for the given GOOS and GOARCH.
+func supported(goos, goarch string) bool {
+	for _, arch := range targets[goos] {
+		if arch == goarch {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTags returns the build tags set by the -tags flags among
+// flags, and the other flags.
+func splitTags(flags []string) (tags, other []string) {
+	for i := 0; i < len(flags); i++ {
+		f := flags[i]
+		var value string
+		switch {
+		case strings.HasPrefix(f, "-tags=") || strings.HasPrefix(f, "--tags="):
+			value = f[strings.Index(f, "=")+1:]
+		case (f == "-tags" || f == "--tags") && i+1 < len(flags):
+			i++
+			value = flags[i]
+		default:
+			other = append(other, f)
+			continue
+		}
+		// The go command accepts tags separated by
+		// commas, and formerly by spaces.
+		tags = strings.FieldsFunc(value, func(r rune) bool {
+			return r == ',' || r == ' '
+		})
+	}
+	return tags, other
+}
+
+// constraintTags returns the tags mentioned in the build constraints
+// of a file with the contents src, other than those that the build
+// configuration sets itself, such as operating systems, architectures,
+// cgo and release tags.
+func constraintTags(src []byte) []string {
+	x := headerConstraint(src)
+	seen := make(map[string]bool)
+	var tags []string
+	var walk func(constraint.Expr)
+	walk = func(x constraint.Expr) {
+		switch x := x.(type) {
+		case *constraint.TagExpr:
+			if !seen[x.Tag] && !configTag(x.Tag) {
+				seen[x.Tag] = true
+				tags = append(tags, x.Tag)
+			}
+		case *constraint.NotExpr:
+			walk(x.X)
+		case *constraint.AndExpr:
+			walk(x.X)
+			walk(x.Y)
+		case *constraint.OrExpr:
+			walk(x.X)
+			walk(x.Y)
+		}
+	}
+	if x != nil {
+		walk(x)
+	}
+	return tags
+}
+
+// headerConstraint returns the build constraint in the header of a
+// file with the contents src: its //go:build line if it has one, or
+// else the conjunction of its // +build lines, or nil if it has none.
+func headerConstraint(src []byte) constraint.Expr {
+	var plus constraint.Expr
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+		if constraint.IsGoBuild(line) {
+			if x, err := constraint.Parse(line); err == nil {
+				return x
+			}
+			continue
+		}
+		if !constraint.IsPlusBuild(line) {
+			continue
+		}
+		if x, err := constraint.Parse(line); err == nil {
+			plus = and(plus, x)
+		}
+	}
+	return plus
+}
+
+// and returns the conjunction of x and y, either of which may be nil.
+func and(x, y constraint.Expr) constraint.Expr {
+	if x == nil {
+		return y
+	}
+	if y == nil {
+		return x
+	}
+	return &constraint.AndExpr{X: x, Y: y}
+}
+
+// FileConstraint returns the build constraint that applies to the
+// named Go file, whose contents are src if not nil, as an expression
+// in the syntax of a //go:build line, such as "linux && amd64",
+// combining the GOOS and GOARCH implied by its name with any in its
+// header, or the empty string if it has none.
+func FileConstraint(filename string, src []byte) string {
+	var x constraint.Expr
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(filename), ".go"), "_test")
+	elems := strings.Split(name, "_")
+	n := len(elems)
+	switch {
+	case n >= 3 && knownOS(elems[n-2]) && knownArch(elems[n-1]):
+		x = and(&constraint.TagExpr{Tag: elems[n-2]}, &constraint.TagExpr{Tag: elems[n-1]})
+	case n >= 2 && (knownOS(elems[n-1]) || knownArch(elems[n-1])):
+		x = &constraint.TagExpr{Tag: elems[n-1]}
+	}
+	if src == nil {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return ""
+		}
+		src = data
+	}
+	if x = and(x, headerConstraint(src)); x == nil {
+		return ""
+	}
+	return x.String()
+}
+
+// configTag reports whether tag is set by the build configuration
+// rather than by the -tags flag, or is ignore, which by convention
+// is never set.
+func configTag(tag string) bool {
+	if knownOS(tag) || knownArch(tag) {
+		return true
+	}
+	switch tag {
+	case "cgo", "gc", "gccgo", "unix", "ignore":
+		return true
+	}
+	return strings.HasPrefix(tag, "go1.")
+}
+
+// knownOS reports whether tag names a GOOS.
+func knownOS(tag string) bool {
+	_, ok := targets[tag]
+	return ok
+}
+
+// knownArch reports whether tag names a GOARCH.
+func knownArch(tag string) bool {
+	for _, archs := range targets {
+		for _, arch := range archs {
+			if tag == arch {
+				return true
+			}
+		}
+	}
+	return false
+}
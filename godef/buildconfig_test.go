@@ -0,0 +1,73 @@
+package godef
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
+
+func TestAlternateConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godef-buildconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	otherOS := "windows"
+	if runtime.GOOS == otherOS {
+		otherOS = "linux"
+	}
+	env := []string{"GOOS=" + runtime.GOOS, "GOARCH=amd64", "CGO_ENABLED=0"}
+	for _, test := range []struct {
+		name, src string
+		flags     []string
+		want      string
+		wantFlags []string
+	}{
+		{"a.go", "package x\n", nil, "", nil},
+		{"a_" + otherOS + ".go", "package x\n", nil, "GOOS=" + otherOS, nil},
+		{"a_arm64.go", "package x\n", []string{"-v"}, "GOARCH=arm64", []string{"-v"}},
+		{"b.go", "//go:build foo && !bar\n// +build foo,!bar\n\npackage x\n", []string{"-tags=baz", "-v"}, "-tags=baz,foo", []string{"-v", "-tags=baz,foo"}},
+		{"c.go", "//go:build cgo\n// +build cgo\n\npackage x\n", nil, "CGO_ENABLED=1", nil},
+		{"d.go", "//go:build ignore\n// +build ignore\n\npackage x\n", nil, "", nil},
+	} {
+		filename := filepath.Join(dir, test.name)
+		if err := ioutil.WriteFile(filename, []byte(test.src), 0666); err != nil {
+			t.Fatal(err)
+		}
+		alt, desc := AlternateConfig(&packages.Config{Env: env, BuildFlags: test.flags}, filename, nil)
+		if desc != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, desc, test.want)
+		}
+		if (alt == nil) != (test.want == "") {
+			t.Errorf("%s: got config %v", test.name, alt)
+			continue
+		}
+		if alt != nil && !reflect.DeepEqual(alt.BuildFlags, test.wantFlags) {
+			t.Errorf("%s: got flags %q, want %q", test.name, alt.BuildFlags, test.wantFlags)
+		}
+	}
+}
+
+func TestFileConstraint(t *testing.T) {
+	for _, test := range []struct {
+		name, src, want string
+	}{
+		{"now.go", "package x\n", ""},
+		{"linux.go", "package x\n", ""},
+		{"now_linux.go", "package x\n", "linux"},
+		{"now_linux_test.go", "package x\n", "linux"},
+		{"now_linux_arm64.go", "package x\n", "linux && arm64"},
+		{"now_amd64.go", "//go:build !purego\n\npackage x\n", "amd64 && !purego"},
+		{"now_windows.go", "//go:build foo || bar\n\npackage x\n", "windows && (foo || bar)"},
+		{"now.go", "// +build linux darwin\n// +build cgo\n\npackage x\n", "(linux || darwin) && cgo"},
+	} {
+		if got := FileConstraint(test.name, []byte(test.src)); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package godef
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Candidate is a declaration that an identifier might refer to.
+type Candidate struct {
+	Position   token.Position
+	Rank       int    // 1 for the likeliest candidate, 2 for the next, and so on
+	Reason     string // why it is a candidate, such as ReasonResolved
+	Constraint string // the build constraint of its file, as FileConstraint returns it
+}
+
+// Candidate reasons, as reported in Candidate.Reason, in order of
+// decreasing likelihood.
+const (
+	ReasonResolved  = "resolved"  // the identifier was resolved to it
+	ReasonDuplicate = "duplicate" // it is declared again in the same build, which does not compile
+	ReasonTest      = "test"      // it is declared in a test file, or a test package, unlike the resolved one, or vice versa
+	ReasonBuild     = "build"     // it is declared in a file that the build constraints exclude
+	ReasonName      = "name"      // it is merely declared with the identifier's name
+)
+
+var reasonOrder = map[string]int{
+	ReasonResolved:  0,
+	ReasonDuplicate: 1,
+	ReasonTest:      2,
+	ReasonBuild:     3,
+	ReasonName:      4,
+}
+
+// FindCandidates returns the declarations that an identifier resolved
+// to the declaration at pos might refer to in other builds of its
+// package: declarations of the same package-level name, or of a
+// method with the same name on the same receiver type, in the other
+// files of the package's directory, including its test files and
+// those that the build constraints exclude. The declaration at pos
+// comes first, and the others follow in order of their reasons. The
+// contents of pos.Filename are src if it is not nil. Files that the
+// exclude patterns match, as Excluded matches them, are ignored. If
+// the declaration at pos is not at package level, there are no other
+// candidates.
+func FindCandidates(pos token.Position, src []byte, exclude []string) []Candidate {
+	cands := []Candidate{{Position: pos, Rank: 1, Reason: ReasonResolved, Constraint: FileConstraint(pos.Filename, src)}}
+	fset := token.NewFileSet()
+	var f *ast.File
+	if src != nil {
+		f, _ = parser.ParseFile(fset, pos.Filename, src, 0)
+	} else {
+		f, _ = parser.ParseFile(fset, pos.Filename, nil, 0)
+	}
+	if f == nil {
+		return cands
+	}
+	key := ""
+	for _, d := range declKeys(f) {
+		if p := fset.Position(d.ident.Pos()); p.Line == pos.Line && p.Column == pos.Column {
+			key = d.key
+			break
+		}
+	}
+	if key == "" {
+		return cands
+	}
+	dir := filepath.Dir(pos.Filename)
+	base := strings.TrimSuffix(f.Name.Name, "_test")
+	test := strings.HasSuffix(pos.Filename, "_test.go")
+	names, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, filename := range names {
+		if SamePath(filename, pos.Filename) || Excluded(filename, exclude) {
+			continue
+		}
+		other, _ := parser.ParseFile(fset, filename, nil, 0)
+		if other == nil || strings.TrimSuffix(other.Name.Name, "_test") != base {
+			continue
+		}
+		reason := ReasonDuplicate
+		if ok, err := build.Default.MatchFile(dir, filepath.Base(filename)); !ok && err == nil {
+			reason = ReasonBuild
+		} else if strings.HasSuffix(filename, "_test.go") != test || other.Name.Name != f.Name.Name {
+			reason = ReasonTest
+		}
+		for _, d := range declKeys(other) {
+			if d.key == key {
+				cands = append(cands, Candidate{
+					Position:   fset.Position(d.ident.Pos()),
+					Reason:     reason,
+					Constraint: FileConstraint(filename, nil),
+				})
+			}
+		}
+	}
+	rankCandidates(cands)
+	return cands
+}
+
+// Variants returns the candidates among cands that are variants of
+// the resolved declaration for other build configurations, such as
+// the declarations of a function in now_linux.go and now_windows.go,
+// with the resolved declaration itself, renumbering their ranks.
+func Variants(cands []Candidate) []Candidate {
+	var variants []Candidate
+	for _, c := range cands {
+		switch c.Reason {
+		case ReasonResolved, ReasonDuplicate, ReasonBuild:
+			c.Rank = len(variants) + 1
+			variants = append(variants, c)
+		}
+	}
+	return variants
+}
+
+// rankCandidates sorts cands by reason, keeping their order
+// otherwise, and numbers their ranks from 1.
+func rankCandidates(cands []Candidate) {
+	sort.SliceStable(cands, func(i, j int) bool {
+		return reasonOrder[cands[i].Reason] < reasonOrder[cands[j].Reason]
+	})
+	for i := range cands {
+		cands[i].Rank = i + 1
+	}
+}
+
+// declKey is a package-level declaration, with a key that identifies
+// it across files: its name, or for a method, its receiver's type
+// name and its own joined by a period.
+type declKey struct {
+	key   string
+	ident *ast.Ident
+}
+
+// declKeys returns the package-level declarations in f.
+func declKeys(f *ast.File) []declKey {
+	var keys []declKey
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			key := d.Name.Name
+			if d.Recv != nil {
+				if len(d.Recv.List) == 0 {
+					continue
+				}
+				key = recvTypeName(d.Recv.List[0].Type) + "." + key
+			}
+			keys = append(keys, declKey{key, d.Name})
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				for _, id := range declIdents(spec) {
+					if id.Name != "_" {
+						keys = append(keys, declKey{id.Name, id})
+					}
+				}
+			}
+		}
+	}
+	return keys
+}
+
+// recvTypeName returns the name of the type of a method receiver
+// declared with type expr.
+func recvTypeName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return recvTypeName(e.X)
+	case *ast.ParenExpr:
+		return recvTypeName(e.X)
+	case *ast.IndexExpr:
+		return recvTypeName(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+package godef
+
+import (
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindCandidates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godef-candidates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"a.go":          "package x\n\ntype T int\n\nfunc now() int64 { return 0 }\n\nfunc (T) M() {}\n",
+		"a_other.go":    "// +build ignore\n\npackage x\n\nfunc now() int64 { return 1 }\n\nfunc (*T) M() {}\n",
+		"a_ext_test.go": "package x_test\n\nfunc now() int64 { return 2 }\n\nfunc M() {}\n",
+		"doc.go":        "package main\n\nfunc now() {}\n",
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, test := range []struct {
+		line, col int
+		want      string
+	}{
+		{5, 6, "1 resolved a.go:5 2 test a_ext_test.go:3 3 build a_other.go:5"},
+		{7, 10, "1 resolved a.go:7 2 build a_other.go:7"},
+		{3, 6, "1 resolved a.go:3"},
+		{5, 1, "1 resolved a.go:5"},
+	} {
+		pos := token.Position{Filename: filepath.Join(dir, "a.go"), Line: test.line, Column: test.col}
+		var got []string
+		for _, c := range FindCandidates(pos, nil, nil) {
+			got = append(got, fmt.Sprintf("%d %s %s:%d", c.Rank, c.Reason, filepath.Base(c.Position.Filename), c.Position.Line))
+		}
+		if strings.Join(got, " ") != test.want {
+			t.Errorf("%d:%d: got %q, want %q", test.line, test.col, strings.Join(got, " "), test.want)
+		}
+	}
+}
+
+func TestPreferHandwritten(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godef-candidates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"kind_string.go": "// Code generated by \"stringer -type=Kind\"; DO NOT EDIT.\n\npackage x\n\nfunc (Kind) String() string { return \"\" }\n",
+		"kind_stub.go":   "// +build ignore\n\npackage x\n\nfunc (Kind) String() string { return \"stub\" }\n",
+		"kind.go":        "package x\n\ntype Kind int\n",
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pos := token.Position{Filename: filepath.Join(dir, "kind_string.go"), Line: 5, Column: 13}
+	cands := FindCandidates(pos, nil, nil)
+	PreferHandwritten(cands)
+	var got []string
+	for _, c := range cands {
+		got = append(got, fmt.Sprintf("%d %s %s", c.Rank, c.Reason, filepath.Base(c.Position.Filename)))
+	}
+	want := "1 build kind_stub.go 2 resolved kind_string.go"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got %q, want %q", strings.Join(got, " "), want)
+	}
+}
+
+func TestVariants(t *testing.T) {
+	cands := []Candidate{
+		{Rank: 1, Reason: ReasonResolved, Constraint: "linux"},
+		{Rank: 2, Reason: ReasonTest},
+		{Rank: 3, Reason: ReasonBuild, Constraint: "windows"},
+	}
+	got := Variants(cands)
+	want := []Candidate{
+		{Rank: 1, Reason: ReasonResolved, Constraint: "linux"},
+		{Rank: 2, Reason: ReasonBuild, Constraint: "windows"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
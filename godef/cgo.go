@@ -0,0 +1,270 @@
+package godef
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// cgoHeader is the comment that starts the files that cgo writes.
+const cgoHeader = "// Code generated by cmd/cgo; DO NOT EDIT."
+
+// cgoPrefixes are the prefixes that cgo gives the Go names of
+// C declarations, each before any that is a prefix of it.
+var cgoPrefixes = []string{
+	"_Cfpvar_fp_",
+	"_Cfunc_",
+	"_Ctype_struct_",
+	"_Ctype_union_",
+	"_Ctype_enum_",
+	"_Ctype_",
+	"_Cvar_",
+	"_Cmacro_",
+	"_Ciconst_",
+	"_Cfconst_",
+	"_Csconst_",
+}
+
+// cgoBuiltins are the C names that cgo provides itself, which
+// no preamble declares.
+var cgoBuiltins = map[string]bool{
+	"char": true, "schar": true, "uchar": true,
+	"short": true, "ushort": true,
+	"int": true, "uint": true,
+	"long": true, "ulong": true,
+	"longlong": true, "ulonglong": true,
+	"float": true, "double": true,
+	"complexfloat": true, "complexdouble": true, "void": true,
+	"CString": true, "CBytes": true,
+	"GoString": true, "GoStringN": true, "GoBytes": true,
+	"_CMalloc": true,
+}
+
+// cgoSource returns the name of the file from which cgo generated
+// src, as given by the line directive after its header, or the
+// empty string if src was not generated from a file by cgo.
+func cgoSource(src []byte) string {
+	header := false
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == cgoHeader:
+			header = true
+		case strings.HasPrefix(line, "//line "):
+			if !header {
+				return ""
+			}
+			name := strings.TrimPrefix(line, "//line ")
+			// Strip the :line:column suffix.
+			for i := 0; i < 2; i++ {
+				if j := strings.LastIndex(name, ":"); j > 0 {
+					name = name[:j]
+				}
+			}
+			return name
+		case line != "" && !strings.HasPrefix(line, "//"):
+			return ""
+		}
+	}
+	return ""
+}
+
+// isCgoTypes reports whether filename is the file of declarations
+// that cgo generates for the C names a package uses. Unlike the
+// files it rewrites, this has no line directives.
+func isCgoTypes(filename string) bool {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 4096)
+	n, _ := f.Read(head)
+	head = head[:n]
+	return bytes.Contains(head, []byte(cgoHeader+"\n")) && cgoSource(head) == ""
+}
+
+// cgoMatch finds the identifier in f, which cgo generated from the
+// file whose contents are src, that stands for the identifier at
+// offset in src. Line directives give the positions in the source
+// of the identifiers that cgo keeps or substitutes, those for C.x
+// references taking the position of the C.
+func cgoMatch(fset *token.FileSet, f *ast.File, src []byte, offset int) (match, error) {
+	if offset > len(src) {
+		return match{}, fmt.Errorf("cursor %d is beyond end of file (%d)", offset, len(src))
+	}
+	start := offset
+	for start > 0 && isIdentByte(src[start-1]) {
+		start--
+	}
+	if start >= 2 && string(src[start-2:start]) == "C." && (start == 2 || !isIdentByte(src[start-3])) {
+		start -= 2
+	}
+	line := 1 + bytes.Count(src[:start], []byte("\n"))
+	col := 1 + start - (bytes.LastIndexByte(src[:start], '\n') + 1)
+	var found *ast.Ident
+	ast.Inspect(f, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && found == nil {
+			if pos := fset.Position(id.Pos()); pos.Line == line && pos.Column == col {
+				found = id
+			}
+		}
+		return found == nil
+	})
+	if found == nil {
+		return match{}, nil
+	}
+	return findMatch(f, found.Pos())
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c >= 0x80
+}
+
+// cgoPosition maps pos, the position of the object called name,
+// from the declarations that cgo generates for a package's C names
+// to the declaration of the C name in the preamble of one of the
+// package's files, or to the import of "C" if there is none there.
+// It reports false if pos is not in such declarations.
+func cgoPosition(fset *token.FileSet, pos token.Position, name string) (token.Position, bool) {
+	if !pos.IsValid() || !isCgoTypes(pos.Filename) {
+		return pos, false
+	}
+	cname := name
+	for _, prefix := range cgoPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			cname = name[len(prefix):]
+			break
+		}
+	}
+	var imports []token.Position
+	for _, filename := range cgoSources(fset) {
+		preamble, importPos, ok := cgoPreamble(filename)
+		if !ok {
+			continue
+		}
+		if !cgoBuiltins[cname] {
+			for _, c := range preamble {
+				if i := indexWord(c.text, cname); i >= 0 {
+					return offsetPosition(c.pos, c.text, i), true
+				}
+			}
+		}
+		imports = append(imports, importPos)
+	}
+	if len(imports) == 0 {
+		return pos, false
+	}
+	return imports[0], true
+}
+
+// cgoSources returns the names of the files that the files in fset
+// were generated from by cgo, as their line directives give them.
+func cgoSources(fset *token.FileSet) []string {
+	seen := make(map[string]bool)
+	fset.Iterate(func(f *token.File) bool {
+		if f.Size() == 0 {
+			return true
+		}
+		name := f.PositionFor(f.Pos(f.Size()), true).Filename
+		if name != f.Name() && strings.HasSuffix(name, ".go") && filepath.IsAbs(name) {
+			seen[name] = true
+		}
+		return true
+	})
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cgoComment is a comment in a cgo preamble.
+type cgoComment struct {
+	pos  token.Position
+	text string
+}
+
+// cgoPreamble returns the comments that form the preamble of the
+// import of "C" in filename, and the position of that import. It
+// reports false if filename does not import "C".
+func cgoPreamble(filename string) ([]cgoComment, token.Position, bool) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, token.Position{}, false
+	}
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, filename, src, parser.ImportsOnly|parser.ParseComments)
+	if f == nil {
+		return nil, token.Position{}, false
+	}
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			is := spec.(*ast.ImportSpec)
+			if path, _ := strconv.Unquote(is.Path.Value); path != "C" {
+				continue
+			}
+			doc := is.Doc
+			if doc == nil && len(gd.Specs) == 1 {
+				doc = gd.Doc
+			}
+			var preamble []cgoComment
+			if doc != nil {
+				for _, c := range doc.List {
+					preamble = append(preamble, cgoComment{fset.Position(c.Pos()), c.Text})
+				}
+			}
+			return preamble, fset.Position(is.Path.Pos()), true
+		}
+	}
+	return nil, token.Position{}, false
+}
+
+// indexWord returns the index of the first occurrence of word in s
+// that is not part of a longer identifier, or -1 if there is none.
+func indexWord(s, word string) int {
+	if word == "" {
+		return -1
+	}
+	for i := 0; ; {
+		j := strings.Index(s[i:], word)
+		if j < 0 {
+			return -1
+		}
+		j += i
+		end := j + len(word)
+		if (j == 0 || !isIdentByte(s[j-1])) && (end == len(s) || !isIdentByte(s[end])) {
+			return j
+		}
+		i = j + 1
+	}
+}
+
+// offsetPosition returns the position i bytes into text, which
+// starts at pos.
+func offsetPosition(pos token.Position, text string, i int) token.Position {
+	before := text[:i]
+	if nl := strings.LastIndexByte(before, '\n'); nl >= 0 {
+		pos.Line += strings.Count(before, "\n")
+		pos.Column = 1 + i - (nl + 1)
+	} else {
+		pos.Column += i
+	}
+	pos.Offset += i
+	return pos
+}
@@ -0,0 +1,71 @@
+package godef
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const cgoUserSrc = `package p
+
+/*
+typedef struct point { int x, y; } point;
+
+static int add(int a, int b) { return a + b; }
+*/
+import "C"
+
+func F() int { return int(C.add(1, 2)) }
+`
+
+func TestCgoPosition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godef-cgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	user := filepath.Join(dir, "p.go")
+	files := map[string]string{
+		user:                            cgoUserSrc,
+		filepath.Join(dir, "p.cgo1.go"): cgoHeader + "\n\n//line " + user + ":1:1\npackage p\n\nfunc F() int { return int(( /*line :10:27*/_Cfunc_add /*line :10:33*/)(1, 2)) }\n",
+		filepath.Join(dir, "types.go"):  "//go:cgo_ldflag \"-g\"\n" + cgoHeader + "\n\npackage p\n\ntype _Ctype_int int32\n\nfunc _Cfunc_add(p0, p1 _Ctype_int) _Ctype_int\n",
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(name, []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := cgoSource([]byte(files[filepath.Join(dir, "p.cgo1.go")])); got != user {
+		t.Errorf("cgoSource = %q, want %q", got, user)
+	}
+	fset := token.NewFileSet()
+	gen, err := parser.ParseFile(fset, filepath.Join(dir, "p.cgo1.go"), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := cgoMatch(fset, gen, []byte(cgoUserSrc), strings.Index(cgoUserSrc, "add(1"))
+	if err != nil || m.ident == nil || m.ident.Name != "_Cfunc_add" {
+		t.Fatalf("cgoMatch found %v, %v; want _Cfunc_add", m.ident, err)
+	}
+	types, err := parser.ParseFile(fset, filepath.Join(dir, "types.go"), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name string
+		line int
+	}{
+		{"_Cfunc_add", 6},
+		{"_Ctype_int", 8},
+	} {
+		obj := types.Scope.Lookup(test.name)
+		pos, ok := cgoPosition(fset, fset.Position(obj.Pos()), test.name)
+		if !ok || pos.Filename != user || pos.Line != test.line {
+			t.Errorf("%s: got %v, want %s:%d", test.name, pos, user, test.line)
+		}
+	}
+}
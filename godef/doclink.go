@@ -0,0 +1,246 @@
+package godef
+
+import (
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// docLink returns the text of the doc link, such as [Name],
+// [Name.Method], [pkg.Name] or [pkg], that holds the given byte
+// offset of src within a comment, without its brackets or any *
+// before the name, and reports whether there is one.
+func docLink(src []byte, offset int) (string, bool) {
+	tok, lit, start := tokenAt(src, offset)
+	if tok != token.COMMENT {
+		return "", false
+	}
+	i := offset - start
+	open := i
+	if lit[i] != '[' {
+		open = strings.LastIndexAny(lit[:i], "[]\n")
+	}
+	if open < 0 || lit[open] != '[' {
+		return "", false
+	}
+	end := strings.IndexAny(lit[open+1:], "[]\n")
+	if end < 0 || lit[open+1+end] != ']' {
+		return "", false
+	}
+	end += open + 1
+	if open > 0 && isIdentByte(lit[open-1]) || end+1 < len(lit) && isIdentByte(lit[end+1]) {
+		// An index expression, as in a[i], not a link.
+		return "", false
+	}
+	if end+1 < len(lit) && lit[end+1] == ':' {
+		// A link definition, as in [text]: URL.
+		return "", false
+	}
+	text := strings.TrimPrefix(lit[open+1:end], "*")
+	if !isDocLink(text) {
+		return "", false
+	}
+	return text, true
+}
+
+// tokenAt returns the token of src that holds the given byte offset,
+// with its literal text and the offset at which it starts, or
+// token.ILLEGAL if there is none.
+func tokenAt(src []byte, offset int) (token.Token, string, int) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, src, nil, scanner.ScanComments)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return token.ILLEGAL, "", 0
+		}
+		start := file.Offset(pos)
+		if start > offset {
+			return token.ILLEGAL, "", 0
+		}
+		if offset < start+len(lit) {
+			return tok, lit, start
+		}
+	}
+}
+
+// wordAt returns the word, a name or a sequence of names joined by
+// dots such as pkg.Name or v.Field.Method, that holds the given byte
+// offset of src within a comment or string literal, with the offset
+// at which it starts, and reports whether there is one.
+func wordAt(src []byte, offset int) (string, int, bool) {
+	tok, lit, start := tokenAt(src, offset)
+	if tok != token.COMMENT && tok != token.STRING && tok != token.CHAR {
+		return "", 0, false
+	}
+	isWordByte := func(c byte) bool {
+		return isIdentByte(c) || c == '.'
+	}
+	i, j := offset-start, offset-start
+	for i > 0 && isWordByte(lit[i-1]) {
+		i--
+	}
+	for j < len(lit) && isWordByte(lit[j]) {
+		j++
+	}
+	for i < j && lit[i] == '.' {
+		i++
+	}
+	for j > i && lit[j-1] == '.' {
+		j--
+	}
+	word := lit[i:j]
+	for _, name := range strings.Split(word, ".") {
+		if !token.IsIdentifier(name) {
+			return "", 0, false
+		}
+	}
+	return word, start + i, true
+}
+
+// isDocLink reports whether text has the form of a doc link target:
+// an import path or package name, optionally followed by a name and
+// a member, or a name declared in the current package and optionally
+// a member.
+func isDocLink(text string) bool {
+	slash := strings.LastIndex(text, "/")
+	names := strings.Split(text[slash+1:], ".")
+	if len(names) > 3 {
+		return false
+	}
+	for i, name := range names {
+		if !token.IsIdentifier(name) && !(i == 0 && slash >= 0 && name != "") {
+			return false
+		}
+	}
+	return true
+}
+
+// LookupDocLink returns the object named by the doc link that holds
+// the given byte offset of filename, whose contents are src, within
+// pkg, which must have been loaded with syntax and type information.
+// A link to a package alone names the file's import of it.
+func LookupDocLink(pkg *packages.Package, filename string, src []byte, offset int) (types.Object, error) {
+	text, ok := docLink(src, offset)
+	if !ok {
+		return nil, &Error{ErrorNoIdent, fmt.Errorf("Offset %d was not a valid identifier or doc link", offset)}
+	}
+	isInputFile := newFileCompare(filename)
+	for _, f := range pkg.Syntax {
+		if tfile := pkg.Fset.File(f.Pos()); tfile != nil && isInputFile(tfile.Name()) {
+			return docLinkObject(pkg, f, text)
+		}
+	}
+	return nil, &Error{ErrorLoad, fmt.Errorf("file %s not found in package %s", filename, pkg.PkgPath)}
+}
+
+// LookupWord returns the object named by the word within a comment
+// or string literal that holds the given byte offset of filename,
+// whose contents are src, resolved as an expression in the scope
+// holding it, within pkg, which must have been loaded with syntax
+// and type information.
+func LookupWord(pkg *packages.Package, filename string, src []byte, offset int) (types.Object, error) {
+	word, start, ok := wordAt(src, offset)
+	if !ok {
+		return nil, &Error{ErrorNoIdent, fmt.Errorf("Offset %d was not on a word in a comment or string", offset)}
+	}
+	isInputFile := newFileCompare(filename)
+	for _, f := range pkg.Syntax {
+		if tfile := pkg.Fset.File(f.Pos()); tfile != nil && isInputFile(tfile.Name()) && start <= tfile.Size() {
+			return wordObject(pkg, tfile.Pos(start), word)
+		}
+	}
+	return nil, &Error{ErrorLoad, fmt.Errorf("file %s not found in package %s", filename, pkg.PkgPath)}
+}
+
+// docLinkObject returns the object named by the doc link text as
+// seen from file, a file of pkg.
+func docLinkObject(pkg *packages.Package, file *ast.File, text string) (types.Object, error) {
+	slash := strings.LastIndex(text, "/")
+	names := strings.Split(text[slash+1:], ".")
+	if slash < 0 && len(names) <= 2 && pkg.Types.Scope().Lookup(names[0]) != nil {
+		return lookupMember(pkg.Types, names)
+	}
+	// The link names a package, either by its import path or by
+	// the name under which the file imports it.
+	pkgPath := text[:slash+1] + names[0]
+	var imported *types.PkgName
+	if scope := pkg.TypesInfo.Scopes[file]; scope != nil {
+		for _, name := range scope.Names() {
+			pn, ok := scope.Lookup(name).(*types.PkgName)
+			if !ok {
+				continue
+			}
+			if pn.Imported().Path() == pkgPath || slash < 0 && pn.Name() == pkgPath {
+				imported = pn
+				break
+			}
+		}
+	}
+	if imported == nil && slash < 0 && len(names) <= 2 {
+		return lookupMember(pkg.Types, names)
+	}
+	if imported == nil {
+		return nil, &Error{ErrorNotFound, fmt.Errorf("doc link [%s]: package %s is not imported", text, pkgPath)}
+	}
+	if len(names) == 1 {
+		return imported, nil
+	}
+	return lookupMember(imported.Imported(), names[1:])
+}
+
+// lookupMember returns the package-level object of pkg named by
+// names[0] or, if there is a second name, its field or method.
+func lookupMember(pkg *types.Package, names []string) (types.Object, error) {
+	obj := pkg.Scope().Lookup(names[0])
+	if obj == nil {
+		return nil, &Error{ErrorNotFound, fmt.Errorf("no %s in package %s", names[0], pkg.Path())}
+	}
+	if len(names) == 1 {
+		return obj, nil
+	}
+	if _, ok := obj.(*types.TypeName); !ok {
+		return nil, &Error{ErrorNotFound, fmt.Errorf("%s.%s is not a type", pkg.Path(), names[0])}
+	}
+	member, _, _ := types.LookupFieldOrMethod(obj.Type(), true, pkg, names[1])
+	if member == nil {
+		return nil, &Error{ErrorNotFound, fmt.Errorf("no field or method %s in %s.%s", names[1], pkg.Path(), names[0])}
+	}
+	return member, nil
+}
+
+// wordObject returns the object named by word, a name or a sequence
+// of names joined by dots, resolved as an expression at pos in pkg:
+// the first name in the innermost scope holding pos, and each that
+// follows as a member of the package, type or value before it.
+func wordObject(pkg *packages.Package, pos token.Pos, word string) (types.Object, error) {
+	names := strings.Split(word, ".")
+	scope := pkg.Types.Scope().Innermost(pos)
+	if scope == nil {
+		scope = pkg.Types.Scope()
+	}
+	_, obj := scope.LookupParent(names[0], pos)
+	if obj == nil {
+		return nil, &Error{ErrorNotFound, fmt.Errorf("no %s in scope", names[0])}
+	}
+	for _, name := range names[1:] {
+		var member types.Object
+		if pn, ok := obj.(*types.PkgName); ok {
+			member = pn.Imported().Scope().Lookup(name)
+		} else {
+			member, _, _ = types.LookupFieldOrMethod(obj.Type(), true, pkg.Types, name)
+		}
+		if member == nil {
+			return nil, &Error{ErrorNotFound, fmt.Errorf("no %s in %s", name, obj.Name())}
+		}
+		obj = member
+	}
+	return obj, nil
+}
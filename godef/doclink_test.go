@@ -0,0 +1,62 @@
+package godef
+
+import (
+	"strings"
+	"testing"
+)
+
+const docLinkSrc = `package x
+
+// F is like [G], [*bytes.Buffer] and [encoding/json.Decoder.Decode],
+// but not a[i] or [1].
+//
+// [spec]: https://go.dev/ref/spec
+func F() {}
+`
+
+func TestDocLink(t *testing.T) {
+	for _, test := range []struct {
+		at   string
+		want string
+	}{
+		{"G]", "G"},
+		{"[G", "G"},
+		{"Buffer", "bytes.Buffer"},
+		{"json.Decoder", "encoding/json.Decoder.Decode"},
+		{"i]", ""},
+		{"1]", ""},
+		{"spec]", ""},
+		{"F()", ""},
+		{"like", ""},
+	} {
+		got, ok := docLink([]byte(docLinkSrc), strings.Index(docLinkSrc, test.at))
+		if got != test.want || ok != (test.want != "") {
+			t.Errorf("at %q: got %q, %v; want %q", test.at, got, ok, test.want)
+		}
+	}
+}
+
+const wordSrc = `package x
+
+// TODO: call strings.ToUpper on c.Name.
+var s = "see T." + x
+`
+
+func TestWordAt(t *testing.T) {
+	for _, test := range []struct {
+		at   string
+		want string
+	}{
+		{"ToUpper", "strings.ToUpper"},
+		{"Name.", "c.Name"},
+		{"T.\"", "T"},
+		{"TODO", "TODO"},
+		{" call", ""},
+		{"x\n", ""},
+	} {
+		got, start, ok := wordAt([]byte(wordSrc), strings.Index(wordSrc, test.at))
+		if got != test.want || ok != (test.want != "") || ok && wordSrc[start:start+len(got)] != got {
+			t.Errorf("at %q: got %q at %d, %v; want %q", test.at, got, start, ok, test.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package godef
+
+import (
+	"fmt"
+	"time"
+)
+
+// EventKind identifies the kind of an Event.
+type EventKind int
+
+const (
+	// EventLoad is reported before loading the package
+	// containing the file.
+	EventLoad EventKind = iota + 1
+
+	// EventParsed is reported as each file is parsed while
+	// loading, possibly concurrently with other events; Count
+	// holds the size of the file in bytes and Duration the time
+	// taken to parse it.
+	EventParsed
+
+	// EventLoaded is reported once the package has been loaded;
+	// Count holds the number of packages loaded, including
+	// dependencies, and Duration the time taken.
+	EventLoaded
+
+	// EventPackageErrors is reported for each loaded package with
+	// errors; Count holds the number of errors and Err the first.
+	// Most are spurious, caused by trimming function bodies that do
+	// not contain the identifier.
+	EventPackageErrors
+
+	// EventResolved is reported once the identifier has been
+	// resolved in the loaded package; Duration holds the time
+	// taken.
+	EventResolved
+
+	// EventFallback is reported when the package cannot be used
+	// and the identifier is resolved from the file's syntax alone;
+	// Err holds the reason.
+	EventFallback
+
+	// EventFallbackFailed is reported when syntax-only resolution
+	// fails too; Err holds its error.
+	EventFallbackFailed
+
+	// EventBuildConfig is reported before loading when the build
+	// configuration excludes the file, so that the package is
+	// loaded under an alternate one; Config describes it.
+	EventBuildConfig
+)
+
+// Event reports the progress of a query. The fields other than
+// Kind and Filename are set only as the kind requires.
+type Event struct {
+	Kind     EventKind
+	Filename string // the file holding the identifier
+	Package  string // the import path of the package concerned
+	Count    int
+	Duration time.Duration
+	Err      error
+	Config   string // the changes to the build configuration
+}
+
+// String returns a description of the event, suitable for logging.
+func (e Event) String() string {
+	switch e.Kind {
+	case EventLoad:
+		return fmt.Sprintf("loading package containing %s", e.Filename)
+	case EventParsed:
+		return fmt.Sprintf("parsed %d bytes in %v", e.Count, e.Duration)
+	case EventLoaded:
+		return fmt.Sprintf("loaded %d packages in %v", e.Count, e.Duration)
+	case EventResolved:
+		return fmt.Sprintf("resolved identifier in %v", e.Duration)
+	case EventPackageErrors:
+		return fmt.Sprintf("%s: %d errors, the first being %v", e.Package, e.Count, e.Err)
+	case EventFallback:
+		return fmt.Sprintf("falling back to syntax-only resolution: %v", e.Err)
+	case EventFallbackFailed:
+		return fmt.Sprintf("syntax-only resolution failed: %v", e.Err)
+	case EventBuildConfig:
+		return fmt.Sprintf("%s is excluded from the build, so loading with %s", e.Filename, e.Config)
+	}
+	return fmt.Sprintf("unknown event %d", e.Kind)
+}
@@ -0,0 +1,33 @@
+package godef
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// CommonExcludes holds patterns for the files and directories that
+// are conventionally not worth resolving against: test data,
+// JavaScript dependencies and generated Go files.
+var CommonExcludes = []string{"testdata", "node_modules", "*.gen.go"}
+
+// Excluded reports whether filename matches one of the glob patterns
+// in exclude, as path.Match matches them. A pattern without a slash
+// is matched against each element of the file's path, so that it
+// excludes whole directories as well as files; a pattern with slashes
+// is matched against each run of as many consecutive elements.
+func Excluded(filename string, exclude []string) bool {
+	if len(exclude) == 0 {
+		return false
+	}
+	elems := strings.Split(filepath.ToSlash(filename), "/")
+	for _, pattern := range exclude {
+		n := strings.Count(pattern, "/") + 1
+		for i := 0; i+n <= len(elems); i++ {
+			if ok, _ := path.Match(pattern, strings.Join(elems[i:i+n], "/")); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
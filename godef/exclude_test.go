@@ -0,0 +1,30 @@
+package godef
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestExcluded(t *testing.T) {
+	for _, test := range []struct {
+		filename string
+		exclude  []string
+		want     bool
+	}{
+		{"/m/a/b.go", nil, false},
+		{"/m/a/b.go", []string{"c"}, false},
+		{"/m/a/b.go", []string{"a"}, true},
+		{"/m/a/b.go", []string{"*.go"}, true},
+		{"/m/a/b.go", []string{"m/a"}, true},
+		{"/m/a/b.go", []string{"a/*.go"}, true},
+		{"/m/a/b.go", []string{"m/b"}, false},
+		{"/m/testdata/x/x.go", CommonExcludes, true},
+		{"/m/node_modules/y.go", CommonExcludes, true},
+		{"/m/api/api.gen.go", CommonExcludes, true},
+		{"/m/api/api.go", CommonExcludes, false},
+	} {
+		if got := Excluded(filepath.FromSlash(test.filename), test.exclude); got != test.want {
+			t.Errorf("Excluded(%q, %q) = %v, want %v", test.filename, test.exclude, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package godef
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// generatedPattern matches the comment that marks a generated file,
+// as described by go help generate.
+var generatedPattern = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// IsGenerated reports whether filename is marked as generated
+// by a comment line before its package clause.
+func IsGenerated(filename string) bool {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if generatedPattern.MatchString(line) {
+			return true
+		}
+		if strings.HasPrefix(line, "package ") {
+			return false
+		}
+	}
+	return false
+}
+
+// PreferHandwritten reorders cands so that the declarations in files
+// not marked as generated come before those in generated files, as
+// when a generated declaration has hand-written variants for other
+// builds, keeping their order otherwise, and renumbers their ranks.
+func PreferHandwritten(cands []Candidate) {
+	generated := make(map[string]bool)
+	for _, c := range cands {
+		if _, ok := generated[c.Position.Filename]; !ok {
+			generated[c.Position.Filename] = IsGenerated(c.Position.Filename)
+		}
+	}
+	sort.SliceStable(cands, func(i, j int) bool {
+		return !generated[cands[i].Position.Filename] && generated[cands[j].Position.Filename]
+	})
+	for i := range cands {
+		cands[i].Rank = i + 1
+	}
+}
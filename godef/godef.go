@@ -0,0 +1,402 @@
+// Package godef finds the definitions of Go identifiers.
+//
+// It is the engine behind the godef command, for use by tools
+// that want to resolve identifiers without running the command
+// and parsing its output.
+//
+// Queries share no state but a cache of the GOROOT that the go
+// command reports, which is safe for concurrent use, so Query may
+// be called concurrently, even with the same Options.
+package godef
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os/exec"
+	"runtime/trace"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// Options describes a query.
+type Options struct {
+	// Config, if not nil, is used to load packages. Its Mode
+	// and ParseFile fields are ignored, and packages are loaded
+	// in the context passed to Query.
+	Config *packages.Config
+
+	// Filename names the file holding the identifier.
+	Filename string
+
+	// Src, if not nil, holds the contents of Filename,
+	// which need not then exist on disk.
+	Src []byte
+
+	// Offset is the byte offset of the identifier in Filename.
+	Offset int
+
+	// Type causes the type of the definition to be computed,
+	// and Members its fields and methods too. Unexported members
+	// are only included if AllMembers is set.
+	Type       bool
+	Members    bool
+	AllMembers bool
+
+	// Strict disables the fallback to resolving the identifier
+	// from the syntax of Filename alone when its package cannot
+	// be loaded.
+	Strict bool
+
+	// NoExec prevents Query from running any other program,
+	// such as the go command, so that the identifier is
+	// resolved as by LookupLayout.
+	NoExec bool
+
+	// Words causes an offset within a comment or string literal,
+	// other than on a doc link, to be taken as on the word there,
+	// which is resolved as an expression in the scope holding it.
+	Words bool
+
+	// Guess causes an identifier that no other engine can resolve,
+	// unless Strict is set, to be looked up by name alone as by
+	// LookupGuess, with the result marked as a guess.
+	Guess bool
+
+	// Candidates causes Result.Candidates to list the other
+	// declarations that the identifier might refer to in other
+	// builds of its package, as FindCandidates finds them.
+	Candidates bool
+
+	// PreferHandwritten causes the candidates in files that are
+	// not marked as generated to be ranked before those in files
+	// that are, as by PreferHandwritten.
+	PreferHandwritten bool
+
+	// Variants is like Candidates, but lists only the variants
+	// of the declaration for other build configurations, as
+	// Variants does.
+	Variants bool
+
+	// Exclude holds glob patterns naming files and directories
+	// that are ignored when the files of a package's directory
+	// are parsed directly, as by the fallbacks, rather than
+	// loaded by the go command. See Excluded.
+	Exclude []string
+
+	// Events, if not nil, is called to report the progress
+	// of the query.
+	Events func(Event)
+}
+
+// Engine names, as reported in Result.Engine.
+const (
+	EnginePackages = "packages" // the package was loaded and type-checked
+	EngineParser   = "parser"   // only the syntax of the file was used
+	EngineLayout   = "layout"   // the go command could not be run, so packages were found by guessing
+	EngineGuess    = "guess"    // nothing resolved the identifier, so declarations were matched by name
+)
+
+// Result holds the definition found by a query.
+type Result struct {
+	Position token.Position
+	Type     string   // the definition's type, if Options.Type was set
+	Members  []Member // its members, if Options.Members was set
+
+	// Engine names the engine that resolved the identifier.
+	// If it is EngineParser, EngineLayout or EngineGuess, Fallback
+	// holds the reason that the package could not be loaded.
+	Engine   string
+	Fallback string
+
+	// Candidates holds, for EngineGuess or if Options.Candidates
+	// or Options.Variants was set, the declarations the identifier
+	// might refer to, ranked. The first of them is at Position, unless
+	// Options.PreferHandwritten ranked a hand-written declaration
+	// above a generated one that the identifier resolved to.
+	Candidates []Candidate
+
+	Fset    *token.FileSet
+	Object  types.Object
+	Package *packages.Package // the loaded package; nil for EngineParser, EngineLayout and EngineGuess
+}
+
+// Member describes a field or method of a definition's type.
+type Member struct {
+	Type     string
+	Position token.Position
+}
+
+// ErrorKind classifies the errors returned by Query.
+type ErrorKind int
+
+const (
+	ErrorLoad     ErrorKind = iota + 1 // packages could not be loaded or parsed
+	ErrorNoIdent                       // there is no identifier at the offset
+	ErrorNotFound                      // the identifier's definition could not be found
+)
+
+// Error is an error returned by Query.
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Query finds the definition of the identifier described by opts.
+// It loads the package containing the file where possible, under the
+// configuration that AlternateConfig finds if that of opts.Config
+// excludes the file, and, unless opts.Strict is set, falls back to resolving the identifier using
+// only the syntax of the file itself if that fails. If there is no go
+// command to load packages with, or opts.NoExec forbids running it,
+// it resolves the identifier as LookupLayout does instead, unless
+// opts.Strict is set. If all that fails and opts.Guess is set, it
+// returns the declarations found by LookupGuess. If resolution
+// panics, Query returns a *PanicError.
+func Query(ctx context.Context, opts Options) (_ *Result, err error) {
+	defer RecoverPanic(opts.Filename, opts.Offset, &err)
+	report := opts.Events
+	if report == nil {
+		report = func(Event) {}
+	}
+	cfg := &packages.Config{}
+	if opts.Config != nil {
+		c := *opts.Config
+		cfg = &c
+	}
+	cfg.Context = ctx
+	cfg.Tests = cfg.Tests || IsTest(opts.Filename, opts.Src)
+	var noGo error
+	if opts.NoExec {
+		noGo = fmt.Errorf("running the go command is not allowed")
+	} else if _, err := exec.LookPath("go"); err != nil {
+		noGo = fmt.Errorf("no go command: %v", err)
+	}
+	if noGo != nil {
+		err := &Error{ErrorLoad, noGo}
+		if opts.Strict {
+			return nil, err
+		}
+		opts.NoExec = true
+		return Fallback(ctx, opts, err)
+	}
+	if alt, desc := AlternateConfig(cfg, opts.Filename, opts.Src); alt != nil {
+		report(Event{Kind: EventBuildConfig, Filename: opts.Filename, Config: desc})
+		cfg = alt
+	}
+	pkg, obj, err := loadDef(cfg, opts.Filename, opts.Src, opts.Offset, opts.Words, report)
+	if err == nil {
+		defer trace.StartRegion(ctx, "describe").End()
+		r := Describe(pkg.Fset, obj, opts)
+		r.Engine, r.Package = EnginePackages, pkg
+		AddCandidates(r, opts)
+		return r, nil
+	}
+	if opts.Strict || ctx.Err() != nil {
+		return nil, err
+	}
+	return Fallback(ctx, opts, err)
+}
+
+// Fallback resolves the identifier described by opts after its
+// package failed to load with err, as Query does: from the syntax of
+// opts.Filename alone, or as LookupLayout does if opts.NoExec is set,
+// and failing that, if opts.Guess is set, by name alone as LookupGuess
+// does. It is for callers that load packages themselves, such as
+// from a cache, and want the same fallbacks as Query. opts.Strict
+// is ignored.
+func Fallback(ctx context.Context, opts Options, err error) (*Result, error) {
+	report := opts.Events
+	if report == nil {
+		report = func(Event) {}
+	}
+	report(Event{Kind: EventFallback, Filename: opts.Filename, Err: err})
+	engine := EngineParser
+	var fset *token.FileSet
+	var obj types.Object
+	var ferr error
+	if opts.NoExec {
+		engine = EngineLayout
+		fset, obj, ferr = lookupLayout(opts.Filename, opts.Src, opts.Offset, opts.Exclude)
+	} else {
+		region := trace.StartRegion(ctx, "fallback")
+		fset, obj, ferr = LookupSyntax(opts.Filename, opts.Src, opts.Offset)
+		region.End()
+	}
+	if ferr != nil {
+		report(Event{Kind: EventFallbackFailed, Filename: opts.Filename, Err: ferr})
+		if r := guess(opts, err); r != nil {
+			return r, nil
+		}
+		if opts.NoExec {
+			return nil, &Error{ErrorNotFound, ferr}
+		}
+		return nil, err
+	}
+	r := Describe(fset, obj, opts)
+	r.Engine, r.Fallback = engine, err.Error()
+	AddCandidates(r, opts)
+	return r, nil
+}
+
+// AddCandidates sets r.Candidates as Query does if opts.Candidates
+// or opts.Variants is set, for callers that resolve the identifier
+// themselves. Its candidates are ranked as opts.PreferHandwritten
+// requires.
+func AddCandidates(r *Result, opts Options) {
+	if !opts.Candidates && !opts.Variants || !r.Position.IsValid() {
+		return
+	}
+	var src []byte
+	if SamePath(r.Position.Filename, opts.Filename) {
+		src = opts.Src
+	}
+	r.Candidates = FindCandidates(r.Position, src, opts.Exclude)
+	if opts.Variants && !opts.Candidates {
+		r.Candidates = Variants(r.Candidates)
+	}
+	if opts.PreferHandwritten {
+		PreferHandwritten(r.Candidates)
+	}
+}
+
+// guess returns the result of looking up the identifier by name
+// alone after the package failed to load with err, or nil if
+// opts.Guess is not set or nothing was found.
+func guess(opts Options, err error) *Result {
+	if !opts.Guess {
+		return nil
+	}
+	positions, gerr := LookupGuess(opts.Filename, opts.Src, opts.Offset, opts.Exclude)
+	if gerr != nil {
+		return nil
+	}
+	r := &Result{
+		Position: positions[0],
+		Engine:   EngineGuess,
+		Fallback: err.Error(),
+	}
+	for i, pos := range positions {
+		r.Candidates = append(r.Candidates, Candidate{Position: pos, Rank: i + 1, Reason: ReasonName})
+	}
+	if opts.PreferHandwritten {
+		PreferHandwritten(r.Candidates)
+		r.Position = r.Candidates[0].Position
+	}
+	return r
+}
+
+// Describe returns the result for obj, with its type and members
+// as opts.Type, opts.Members and opts.AllMembers require. Of the
+// other fields of opts, only NoExec is used, to keep Describe from
+// running the go command to find the files of the standard library.
+func Describe(fset *token.FileSet, obj types.Object, opts Options) *Result {
+	r := &Result{
+		Position: position(fset, obj, opts.NoExec),
+		Fset:     fset,
+		Object:   obj,
+	}
+	if !opts.Type && !opts.Members {
+		return r
+	}
+	r.Type = TypeString(obj, qualifier)
+	if opts.Members {
+		m := orderedObjects(members(obj))
+		sort.Sort(m)
+		for _, obj := range m {
+			// Ignore unexported members unless AllMembers is set.
+			if !opts.AllMembers && !ast.IsExported(obj.Name()) {
+				continue
+			}
+			pos := sourcePosition(fset, obj.Pos(), opts.NoExec)
+			if cpos, ok := cgoPosition(fset, pos, obj.Name()); ok {
+				pos = cpos
+			}
+			r.Members = append(r.Members, Member{
+				Type:     TypeString(obj, qualifier),
+				Position: pos,
+			})
+		}
+	}
+	return r
+}
+
+func qualifier(p *types.Package) string {
+	//TODO: this matches existing behaviour, but we can do better.
+	//The previous code had the following TODO in it that now belongs here
+	// TODO print path package when appropriate.
+	// Current issues with using p.n.Pkg:
+	//	- we should actually print the local package identifier
+	//	rather than the package path when possible.
+	//	- p.n.Pkg is non-empty even when
+	//	the type is not relative to the package.
+	return ""
+}
+
+type orderedObjects []types.Object
+
+func (o orderedObjects) Less(i, j int) bool { return o[i].Name() < o[j].Name() }
+func (o orderedObjects) Len() int           { return len(o) }
+func (o orderedObjects) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
+
+// TypeString returns a description of obj and its type,
+// with packages named as q requires.
+func TypeString(obj types.Object, q types.Qualifier) string {
+	buf := &bytes.Buffer{}
+	switch obj := obj.(type) {
+	case *types.Func:
+		buf.WriteString(obj.Name())
+		buf.WriteString(" ")
+		types.WriteType(buf, obj.Type(), q)
+	case *types.Var:
+		buf.WriteString(obj.Name())
+		buf.WriteString(" ")
+		types.WriteType(buf, obj.Type(), q)
+	case *types.PkgName:
+		fmt.Fprintf(buf, "import (%v %q)", obj.Name(), obj.Imported().Path())
+	case *types.Const:
+		fmt.Fprintf(buf, "const %s ", obj.Name())
+		types.WriteType(buf, obj.Type(), q)
+		if obj.Val() != nil {
+			buf.WriteString(" ")
+			buf.WriteString(obj.Val().String())
+		}
+	case *types.Label:
+		fmt.Fprintf(buf, "label %s ", obj.Name())
+	case *types.TypeName:
+		fmt.Fprintf(buf, "type %s ", obj.Name())
+		types.WriteType(buf, obj.Type().Underlying(), q)
+	default:
+		fmt.Fprintf(buf, "unknown %v [%T] ", obj.Name(), obj)
+		types.WriteType(buf, obj.Type(), q)
+	}
+	return buf.String()
+}
+
+func members(obj types.Object) []types.Object {
+	var result []types.Object
+	switch typ := obj.Type().Underlying().(type) {
+	case *types.Struct:
+		for i := 0; i < typ.NumFields(); i++ {
+			result = append(result, typ.Field(i))
+		}
+	default:
+	}
+	mset := typeutil.IntuitiveMethodSet(obj.Type(), nil)
+	for _, m := range mset {
+		result = append(result, m.Obj())
+	}
+	return result
+}
@@ -0,0 +1,293 @@
+package godef
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
+
+const testSrc = `package x
+
+type T struct {
+	A int
+	b string
+}
+
+func (T) M() {}
+
+var v T
+`
+
+func TestQuery(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module example.com/x\n",
+		"x.go":   testSrc,
+	})
+	filename := filepath.Join(dir, "x.go")
+	opts := Options{
+		Config:   &packages.Config{Dir: dir},
+		Filename: filename,
+		Offset:   strings.Index(testSrc, "v T") + len("v "),
+		Members:  true,
+		Strict:   true,
+	}
+	var (
+		mu     sync.Mutex
+		events []EventKind
+	)
+	opts.Events = func(e Event) {
+		// Files are parsed concurrently.
+		mu.Lock()
+		defer mu.Unlock()
+		if e.Kind != EventParsed {
+			events = append(events, e.Kind)
+		}
+	}
+	r, err := Query(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) < 3 || events[0] != EventLoad || events[1] != EventLoaded || events[2] != EventResolved {
+		t.Errorf("got events %v, want EventLoad, EventLoaded then EventResolved", events)
+	}
+	if r.Engine != EnginePackages || r.Package == nil {
+		t.Errorf("got engine %q, package %v; want packages engine", r.Engine, r.Package)
+	}
+	if r.Position.Line != 3 || r.Position.Column != 6 {
+		t.Errorf("got position %v, want 3:6", r.Position)
+	}
+	if want := "type T struct{A int; b string}"; r.Type != want {
+		t.Errorf("got type %q, want %q", r.Type, want)
+	}
+	why := strings.Join(Explain(r, filename), "\n")
+	if want := "T is declared in the package scope of example.com/x\nit is defined in the queried file\nresolved by the packages engine"; why != want {
+		t.Errorf("got explanation %q, want %q", why, want)
+	}
+	var got []string
+	for _, m := range r.Members {
+		got = append(got, m.Type)
+	}
+	if want := "A int,M func()"; strings.Join(got, ",") != want {
+		t.Errorf("got members %q, want %q", got, want)
+	}
+
+	opts.Offset = strings.Index(testSrc, "{\n\tA")
+	_, err = Query(context.Background(), opts)
+	if e, ok := err.(*Error); !ok || e.Kind != ErrorNoIdent {
+		t.Errorf("got error %#v, want ErrorNoIdent", err)
+	}
+}
+
+func TestQueryEvents(t *testing.T) {
+	otherOS := "windows"
+	if runtime.GOOS == otherOS {
+		otherOS = "linux"
+	}
+	src := "package x\n\n// C is used by v.\nconst C = 1\n\nvar v = C\n"
+	dir := writeTree(t, map[string]string{
+		"go.mod":               "module example.com/x\n",
+		"x.go":                 src,
+		"y_" + otherOS + ".go": src,
+	})
+	for _, test := range []struct {
+		file   string
+		at     string
+		noExec bool
+		want   []EventKind
+	}{
+		{"x.go", "C\n", false, []EventKind{EventLoad, EventLoaded, EventResolved}},
+		{"y_" + otherOS + ".go", "C\n", false, []EventKind{EventBuildConfig, EventLoad, EventLoaded, EventResolved}},
+		{"x.go", "C\n", true, []EventKind{EventFallback}},
+		{"x.go", "is used", true, []EventKind{EventFallback, EventFallbackFailed}},
+	} {
+		var (
+			mu  sync.Mutex
+			got []EventKind
+		)
+		opts := Options{
+			Config:   &packages.Config{Dir: dir},
+			Filename: filepath.Join(dir, test.file),
+			Offset:   strings.Index(src, test.at),
+			NoExec:   test.noExec,
+			Events: func(e Event) {
+				mu.Lock()
+				defer mu.Unlock()
+				if e.Kind != EventParsed && e.Kind != EventPackageErrors {
+					got = append(got, e.Kind)
+				}
+				if strings.HasPrefix(e.String(), "unknown") {
+					t.Errorf("no description of event %d", e.Kind)
+				}
+			},
+		}
+		Query(context.Background(), opts)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s at %q, noExec %v: got events %v, want %v", test.file, test.at, test.noExec, got, test.want)
+		}
+	}
+}
+
+func TestQueryDependencySyntax(t *testing.T) {
+	files := map[string]string{
+		"go.mod": "module example.com/x\n",
+		"x.go":   "package x\n\nimport \"example.com/x/y\"\n\nvar v = y.F()\n",
+		"y/y.go": "package y\n\nfunc F() int {\n\treturn 1\n}\n",
+	}
+	dir := writeTree(t, files)
+	r, err := Query(context.Background(), Options{
+		Config:   &packages.Config{Dir: dir},
+		Filename: filepath.Join(dir, "x.go"),
+		Offset:   strings.Index(files["x.go"], "F()"),
+		Strict:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Position.Line != 3 || filepath.Base(r.Position.Filename) != "y.go" {
+		t.Errorf("got position %v, want y.go:3", r.Position)
+	}
+	// Dependencies should come from export data, so that
+	// their function bodies are never parsed or type checked.
+	y := r.Package.Imports["example.com/x/y"]
+	if y == nil || y.Types == nil {
+		t.Fatalf("no type information for dependency y")
+	}
+	if len(y.Syntax) != 0 {
+		t.Errorf("dependency y was parsed")
+	}
+}
+
+func TestQueryConcurrent(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module example.com/x\n",
+		"x.go":   testSrc,
+	})
+	filename := filepath.Join(dir, "x.go")
+	cfg := &packages.Config{Dir: dir}
+	errs := make(chan error)
+	for _, target := range []string{"v T", "(T) M", "A int", "b string"} {
+		// Half the queries are given the file's contents.
+		for _, src := range [][]byte{nil, []byte(testSrc)} {
+			go func(offset int, src []byte) {
+				_, err := Query(context.Background(), Options{
+					Config:   cfg,
+					Filename: filename,
+					Src:      src,
+					Offset:   offset,
+					Type:     true,
+					Members:  true,
+					Strict:   true,
+				})
+				errs <- err
+			}(strings.Index(testSrc, target)+len(target)-1, src)
+		}
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestFallback(t *testing.T) {
+	xsrc := "package x\n\nvar v = C\n"
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module example.com/x\n",
+		"x.go":   xsrc,
+		"c.go":   "package x\n\nconst C = 1\n",
+	})
+	loadErr := errors.New("cannot load")
+	opts := Options{
+		Filename: filepath.Join(dir, "x.go"),
+		Offset:   strings.Index(xsrc, "C"),
+	}
+	for _, test := range []struct {
+		noExec, guess bool
+		exclude       []string
+		want          string
+	}{
+		{false, false, nil, "error cannot load"},
+		{false, true, nil, "guess c.go:3"},
+		{true, false, nil, "layout c.go:3"},
+		{true, false, []string{"c.go"}, "not found"},
+		{true, true, []string{"c.go"}, "not found"},
+	} {
+		opts.NoExec, opts.Guess, opts.Exclude = test.noExec, test.guess, test.exclude
+		r, err := Fallback(context.Background(), opts, loadErr)
+		got := ""
+		switch {
+		case err == loadErr:
+			got = "error cannot load"
+		case err != nil:
+			if e, ok := err.(*Error); !ok || e.Kind != ErrorNotFound {
+				t.Errorf("%+v: got error %#v, want ErrorNotFound", test, err)
+			}
+			got = "not found"
+		default:
+			got = fmt.Sprintf("%s %s:%d", r.Engine, filepath.Base(r.Position.Filename), r.Position.Line)
+		}
+		if got != test.want {
+			t.Errorf("%+v: got %q, want %q", test, got, test.want)
+		}
+	}
+}
+
+func TestLookupSyntax(t *testing.T) {
+	filename := filepath.Join("..", "testdata", "a", "random.go")
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The y in "return y //@godef" refers to the parameter of Random2.
+	use := bytes.Index(src, []byte("return y //"))
+	decl := bytes.Index(src, []byte("y int) int"))
+	if use < 0 || decl < 0 {
+		t.Fatalf("cannot find y in %s", filename)
+	}
+	fSet, obj, err := LookupSyntax(filename, src, use+len("return "))
+	if err != nil {
+		t.Fatalf("LookupSyntax error: %v", err)
+	}
+	pos := fSet.Position(obj.Pos())
+	if pos.Offset != decl {
+		t.Errorf("unexpected result %v want offset %d", pos, decl)
+	}
+}
+
+// writeTree writes files, keyed by slash-separated names, into a new
+// temporary directory that is removed when the test ends, and returns
+// the directory with any symbolic links resolved, so that it matches
+// the file names that the go command reports.
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "godef-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
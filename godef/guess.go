@@ -0,0 +1,277 @@
+package godef
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// LookupGuess finds the declarations that the identifier at the given
+// byte offset of filename, whose contents are src if not nil, might
+// refer to, going by its name alone, for when it cannot be resolved
+// properly. An identifier qualified by an imported package is looked
+// for at package level in the package's directory, found as by
+// LookupLayout. Another selector, such as a method call, is looked for
+// among the methods and fields declared in the file's package and then
+// in the packages it imports. Any other identifier is looked for among
+// the declarations in the file, nearest first, then at package level
+// in the rest of its package and in any dot-imported packages.
+// Files that the exclude patterns match, as Excluded matches them,
+// are ignored. The positions are returned most likely first.
+func LookupGuess(filename string, src []byte, searchpos int, exclude []string) ([]token.Position, error) {
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	if src == nil {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		src = data
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, 0)
+	if file == nil {
+		return nil, err
+	}
+	tfile := fset.File(file.Pos())
+	if tfile == nil || searchpos > tfile.Size() {
+		return nil, fmt.Errorf("cursor %d is beyond end of file %s", searchpos, filename)
+	}
+	m, err := findMatch(file, tfile.Pos(searchpos))
+	if err != nil {
+		return nil, err
+	}
+	if m.ident == nil {
+		return nil, fmt.Errorf("Offset %d was not a valid identifier", searchpos)
+	}
+	name := m.ident.Name
+	dir := filepath.Dir(filename)
+	tests := strings.HasSuffix(file.Name.Name, "_test") || strings.HasSuffix(filename, "_test.go")
+	g := &guesser{fset: fset, name: name, exclude: exclude, seen: make(map[token.Position]bool)}
+	nodes, _ := astutil.PathEnclosingInterval(file, m.ident.Pos(), m.ident.End())
+	var sel *ast.SelectorExpr
+	if len(nodes) > 1 {
+		if s, ok := nodes[1].(*ast.SelectorExpr); ok && s.Sel == m.ident {
+			sel = s
+		}
+	}
+	switch {
+	case sel != nil:
+		if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil {
+			if importPath := importNamed(file, x.Name); importPath != "" {
+				if pdir := guessPackageDir(filename, importPath); pdir != "" {
+					g.dir(pdir, "", "", false, false)
+				}
+				break
+			}
+		}
+		g.file(file, false)
+		g.dir(dir, file.Name.Name, filename, tests, true)
+		for _, importPath := range importPaths(file) {
+			if pdir := guessPackageDir(filename, importPath); pdir != "" {
+				g.dir(pdir, "", "", false, true)
+			}
+		}
+	default:
+		g.local(file, m.ident)
+		g.dir(dir, file.Name.Name, filename, tests, false)
+		for _, spec := range file.Imports {
+			importPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil || spec.Name == nil || spec.Name.Name != "." {
+				continue
+			}
+			if pdir := guessPackageDir(filename, importPath); pdir != "" {
+				g.dir(pdir, "", "", false, false)
+			}
+		}
+	}
+	if len(g.found) == 0 {
+		return nil, fmt.Errorf("no declaration named %s found", name)
+	}
+	return g.found, nil
+}
+
+// guesser accumulates the positions of the declarations of name.
+type guesser struct {
+	fset    *token.FileSet
+	name    string
+	exclude []string
+	seen    map[token.Position]bool
+	found   []token.Position
+}
+
+func (g *guesser) add(pos token.Pos) {
+	p := g.fset.Position(pos)
+	if !g.seen[p] {
+		g.seen[p] = true
+		g.found = append(g.found, p)
+	}
+}
+
+// local adds the declarations of the name of ident anywhere in file
+// other than ident itself, those preceding it first, nearest first,
+// then those following it.
+func (g *guesser) local(file *ast.File, ident *ast.Ident) {
+	var before, after []*ast.Ident
+	ast.Inspect(file, func(n ast.Node) bool {
+		for _, id := range declaredIdents(n) {
+			if id.Name != g.name || id == ident {
+				continue
+			}
+			if id.Pos() < ident.Pos() {
+				before = append(before, id)
+			} else {
+				after = append(after, id)
+			}
+		}
+		return true
+	})
+	sort.SliceStable(before, func(i, j int) bool {
+		return before[i].Pos() > before[j].Pos()
+	})
+	for _, id := range append(before, after...) {
+		g.add(id.Pos())
+	}
+}
+
+// file adds the package-level declarations of name in file if
+// pkgLevel is set, and otherwise its methods and fields.
+func (g *guesser) file(file *ast.File, pkgLevel bool) {
+	if pkgLevel {
+		if o := file.Scope.Lookup(g.name); o != nil {
+			if id := declIdent(o); id != nil {
+				g.add(id.Pos())
+			}
+		}
+		return
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Recv != nil && n.Name.Name == g.name {
+				g.add(n.Name.Pos())
+			}
+		case *ast.StructType, *ast.InterfaceType:
+			var fields *ast.FieldList
+			if s, ok := n.(*ast.StructType); ok {
+				fields = s.Fields
+			} else {
+				fields = n.(*ast.InterfaceType).Methods
+			}
+			for _, field := range fields.List {
+				for _, id := range field.Names {
+					if id.Name == g.name {
+						g.add(id.Pos())
+					}
+				}
+				if len(field.Names) == 0 && embeddedName(field.Type) == g.name {
+					g.add(field.Type.Pos())
+				}
+			}
+		}
+		return true
+	})
+}
+
+// dir adds the declarations of name in the Go files in dir that match
+// the build constraints, other than skip, and belong to package pkgName
+// if it is not empty: those at package level, or if members is set,
+// methods and fields. Test files are included only if tests is set,
+// and excluded files never are.
+func (g *guesser) dir(dir, pkgName, skip string, tests, members bool) {
+	names, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, filename := range names {
+		if SamePath(filename, skip) || Excluded(filename, g.exclude) {
+			continue
+		}
+		if strings.HasSuffix(filename, "_test.go") && !tests {
+			continue
+		}
+		if ok, err := build.Default.MatchFile(dir, filepath.Base(filename)); !ok && err == nil {
+			continue
+		}
+		f, _ := parser.ParseFile(g.fset, filename, nil, 0)
+		if f == nil || pkgName != "" && f.Name.Name != pkgName {
+			continue
+		}
+		g.file(f, !members)
+	}
+}
+
+// declaredIdents returns the identifiers that n declares, including
+// those declared by short variable declarations, but not the names
+// of methods, which cannot be referred to unqualified.
+func declaredIdents(n ast.Node) []*ast.Ident {
+	var lhs []ast.Expr
+	switch n := n.(type) {
+	case *ast.FuncDecl:
+		if n.Recv != nil {
+			return nil
+		}
+	case *ast.AssignStmt:
+		if n.Tok == token.DEFINE {
+			lhs = n.Lhs
+		}
+	case *ast.RangeStmt:
+		if n.Tok == token.DEFINE {
+			lhs = []ast.Expr{n.Key, n.Value}
+		}
+	}
+	ids := declIdents(n)
+	for _, e := range lhs {
+		if id, ok := e.(*ast.Ident); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// declIdent returns the identifier declaring the package-level
+// object o, if there is one.
+func declIdent(o *ast.Object) *ast.Ident {
+	n, ok := o.Decl.(ast.Node)
+	if !ok {
+		return nil
+	}
+	for _, id := range declIdents(n) {
+		if id.Name == o.Name {
+			return id
+		}
+	}
+	return nil
+}
+
+// embeddedName returns the name of the type embedded as a field or
+// interface element of type expr, or the empty string.
+func embeddedName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedName(e.X)
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+// importPaths returns the paths imported by file, in order.
+func importPaths(file *ast.File) []string {
+	var paths []string
+	for _, spec := range file.Imports {
+		if importPath, err := strconv.Unquote(spec.Path.Value); err == nil {
+			paths = append(paths, importPath)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,43 @@
+package godef
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLookupGuess(t *testing.T) {
+	// The file does not parse past its first function, and
+	// nothing it uses can be type-checked.
+	xsrc := "package x\n\nimport \"example.com/x/dep\"\n\nfunc f() {\n\tv := 1\n\tv := dep.Open(v)\n\tv.Close(\n\tg(\n"
+	files := map[string]string{
+		"go.mod":     "module example.com/x\n",
+		"x.go":       xsrc,
+		"y.go":       "package x\n\ntype T struct{ v int }\n\nfunc g() {}\n",
+		"dep/dep.go": "package dep\n\nfunc Open(int) *F { return nil }\n\ntype F struct{}\n\nfunc (*F) Close() {}\n",
+	}
+	dir := writeTree(t, files)
+	for _, test := range []struct {
+		ident string
+		want  []string
+	}{
+		{"Open", []string{"dep.go:3"}},
+		{"Close", []string{"dep.go:7"}},
+		{"g(\n", []string{"y.go:5"}},
+		{"v)", []string{"x.go:7", "x.go:6"}},
+	} {
+		cands, err := LookupGuess(filepath.Join(dir, "x.go"), nil, strings.Index(xsrc, test.ident), nil)
+		if err != nil {
+			t.Errorf("%s: %v", test.ident, err)
+			continue
+		}
+		var got []string
+		for _, c := range cands {
+			got = append(got, fmt.Sprintf("%s:%d", filepath.Base(c.Filename), c.Line))
+		}
+		if strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("%s: got %v, want %v", test.ident, got, test.want)
+		}
+	}
+}
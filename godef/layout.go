@@ -0,0 +1,364 @@
+package godef
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// LookupLayout resolves the identifier at the given byte offset of
+// filename, whose contents are src if not nil, without the go
+// command. Identifiers declared in the file are found as by
+// LookupSyntax, those declared at package level in other files
+// of its directory by parsing them, and those qualified by an
+// imported package by guessing the package's directory from
+// GOROOT, the enclosing module, its vendor directory and its
+// requirements in the module cache, and GOPATH. The returned
+// object carries a position but no useful type information.
+func LookupLayout(filename string, src []byte, searchpos int) (*token.FileSet, types.Object, error) {
+	return lookupLayout(filename, src, searchpos, nil)
+}
+
+// lookupLayout is like LookupLayout, but ignores the files
+// that the exclude patterns match, as Excluded matches them.
+func lookupLayout(filename string, src []byte, searchpos int, exclude []string) (*token.FileSet, types.Object, error) {
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	if src == nil {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		src = data
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, 0)
+	if file == nil {
+		return nil, nil, err
+	}
+	tfile := fset.File(file.Pos())
+	if tfile == nil || searchpos > tfile.Size() {
+		return nil, nil, fmt.Errorf("cursor %d is beyond end of file %s", searchpos, filename)
+	}
+	pos := tfile.Pos(searchpos)
+	m, err := findMatch(file, pos)
+	if err != nil {
+		return nil, nil, err
+	}
+	if m.ident == nil {
+		return nil, nil, fmt.Errorf("Offset %d was not a valid identifier", searchpos)
+	}
+	if m.ident.Obj != nil {
+		obj, err := syntaxObject(m.ident.Obj)
+		if err != nil {
+			return nil, nil, err
+		}
+		return fset, obj, nil
+	}
+	nodes, _ := astutil.PathEnclosingInterval(file, m.ident.Pos(), m.ident.End())
+	for _, n := range nodes {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok || sel.Sel != m.ident {
+			continue
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok || x.Obj != nil {
+			break
+		}
+		importPath := importNamed(file, x.Name)
+		if importPath == "" {
+			break
+		}
+		dir := guessPackageDir(filename, importPath)
+		if dir == "" {
+			return nil, nil, fmt.Errorf("cannot find the source of package %q", importPath)
+		}
+		if pkgName := strings.TrimSuffix(file.Name.Name, "_test"); pkgName != file.Name.Name && SamePath(dir, filepath.Dir(filename)) {
+			// An external test package sees the test
+			// files of the package it tests, such as
+			// export_test.go.
+			return lookupDir(fset, dir, m.ident.Name, pkgName, filename, true, exclude)
+		}
+		return lookupDir(fset, dir, m.ident.Name, "", "", false, exclude)
+	}
+	tests := strings.HasSuffix(file.Name.Name, "_test") || strings.HasSuffix(filename, "_test.go")
+	return lookupDir(fset, filepath.Dir(filename), m.ident.Name, file.Name.Name, filename, tests, exclude)
+}
+
+// lookupDir finds the package-level declaration of name in the
+// Go files in dir that match the build constraints, other than
+// skip, and belong to package pkgName if it is not empty. Test
+// files are included only if tests is set, and files that the
+// exclude patterns match never are.
+func lookupDir(fset *token.FileSet, dir, name, pkgName, skip string, tests bool, exclude []string) (*token.FileSet, types.Object, error) {
+	names, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, filename := range names {
+		if SamePath(filename, skip) || Excluded(filename, exclude) {
+			continue
+		}
+		if strings.HasSuffix(filename, "_test.go") && !tests {
+			continue
+		}
+		if ok, err := build.Default.MatchFile(dir, filepath.Base(filename)); !ok && err == nil {
+			continue
+		}
+		f, _ := parser.ParseFile(fset, filename, nil, 0)
+		if f == nil || pkgName != "" && f.Name.Name != pkgName {
+			continue
+		}
+		if o := f.Scope.Lookup(name); o != nil {
+			obj, err := syntaxObject(o)
+			if err != nil {
+				return nil, nil, err
+			}
+			return fset, obj, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("no declaration of %s found in %s", name, dir)
+}
+
+// importNamed returns the path of the package imported by file
+// under the given name, or the empty string if there is none.
+// Without the package's source, its name is guessed from the last
+// element of its path.
+func importNamed(file *ast.File, name string) string {
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		if spec.Name != nil {
+			if spec.Name.Name == name {
+				return importPath
+			}
+			continue
+		}
+		if guessPackageName(importPath) == name {
+			return importPath
+		}
+	}
+	return ""
+}
+
+// guessPackageName guesses the name of the package with the given
+// import path from its last element, ignoring any major version
+// suffix, such as /v2 or .v2, and go- prefix or -go suffix.
+func guessPackageName(importPath string) string {
+	elem := path.Base(importPath)
+	if isMajorVersion(elem) && path.Dir(importPath) != "." {
+		elem = path.Base(path.Dir(importPath))
+	}
+	if i := strings.Index(elem, ".v"); i > 0 && isMajorVersion(elem[i+1:]) {
+		elem = elem[:i]
+	}
+	elem = strings.TrimPrefix(elem, "go-")
+	elem = strings.TrimSuffix(elem, "-go")
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return r
+	}, elem)
+}
+
+// isMajorVersion reports whether elem is of the form vN.
+func isMajorVersion(elem string) bool {
+	if len(elem) < 2 || elem[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(elem[1:])
+	return err == nil
+}
+
+// guessPackageDir guesses the directory holding the package with
+// the given import path, as imported from filename, trying the
+// places the go command would look in turn. It returns the empty
+// string if none of them exists.
+func guessPackageDir(filename, importPath string) string {
+	var dirs []string
+	goroot := os.Getenv("GOROOT")
+	if goroot == "" {
+		goroot = runtime.GOROOT()
+	}
+	dirs = append(dirs, filepath.Join(goroot, "src", filepath.FromSlash(importPath)))
+	if root, mod := findModule(filepath.Dir(filename)); root != "" {
+		if rest, ok := pathWithin(importPath, mod.path); ok {
+			dirs = append(dirs, filepath.Join(root, filepath.FromSlash(rest)))
+		}
+		dirs = append(dirs, filepath.Join(root, "vendor", filepath.FromSlash(importPath)))
+		if _, dir, rest, ok := longestWithin(mod.replace, importPath); ok {
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(root, dir)
+			}
+			dirs = append(dirs, filepath.Join(dir, filepath.FromSlash(rest)))
+		}
+		if modPath, version, rest, ok := longestWithin(mod.require, importPath); ok {
+			dirs = append(dirs, filepath.Join(modCache(), escapePath(modPath)+"@"+escapePath(version), filepath.FromSlash(rest)))
+		}
+	}
+	for _, dir := range gopath() {
+		dirs = append(dirs, filepath.Join(dir, "src", filepath.FromSlash(importPath)))
+	}
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	return ""
+}
+
+// pathWithin reports whether importPath is modPath or within it,
+// returning the rest of the path if so.
+func pathWithin(importPath, modPath string) (string, bool) {
+	if importPath == modPath {
+		return "", true
+	}
+	if strings.HasPrefix(importPath, modPath+"/") {
+		return importPath[len(modPath)+1:], true
+	}
+	return "", false
+}
+
+// longestWithin finds the longest module path in m that holds
+// importPath, returning it with its value and the rest of the path.
+func longestWithin(m map[string]string, importPath string) (modPath, value, rest string, ok bool) {
+	for p, v := range m {
+		if r, within := pathWithin(importPath, p); within && len(p) > len(modPath) {
+			modPath, value, rest, ok = p, v, r, true
+		}
+	}
+	return modPath, value, rest, ok
+}
+
+// goMod holds what the layout resolver needs of a go.mod file.
+type goMod struct {
+	path    string
+	require map[string]string // module path to version
+	replace map[string]string // module path to local directory
+}
+
+// findModule returns the root directory of the module containing
+// dir, with its go.mod file, or the empty string if there is none.
+func findModule(dir string) (string, *goMod) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", nil
+	}
+	for {
+		if data, err := ioutil.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, parseGoMod(data)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// parseGoMod reads the module path, requirements and replacements
+// by local directories from the contents of a go.mod file, without
+// checking its syntax.
+func parseGoMod(data []byte) *goMod {
+	mod := &goMod{
+		require: make(map[string]string),
+		replace: make(map[string]string),
+	}
+	block := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		if block != "" {
+			if f[0] == ")" {
+				block = ""
+				continue
+			}
+			f = append([]string{block}, f...)
+		} else if len(f) == 2 && f[1] == "(" {
+			block = f[0]
+			continue
+		}
+		switch {
+		case f[0] == "module" && len(f) == 2:
+			mod.path = unquote(f[1])
+		case f[0] == "require" && len(f) >= 3:
+			mod.require[unquote(f[1])] = unquote(f[2])
+		case f[0] == "replace":
+			// replace old [version] => new [version]
+			for i := range f {
+				if f[i] == "=>" && i+1 < len(f) && i+2 == len(f) {
+					if dir := unquote(f[i+1]); strings.HasPrefix(dir, ".") || filepath.IsAbs(dir) {
+						mod.replace[unquote(f[1])] = filepath.FromSlash(dir)
+					}
+				}
+			}
+		}
+	}
+	return mod
+}
+
+func unquote(s string) string {
+	if t, err := strconv.Unquote(s); err == nil {
+		return t
+	}
+	return s
+}
+
+// gopath returns the GOPATH entries, defaulting to $HOME/go.
+func gopath() []string {
+	if p := os.Getenv("GOPATH"); p != "" {
+		return filepath.SplitList(p)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return []string{filepath.Join(home, "go")}
+	}
+	return nil
+}
+
+// modCache returns the module cache directory.
+func modCache() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	if p := gopath(); len(p) > 0 {
+		return filepath.Join(p[0], "pkg", "mod")
+	}
+	return ""
+}
+
+// escapePath escapes a module path or version as the module cache
+// does, replacing each upper-case letter by ! and its lower case.
+func escapePath(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,117 @@
+package godef
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLookupLayout(t *testing.T) {
+	xsrc := "package x\n\nimport dep \"example.com/Dep/v2\"\n\nvar v = dep.F() + G\n"
+	files := map[string]string{
+		"x/go.mod":                              "module example.com/x\n\nrequire (\n\texample.com/Dep/v2 v2.0.0 // indirect\n)\n",
+		"x/x.go":                                xsrc,
+		"x/y.go":                                "package x\n\nconst G = 1\n",
+		"mod/example.com/!dep/v2@v2.0.0/dep.go": "package dep\n\nfunc F() int { return 0 }\n",
+	}
+	dir := writeTree(t, files)
+	defer os.Setenv("GOMODCACHE", os.Getenv("GOMODCACHE"))
+	os.Setenv("GOMODCACHE", filepath.Join(dir, "mod"))
+	for _, test := range []struct {
+		ident, file string
+		line        int
+	}{
+		{"F()", "dep.go", 3},
+		{"G\n", "y.go", 3},
+		{"v =", "x.go", 5},
+	} {
+		offset := strings.Index(xsrc, test.ident)
+		fset, obj, err := LookupLayout(filepath.Join(dir, "x", "x.go"), nil, offset)
+		if err != nil {
+			t.Errorf("%s: %v", test.ident, err)
+			continue
+		}
+		pos := fset.Position(obj.Pos())
+		if filepath.Base(pos.Filename) != test.file || pos.Line != test.line {
+			t.Errorf("%s: got %v, want %s:%d", test.ident, pos, test.file, test.line)
+		}
+	}
+}
+
+func TestLookupLayoutExternalTest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godef-layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	xsrc := "package x_test\n\nimport \"example.com/x\"\n\nvar v = x.Internal + helper\n"
+	files := map[string]string{
+		"go.mod":         "module example.com/x\n",
+		"x.go":           "package x\n\nfunc internal() int { return 0 }\n",
+		"export_test.go": "package x\n\nvar Internal = internal\n",
+		"x_test.go":      xsrc,
+		"y_test.go":      "package x_test\n\nvar helper = 1\n",
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for ident, want := range map[string]string{
+		"Internal": "export_test.go",
+		"helper":   "y_test.go",
+	} {
+		fset, obj, err := LookupLayout(filepath.Join(dir, "x_test.go"), nil, strings.Index(xsrc, ident))
+		if err != nil {
+			t.Errorf("%s: %v", ident, err)
+			continue
+		}
+		if pos := fset.Position(obj.Pos()); filepath.Base(pos.Filename) != want {
+			t.Errorf("%s: got %v, want %s", ident, pos, want)
+		}
+	}
+}
+
+func TestQueryNoExec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godef-noexec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "x.go")
+	src := "package x\n\nconst C = 1\n\nvar v = C\n"
+	if err := ioutil.WriteFile(filename, []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Query(context.Background(), Options{
+		Filename: filename,
+		Offset:   strings.LastIndex(src, "C"),
+		NoExec:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Engine != EngineLayout || r.Position.Line != 3 {
+		t.Errorf("got %v by the %s engine, want line 3 by the layout engine", r.Position, r.Engine)
+	}
+	if _, err := Query(context.Background(), Options{Filename: filename, Offset: 0, NoExec: true, Strict: true}); err == nil {
+		t.Errorf("strict query without exec succeeded")
+	}
+}
+
+func TestGuessPackageName(t *testing.T) {
+	for path, want := range map[string]string{
+		"fmt":                         "fmt",
+		"example.com/x/v2":            "x",
+		"gopkg.in/yaml.v2":            "yaml",
+		"github.com/mattn/go-sqlite3": "sqlite3",
+		"example.com/a-b":             "a_b",
+	} {
+		if got := guessPackageName(path); got != want {
+			t.Errorf("guessPackageName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
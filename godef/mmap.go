@@ -0,0 +1,50 @@
+package godef
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+)
+
+// largeFile is the size beyond which the syntax-only resolver maps
+// a file into memory rather than copying it, and first parses it
+// only as far as the declaration holding the identifier.
+const largeFile = 1 << 20
+
+// readSource returns the contents of filename, mapped into memory
+// if the file is large, along with a function that releases them.
+func readSource(filename string) ([]byte, func(), error) {
+	if info, err := os.Stat(filename); err == nil && info.Size() >= largeFile {
+		if data, unmap, err := mapFile(filename, info.Size()); err == nil {
+			return data, unmap, nil
+		}
+	}
+	data, err := ioutil.ReadFile(filename)
+	return data, func() {}, err
+}
+
+// declStarts holds the keywords that begin top-level
+// declarations in formatted source.
+var declStarts = [][]byte{
+	[]byte("\nfunc "),
+	[]byte("\ntype "),
+	[]byte("\nvar "),
+	[]byte("\nconst "),
+	[]byte("\nimport "),
+}
+
+// declEnd returns the offset in src of the start of the first
+// top-level declaration after offset, assuming that src is
+// formatted, or len(src) if there is none.
+func declEnd(src []byte, offset int) int {
+	if offset >= len(src) {
+		return len(src)
+	}
+	end := len(src)
+	for _, start := range declStarts {
+		if i := bytes.Index(src[offset:end], start); i >= 0 {
+			end = offset + i + 1
+		}
+	}
+	return end
+}
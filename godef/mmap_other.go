@@ -0,0 +1,12 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package godef
+
+import "fmt"
+
+// mapFile reports that files cannot be mapped into memory
+// on this system, so that they are read instead.
+func mapFile(filename string, size int64) ([]byte, func(), error) {
+	return nil, nil, fmt.Errorf("cannot map files on this system")
+}
@@ -0,0 +1,38 @@
+package godef
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is returned when resolving an identifier panics,
+// so that a bug in godef or the type checker is reported as an
+// error rather than crashing the calling program. Panics in the
+// goroutines that go/packages uses to type check packages cannot
+// be recovered, however.
+type PanicError struct {
+	Value    interface{} // the value passed to panic
+	Stack    []byte      // the stack of the panicking goroutine
+	Filename string      // the file holding the identifier
+	Offset   int         // the identifier's byte offset in the file
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("internal error resolving %s:#%d: %v", e.Filename, e.Offset, e.Value)
+}
+
+// RecoverPanic recovers from any panic while resolving the identifier
+// at the given offset of filename, storing a *PanicError in *err.
+// It must be called directly by a deferred function call:
+//
+//	defer godef.RecoverPanic(filename, offset, &err)
+func RecoverPanic(filename string, offset int, err *error) {
+	if v := recover(); v != nil {
+		*err = &PanicError{
+			Value:    v,
+			Stack:    debug.Stack(),
+			Filename: filename,
+			Offset:   offset,
+		}
+	}
+}
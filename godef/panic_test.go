@@ -0,0 +1,27 @@
+package godef
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	f := func() (err error) {
+		defer RecoverPanic("x.go", 12, &err)
+		panic("boom")
+	}
+	err := f()
+	perr, ok := err.(*PanicError)
+	if !ok {
+		t.Fatalf("got error %#v, want *PanicError", err)
+	}
+	if perr.Value != "boom" || perr.Filename != "x.go" || perr.Offset != 12 {
+		t.Errorf("got %+v, want boom at x.go:#12", perr)
+	}
+	if want := "internal error resolving x.go:#12: boom"; err.Error() != want {
+		t.Errorf("got message %q, want %q", err.Error(), want)
+	}
+	if !strings.Contains(string(perr.Stack), "TestRecoverPanic") {
+		t.Errorf("stack does not include the panicking function:\n%s", perr.Stack)
+	}
+}
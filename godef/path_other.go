@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package godef
+
+import "path/filepath"
+
+// NormalizePath returns name in a canonical form for comparison
+// and printing.
+func NormalizePath(name string) string {
+	return filepath.Clean(name)
+}
+
+// SamePath reports whether a and b name the same file.
+func SamePath(a, b string) bool {
+	return NormalizePath(a) == NormalizePath(b)
+}
@@ -0,0 +1,23 @@
+package godef
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSamePath(t *testing.T) {
+	dir := filepath.FromSlash("/work/m")
+	for _, test := range []struct {
+		a, b string
+		want bool
+	}{
+		{filepath.Join(dir, "x.go"), filepath.Join(dir, "x.go"), true},
+		{filepath.Join(dir, "x.go"), filepath.Join(dir, "sub", "..", "x.go"), true},
+		{filepath.Join(dir, "x.go"), dir + string(filepath.Separator) + "." + string(filepath.Separator) + "x.go", true},
+		{filepath.Join(dir, "x.go"), filepath.Join(dir, "y.go"), false},
+	} {
+		if got := SamePath(test.a, test.b); got != test.want {
+			t.Errorf("SamePath(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+//go:build windows
+// +build windows
+
+package godef
+
+import (
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// NormalizePath returns name in a canonical form for comparison
+// and printing: cleaned, with backslash separators, an upper-case
+// drive letter, and any 8.3 short names expanded.
+func NormalizePath(name string) string {
+	name = filepath.Clean(name)
+	if long, err := longPathName(name); err == nil {
+		name = long
+	}
+	if len(name) >= 2 && name[1] == ':' {
+		name = strings.ToUpper(name[:1]) + name[1:]
+	}
+	return name
+}
+
+// SamePath reports whether a and b name the same file,
+// ignoring case as Windows file systems do.
+func SamePath(a, b string) bool {
+	return strings.EqualFold(NormalizePath(a), NormalizePath(b))
+}
+
+func longPathName(name string) (string, error) {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]uint16, syscall.MAX_PATH)
+	for {
+		n, err := syscall.GetLongPathName(p, &buf[0], uint32(len(buf)))
+		if err != nil {
+			return "", err
+		}
+		if int(n) <= len(buf) {
+			return syscall.UTF16ToString(buf[:n]), nil
+		}
+		buf = make([]uint16, n)
+	}
+}
@@ -0,0 +1,20 @@
+package godef
+
+import "testing"
+
+func TestNormalizePathWindows(t *testing.T) {
+	for _, test := range []struct {
+		name, want string
+	}{
+		{`c:\nonexistent\x.go`, `C:\nonexistent\x.go`},
+		{`C:/nonexistent/sub/../x.go`, `C:\nonexistent\x.go`},
+		{`c:\nonexistent/x.go`, `C:\nonexistent\x.go`},
+	} {
+		if got := NormalizePath(test.name); got != test.want {
+			t.Errorf("NormalizePath(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+	if !SamePath(`c:\Nonexistent\X.go`, `C:/nonexistent/x.go`) {
+		t.Errorf("paths differing only in case and separators are not the same")
+	}
+}
@@ -0,0 +1,621 @@
+package godef
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/trace"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+// loadDef loads the package containing filename and returns
+// it along with the object referred to at searchpos, which may
+// be on a word in a comment or string literal if words is set.
+func loadDef(cfg *packages.Config, filename string, src []byte, searchpos int, words bool, report func(Event)) (*packages.Package, types.Object, error) {
+	parser, result := parseFile(filename, src, searchpos, words)
+	// Load, parse, and type-check the packages named on the command line.
+	if src != nil {
+		overlay := map[string][]byte{
+			filename: src,
+		}
+		for name, data := range cfg.Overlay {
+			if name != filename {
+				overlay[name] = data
+			}
+		}
+		cfg.Overlay = overlay
+	}
+	// Only the package holding the file is parsed and type checked,
+	// with the function bodies that do not contain searchpos
+	// trimmed; dependencies come from export data, so that their
+	// bodies are never examined at all.
+	cfg.Mode = packages.LoadSyntax
+	cfg.ParseFile = parser
+	if ctx := cfg.Context; ctx != nil {
+		// Stop parsing once the context is done, and
+		// trace the parsing of each file.
+		cfg.ParseFile = func(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			defer trace.StartRegion(ctx, "parse").End()
+			return parser(fset, filename, src)
+		}
+	}
+	// Parsing happens in goroutines of the loader, so panics
+	// there must be recovered there and passed back.
+	panicked := make(chan error, 1)
+	parse := cfg.ParseFile
+	cfg.ParseFile = func(fset *token.FileSet, fname string, src []byte) (_ *ast.File, err error) {
+		defer func() {
+			if _, ok := err.(*PanicError); ok {
+				select {
+				case panicked <- err:
+				default:
+				}
+			}
+		}()
+		defer RecoverPanic(filename, searchpos, &err)
+		start := time.Now()
+		defer func() {
+			report(Event{Kind: EventParsed, Filename: filename, Count: len(src), Duration: time.Since(start)})
+		}()
+		return parse(fset, fname, src)
+	}
+	report(Event{Kind: EventLoad, Filename: filename})
+	start := time.Now()
+	region := startRegion(cfg.Context, "load")
+	lpkgs, err := packages.Load(cfg, "file="+filename)
+	region.End()
+	if err != nil {
+		return nil, nil, &Error{ErrorLoad, err}
+	}
+	loaded := 0
+	packages.Visit(lpkgs, nil, func(*packages.Package) { loaded++ })
+	report(Event{Kind: EventLoaded, Filename: filename, Count: loaded, Duration: time.Since(start)})
+	select {
+	case err := <-panicked:
+		return nil, nil, err
+	default:
+	}
+	for _, pkg := range lpkgs {
+		// Most errors are spurious, caused by trimming the
+		// function bodies that do not contain searchpos.
+		if len(pkg.Errors) > 0 {
+			report(Event{Kind: EventPackageErrors, Filename: filename, Package: pkg.PkgPath, Count: len(pkg.Errors), Err: pkg.Errors[0]})
+		}
+	}
+	if cfg.Context != nil && cfg.Context.Err() != nil {
+		return nil, nil, &Error{ErrorLoad, cfg.Context.Err()}
+	}
+	if len(lpkgs) < 1 {
+		return nil, nil, &Error{ErrorLoad, fmt.Errorf("There must be at least one package that contains the file")}
+	}
+	// get the node
+	var m match
+	select {
+	case m = <-result:
+	default:
+		// The file was loaded, but there was nothing at searchpos.
+		return nil, nil, &Error{ErrorNoIdent, fmt.Errorf("no file found at search pos %d", searchpos)}
+	}
+	if m.ident == nil && m.link == "" && m.word == "" {
+		return nil, nil, &Error{ErrorNoIdent, fmt.Errorf("Offset %d was not a valid identifier", searchpos)}
+	}
+	defer startRegion(cfg.Context, "resolve").End()
+	start = time.Now()
+	var obj types.Object
+	switch {
+	case m.link != "":
+		obj, err = docLinkObject(lpkgs[0], m.file, m.link)
+	case m.word != "":
+		obj, err = wordObject(lpkgs[0], m.wordPos, m.word)
+	default:
+		obj, err = objectOf(lpkgs[0].TypesInfo, m)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	report(Event{Kind: EventResolved, Filename: filename, Duration: time.Since(start)})
+	return lpkgs[0], obj, nil
+}
+
+// startRegion starts a trace region of the given type, in ctx if
+// it is not nil. Loading is traced in regions of type "load", within
+// which each file is parsed in a region of type "parse"; the rest of
+// the loading time is spent type checking.
+func startRegion(ctx context.Context, regionType string) *trace.Region {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return trace.StartRegion(ctx, regionType)
+}
+
+// objectOf returns the object denoted by the matched identifier.
+func objectOf(info *types.Info, m match) (types.Object, error) {
+	obj := info.ObjectOf(m.ident)
+	if obj == nil {
+		return nil, &Error{ErrorNotFound, fmt.Errorf("no object")}
+	}
+	if m.wasEmbeddedField {
+		// the original position was on the embedded field declaration
+		// so we try to dig out the type and jump to that instead
+		if v, ok := obj.(*types.Var); ok {
+			if n, ok := v.Type().(*types.Named); ok {
+				obj = n.Obj()
+			}
+		}
+	}
+	return obj, nil
+}
+
+// Lookup returns the object referred to at the given byte offset
+// of filename within pkg, which must have been loaded with syntax
+// and type information, including all function bodies.
+func Lookup(pkg *packages.Package, filename string, offset int) (types.Object, error) {
+	isInputFile := newFileCompare(filename)
+	for _, f := range pkg.Syntax {
+		tfile := pkg.Fset.File(f.Pos())
+		if tfile == nil || !isInputFile(tfile.Name()) {
+			continue
+		}
+		if offset > tfile.Size() {
+			return nil, &Error{ErrorNoIdent, fmt.Errorf("cursor %d is beyond end of file %s (%d)", offset, filename, tfile.Size())}
+		}
+		m, err := findMatch(f, tfile.Pos(offset))
+		if err != nil {
+			return nil, &Error{ErrorNoIdent, err}
+		}
+		if m.ident == nil {
+			return nil, &Error{ErrorNoIdent, fmt.Errorf("Offset %d was not a valid identifier", offset)}
+		}
+		return objectOf(pkg.TypesInfo, m)
+	}
+	for _, f := range pkg.Syntax {
+		// In a package using cgo, the syntax is of the
+		// files cgo generated from the input file.
+		tfile := pkg.Fset.File(f.Pos())
+		if tfile == nil {
+			continue
+		}
+		data, err := ioutil.ReadFile(tfile.Name())
+		if err != nil || !isInputFile(cgoSource(data)) {
+			continue
+		}
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, &Error{ErrorLoad, err}
+		}
+		m, err := cgoMatch(pkg.Fset, f, src, offset)
+		if err != nil {
+			return nil, &Error{ErrorNoIdent, err}
+		}
+		if m.ident == nil {
+			return nil, &Error{ErrorNoIdent, fmt.Errorf("Offset %d was not a valid identifier", offset)}
+		}
+		return objectOf(pkg.TypesInfo, m)
+	}
+	return nil, &Error{ErrorLoad, fmt.Errorf("file %s not found in package %s", filename, pkg.PkgPath)}
+}
+
+// LookupSyntax resolves the identifier at the given byte offset
+// of filename, whose contents are src if not nil, using only the
+// declarations that go/parser can see within the file. The returned
+// object carries a position but no useful type information.
+func LookupSyntax(filename string, src []byte, searchpos int) (*token.FileSet, types.Object, error) {
+	if src == nil {
+		data, release, err := readSource(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		// The parser copies what it keeps, so
+		// the contents can be released after.
+		defer release()
+		src = data
+	}
+	if len(src) >= largeFile {
+		// Most identifiers are declared before they are used, so
+		// try the file as far as the end of the declaration holding
+		// the identifier before parsing all of it.
+		if end := declEnd(src, searchpos); end < len(src) {
+			if fset, obj, err := lookupSyntax(filename, src[:end], searchpos, true); err == nil {
+				return fset, obj, nil
+			}
+		}
+	}
+	return lookupSyntax(filename, src, searchpos, false)
+}
+
+// lookupSyntax implements LookupSyntax for the given contents of
+// filename. If prefix is set, src holds only the start of the file,
+// and so must parse without error.
+func lookupSyntax(filename string, src []byte, searchpos int, prefix bool) (*token.FileSet, types.Object, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, 0)
+	if file == nil || prefix && err != nil {
+		return nil, nil, err
+	}
+	tfile := fset.File(file.Pos())
+	if tfile == nil || searchpos > tfile.Size() {
+		return nil, nil, fmt.Errorf("cursor %d is beyond end of file %s", searchpos, filename)
+	}
+	m, err := findMatch(file, tfile.Pos(searchpos))
+	if err != nil {
+		return nil, nil, err
+	}
+	if m.ident == nil || m.ident.Obj == nil {
+		return nil, nil, fmt.Errorf("no declaration found in %s", filename)
+	}
+	obj, err := syntaxObject(m.ident.Obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fset, obj, nil
+}
+
+// syntaxObject returns an object standing for the declaration o
+// found by go/parser, with a position but no type information.
+func syntaxObject(o *ast.Object) (types.Object, error) {
+	pos := o.Pos()
+	if !pos.IsValid() {
+		return nil, fmt.Errorf("no position for %s", o.Name)
+	}
+	invalid := types.Typ[types.Invalid]
+	switch o.Kind {
+	case ast.Con:
+		return types.NewConst(pos, nil, o.Name, invalid, constant.MakeUnknown()), nil
+	case ast.Typ:
+		return types.NewTypeName(pos, nil, o.Name, invalid), nil
+	case ast.Var:
+		return types.NewVar(pos, nil, o.Name, invalid), nil
+	case ast.Fun:
+		return types.NewFunc(pos, nil, o.Name, types.NewSignature(nil, nil, nil, false)), nil
+	case ast.Lbl:
+		return types.NewLabel(pos, nil, o.Name), nil
+	}
+	return nil, fmt.Errorf("cannot resolve %s of kind %v", o.Name, o.Kind)
+}
+
+// match returns the ident plus any extra information needed
+type match struct {
+	ident            *ast.Ident
+	wasEmbeddedField bool
+
+	// link holds the text of the doc link at the search
+	// position, if it is in a comment, and file the file
+	// holding it.
+	link string
+	file *ast.File
+
+	// word holds the word at the search position, if it is in
+	// a comment or string literal and words are resolved, and
+	// wordPos its position.
+	word    string
+	wordPos token.Pos
+}
+
+// parseFile returns a function that can be used as a Parser in packages.Config.
+// It replaces the contents of a file that matches filename with the src.
+// It also drops all function bodies that do not contain the searchpos.
+// It also modifies the filename to be the canonical form that will appear in the fileset.
+func parseFile(filename string, src []byte, searchpos int, words bool) (func(*token.FileSet, string, []byte) (*ast.File, error), chan match) {
+	result := make(chan match, 1)
+	isInputFile := newFileCompare(filename)
+	return func(fset *token.FileSet, fname string, filedata []byte) (*ast.File, error) {
+		isInput := isInputFile(fname)
+		file, err := parser.ParseFile(fset, fname, filedata, 0)
+		if file == nil {
+			return nil, err
+		}
+		pos := token.Pos(-1)
+		if source := cgoSource(filedata); !isInput && source != "" && isInputFile(source) {
+			// The package uses cgo, and this is the input
+			// file as cgo rewrote it.
+			if src == nil {
+				if src, err = ioutil.ReadFile(filename); err != nil {
+					return nil, err
+				}
+			}
+			m, err := cgoMatch(fset, file, src, searchpos)
+			if err != nil {
+				return nil, err
+			}
+			if m.ident != nil {
+				pos = m.ident.Pos()
+			}
+			result <- m
+		} else if isInput {
+			tfile := fset.File(file.Pos())
+			if tfile == nil {
+				return file, fmt.Errorf("cursor %d is beyond end of file %s (%d)", searchpos, fname, file.End()-file.Pos())
+			}
+			if searchpos > tfile.Size() {
+				return file, fmt.Errorf("cursor %d is beyond end of file %s (%d)", searchpos, fname, tfile.Size())
+			}
+			pos = tfile.Pos(searchpos)
+			var m match
+			if text, ok := docLink(filedata, searchpos); ok {
+				m = match{link: text, file: file}
+			} else if words {
+				if word, start, ok := wordAt(filedata, searchpos); ok {
+					m = match{word: word, wordPos: tfile.Pos(start)}
+				}
+			}
+			if m.link == "" && m.word == "" {
+				if m, err = findMatch(file, pos); err != nil {
+					return nil, err
+				}
+			}
+			result <- m
+		}
+		TrimBodies(file, pos)
+		return file, err
+	}, result
+}
+
+// IsTest reports whether filename, whose contents are src if not
+// nil, must be loaded with its package's tests: that is, whether it
+// is a _test.go file, or its package clause names an external test
+// package, as that of a buffer being edited under another name may.
+func IsTest(filename string, src []byte) bool {
+	if strings.HasSuffix(filename, "_test.go") {
+		return true
+	}
+	if src == nil {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return false
+		}
+		src = data
+	}
+	f, _ := parser.ParseFile(token.NewFileSet(), filename, src, parser.PackageClauseOnly)
+	return f != nil && strings.HasSuffix(f.Name.Name, "_test")
+}
+
+func newFileCompare(filename string) func(string) bool {
+	fstat, fstatErr := os.Stat(filename)
+	return func(compare string) bool {
+		if filename == compare || SamePath(filename, compare) {
+			return true
+		}
+		if fstatErr != nil {
+			return false
+		}
+		if s, err := os.Stat(compare); err == nil {
+			return os.SameFile(fstat, s)
+		}
+		return false
+	}
+}
+
+func findMatch(f *ast.File, pos token.Pos) (match, error) {
+	m, err := checkMatch(f, pos)
+	if err != nil {
+		return match{}, err
+	}
+	if m.ident != nil {
+		return m, nil
+	}
+	// If the position is not an identifier but immediately follows
+	// an identifier or selector period (as is common when
+	// requesting a completion), use the path to the preceding node.
+	return checkMatch(f, pos-1)
+}
+
+// checkMatch checks a single position for a potential identifier.
+func checkMatch(f *ast.File, pos token.Pos) (match, error) {
+	path, _ := astutil.PathEnclosingInterval(f, pos, pos)
+	result := match{}
+	if path == nil {
+		return result, fmt.Errorf("can't find node enclosing position")
+	}
+	switch node := path[0].(type) {
+	case *ast.Ident:
+		result.ident = node
+	case *ast.SelectorExpr:
+		result.ident = node.Sel
+	}
+	if result.ident != nil {
+		for _, n := range path[1:] {
+			if field, ok := n.(*ast.Field); ok {
+				result.wasEmbeddedField = len(field.Names) == 0
+			}
+		}
+	}
+	return result, nil
+}
+
+// TrimBodies drops the contents of the function bodies, blocks,
+// clauses and composite literals of file that do not contain pos,
+// so that type checking the file skips them without changing the
+// types of its declarations. With token.NoPos, all are dropped.
+func TrimBodies(file *ast.File, pos token.Pos) {
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		if pos < n.Pos() || pos >= n.End() {
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				n.Body = nil
+			case *ast.BlockStmt:
+				n.List = nil
+			case *ast.CaseClause:
+				n.Body = nil
+			case *ast.CommClause:
+				n.Body = nil
+			case *ast.CompositeLit:
+				// Leave elts in place for [...]T
+				// array literals, because they can
+				// affect the expression's type.
+				if !isEllipsisArray(n.Type) {
+					n.Elts = nil
+				}
+			}
+		}
+		return true
+	})
+}
+
+func isEllipsisArray(n ast.Expr) bool {
+	at, ok := n.(*ast.ArrayType)
+	if !ok {
+		return false
+	}
+	_, ok = at.Len.(*ast.Ellipsis)
+	return ok
+}
+
+// Position returns the position of the declaration of obj.
+// Dependencies are loaded from export data, which may not record
+// columns; when the column is missing, only the file holding the
+// declaration is parsed, to find the identifier that declares obj.
+func Position(fSet *token.FileSet, obj types.Object) token.Position {
+	return position(fSet, obj, false)
+}
+
+// position is like Position, but if noExec is set, it does not
+// run the go command to find GOROOT, as sourcePosition explains.
+func position(fSet *token.FileSet, obj types.Object, noExec bool) token.Position {
+	pos := sourcePosition(fSet, obj.Pos(), noExec)
+	if cpos, ok := cgoPosition(fSet, pos, obj.Name()); ok {
+		return cpos
+	}
+	if pos.Column != 1 {
+		return pos
+	}
+	if col, ok := declColumn(pos.Filename, pos.Line, obj.Name()); ok {
+		pos.Column = col
+	}
+	return pos
+}
+
+// sourcePosition returns the position of p in fset. Export data
+// for the standard library names its files relative to $GOROOT,
+// so such names are expanded to name the files on disk, using the
+// GOROOT that the go command reports unless noExec is set.
+func sourcePosition(fset *token.FileSet, p token.Pos, noExec bool) token.Position {
+	pos := fset.Position(p)
+	if rest := strings.TrimPrefix(pos.Filename, "$GOROOT"); rest != pos.Filename {
+		if root := goroot(noExec); root != "" {
+			pos.Filename = filepath.Join(root, filepath.FromSlash(rest))
+		}
+	}
+	return pos
+}
+
+var gorootOnce struct {
+	sync.Once
+	dir string
+}
+
+// goroot returns the GOROOT used by the go command. If noExec is
+// set, the go command is not run, and $GOROOT, or failing that the
+// GOROOT that godef was built with, is returned instead.
+func goroot(noExec bool) string {
+	if noExec {
+		if dir := os.Getenv("GOROOT"); dir != "" {
+			return dir
+		}
+		return runtime.GOROOT()
+	}
+	gorootOnce.Do(func() {
+		if out, err := exec.Command("go", "env", "GOROOT").Output(); err == nil {
+			gorootOnce.dir = strings.TrimSpace(string(out))
+		} else {
+			gorootOnce.dir = os.Getenv("GOROOT")
+		}
+	})
+	return gorootOnce.dir
+}
+
+// declColumn returns the column of the identifier called name
+// declared on the given line of filename. If the file cannot be
+// parsed, it falls back to the first occurrence of name on the line.
+func declColumn(filename string, line int, name string) (int, bool) {
+	fset := token.NewFileSet()
+	file, _ := parser.ParseFile(fset, filename, nil, 0)
+	if file == nil {
+		return textColumn(filename, line, name)
+	}
+	col := 0
+	ast.Inspect(file, func(n ast.Node) bool {
+		if col != 0 || n == nil {
+			return false
+		}
+		if p := fset.Position(n.Pos()); p.Line > line {
+			return false
+		}
+		if p := fset.Position(n.End()); p.Line < line {
+			return false
+		}
+		for _, id := range declIdents(n) {
+			if id.Name == name {
+				if p := fset.Position(id.Pos()); p.Line == line {
+					col = p.Column
+					return false
+				}
+			}
+		}
+		return true
+	})
+	if col == 0 {
+		return textColumn(filename, line, name)
+	}
+	return col, true
+}
+
+// declIdents returns the identifiers declared directly by n.
+func declIdents(n ast.Node) []*ast.Ident {
+	switch n := n.(type) {
+	case *ast.FuncDecl:
+		return []*ast.Ident{n.Name}
+	case *ast.TypeSpec:
+		return []*ast.Ident{n.Name}
+	case *ast.ValueSpec:
+		return n.Names
+	case *ast.Field:
+		return n.Names
+	case *ast.ImportSpec:
+		if n.Name != nil {
+			return []*ast.Ident{n.Name}
+		}
+	case *ast.LabeledStmt:
+		return []*ast.Ident{n.Label}
+	}
+	return nil
+}
+
+// textColumn returns the column of the first occurrence
+// of name on the given line of filename.
+func textColumn(filename string, line int, name string) (int, bool) {
+	in, err := os.Open(filename)
+	if err != nil {
+		return 0, false
+	}
+	defer in.Close()
+	for l, scanner := 1, bufio.NewScanner(in); scanner.Scan(); l++ {
+		if l < line {
+			continue
+		}
+		col := bytes.Index([]byte(scanner.Text()), []byte(name))
+		return col + 1, col >= 0
+	}
+	return 0, false
+}
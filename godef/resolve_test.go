@@ -0,0 +1,138 @@
+package godef
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const declSrc = `package x
+
+type Foo struct{ Foo int }
+
+func (f *Foo) Foo() {}
+
+var bar, Foo2 = 1, 2
+
+type Baz Foo
+`
+
+func TestDeclColumn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godef-decl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "x.go")
+	if err := ioutil.WriteFile(filename, []byte(declSrc), 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		line int
+		name string
+		want int
+	}{
+		{3, "Foo", 6},
+		{5, "Foo", 15},
+		{7, "Foo2", 10},
+		{9, "Foo", 10}, // not declared, so found by text
+		{9, "Qux", 0},
+	} {
+		col, ok := declColumn(filename, test.line, test.name)
+		if col != test.want || ok != (test.want != 0) {
+			t.Errorf("declColumn(%d, %q) = %d, %v; want %d", test.line, test.name, col, ok, test.want)
+		}
+	}
+}
+
+func TestLookupSyntaxLargeFile(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("package x\n")
+	filler := func() {
+		for buf.Len() < largeFile {
+			fmt.Fprintf(&buf, "\nfunc f%d() {\n\tv := 1\n\t_ = v\n}\n", buf.Len())
+		}
+	}
+	filler()
+	buf.WriteString("\nfunc target() {\n\tlocal := 1\n\t_ = local\n\t_ = Later(0)\n}\n")
+	filler()
+	buf.WriteString("\ntype Later int\n")
+	src := buf.Bytes()
+
+	dir, err := ioutil.TempDir("", "godef-large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "x.go")
+	if err := ioutil.WriteFile(filename, src, 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		ref, decl string
+	}{
+		{"_ = local", "local := 1"},
+		{"_ = Later", "type Later"},
+	} {
+		offset := bytes.Index(src, []byte(test.ref)) + len("_ = ")
+		want := bytes.Index(src, []byte(test.decl))
+		if strings.HasPrefix(test.decl, "type ") {
+			want += len("type ")
+		}
+		fset, obj, err := LookupSyntax(filename, nil, offset)
+		if err != nil {
+			t.Errorf("%s: %v", test.ref, err)
+			continue
+		}
+		if got := fset.Position(obj.Pos()).Offset; got != want {
+			t.Errorf("%s: got declaration at offset %d, want %d", test.ref, got, want)
+		}
+	}
+}
+
+func TestDeclEnd(t *testing.T) {
+	src := []byte("package x\n\nfunc f() {\n\tvar x int\n}\n\nvar y int\n")
+	if got, want := declEnd(src, bytes.Index(src, []byte("var x"))), bytes.Index(src, []byte("var y")); got != want {
+		t.Errorf("declEnd in f = %d, want %d", got, want)
+	}
+	if got := declEnd(src, bytes.Index(src, []byte("var y"))); got != len(src) {
+		t.Errorf("declEnd in last declaration = %d, want %d", got, len(src))
+	}
+}
+
+func TestIsTest(t *testing.T) {
+	for _, test := range []struct {
+		filename, src string
+		want          bool
+	}{
+		{"x.go", "package x\n", false},
+		{"x_test.go", "package x\n", true},
+		{"x_test.go", "package x_test\n", true},
+		{"buffer.go", "package x_test\n", true},
+	} {
+		if got := IsTest(test.filename, []byte(test.src)); got != test.want {
+			t.Errorf("IsTest(%q, %q) = %v, want %v", test.filename, test.src, got, test.want)
+		}
+	}
+}
+
+func TestSourcePositionNoExec(t *testing.T) {
+	defer os.Setenv("GOROOT", os.Getenv("GOROOT"))
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	// With no go command to run, only $GOROOT can
+	// name the root.
+	os.Setenv("PATH", "")
+	os.Setenv("GOROOT", filepath.FromSlash("/goroot"))
+	fset := token.NewFileSet()
+	f := fset.AddFile("$GOROOT/src/fmt/print.go", -1, 10)
+	f.SetLines([]int{0})
+	pos := sourcePosition(fset, f.Pos(1), true)
+	if want := filepath.FromSlash("/goroot/src/fmt/print.go"); pos.Filename != want {
+		t.Errorf("got file %q, want %q", pos.Filename, want)
+	}
+}
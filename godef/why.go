@@ -0,0 +1,105 @@
+package godef
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+)
+
+// Explain describes, one step per line, how the identifier queried
+// in filename was resolved to r: the scope where it was found,
+// where that is, and which engine resolved it.
+func Explain(r *Result, filename string) []string {
+	obj := r.Object
+	var why []string
+	switch r.Engine {
+	case EngineParser:
+		why = append(why, fmt.Sprintf("%s is declared in the file's syntax", obj.Name()))
+	case EngineLayout:
+		why = append(why, fmt.Sprintf("%s is declared in the syntax of %s, found by guessing the layout of the source tree", obj.Name(), r.Position.Filename))
+	default:
+		why = append(why, fmt.Sprintf("%s is %s", obj.Name(), scopeOf(r)))
+		if w := originOf(r, filename); w != "" {
+			why = append(why, w)
+		}
+	}
+	if r.Fallback != "" {
+		why = append(why, fmt.Sprintf("resolved by the %s engine, because %s", r.Engine, r.Fallback))
+	} else {
+		why = append(why, fmt.Sprintf("resolved by the %s engine", r.Engine))
+	}
+	return why
+}
+
+// scopeOf describes the scope in which the object of r is declared.
+func scopeOf(r *Result) string {
+	obj := r.Object
+	switch obj := obj.(type) {
+	case *types.PkgName:
+		return "an import in the file scope"
+	case *types.Var:
+		if obj.IsField() {
+			return "a struct field"
+		}
+	case *types.Func:
+		if sig, ok := obj.Type().(*types.Signature); ok && sig.Recv() != nil {
+			return fmt.Sprintf("a method of %s", types.TypeString(sig.Recv().Type(), nil))
+		}
+	}
+	parent := obj.Parent()
+	switch {
+	case parent == nil:
+		return "declared in an unknown scope"
+	case parent == types.Universe:
+		return "predeclared in the universe scope"
+	case obj.Pkg() != nil && parent == obj.Pkg().Scope():
+		return fmt.Sprintf("declared in the package scope of %s", obj.Pkg().Path())
+	}
+	if r.Package != nil && r.Package.TypesInfo != nil {
+		for node, scope := range r.Package.TypesInfo.Scopes {
+			if scope == parent {
+				return "declared in " + describeScopeNode(node)
+			}
+		}
+	}
+	return "declared in a local scope"
+}
+
+// describeScopeNode describes the syntax that introduces a scope.
+func describeScopeNode(node ast.Node) string {
+	switch node.(type) {
+	case *ast.File:
+		return "the file scope"
+	case *ast.FuncType:
+		return "the scope of a function"
+	case *ast.BlockStmt:
+		return "a block"
+	case *ast.IfStmt:
+		return "an if statement"
+	case *ast.ForStmt, *ast.RangeStmt:
+		return "a for statement"
+	case *ast.SwitchStmt, *ast.TypeSwitchStmt:
+		return "a switch statement"
+	case *ast.CaseClause:
+		return "a case clause"
+	case *ast.CommClause:
+		return "a select case"
+	}
+	return "a local scope"
+}
+
+// originOf describes where the object of r comes from
+// relative to the queried file.
+func originOf(r *Result, filename string) string {
+	obj := r.Object
+	if obj.Pkg() == nil {
+		return ""
+	}
+	switch {
+	case newFileCompare(filename)(r.Position.Filename):
+		return "it is defined in the queried file"
+	case r.Package != nil && obj.Pkg() == r.Package.Types:
+		return fmt.Sprintf("it is defined in %s, another file of the same package", r.Position.Filename)
+	}
+	return fmt.Sprintf("it is defined in the imported package %s", obj.Pkg().Path())
+}
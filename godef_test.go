@@ -1,13 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"go/token"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
-	"go/types"
 
+	"github.com/rogpeppe/godef/godef"
 	"golang.org/x/tools/go/packages/packagestest"
 )
 
@@ -61,16 +65,21 @@ func runGoDefTest(t testing.TB, exporter packagestest.Exporter, runCount int, mo
 				}
 				defer ioutil.WriteFile(src.Filename, input, 0666)
 			}
-			var obj types.Object
-			var fSet *token.FileSet
+			var res *godef.Result
 			for i := 0; i < runCount; i++ {
-				fSet, obj, err = godef(exported.Config, src.Filename, input, src.Offset)
+				res, err = godef.Query(context.Background(), godef.Options{
+					Config:   exported.Config,
+					Filename: src.Filename,
+					Src:      input,
+					Offset:   src.Offset,
+					Strict:   true,
+				})
 				if err != nil {
 					t.Errorf("godef error %v: %v", posStr(src), err)
 					return
 				}
 			}
-			pos := objToPos(fSet, obj)
+			pos := res.Position
 			if pos.String() != target.String() {
 				t.Errorf("unexpected result %v -> %v want %v", posStr(src), posStr(pos), posStr(target))
 			}
@@ -101,3 +110,127 @@ func localPos(pos token.Position, e *packagestest.Exported, modules []packageste
 	}
 	return pos.String()
 }
+
+func TestStdinWithoutFilename(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module x\n",
+		"a.go":   "package x\n\nfunc G() {}\n",
+	})
+	for _, src := range []string{
+		"package x\n\nvar v = G\n",
+		"package x_test\n\nimport \"x\"\n\nvar v = x.G\n",
+	} {
+		stdout, stderr, code := runGodef(t, dir, src, nil, "-i", "-o", fmt.Sprint(strings.LastIndex(src, "G")))
+		if code != 0 {
+			t.Errorf("%q: exit status %d: %s", src, code, stderr)
+			continue
+		}
+		// The source is resolved as part of the package in the
+		// current directory, so G is found in another file.
+		if want := filepath.Join(dir, "a.go") + ":3:6\n"; stdout != want {
+			t.Errorf("%q: got %q, want %q", src, stdout, want)
+		}
+	}
+}
+
+func TestChdirFlag(t *testing.T) {
+	src := "package x\n\nfunc F() {}\n\nvar v = F\n"
+	dir := writeTree(t, map[string]string{
+		"m/go.mod": "module x\n",
+		"m/x.go":   src,
+	})
+	off := fmt.Sprint(strings.LastIndex(src, "F"))
+	want := filepath.Join(dir, "m", "x.go") + ":3:6\n"
+	for _, test := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"-C", "m", "-f", "x.go", "-o", off}, 0},
+		{[]string{"-C=m", "-f", "x.go", "-o", off}, 0},
+		{[]string{"-f", "x.go", "-C", "m", "-o", off}, exitUsage},
+		{[]string{"-C", "nonexistent", "-f", "x.go", "-o", off}, exitFailure},
+	} {
+		stdout, stderr, code := runGodef(t, dir, "", nil, test.args...)
+		if code != test.code {
+			t.Errorf("godef %s: got exit status %d, want %d; stderr: %s", strings.Join(test.args, " "), code, test.code, stderr)
+			continue
+		}
+		if code == 0 && stdout != want {
+			t.Errorf("godef %s: got %q, want %q", strings.Join(test.args, " "), stdout, want)
+		}
+	}
+}
+
+func TestTimeoutFlag(t *testing.T) {
+	src := "package x\n\nfunc F() {}\n\nvar v = F\n"
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module x\n",
+		"x.go":   src,
+	})
+	off := fmt.Sprint(strings.LastIndex(src, "F"))
+	_, stderr, code := runGodef(t, dir, "", nil, "-timeout", "1ns", "-f", "x.go", "-o", off)
+	if code != exitLoad || !strings.Contains(stderr, "timed out") {
+		t.Errorf("got exit status %d and %q, want %d and a timeout", code, stderr, exitLoad)
+	}
+	stdout, stderr, code := runGodef(t, dir, "", nil, "-timeout", "1m", "-f", "x.go", "-o", off)
+	if code != 0 || stdout != filepath.Join(dir, "x.go")+":3:6\n" {
+		t.Errorf("got exit status %d and %q; stderr: %s", code, stdout, stderr)
+	}
+}
+
+func TestGodefFlagsEnv(t *testing.T) {
+	src := "package x\n\nfunc F() {}\n\nvar v = F\n"
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module x\n",
+		"x.go":   src,
+	})
+	off := fmt.Sprint(strings.LastIndex(src, "F"))
+	plain := filepath.Join(dir, "x.go") + ":3:6\n"
+	for _, test := range []struct {
+		env  string
+		args []string
+		want string
+		code int
+	}{
+		{"-t", nil, plain + "F func()\n", 0},
+		// Flags on the command line take precedence.
+		{"-t", []string{"-t=false"}, plain, 0},
+		{"-t x.go", nil, "", exitUsage},
+	} {
+		args := append(test.args, "-f", "x.go", "-o", off)
+		stdout, stderr, code := runGodef(t, dir, "", []string{"GODEFFLAGS=" + test.env}, args...)
+		if code != test.code {
+			t.Errorf("GODEFFLAGS=%q: got exit status %d, want %d; stderr: %s", test.env, code, test.code, stderr)
+			continue
+		}
+		if code == 0 && stdout != test.want {
+			t.Errorf("GODEFFLAGS=%q: got %q, want %q", test.env, stdout, test.want)
+		}
+	}
+}
+
+func TestTraceFlag(t *testing.T) {
+	src := "package x\n\nfunc F() {}\n\nvar v = F\n"
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module x\n",
+		"x.go":   src,
+	})
+	traceFile := filepath.Join(dir, "trace.out")
+	_, stderr, code := runGodef(t, dir, "", nil, "-trace", traceFile, "-f", "x.go", "-o", fmt.Sprint(strings.LastIndex(src, "F")))
+	if code != 0 {
+		t.Fatalf("exit status %d: %s", code, stderr)
+	}
+	data, err := ioutil.ReadFile(traceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("go 1.")) {
+		t.Fatalf("%s is not a runtime trace", traceFile)
+	}
+	// The names of the task and regions are among the trace's strings.
+	for _, name := range []string{"godef", "read input", "load", "parse", "describe", "print"} {
+		if !bytes.Contains(data, []byte(name)) {
+			t.Errorf("trace has no region %q", name)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rogpeppe/godef/godef"
+	"golang.org/x/tools/go/packages"
+)
+
+func docMain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("doc", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: godef doc symbol|package|file:line:col\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	arg := fs.Arg(0)
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	var obj types.Object
+	var fset *token.FileSet
+	if addr, ok := parseFileAddress(arg); ok {
+		filename := abs(dir, addr.filename)
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		offset := addr.offset
+		if addr.line > 0 {
+			if offset, err = lineColOffset(content, addr.line, addr.col, encodingBytes); err != nil {
+				return &queryError{exitUsage, err}
+			}
+		}
+		res, err := typedObject(ctx, dir, filename, content, nil, offset)
+		if err != nil {
+			return err
+		}
+		fset, obj = res.Fset, res.Object
+	} else if isPackagePath(arg) && strings.Contains(arg, "/") {
+		return writePackageDoc(ctx, os.Stdout, arg)
+	} else {
+		fset, obj, err = resolveSymbol(ctx, arg)
+		if err != nil {
+			if isPackagePath(arg) && writePackageDoc(ctx, os.Stdout, arg) == nil {
+				return nil
+			}
+			return err
+		}
+	}
+	if pn, ok := obj.(*types.PkgName); ok {
+		return writePackageDoc(ctx, os.Stdout, pn.Imported().Path())
+	}
+	if obj.Pkg() == nil {
+		return &queryError{exitNotFound, fmt.Errorf("%s is predeclared", obj.Name())}
+	}
+	if obj.Parent() != nil && obj.Parent() != obj.Pkg().Scope() {
+		return &queryError{exitNotFound, fmt.Errorf("%s is not declared at package level", obj.Name())}
+	}
+	// Objects read from export data carry the line and column
+	// of their declarations, but not their offsets.
+	pos := godef.Position(fset, obj)
+	return writeDoc(os.Stdout, filepath.Dir(pos.Filename), obj.Pkg().Path(), pos, obj.Exported())
+}
+
+// writePackageDoc writes the documentation of the package with the
+// given import path, found as from the current module, to w.
+func writePackageDoc(ctx context.Context, w io.Writer, pkgPath string) error {
+	pkg, err := loadSymbolPackage(ctx, pkgPath, packages.LoadFiles)
+	if err != nil {
+		return err
+	}
+	if len(pkg.GoFiles) == 0 {
+		return &queryError{exitNotFound, fmt.Errorf("package %s has no Go files", pkgPath)}
+	}
+	return writeDoc(w, filepath.Dir(pkg.GoFiles[0]), pkg.PkgPath, token.Position{}, true)
+}
+
+// writeDoc writes to w the documentation of the declaration at pos
+// in the package with the given import path in dir, as go doc would
+// show it: the declaration, without any function body, its comment,
+// and the examples of it in the package's tests, if it is a type or
+// function. If pos is not
+// valid, it writes the package's own documentation and examples
+// instead. Unexported declarations are left out of their groups,
+// and unexported fields out of their structs, unless exported is
+// false.
+func writeDoc(w io.Writer, dir, pkgPath string, pos token.Position, exported bool) error {
+	fset := token.NewFileSet()
+	files := make(map[string]*ast.File)
+	var tests []*ast.File
+	var pkgName string
+	counts := make(map[string]int)
+	names, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, filename := range names {
+		if !matchFile(filename) {
+			continue
+		}
+		f, _ := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+		if f == nil {
+			continue
+		}
+		if strings.HasSuffix(filename, "_test.go") {
+			tests = append(tests, f)
+			continue
+		}
+		files[filename] = f
+		counts[f.Name.Name]++
+		if pkgName == "" || counts[f.Name.Name] > counts[pkgName] {
+			pkgName = f.Name.Name
+		}
+	}
+	// Files of other packages, such as documentation
+	// packages, are left out.
+	if f := files[pos.Filename]; f != nil {
+		pkgName = f.Name.Name
+	}
+	for filename, f := range files {
+		if f.Name.Name != pkgName {
+			delete(files, filename)
+		}
+	}
+	if len(files) == 0 {
+		return &queryError{exitNotFound, fmt.Errorf("no Go files in %s", dir)}
+	}
+	mode := doc.Mode(0)
+	if !exported {
+		mode = doc.AllDecls
+	}
+	dpkg := doc.New(&ast.Package{Name: pkgName, Files: files}, pkgPath, mode)
+	examples := doc.Examples(tests...)
+	if !pos.IsValid() {
+		fmt.Fprintf(w, "package %s // import %q\n\n", dpkg.Name, dpkg.ImportPath)
+		doc.ToText(w, dpkg.Doc, "", "\t", docWidth)
+		writeExamples(w, fset, examples, "")
+		return nil
+	}
+	before := func(p, q token.Position) bool {
+		return p.Line < q.Line || p.Line == q.Line && p.Column <= q.Column
+	}
+	contains := func(n ast.Node) bool {
+		start, end := fset.Position(n.Pos()), fset.Position(n.End())
+		return start.Filename == pos.Filename && before(start, pos) && before(pos, end)
+	}
+	write := func(decl ast.Decl, text, example string) error {
+		// The comment is written as text below.
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			copy := *d
+			copy.Doc, copy.Body = nil, nil
+			decl = &copy
+		case *ast.GenDecl:
+			copy := *d
+			copy.Doc = nil
+			decl = &copy
+		}
+		var comments []*ast.CommentGroup
+		if f := files[fset.Position(decl.Pos()).Filename]; f != nil {
+			comments = f.Comments
+		}
+		if err := docPrinter.Fprint(w, fset, &printer.CommentedNode{Node: decl, Comments: comments}); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "\n")
+		if text != "" {
+			doc.ToText(w, text, docIndent, docIndent+"\t", docWidth-len(docIndent))
+		}
+		if example != "" {
+			writeExamples(w, fset, examples, example)
+		}
+		return nil
+	}
+	values := append(dpkg.Consts, dpkg.Vars...)
+	funcs := dpkg.Funcs
+	for _, t := range dpkg.Types {
+		for _, m := range t.Methods {
+			if contains(m.Decl) {
+				return write(m.Decl, m.Doc, t.Name+"_"+m.Name)
+			}
+		}
+		values = append(append(values, t.Consts...), t.Vars...)
+		funcs = append(funcs, t.Funcs...)
+		if contains(t.Decl) {
+			return write(t.Decl, t.Doc, t.Name)
+		}
+	}
+	for _, f := range funcs {
+		if contains(f.Decl) {
+			return write(f.Decl, f.Doc, f.Name)
+		}
+	}
+	for _, v := range values {
+		if contains(v.Decl) {
+			return write(v.Decl, v.Doc, "")
+		}
+	}
+	return &queryError{exitNotFound, fmt.Errorf("no documented declaration at %v", pos)}
+}
+
+const (
+	docIndent = "    "
+	docWidth  = 80
+)
+
+// docPrinter prints declarations and examples aligned with spaces,
+// as go doc does.
+var docPrinter = &printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+
+// writeExamples writes to w the examples among examples for the
+// declaration whose examples are named name, or for the package if
+// name is empty, with their code, which ends with any comment giving
+// their expected output.
+func writeExamples(w io.Writer, fset *token.FileSet, examples []*doc.Example, name string) {
+	for _, ex := range examples {
+		suffix := ""
+		if ex.Name != name {
+			if !strings.HasPrefix(ex.Name, name+"_") {
+				continue
+			}
+			suffix = ex.Name[len(name)+1:]
+			// Further underscores separate a type from its
+			// method, and a suffix must start in lower case.
+			if r, _ := utf8.DecodeRuneInString(suffix); !unicode.IsLower(r) {
+				continue
+			}
+		}
+		if suffix == "" {
+			fmt.Fprintf(w, "\nExample:\n")
+		} else {
+			fmt.Fprintf(w, "\nExample (%s):\n", suffix)
+		}
+		var buf bytes.Buffer
+		docPrinter.Fprint(&buf, fset, &printer.CommentedNode{Node: ex.Code, Comments: ex.Comments})
+		code := buf.String()
+		if _, ok := ex.Code.(*ast.BlockStmt); ok {
+			// Leave out the braces of a function body
+			// and the indentation of its statements.
+			code = strings.TrimSuffix(strings.TrimPrefix(code, "{\n"), "\n}")
+			code = strings.Replace(code, "\n\t", "\n", -1)
+			code = strings.TrimPrefix(code, "\t")
+		}
+		for _, line := range strings.Split(code, "\n") {
+			fmt.Fprintf(w, "%s%s\n", docIndent, line)
+		}
+	}
+}
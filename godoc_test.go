@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"go/token"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteDoc(t *testing.T) {
+	files := map[string]string{
+		"x.go": `// Package x does things.
+package x
+
+// T is a thing.
+type T struct {
+	A int // A is counted.
+	b int
+}
+
+// M does nothing
+// to t.
+func (t *T) M() {
+	t.b++
+}
+
+// F returns one.
+func F() int { return 1 }
+`,
+		"x_test.go": `package x_test
+
+import (
+	"fmt"
+
+	"x"
+)
+
+func Example() {
+	fmt.Println(x.F())
+	// Output: 1
+}
+
+func ExampleF_twice() {
+	x.F()
+	x.F()
+}
+
+func ExampleT_M() {
+	new(x.T).M()
+}
+`,
+	}
+	dir := writeTree(t, files)
+	filename := filepath.Join(dir, "x.go")
+	for _, test := range []struct {
+		pos  token.Position
+		want string
+	}{{
+		pos: token.Position{},
+		want: `package x // import "example.com/x"
+
+Package x does things.
+
+Example:
+    fmt.Println(x.F())
+    // Output: 1
+`,
+	}, {
+		pos: token.Position{Filename: filename, Line: 5, Column: 6},
+		want: `type T struct {
+	A int // A is counted.
+	// contains filtered or unexported fields
+}
+    T is a thing.
+`,
+	}, {
+		pos: token.Position{Filename: filename, Line: 12, Column: 13},
+		want: `func (t *T) M()
+    M does nothing to t.
+
+Example:
+    new(x.T).M()
+`,
+	}, {
+		pos: token.Position{Filename: filename, Line: 17, Column: 6},
+		want: `func F() int
+    F returns one.
+
+Example (twice):
+    x.F()
+    x.F()
+`,
+	}} {
+		var buf bytes.Buffer
+		if err := writeDoc(&buf, dir, "example.com/x", test.pos, true); err != nil {
+			t.Errorf("%v: %v", test.pos, err)
+			continue
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("%v: got\n%s\nwant\n%s", test.pos, got, test.want)
+		}
+	}
+}
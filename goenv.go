@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// errNoExec is returned in place of running the go command
+// when -no-exec is given.
+var errNoExec = errors.New("-no-exec forbids running the go command")
+
+var gorootFlag = flag.String("goroot", "", "use the Go installation or standard library sources in `dir` rather than the go command's GOROOT")
+
+// setGOROOT applies the -goroot flag by setting $GOROOT, so that
+// the go command, go env and the standard library summaries all
+// agree on it. If the directory holds a go command, that is used
+// too, as the go command of another release refuses its sources.
+func setGOROOT() error {
+	if *gorootFlag == "" {
+		return nil
+	}
+	if *remoteFlag != "" {
+		return &queryError{exitUsage, fmt.Errorf("-goroot cannot be used with -remote, as the daemon uses its own GOROOT")}
+	}
+	dir, err := filepath.Abs(*gorootFlag)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(filepath.Join(dir, "src")); err != nil || !info.IsDir() {
+		return &queryError{exitUsage, fmt.Errorf("-goroot %s has no src directory", *gorootFlag)}
+	}
+	os.Setenv("GOROOT", dir)
+	gocmd := filepath.Join(dir, "bin", "go")
+	if runtime.GOOS == "windows" {
+		gocmd += ".exe"
+	}
+	if _, err := os.Stat(gocmd); err == nil {
+		os.Setenv("PATH", filepath.Dir(gocmd)+string(os.PathListSeparator)+os.Getenv("PATH"))
+	}
+	return nil
+}
+
+// goEnvCache holds the output of go env for each directory,
+// so that it is run at most once per directory by each process.
+var goEnvCache struct {
+	sync.Mutex
+	env map[string]map[string]string
+}
+
+// goEnvEntry is the output of go env cached on disk, along with the
+// stamps of the files it depends on. The entry is valid only while
+// none of them has changed.
+type goEnvEntry struct {
+	Env   map[string]string
+	Files map[string]fileStamp
+}
+
+// goEnv returns the go command's environment as seen from dir,
+// as printed by go env -json. With -cache, the result is also
+// kept on disk, keyed by dir and the process environment.
+func goEnv(ctx context.Context, dir string) (map[string]string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	goEnvCache.Lock()
+	defer goEnvCache.Unlock()
+	if env, ok := goEnvCache.env[dir]; ok {
+		return env, nil
+	}
+	key := goEnvKey(dir)
+	env := map[string]string(nil)
+	if *cacheFlag {
+		env = cachedGoEnv(key)
+	}
+	if env == nil {
+		if *noExecFlag {
+			return nil, errNoExec
+		}
+		cmd := exec.CommandContext(ctx, "go", "env", "-json")
+		cmd.Dir = dir
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("cannot run go env: %v", err)
+		}
+		if err := json.Unmarshal(out, &env); err != nil {
+			return nil, fmt.Errorf("cannot parse output of go env: %v", err)
+		}
+		if *cacheFlag {
+			cacheGoEnv(key, dir, env)
+		}
+	}
+	if goEnvCache.env == nil {
+		goEnvCache.env = make(map[string]map[string]string)
+	}
+	goEnvCache.env[dir] = env
+	return env, nil
+}
+
+// goEnvKey returns the key under which the go environment
+// of dir is cached on disk.
+func goEnvKey(dir string) string {
+	environ := os.Environ()
+	sort.Strings(environ)
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", dir)
+	for _, kv := range environ {
+		fmt.Fprintf(h, "%q\n", kv)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// goEnvFiles returns the files whose change may change
+// the go environment of dir, given env.
+func goEnvFiles(dir string, env map[string]string) []string {
+	files := []string{
+		filepath.Join(dir, "go.mod"),
+		filepath.Join(dir, "go.work"),
+	}
+	if goCmd, err := exec.LookPath("go"); err == nil {
+		files = append(files, goCmd)
+	}
+	for _, name := range []string{"GOENV", "GOMOD", "GOWORK"} {
+		if f := env[name]; filepath.IsAbs(f) {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+func goEnvCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "godef", "goenv"), nil
+}
+
+// cachedGoEnv returns the go environment cached under key,
+// or nil if there is none or it is out of date.
+func cachedGoEnv(key string) map[string]string {
+	dir, err := goEnvCacheDir()
+	if err != nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, key))
+	if err != nil {
+		return nil
+	}
+	var e goEnvEntry
+	if err := json.Unmarshal(data, &e); err != nil || e.Env == nil {
+		return nil
+	}
+	for name, stamp := range e.Files {
+		if s, ok := statFile(name); !ok || !s.same(stamp) {
+			return nil
+		}
+	}
+	return e.Env
+}
+
+// cacheGoEnv stores the go environment of dir under key.
+// Failures are ignored: the cache is only an optimization.
+func cacheGoEnv(key, dir string, env map[string]string) {
+	cacheDir, err := goEnvCacheDir()
+	if err != nil {
+		return
+	}
+	e := goEnvEntry{
+		Env:   env,
+		Files: make(map[string]fileStamp),
+	}
+	for _, name := range goEnvFiles(dir, env) {
+		addStamp(e.Files, name)
+	}
+	writeFileAtomic(filepath.Join(cacheDir, key), e)
+}
+
+// goEnvVars returns NAME=value pairs for the cacheEnv variables as
+// the go command sees them from dir, including those set by GOENV
+// files and go.work. If go env cannot be run, the values are taken
+// from the process environment instead.
+func goEnvVars(ctx context.Context, dir string) []string {
+	env, err := goEnv(ctx, dir)
+	vars := make([]string, len(cacheEnv))
+	for i, name := range cacheEnv {
+		value := env[name]
+		if err != nil {
+			value = os.Getenv(name)
+		}
+		vars[i] = name + "=" + value
+	}
+	return vars
+}
+
+// buildContext returns the build context that the go command
+// uses in dir, with GOOS, GOARCH, cgo and any build tags given
+// in GOFLAGS as go env reports them there.
+func buildContext(dir string) *build.Context {
+	ctxt := build.Default
+	env, err := goEnv(context.Background(), dir)
+	if err != nil {
+		return &ctxt
+	}
+	if env["GOOS"] != "" {
+		ctxt.GOOS = env["GOOS"]
+	}
+	if env["GOARCH"] != "" {
+		ctxt.GOARCH = env["GOARCH"]
+	}
+	if env["GOROOT"] != "" {
+		ctxt.GOROOT = env["GOROOT"]
+	}
+	ctxt.GOPATH = env["GOPATH"]
+	ctxt.CgoEnabled = env["CGO_ENABLED"] == "1"
+	for _, f := range strings.Fields(env["GOFLAGS"]) {
+		if f = strings.TrimLeft(f, "-"); strings.HasPrefix(f, "tags=") {
+			ctxt.BuildTags = strings.Split(f[len("tags="):], ",")
+		}
+	}
+	return &ctxt
+}
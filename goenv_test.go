@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGoEnv(t *testing.T) {
+	env, err := goEnv(context.Background(), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env["GOROOT"] == "" {
+		t.Errorf("no GOROOT in go env output")
+	}
+	again, err := goEnv(context.Background(), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again["GOROOT"] != env["GOROOT"] {
+		t.Errorf("got GOROOT %q the second time, want %q", again["GOROOT"], env["GOROOT"])
+	}
+}
+
+func TestGoEnvVars(t *testing.T) {
+	env, err := goEnv(context.Background(), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := goEnvVars(context.Background(), ".")
+	if len(vars) != len(cacheEnv) {
+		t.Fatalf("got %d variables, want %d", len(vars), len(cacheEnv))
+	}
+	found := false
+	for _, v := range vars {
+		found = found || v == "GOROOT="+env["GOROOT"]
+	}
+	if !found {
+		t.Errorf("got %q, want GOROOT=%s among them", vars, env["GOROOT"])
+	}
+	if got := buildContext(".").GOARCH; got != env["GOARCH"] {
+		t.Errorf("got build context GOARCH %q, want %q", got, env["GOARCH"])
+	}
+}
+
+func TestCachedGoEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godef-goenv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("XDG_CACHE_HOME", os.Getenv("XDG_CACHE_HOME"))
+	os.Setenv("XDG_CACHE_HOME", dir)
+	env := map[string]string{"GOROOT": "/go", "GOMOD": filepath.Join(dir, "go.mod")}
+	cacheGoEnv("key", dir, env)
+	if got := cachedGoEnv("key"); got["GOROOT"] != "/go" {
+		t.Fatalf("got cached env %v, want GOROOT /go", got)
+	}
+	// Creating go.mod changes the environment.
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module x\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if got := cachedGoEnv("key"); got != nil {
+		t.Errorf("got stale cached env %v", got)
+	}
+}
+
+func TestSetGOROOT(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godef-goroot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("GOROOT", os.Getenv("GOROOT"))
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	defer func(dir string) { *gorootFlag = dir }(*gorootFlag)
+	*gorootFlag = dir
+	if err := setGOROOT(); err == nil {
+		t.Errorf("no error for -goroot without sources")
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "src"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := setGOROOT(); err != nil {
+		t.Fatal(err)
+	}
+	if got := os.Getenv("GOROOT"); got != dir {
+		t.Errorf("got GOROOT %q, want %q", got, dir)
+	}
+	if filepath.SplitList(os.Getenv("PATH"))[0] == filepath.Join(dir, "bin") {
+		t.Errorf("PATH includes the bin directory of a GOROOT with no go command")
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// engineGoMod names the engine that answers queries on go.mod files.
+const engineGoMod = "gomod"
+
+// modDirective is a directive in a go.mod file, such as a require
+// or replace line, with the byte offset of each of its arguments.
+// Directives in blocks are given their block's verb.
+type modDirective struct {
+	verb string
+	args []string
+	offs []int
+}
+
+// parseModDirectives splits the contents of a go.mod file into
+// directives, without checking their syntax.
+func parseModDirectives(data []byte) []modDirective {
+	var ds []modDirective
+	block := ""
+	off := 0
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		start := off
+		off += len(line)
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		var args []string
+		var offs []int
+		for i := 0; i < len(line); {
+			if unicode.IsSpace(rune(line[i])) {
+				i++
+				continue
+			}
+			j := i
+			for j < len(line) && !unicode.IsSpace(rune(line[j])) {
+				j++
+			}
+			arg := line[i:j]
+			if s, err := strconv.Unquote(arg); err == nil {
+				arg = s
+			}
+			args, offs = append(args, arg), append(offs, start+i)
+			i = j
+		}
+		switch {
+		case len(args) == 0:
+		case block != "":
+			if args[0] == ")" {
+				block = ""
+			} else {
+				ds = append(ds, modDirective{block, args, offs})
+			}
+		case len(args) == 2 && args[1] == "(":
+			block = args[0]
+		default:
+			ds = append(ds, modDirective{args[0], args[1:], offs[1:]})
+		}
+	}
+	return ds
+}
+
+// arrow returns the index of the => in a replace directive, or -1.
+func (d modDirective) arrow() int {
+	for i, arg := range d.args {
+		if arg == "=>" {
+			return i
+		}
+	}
+	return -1
+}
+
+// goModDefinition answers a query at the given offset of the
+// go.mod file filename, whose contents are src if not nil. On a
+// module path in a require or replace directive, the definition
+// is the directory holding the source that the module builds with:
+// its replacement, if it has one, or else its copy in the module
+// cache, or that copy anyway with -original.
+// With -t, the module's path and version follow, along with
+// the position of its doc.go file if it has one.
+func goModDefinition(ctx context.Context, filename string, src []byte, offset int) (*definition, error) {
+	if src == nil {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		src = data
+	}
+	ds := parseModDirectives(src)
+	var d modDirective
+	arg := -1
+	for _, dd := range ds {
+		for i, off := range dd.offs {
+			if off <= offset && offset <= off+len(dd.args[i]) {
+				d, arg = dd, i
+			}
+		}
+	}
+	if arg < 0 || d.verb != "require" && d.verb != "replace" || d.args[arg] == "=>" {
+		return nil, &queryError{exitNoIdent, fmt.Errorf("no module path in a require or replace directive at offset %d", offset)}
+	}
+	modPath, version := d.args[0], ""
+	if len(d.args) > 1 && d.args[1] != "=>" {
+		version = d.args[1]
+	}
+	target, targetVersion := modPath, version
+	if d.verb == "replace" {
+		k := d.arrow()
+		if k < 0 || k+1 >= len(d.args) {
+			return nil, &queryError{exitNotFound, fmt.Errorf("malformed replace directive")}
+		}
+		target, targetVersion = d.args[k+1], ""
+		if k+2 < len(d.args) {
+			targetVersion = d.args[k+2]
+		}
+	} else if !*originalFlag {
+		// A replace directive for the module, or for
+		// this version of it, takes its place.
+		for _, r := range ds {
+			k := r.arrow()
+			if r.verb != "replace" || k < 1 || k+1 >= len(r.args) || r.args[0] != modPath || k == 2 && r.args[1] != version {
+				continue
+			}
+			target, targetVersion = r.args[k+1], ""
+			if k+2 < len(r.args) {
+				targetVersion = r.args[k+2]
+			}
+		}
+	}
+	var dir string
+	if targetVersion == "" {
+		// Only a local directory can replace a module
+		// without giving a version.
+		dir = filepath.FromSlash(target)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(filename), dir)
+		}
+	} else {
+		env, err := goEnv(ctx, filepath.Dir(filename))
+		if err != nil {
+			return nil, err
+		}
+		if env["GOMODCACHE"] == "" {
+			return nil, &queryError{exitNotFound, fmt.Errorf("no module cache")}
+		}
+		dir = filepath.Join(env["GOMODCACHE"], filepath.FromSlash(escapePath(target)+"@"+escapePath(targetVersion)))
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		if targetVersion == "" {
+			return nil, &queryError{exitNotFound, fmt.Errorf("replacement directory %s does not exist", dir)}
+		}
+		return nil, &queryError{exitNotFound, fmt.Errorf("%s@%s is not in the module cache (run go mod download %[1]s@%[2]s)", target, targetVersion)}
+	}
+	def := &definition{
+		Pos:    token.Position{Filename: dir},
+		Engine: engineGoMod,
+		Type:   strings.TrimSpace("module " + modPath + " " + version),
+	}
+	if target != modPath || targetVersion != version {
+		def.Type += " => " + strings.TrimSpace(target+" "+targetVersion)
+	}
+	if doc := filepath.Join(dir, "doc.go"); fileExists(doc) {
+		def.Members = []member{{Type: "doc.go", Pos: token.Position{Filename: doc, Line: 1, Column: 1}}}
+	}
+	return def, nil
+}
+
+func fileExists(filename string) bool {
+	info, err := os.Stat(filename)
+	return err == nil && !info.IsDir()
+}
+
+var originalFlag = flag.Bool("original", false, "report positions in modules replaced by local directories at the module cache copy of the original")
+
+// localReplacements returns a map from each local directory that
+// replaces a module in the go.mod file gomod, whose contents are
+// data, to the directory in modCache holding the version of the
+// module that it replaces. Replaced modules without a version
+// are left out, as they have no copy in the module cache.
+func localReplacements(gomod string, data []byte, modCache string) map[string]string {
+	ds := parseModDirectives(data)
+	required := make(map[string]string)
+	for _, d := range ds {
+		if d.verb == "require" && len(d.args) >= 2 {
+			required[d.args[0]] = d.args[1]
+		}
+	}
+	m := make(map[string]string)
+	for _, d := range ds {
+		k := d.arrow()
+		if d.verb != "replace" || k < 1 || k+2 != len(d.args) {
+			// Not a replacement by a directory.
+			continue
+		}
+		modPath, version := d.args[0], required[d.args[0]]
+		if k == 2 {
+			version = d.args[1]
+		}
+		if version == "" {
+			continue
+		}
+		dir := filepath.FromSlash(d.args[k+1])
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(gomod), dir)
+		}
+		m[dir] = filepath.Join(modCache, filepath.FromSlash(escapePath(modPath)+"@"+escapePath(version)))
+	}
+	return m
+}
+
+// originalDefinition moves the positions of def that lie in local
+// directories replacing modules required by the current module to
+// the same places in the module cache copies of the modules they
+// replace, as -original asks, where those copies exist.
+func originalDefinition(ctx context.Context, def *definition) {
+	env, err := goEnv(ctx, ".")
+	if err != nil {
+		logf(levelDebug, "cannot find replaced modules: %v", err)
+		return
+	}
+	if env["GOMOD"] == "" || env["GOMOD"] == os.DevNull {
+		return
+	}
+	data, err := ioutil.ReadFile(env["GOMOD"])
+	if err != nil {
+		return
+	}
+	m := localReplacements(env["GOMOD"], data, env["GOMODCACHE"])
+	def.Pos.Filename = originalFile(m, def.Pos.Filename)
+	for i := range def.Members {
+		def.Members[i].Pos.Filename = originalFile(m, def.Members[i].Pos.Filename)
+	}
+}
+
+// originalFile returns the name of the file in the module cache
+// corresponding to filename, according to the replacements m,
+// or filename itself if there is none.
+func originalFile(m map[string]string, filename string) string {
+	for dir, orig := range m {
+		rel, err := filepath.Rel(dir, filename)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if name := filepath.Join(orig, rel); fileExists(name) || rel == "." && fileExists(filepath.Join(orig, "go.mod")) {
+			return name
+		}
+		logf(levelWarn, "%s has no original in the module cache", filename)
+	}
+	return filename
+}
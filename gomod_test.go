@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testGoMod = `module example.com/m
+
+require (
+	example.com/a v1.0.0 // indirect
+	example.com/b v1.2.0
+)
+
+replace example.com/b => ./b
+`
+
+func TestGoModDefinition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godef-gomod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "b"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "b", "doc.go"), []byte("package b\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "go.mod")
+	for _, at := range []string{"example.com/b v1", "example.com/b =>", "./b"} {
+		def, err := goModDefinition(context.Background(), filename, []byte(testGoMod), strings.Index(testGoMod, at)+1)
+		if err != nil {
+			t.Errorf("at %q: %v", at, err)
+			continue
+		}
+		if want := filepath.Join(dir, "b"); def.Pos.Filename != want {
+			t.Errorf("at %q: got %s, want %s", at, def.Pos.Filename, want)
+		}
+		if len(def.Members) != 1 || def.Members[0].Type != "doc.go" {
+			t.Errorf("at %q: got members %v, want doc.go", at, def.Members)
+		}
+	}
+	if _, err := goModDefinition(context.Background(), filename, []byte(testGoMod), 2); err == nil {
+		t.Errorf("got definition for the module directive")
+	}
+}
+
+func TestOriginalFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godef-original")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	modCache := filepath.Join(dir, "mod")
+	orig := filepath.Join(modCache, "example.com", "b@v1.2.0")
+	if err := os.MkdirAll(orig, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(orig, "b.go"), []byte("package b\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	m := localReplacements(filepath.Join(dir, "go.mod"), []byte(testGoMod), modCache)
+	for filename, want := range map[string]string{
+		filepath.Join(dir, "b", "b.go"):   filepath.Join(orig, "b.go"),
+		filepath.Join(dir, "b", "new.go"): filepath.Join(dir, "b", "new.go"),
+		filepath.Join(dir, "m.go"):        filepath.Join(dir, "m.go"),
+	} {
+		if got := originalFile(m, filename); got != want {
+			t.Errorf("originalFile(%s) = %s, want %s", filename, got, want)
+		}
+	}
+}
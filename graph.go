@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"golang.org/x/tools/go/packages"
+)
+
+func graphMain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	jsonOut := fs.Bool("json", false, "print each package as a JSON object on its own line")
+	dotOut := fs.Bool("dot", false, "print the graph in the DOT language of Graphviz")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: godef graph [-json | -dot] [package]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 || *jsonOut && *dotOut {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	pattern := "."
+	if fs.NArg() == 1 {
+		pattern = fs.Arg(0)
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	root := dir
+	if env, err := goEnv(ctx, dir); err == nil && env["GOMOD"] != "" && env["GOMOD"] != os.DevNull {
+		root = filepath.Dir(env["GOMOD"])
+	}
+	cfg := &packages.Config{
+		Context: ctx,
+		Dir:     dir,
+		Mode:    packages.LoadFiles,
+	}
+	target, err := packages.Load(cfg, pattern)
+	if err != nil {
+		return err
+	}
+	if len(target) != 1 {
+		return &queryError{exitUsage, fmt.Errorf("%s matches %d packages, not one", pattern, len(target))}
+	}
+	cfg.Dir, cfg.Mode = root, packages.LoadImports
+	lpkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return err
+	}
+	g := newImportGraph(lpkgs, target[0].PkgPath)
+	if g == nil {
+		return &queryError{exitNotFound, fmt.Errorf("package %s is not in the module at %s", target[0].PkgPath, root)}
+	}
+	format := "text"
+	switch {
+	case *jsonOut:
+		format = "json"
+	case *dotOut:
+		format = "dot"
+	}
+	return g.write(os.Stdout, format)
+}
+
+// importGraph is the part of the import graph of a module's packages
+// that leads to or from one of them: the packages it imports, directly
+// or indirectly, and those that import it, with the imports between
+// them. Packages outside the module are left out.
+type importGraph struct {
+	Root    string
+	Imports map[string][]string // import path to those of its imports in the graph, sorted
+}
+
+// newImportGraph returns the import graph around the package with
+// the given path among pkgs, loaded with their imports, or nil if
+// it is not among them.
+func newImportGraph(pkgs []*packages.Package, root string) *importGraph {
+	imports := make(map[string][]string)
+	for _, pkg := range pkgs {
+		imports[pkg.PkgPath] = []string{}
+	}
+	if _, ok := imports[root]; !ok {
+		return nil
+	}
+	importedBy := make(map[string][]string)
+	for _, pkg := range pkgs {
+		for path := range pkg.Imports {
+			if _, ok := imports[path]; ok {
+				imports[pkg.PkgPath] = append(imports[pkg.PkgPath], path)
+				importedBy[path] = append(importedBy[path], pkg.PkgPath)
+			}
+		}
+	}
+	forward := reachable(root, imports)
+	reverse := reachable(root, importedBy)
+	g := &importGraph{
+		Root:    root,
+		Imports: make(map[string][]string),
+	}
+	g.Imports[root] = nil
+	for from, tos := range imports {
+		if !forward[from] && !reverse[from] {
+			continue
+		}
+		g.Imports[from] = nil
+		for _, to := range tos {
+			// Imports from the root and the packages it imports
+			// lead to more of those; other packages in the graph
+			// import the root, so only imports among them count.
+			if forward[from] || reverse[to] {
+				g.Imports[from] = append(g.Imports[from], to)
+			}
+		}
+		sort.Strings(g.Imports[from])
+	}
+	return g
+}
+
+// reachable returns the set of nodes reachable from start, itself
+// included, by following edges.
+func reachable(start string, edges map[string][]string) map[string]bool {
+	seen := map[string]bool{start: true}
+	queue := []string{start}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, m := range edges[n] {
+			if !seen[m] {
+				seen[m] = true
+				queue = append(queue, m)
+			}
+		}
+	}
+	return seen
+}
+
+// paths returns the import paths of the packages in g, sorted.
+func (g *importGraph) paths() []string {
+	var paths []string
+	for path := range g.Imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// graphNode is the JSON form of a package printed by godef graph -json.
+type graphNode struct {
+	Path       string   `json:"path"`
+	Root       bool     `json:"root,omitempty"`
+	Imports    []string `json:"imports,omitempty"`
+	ImportedBy []string `json:"importedBy,omitempty"`
+}
+
+// write prints g to w in the given format: as text, each import as
+// a line holding the importing and imported paths, as in go mod
+// graph; as json, each package as a JSON object on its own line;
+// or as dot, a Graphviz digraph with the root in bold.
+func (g *importGraph) write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		importedBy := make(map[string][]string)
+		for _, from := range g.paths() {
+			for _, to := range g.Imports[from] {
+				importedBy[to] = append(importedBy[to], from)
+			}
+		}
+		enc := json.NewEncoder(w)
+		for _, path := range g.paths() {
+			node := &graphNode{
+				Path:       path,
+				Root:       path == g.Root,
+				Imports:    g.Imports[path],
+				ImportedBy: importedBy[path],
+			}
+			if err := enc.Encode(node); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "dot":
+		fmt.Fprintf(w, "digraph imports {\n")
+		fmt.Fprintf(w, "\t%s [style=bold];\n", strconv.Quote(g.Root))
+		for _, from := range g.paths() {
+			for _, to := range g.Imports[from] {
+				fmt.Fprintf(w, "\t%s -> %s;\n", strconv.Quote(from), strconv.Quote(to))
+			}
+		}
+		_, err := fmt.Fprintf(w, "}\n")
+		return err
+	}
+	for _, from := range g.paths() {
+		for _, to := range g.Imports[from] {
+			if _, err := fmt.Fprintf(w, "%s %s\n", from, to); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
+
+func TestImportGraph(t *testing.T) {
+	pkgs := make(map[string]*packages.Package)
+	var list []*packages.Package
+	for _, path := range []string{"x/cmd", "x/lib", "x/util", "x/other", "x/tool"} {
+		pkgs[path] = &packages.Package{PkgPath: path, Imports: make(map[string]*packages.Package)}
+		list = append(list, pkgs[path])
+	}
+	for from, tos := range map[string][]string{
+		"x/cmd":   {"x/lib", "x/util", "fmt"},
+		"x/lib":   {"x/util", "strings"},
+		"x/tool":  {"x/cmd"},
+		"x/other": {"x/util"},
+	} {
+		for _, to := range tos {
+			pkg := pkgs[to]
+			if pkg == nil {
+				pkg = &packages.Package{PkgPath: to}
+			}
+			pkgs[from].Imports[to] = pkg
+		}
+	}
+	if g := newImportGraph(list, "fmt"); g != nil {
+		t.Errorf("got graph around a package outside the module")
+	}
+	g := newImportGraph(list, "x/lib")
+	for format, want := range map[string]string{
+		"text": `x/cmd x/lib
+x/lib x/util
+x/tool x/cmd
+`,
+		"json": `{"path":"x/cmd","imports":["x/lib"],"importedBy":["x/tool"]}
+{"path":"x/lib","root":true,"imports":["x/util"],"importedBy":["x/cmd"]}
+{"path":"x/tool","imports":["x/cmd"]}
+{"path":"x/util","importedBy":["x/lib"]}
+`,
+		"dot": `digraph imports {
+	"x/lib" [style=bold];
+	"x/cmd" -> "x/lib";
+	"x/lib" -> "x/util";
+	"x/tool" -> "x/cmd";
+}
+`,
+	} {
+		var buf bytes.Buffer
+		if err := g.write(&buf, format); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != want {
+			t.Errorf("%s graph: got\n%s\nwant\n%s", format, got, want)
+		}
+	}
+}
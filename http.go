@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// serveHTTP serves the /definition, /hover and /members endpoints
+// on addr until ctx is done. Each takes the file and offset as
+// query parameters, or a JSON body of the form accepted by -rpc,
+// and returns the result as JSON.
+func serveHTTP(ctx context.Context, addr string) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: httpHandler(dir),
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// httpHandler returns the handler for the endpoints that serveHTTP
+// serves, resolving relative file names against dir.
+func httpHandler(dir string) http.Handler {
+	cache := newPackageCache()
+	mux := http.NewServeMux()
+	for path, method := range map[string]string{
+		"/definition": "definition",
+		"/hover":      "type",
+		"/members":    "members",
+	} {
+		method := method
+		mux.HandleFunc(path, func(w http.ResponseWriter, req *http.Request) {
+			p, err := httpParams(req)
+			if err != nil {
+				httpError(w, http.StatusBadRequest, err)
+				return
+			}
+			def, err := rpcAnswer(req.Context(), cache, dir, method, p)
+			if err != nil {
+				status := http.StatusNotFound
+				if _, ok := err.(*rpcError); ok {
+					status = http.StatusBadRequest
+				}
+				httpError(w, status, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(def)
+		})
+	}
+	return mux
+}
+
+// httpParams returns the query parameters from the request.
+func httpParams(req *http.Request) (*rpcParams, error) {
+	var p rpcParams
+	if req.Method == http.MethodPost {
+		if err := json.NewDecoder(req.Body).Decode(&p); err != nil {
+			return nil, err
+		}
+		return &p, nil
+	}
+	v := req.URL.Query()
+	p.Filename = v.Get("file")
+	if s := v.Get("offset"); s != "" {
+		offset, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, err
+		}
+		p.Offset = offset
+	}
+	if s := v.Get("all"); s != "" {
+		all, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, err
+		}
+		p.All = all
+	}
+	return &p, nil
+}
+
+func httpError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
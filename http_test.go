@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	src := "package x\n\ntype T struct{ A int }\n\nfunc F() T { return T{} }\n\nvar v = F()\n"
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module x\n",
+		"x.go":   src,
+	})
+	h := httpHandler(dir)
+	for _, test := range []struct {
+		method, target, body string
+		wantStatus           int
+		want                 string
+	}{
+		{"GET", fmt.Sprintf("/definition?file=x.go&offset=%d", strings.LastIndex(src, "F()")), "", http.StatusOK, "x.go:5 "},
+		{"GET", fmt.Sprintf("/hover?file=x.go&offset=%d", strings.LastIndex(src, "F()")), "", http.StatusOK, "x.go:5 F func() T"},
+		{"POST", "/members", fmt.Sprintf(`{"filename": "x.go", "offset": %d}`, strings.Index(src, "v =")), http.StatusOK, "x.go:7 v T A int"},
+		{"GET", "/definition?offset=1", "", http.StatusBadRequest, "no filename specified"},
+		{"GET", "/definition?file=x.go&offset=z", "", http.StatusBadRequest, ""},
+		{"GET", "/definition?file=x.go&offset=1", "", http.StatusNotFound, ""},
+	} {
+		req := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != test.wantStatus {
+			t.Errorf("%s %s: got status %d, want %d", test.method, test.target, w.Code, test.wantStatus)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			var e struct{ Error string }
+			if err := json.NewDecoder(w.Body).Decode(&e); err != nil || e.Error == "" {
+				t.Errorf("%s %s: got body %q, want an error", test.method, test.target, w.Body)
+			} else if test.want != "" && e.Error != test.want {
+				t.Errorf("%s %s: got error %q, want %q", test.method, test.target, e.Error, test.want)
+			}
+			continue
+		}
+		var def rpcDefinition
+		if err := json.NewDecoder(w.Body).Decode(&def); err != nil {
+			t.Errorf("%s %s: %v", test.method, test.target, err)
+			continue
+		}
+		got := fmt.Sprintf("%s:%d %s", filepath.Base(def.Filename), def.Line, def.Type)
+		for _, m := range def.Members {
+			got += " " + m.Type
+		}
+		if got != test.want {
+			t.Errorf("%s %s: got %q, want %q", test.method, test.target, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/token"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var hyperlinkFlag = flag.String("hyperlink", "auto", "wrap printed positions in terminal hyperlinks: auto, always or never")
+
+// checkHyperlinkFlag checks the value of the -hyperlink flag.
+func checkHyperlinkFlag() error {
+	switch *hyperlinkFlag {
+	case "auto", "always", "never":
+		return nil
+	}
+	return &queryError{exitUsage, fmt.Errorf("invalid -hyperlink value %q (want auto, always or never)", *hyperlinkFlag)}
+}
+
+// useHyperlinks reports whether positions printed to standard
+// output should be hyperlinks. In auto mode, they are when
+// standard output is a terminal known to support them.
+func useHyperlinks() bool {
+	switch *hyperlinkFlag {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	return hyperlinkTerminal(os.Getenv)
+}
+
+// hyperlinkTerminal reports whether the environment, as returned
+// by getenv, describes a terminal that supports OSC 8 hyperlinks.
+func hyperlinkTerminal(getenv func(string) string) bool {
+	switch getenv("TERM_PROGRAM") {
+	case "iTerm.app", "WezTerm", "vscode", "ghostty":
+		return true
+	}
+	if getenv("KITTY_WINDOW_ID") != "" || getenv("WEZTERM_EXECUTABLE") != "" {
+		return true
+	}
+	if strings.Contains(getenv("TERM"), "kitty") {
+		return true
+	}
+	// VTE-based terminals support hyperlinks from version 0.50.
+	if v, err := strconv.Atoi(getenv("VTE_VERSION")); err == nil && v >= 5000 {
+		return true
+	}
+	return false
+}
+
+// hyperlink returns text wrapped in an OSC 8 hyperlink to the
+// file holding pos, which is named as on the local machine.
+// The link names the file as on the host, as -path-map requires.
+func hyperlink(pos token.Position, text string) string {
+	name, err := filepath.Abs(pos.Filename)
+	if err != nil {
+		return text
+	}
+	host, _ := os.Hostname()
+	return fmt.Sprintf("\x1b]8;;%s\x1b\\%s\x1b]8;;\x1b\\", fileURL(host, pathMapFlag.toHost(name)), text)
+}
+
+// fileURL returns the file URL for the absolute file name on host.
+func fileURL(host, name string) string {
+	p := filepath.ToSlash(name)
+	if !strings.HasPrefix(p, "/") {
+		// A Windows drive letter.
+		p = "/" + p
+	}
+	u := url.URL{Scheme: "file", Host: host, Path: p}
+	return u.String()
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestFileURL(t *testing.T) {
+	for _, test := range []struct {
+		host, name, want string
+	}{
+		{"box", "/src/x.go", "file://box/src/x.go"},
+		{"", "/src/a b.go", "file:///src/a%20b.go"},
+		{"box", "C:/src/x.go", "file://box/C:/src/x.go"},
+	} {
+		if got := fileURL(test.host, test.name); got != test.want {
+			t.Errorf("fileURL(%q, %q) = %q, want %q", test.host, test.name, got, test.want)
+		}
+	}
+}
+
+func TestHyperlinkTerminal(t *testing.T) {
+	for _, test := range []struct {
+		env  map[string]string
+		want bool
+	}{
+		{map[string]string{}, false},
+		{map[string]string{"TERM": "xterm-256color"}, false},
+		{map[string]string{"TERM_PROGRAM": "iTerm.app"}, true},
+		{map[string]string{"TERM": "xterm-kitty"}, true},
+		{map[string]string{"WEZTERM_EXECUTABLE": "/usr/bin/wezterm"}, true},
+		{map[string]string{"VTE_VERSION": "4803"}, false},
+		{map[string]string{"VTE_VERSION": "6003"}, true},
+	} {
+		getenv := func(key string) string { return test.env[key] }
+		if got := hyperlinkTerminal(getenv); got != test.want {
+			t.Errorf("hyperlinkTerminal(%v) = %v, want %v", test.env, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/rogpeppe/godef/godef"
+	"golang.org/x/tools/go/packages"
+)
+
+func importsMain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("imports", flag.ExitOnError)
+	jsonOut := fs.Bool("json", false, "print each import as a JSON object on its own line")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: godef imports [-json] file\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	filename, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *noExecFlag {
+		return &queryError{exitLoad, errNoExec}
+	}
+	cfg := &packages.Config{
+		Context: ctx,
+		Mode:    packages.LoadSyntax,
+		Tests:   godef.IsTest(filename, nil),
+	}
+	pkgs, err := packages.Load(cfg, "file="+filename)
+	if err != nil {
+		return &queryError{exitLoad, err}
+	}
+	pkg, file := findFile(pkgs, filename)
+	if file == nil {
+		return &queryError{exitLoad, fmt.Errorf("no package contains %s", filename)}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	for _, imp := range fileImports(pkg.Fset, pkg.TypesInfo, file) {
+		if *jsonOut {
+			if err := enc.Encode(newImportJSON(imp)); err != nil {
+				return err
+			}
+			continue
+		}
+		note := ""
+		switch {
+		case imp.Name == "_":
+			note = " (blank)"
+		case imp.Path == "C":
+			note = " (cgo)"
+		case imp.unused():
+			note = " unused"
+		}
+		fmt.Printf("%s %s%s\n", imp.spec(), relPos(dir, imp.Pos), note)
+		for _, use := range imp.Uses {
+			fmt.Printf("\t%s\t%s\n", relPos(dir, use.Pos), use.Name)
+		}
+	}
+	return nil
+}
+
+// fileImport is an import in a file, with the uses of the package
+// it imports.
+type fileImport struct {
+	Path string
+	Name string // as given in the import, if any
+	Pos  token.Position
+	Uses []importUse // in file order
+}
+
+// importUse is a use of an imported package: the qualifier of a
+// qualified identifier, or for a dot import the identifier itself.
+type importUse struct {
+	Pos  token.Position
+	Name string // the qualified identifier, such as fmt.Println
+}
+
+func (imp *fileImport) spec() string {
+	if imp.Name != "" {
+		return imp.Name + " " + strconv.Quote(imp.Path)
+	}
+	return strconv.Quote(imp.Path)
+}
+
+// unused reports whether the package is imported for nothing: the
+// import has no uses, and is neither a blank import nor the import
+// of "C", which cgo handles.
+func (imp *fileImport) unused() bool {
+	return len(imp.Uses) == 0 && imp.Name != "_" && imp.Path != "C"
+}
+
+// fileImports returns the imports of file, with the uses in file
+// of each package imported, as recorded by info.
+func fileImports(fset *token.FileSet, info *types.Info, file *ast.File) []*fileImport {
+	var imports []*fileImport
+	byName := make(map[*types.PkgName]*fileImport)
+	byPkg := make(map[*types.Package]*fileImport) // dot imports
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		imp := &fileImport{
+			Path: path,
+			Pos:  fset.Position(spec.Pos()),
+		}
+		if spec.Name != nil {
+			imp.Name = spec.Name.Name
+		}
+		imports = append(imports, imp)
+		obj := info.Implicits[spec]
+		if spec.Name != nil && obj == nil {
+			obj = info.Defs[spec.Name]
+		}
+		pn, ok := obj.(*types.PkgName)
+		if !ok {
+			continue
+		}
+		byName[pn] = imp
+		if imp.Name == "." {
+			byPkg[pn.Imported()] = imp
+		}
+	}
+	qualified := make(map[*ast.Ident]string)
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			if x, ok := n.X.(*ast.Ident); ok {
+				qualified[x] = x.Name + "." + n.Sel.Name
+				qualified[n.Sel] = ""
+			}
+		case *ast.Ident:
+			obj := info.Uses[n]
+			if obj == nil {
+				return true
+			}
+			if pn, ok := obj.(*types.PkgName); ok {
+				if imp := byName[pn]; imp != nil {
+					imp.Uses = append(imp.Uses, importUse{fset.Position(n.Pos()), qualified[n]})
+				}
+			} else if imp := byPkg[obj.Pkg()]; imp != nil {
+				if _, ok := qualified[n]; !ok {
+					imp.Uses = append(imp.Uses, importUse{fset.Position(n.Pos()), n.Name})
+				}
+			}
+		}
+		return true
+	})
+	return imports
+}
+
+// importJSON is the JSON form of an import printed by godef imports -json.
+type importJSON struct {
+	Path   string    `json:"path"`
+	Name   string    `json:"name,omitempty"`
+	Pos    jsonPos   `json:"position"`
+	Uses   []useJSON `json:"uses,omitempty"`
+	Unused bool      `json:"unused,omitempty"`
+}
+
+type useJSON struct {
+	jsonPos
+	Name string `json:"name"`
+}
+
+func newImportJSON(imp *fileImport) *importJSON {
+	j := &importJSON{
+		Path:   imp.Path,
+		Name:   imp.Name,
+		Pos:    newJSONPos(imp.Pos),
+		Unused: imp.unused(),
+	}
+	for _, use := range imp.Uses {
+		j.Uses = append(j.Uses, useJSON{newJSONPos(use.Pos), use.Name})
+	}
+	return j
+}
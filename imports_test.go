@@ -0,0 +1,66 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+func TestFileImports(t *testing.T) {
+	src := `package x
+
+import (
+	"fmt"
+	str "strings"
+	. "sort"
+	_ "embed"
+	"os"
+)
+
+func F(s []string) {
+	fmt.Println(str.ToUpper(s[0]))
+	fmt.Print(len(s))
+	Strings(s)
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "x.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Defs:      make(map[*ast.Ident]types.Object),
+		Uses:      make(map[*ast.Ident]types.Object),
+		Implicits: make(map[ast.Node]types.Object),
+	}
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error:    func(error) {},
+	}
+	conf.Check("x", fset, []*ast.File{f}, info)
+	var got []string
+	for _, imp := range fileImports(fset, info, f) {
+		line := imp.spec()
+		if imp.unused() {
+			line += " unused"
+		}
+		for _, use := range imp.Uses {
+			line += " " + use.Pos.String() + " " + use.Name
+		}
+		got = append(got, line)
+	}
+	want := []string{
+		`"fmt" x.go:12:2 fmt.Println x.go:13:2 fmt.Print`,
+		`str "strings" x.go:12:14 str.ToUpper`,
+		`. "sort" x.go:14:2 Strings`,
+		`_ "embed"`,
+		`"os" unused`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got imports\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rogpeppe/godef/godef"
+	"golang.org/x/tools/go/packages"
+)
+
+// symbolIndex records every declaration in a module, so that
+// symbol queries can be answered without loading any packages.
+type symbolIndex struct {
+	Root    string
+	Files   map[string]*indexedFile // keyed by absolute file name
+	Dirs    map[string]*indexedDir  // keyed by absolute directory name
+	Exclude []string                `json:",omitempty"` // patterns of files left out, as for godef.Excluded
+}
+
+// indexedFile holds the declarations found in a single file.
+type indexedFile struct {
+	Pkg     string // import path of the file's package
+	PkgName string // name of the file's package
+	Stamp   fileStamp
+	Hash    string // hash of the file's contents
+	Decls   []decl
+}
+
+// indexedDir records the package in a directory, so that
+// files added to it later can be indexed too.
+type indexedDir struct {
+	Pkg   string
+	Stamp fileStamp
+}
+
+// decl is a single declaration.
+type decl struct {
+	Name   string
+	Kind   string // func, method, type, field, var or const
+	Recv   string `json:",omitempty"` // receiver or enclosing type name, if any
+	Detail string `json:",omitempty"` // struct or interface, for types and their members
+	Line   int
+	Column int
+}
+
+func indexMain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	out := fs.String("o", "", "write the index to this file rather than the default")
+	fs.IntVar(jobsFlag, "jobs", *jobsFlag, "maximum number of files to index concurrently")
+	addExcludeFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: godef index [-o file] [-jobs n] [-exclude glob] [packages]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	idx, err := buildIndex(ctx, dir, patterns, *jobsFlag, excludePatterns())
+	if err != nil {
+		return err
+	}
+	filename := *out
+	if filename == "" {
+		if filename, err = indexFile(idx.Root); err != nil {
+			return err
+		}
+	}
+	return idx.write(filename)
+}
+
+// buildIndex loads the packages matching patterns and indexes
+// their files, other than those matching the exclude patterns,
+// parsing up to jobs files concurrently.
+func buildIndex(ctx context.Context, dir string, patterns []string, jobs int, exclude []string) (*symbolIndex, error) {
+	root := moduleRoot(dir)
+	if root == "" {
+		root = dir
+	}
+	cfg := &packages.Config{
+		Context: ctx,
+		Dir:     dir,
+		Mode:    packages.LoadFiles,
+		Tests:   true,
+	}
+	lpkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	idx := &symbolIndex{
+		Root:    root,
+		Files:   make(map[string]*indexedFile),
+		Dirs:    make(map[string]*indexedDir),
+		Exclude: exclude,
+	}
+	var names, pkgPaths []string
+	for _, pkg := range lpkgs {
+		for _, name := range pkg.GoFiles {
+			if _, ok := idx.Files[name]; ok {
+				// Test variants repeat the files of the package under test.
+				continue
+			}
+			if godef.Excluded(name, exclude) {
+				continue
+			}
+			idx.Files[name] = nil
+			names = append(names, name)
+			pkgPaths = append(pkgPaths, pkg.PkgPath)
+		}
+	}
+	files := make([]*indexedFile, len(names))
+	errs := make([]error, len(names))
+	runJobs(len(names), jobs, func(i int) {
+		if errs[i] = ctx.Err(); errs[i] == nil {
+			files[i], errs[i] = indexSourceFile(names[i], pkgPaths[i])
+		}
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for i, name := range names {
+		if errs[i] != nil {
+			logf(levelWarn, "%v", errs[i])
+			delete(idx.Files, name)
+			continue
+		}
+		idx.Files[name] = files[i]
+		d := filepath.Dir(name)
+		if _, ok := idx.Dirs[d]; !ok {
+			stamp, _ := statFile(d)
+			idx.Dirs[d] = &indexedDir{Pkg: pkgPaths[i], Stamp: stamp}
+		}
+	}
+	return idx, nil
+}
+
+// matchFile reports whether the named Go file would be built for the
+// go command's GOOS, GOARCH and build tags, judging by its name and
+// build constraints, which are read without parsing the whole file.
+// Files whose constraints cannot be read are assumed to match.
+func matchFile(filename string) bool {
+	ok, err := buildContext(filepath.Dir(filename)).MatchFile(filepath.Split(filename))
+	return ok || err != nil
+}
+
+// indexSourceFile parses the named file and records its declarations.
+func indexSourceFile(filename, pkgPath string) (*indexedFile, error) {
+	stamp, _ := statFile(filename)
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, data, 0)
+	if file == nil {
+		return nil, err
+	}
+	f := &indexedFile{
+		Pkg:     pkgPath,
+		PkgName: file.Name.Name,
+		Stamp:   stamp,
+		Hash:    fmt.Sprintf("%x", sha256.Sum256(data)),
+	}
+	add := func(id *ast.Ident, kind, recv, detail string) {
+		if id == nil || id.Name == "_" {
+			return
+		}
+		pos := fset.Position(id.Pos())
+		f.Decls = append(f.Decls, decl{
+			Name:   id.Name,
+			Kind:   kind,
+			Recv:   recv,
+			Detail: detail,
+			Line:   pos.Line,
+			Column: pos.Column,
+		})
+	}
+	for _, d := range file.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				add(d.Name, "method", recvName(d.Recv.List[0].Type), "")
+			} else {
+				add(d.Name, "func", "", "")
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					add(spec.Name, "type", "", typeDetail(spec.Type))
+					addMembers(spec, add)
+				case *ast.ValueSpec:
+					kind := "var"
+					if d.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, id := range spec.Names {
+						add(id, kind, "", "")
+					}
+				}
+			}
+		}
+	}
+	return f, nil
+}
+
+// addMembers records the fields of struct types and
+// the methods of interface types declared by spec.
+func addMembers(spec *ast.TypeSpec, add func(id *ast.Ident, kind, recv, detail string)) {
+	var fields *ast.FieldList
+	kind := "field"
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		fields = t.Fields
+	case *ast.InterfaceType:
+		fields, kind = t.Methods, "method"
+	}
+	if fields == nil {
+		return
+	}
+	detail := typeDetail(spec.Type)
+	for _, field := range fields.List {
+		for _, id := range field.Names {
+			add(id, kind, spec.Name.Name, detail)
+		}
+	}
+}
+
+// typeDetail returns "struct" or "interface" for struct
+// and interface type expressions, and "" otherwise.
+func typeDetail(expr ast.Expr) string {
+	switch expr.(type) {
+	case *ast.StructType:
+		return "struct"
+	case *ast.InterfaceType:
+		return "interface"
+	}
+	return ""
+}
+
+// recvName returns the name of the type of a method receiver.
+func recvName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// indexFile returns the default location of the index for the module at root.
+func indexFile(root string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256([]byte(root))
+	return filepath.Join(dir, "godef", "index", fmt.Sprintf("%x.json", h[:8])), nil
+}
+
+func (idx *symbolIndex) write(filename string) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0666)
+}
+
+func readIndex(filename string) (*symbolIndex, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var idx symbolIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("cannot read index %s: %v", filename, err)
+	}
+	return &idx, nil
+}
+
+// refresh re-indexes any files that have changed since the index was
+// built, and any files added to indexed directories. It reports
+// whether anything changed.
+func (idx *symbolIndex) refresh() bool {
+	changed := false
+	for name, f := range idx.Files {
+		stamp, _ := statFile(name)
+		if stamp.same(f.Stamp) {
+			continue
+		}
+		changed = true
+		nf, err := indexSourceFile(name, f.Pkg)
+		if err != nil {
+			delete(idx.Files, name)
+			continue
+		}
+		idx.Files[name] = nf
+	}
+	for dir, d := range idx.Dirs {
+		stamp, _ := statFile(dir)
+		if stamp.same(d.Stamp) {
+			continue
+		}
+		changed = true
+		d.Stamp = stamp
+		names, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+		for _, name := range names {
+			if _, ok := idx.Files[name]; ok || !matchFile(name) || godef.Excluded(name, idx.Exclude) {
+				continue
+			}
+			if f, err := indexSourceFile(name, d.Pkg); err == nil {
+				idx.Files[name] = f
+			}
+		}
+	}
+	return changed
+}
+
+// symbol is a declaration found by a search of the index.
+type symbol struct {
+	decl
+	Pkg      string
+	PkgName  string
+	Filename string
+}
+
+// lookup returns all declarations matching name, which is either a
+// plain identifier or an identifier qualified by a package name,
+// package path or type name, as in http.Get or Client.Do, or
+// both, as in http.Client.Do. Each of these may be a glob pattern,
+// as for path.Match, as in http.*Handler*. Only declarations that
+// filter accepts are returned, if it is not nil.
+func (idx *symbolIndex) lookup(name string, filter *symbolFilter) []symbol {
+	qual, recv := "", ""
+	// Only periods after the last slash separate names, and in a
+	// package path such as gopkg.in/yaml.v2 the period before a
+	// major version is part of the path.
+	if i := strings.LastIndex(name, "."); i > strings.LastIndex(name, "/") {
+		qual, name = name[:i], name[i+1:]
+	}
+	if i := strings.LastIndex(qual, "."); i > strings.LastIndex(qual, "/") && !(strings.Contains(qual, "/") && isMajorVersion(qual[i+1:])) {
+		// pkg.Type.Method
+		qual, recv = qual[:i], qual[i+1:]
+	}
+	var syms []symbol
+	for filename, f := range idx.Files {
+		if filter != nil && !filter.inScope(filename, f.Pkg) {
+			continue
+		}
+		inPkg := matchName(qual, f.Pkg) || matchName(qual, f.PkgName)
+		for _, d := range f.Decls {
+			if !matchName(name, d.Name) || filter != nil && len(filter.kinds) > 0 && !filter.kinds[d.Kind] {
+				continue
+			}
+			if recv != "" {
+				if !inPkg || !matchName(recv, d.Recv) {
+					continue
+				}
+			} else if qual != "" && !inPkg && !matchName(qual, d.Recv) {
+				continue
+			}
+			syms = append(syms, symbol{d, f.Pkg, f.PkgName, filename})
+		}
+	}
+	sort.Slice(syms, func(i, j int) bool {
+		if syms[i].Filename != syms[j].Filename {
+			return syms[i].Filename < syms[j].Filename
+		}
+		return syms[i].Line < syms[j].Line
+	})
+	return syms
+}
+
+// isMajorVersion reports whether elem is a major version
+// suffix of a package path, such as v2.
+func isMajorVersion(elem string) bool {
+	if len(elem) < 2 || elem[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(elem[1:])
+	return err == nil
+}
+
+func symbolMain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("symbol", flag.ExitOnError)
+	in := fs.String("index", "", "read the index from this file rather than the default")
+	jsonOut := fs.Bool("json", false, "output results in JSON format")
+	kinds := fs.String("kind", "", "comma-separated `kinds` of declaration to find: "+strings.Join(declKinds, ", "))
+	scopes := fs.String("scope", "", "comma-separated package `patterns`, such as ./..., to which to restrict the search")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: godef symbol [-index file] [-json] [-kind kinds] [-scope patterns] name\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	filter, err := newSymbolFilter(dir, *kinds, *scopes)
+	if err != nil {
+		return &queryError{exitUsage, err}
+	}
+	filename := *in
+	if filename == "" {
+		root := moduleRoot(dir)
+		if root == "" {
+			root = dir
+		}
+		if filename, err = indexFile(root); err != nil {
+			return err
+		}
+	}
+	idx, err := readIndex(filename)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no index found; run godef index first")
+	}
+	if err != nil {
+		return err
+	}
+	if idx.refresh() {
+		// Keep the index up to date for next time;
+		// failing to do so is not an error.
+		idx.write(filename)
+	}
+	syms := idx.lookup(fs.Arg(0), filter)
+	if len(syms) == 0 {
+		return fmt.Errorf("no symbol %s found", fs.Arg(0))
+	}
+	for _, s := range syms {
+		if *jsonOut {
+			data, err := json.Marshal(s)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s\n", data)
+			continue
+		}
+		name := s.Name
+		if s.Recv != "" {
+			name = s.Recv + "." + name
+		}
+		fmt.Printf("%s:%d:%d\t%s %s.%s\n", s.Filename, s.Line, s.Column, s.Kind, s.PkgName, name)
+	}
+	return nil
+}
+
+// matchName reports whether name matches pattern, which is either
+// a name or a glob pattern, as for path.Match.
+func matchName(pattern, name string) bool {
+	if pattern == name {
+		return true
+	}
+	if !strings.ContainsAny(pattern, "*?[") {
+		return false
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok && name != ""
+}
+
+// declKinds are the kinds of declaration recorded in the index.
+var declKinds = []string{"func", "method", "type", "field", "var", "const"}
+
+// symbolFilter restricts a search of the index to declarations of
+// the given kinds, if any, in packages that match any of the given
+// scopes, if any.
+type symbolFilter struct {
+	kinds  map[string]bool
+	scopes []func(filename, pkgPath string) bool
+}
+
+// newSymbolFilter returns the filter for the comma-separated kinds
+// of declaration and package patterns given, as by the -kind and
+// -scope flags of godef symbol. Relative package patterns, such as
+// ./..., are relative to dir.
+func newSymbolFilter(dir, kinds, scopes string) (*symbolFilter, error) {
+	filter := &symbolFilter{kinds: make(map[string]bool)}
+	for _, kind := range strings.Split(kinds, ",") {
+		if kind = strings.TrimSpace(kind); kind == "" {
+			continue
+		}
+		known := false
+		for _, k := range declKinds {
+			known = known || k == kind
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown kind %q (want one of %s)", kind, strings.Join(declKinds, ", "))
+		}
+		filter.kinds[kind] = true
+	}
+	for _, pattern := range strings.Split(scopes, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			filter.scopes = append(filter.scopes, scopeMatcher(dir, pattern))
+		}
+	}
+	return filter, nil
+}
+
+func (filter *symbolFilter) inScope(filename, pkgPath string) bool {
+	for _, match := range filter.scopes {
+		if match(filename, pkgPath) {
+			return true
+		}
+	}
+	return len(filter.scopes) == 0
+}
+
+// scopeMatcher returns a function reporting whether a file is in a
+// package matching pattern, as the go command matches packages: a
+// pattern that is a directory, relative to dir if it starts with .
+// or .., matches the package in that directory, and an import path
+// the package with that path, with ... matching any string, and a
+// trailing /... the directory or path alone too.
+func scopeMatcher(dir, pattern string) func(filename, pkgPath string) bool {
+	if pattern == "." || pattern == ".." || strings.HasPrefix(pattern, "./") || strings.HasPrefix(pattern, "../") || filepath.IsAbs(pattern) {
+		base, all := pattern, false
+		if strings.HasSuffix(base, "/...") {
+			base, all = strings.TrimSuffix(base, "/..."), true
+		}
+		if !filepath.IsAbs(base) {
+			base = filepath.Join(dir, base)
+		}
+		base = filepath.Clean(base)
+		return func(filename, pkgPath string) bool {
+			d := filepath.Dir(filename)
+			return d == base || all && strings.HasPrefix(d, base+string(filepath.Separator))
+		}
+	}
+	re := regexp.QuoteMeta(pattern)
+	if strings.HasSuffix(re, `/\.\.\.`) {
+		re = strings.TrimSuffix(re, `/\.\.\.`) + `(/.*)?`
+	}
+	re = strings.Replace(re, `\.\.\.`, `.*`, -1)
+	rx := regexp.MustCompile("^" + re + "$")
+	return func(filename, pkgPath string) bool {
+		return rx.MatchString(pkgPath)
+	}
+}
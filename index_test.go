@@ -0,0 +1,165 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestIndexLookup(t *testing.T) {
+	filename := filepath.Join("testdata", "a", "random.go")
+	f, err := indexSourceFile(filename, "github.com/rogpeppe/godef/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := &symbolIndex{
+		Files: map[string]*indexedFile{filename: f},
+	}
+	for _, test := range []struct {
+		name string
+		kind string
+		line int
+	}{
+		{"Random2", "func", 8},
+		{"a.Random2", "func", 8},
+		{"Pos", "type", 12},
+		{"Pos.y", "field", 13},
+		{"Pos.Sum", "method", 16},
+		{"a.Pos.Sum", "method", 16},
+		{"github.com/rogpeppe/godef/a.Pos.Sum", "method", 16},
+	} {
+		syms := idx.lookup(test.name, nil)
+		if len(syms) != 1 {
+			t.Errorf("lookup %s: got %d results want 1", test.name, len(syms))
+			continue
+		}
+		if s := syms[0]; s.Kind != test.kind || s.Line != test.line {
+			t.Errorf("lookup %s: got %s at line %d want %s at line %d", test.name, s.Kind, s.Line, test.kind, test.line)
+		}
+	}
+	// The last element of a package path may hold a period.
+	f, err = indexSourceFile(filename, "gopkg.in/a.v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vidx := &symbolIndex{
+		Files: map[string]*indexedFile{filename: f},
+	}
+	for _, name := range []string{"gopkg.in/a.v2.Random2", "gopkg.in/a.v2.Pos.Sum"} {
+		if syms := vidx.lookup(name, nil); len(syms) != 1 {
+			t.Errorf("lookup %s: got %d results want 1", name, len(syms))
+		}
+	}
+	for _, name := range []string{"b.Random2", "b.Pos.Sum", "a.Other.Sum"} {
+		if syms := idx.lookup(name, nil); len(syms) != 0 {
+			t.Errorf("lookup %s: unexpected results %v", name, syms)
+		}
+	}
+}
+
+func TestMatchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godef-match")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	other := "windows"
+	if runtime.GOOS == "windows" {
+		other = "linux"
+	}
+	for _, test := range []struct {
+		name, src string
+		want      bool
+	}{
+		{"x.go", "package x\n", true},
+		{"x_test.go", "package x\n", true},
+		{"x_" + runtime.GOOS + ".go", "package x\n", true},
+		{"x_" + other + ".go", "package x\n", false},
+		{"ignored.go", "//go:build ignore\n\npackage x\n", false},
+		{"old.go", "// +build ignore\n\npackage x\n", false},
+	} {
+		filename := filepath.Join(dir, test.name)
+		if err := ioutil.WriteFile(filename, []byte(test.src), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if got := matchFile(filename); got != test.want {
+			t.Errorf("matchFile(%q) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	dir, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := &symbolIndex{Files: make(map[string]*indexedFile)}
+	for _, name := range []string{"a/random.go", "b/b.go"} {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		f, err := indexSourceFile(filename, "github.com/rogpeppe/godef/"+filepath.Dir(filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx.Files[filename] = f
+	}
+	for _, test := range []struct {
+		name, kinds, scopes string
+		want                []string
+	}{
+		{"Random*", "", "", []string{"a.Random", "a.Random2"}},
+		{"a.Random?", "", "", []string{"a.Random2"}},
+		{"Pos.*", "method", "", []string{"a.Pos.Sum"}},
+		{"*", "type", "./a", []string{"a.Pos"}},
+		{"*", "type", "github.com/rogpeppe/godef/...", []string{"a.Pos", "b.S1", "b.S2"}},
+		{"*", "type", "./b/...", []string{"b.S1", "b.S2"}},
+		{"S*", "func", "", nil},
+		{"*", "func", "./a,./b", []string{"a.Random", "a.Random2", "b.Bar"}},
+		{"P?s.[xy]", "field", "", []string{"a.Pos.x", "a.Pos.y"}},
+	} {
+		filter, err := newSymbolFilter(dir, test.kinds, test.scopes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, s := range idx.lookup(test.name, filter) {
+			name := s.PkgName + "." + s.Name
+			if s.Recv != "" {
+				name = s.PkgName + "." + s.Recv + "." + s.Name
+			}
+			got = append(got, name)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("lookup %s -kind=%s -scope=%s: got %v want %v", test.name, test.kinds, test.scopes, got, test.want)
+		}
+	}
+	if _, err := newSymbolFilter(dir, "func,struct", ""); err == nil {
+		t.Errorf("got no error for an unknown kind")
+	}
+}
+
+func TestScopeMatcher(t *testing.T) {
+	for _, test := range []struct {
+		pattern, filename, pkgPath string
+		want                       bool
+	}{
+		{"./...", "/m/x/y.go", "m/x", true},
+		{"./...", "/n/y.go", "n", false},
+		{".", "/m/y.go", "m", true},
+		{".", "/m/x/y.go", "m/x", false},
+		{"./x", "/m/x/y.go", "m/x", true},
+		{"../n/...", "/n/z/y.go", "n/z", true},
+		{"m/...", "/m/y.go", "m", true},
+		{"m/...", "/m/x/y.go", "m/x", true},
+		{"m/...", "/mx/y.go", "mx", false},
+		{"m/.../z", "/m/x/z/y.go", "m/x/z", true},
+		{"net/http", "/go/src/net/http/y.go", "net/http", true},
+	} {
+		match := scopeMatcher(filepath.FromSlash("/m"), test.pattern)
+		if got := match(filepath.FromSlash(test.filename), test.pkgPath); got != test.want {
+			t.Errorf("scope %s, file %s: got %v want %v", test.pattern, test.filename, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var jumpsFlag = flag.Bool("jumps", false, "record the query in the jump history for godef back and forward")
+
+// maxJumps is the number of locations kept in the jump history.
+const maxJumps = 100
+
+// jumpHistory records the locations visited by successive queries,
+// like the history of a web browser: each query truncates any
+// forward history and appends its starting point and the
+// definition it found.
+type jumpHistory struct {
+	Locs    []jsonPos `json:"locations"`
+	Current int       `json:"current"` // index in Locs of the current location
+}
+
+// jumpsFile returns the name of the file holding the jump history.
+func jumpsFile() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "godef", "jumps"), nil
+}
+
+// readJumps reads the jump history, returning an empty
+// history if there is none yet.
+func readJumps(filename string) (*jumpHistory, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return &jumpHistory{Current: -1}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var h jumpHistory
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("cannot read jump history %s: %v", filename, err)
+	}
+	if h.Current < 0 || h.Current >= len(h.Locs) {
+		h.Current = len(h.Locs) - 1
+	}
+	return &h, nil
+}
+
+func (h *jumpHistory) write(filename string) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return err
+	}
+	// Write to a temporary file first so that concurrent
+	// invocations never see a partial history.
+	tmp := fmt.Sprintf("%s.%d", filename, os.Getpid())
+	if err := ioutil.WriteFile(tmp, data, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// add records a jump from one location to another.
+func (h *jumpHistory) add(from, to jsonPos) {
+	h.Locs = h.Locs[:h.Current+1]
+	if len(h.Locs) == 0 || h.Locs[len(h.Locs)-1] != from {
+		h.Locs = append(h.Locs, from)
+	}
+	h.Locs = append(h.Locs, to)
+	if len(h.Locs) > maxJumps {
+		h.Locs = h.Locs[len(h.Locs)-maxJumps:]
+	}
+	h.Current = len(h.Locs) - 1
+}
+
+// recordJump adds a jump from the byte offset off in the named
+// file, whose contents are src if not nil, to the position to, if
+// the -jumps flag asks for it. Otherwise the history is untouched.
+func recordJump(filename string, src []byte, off int, to token.Position) error {
+	if !*jumpsFlag || to.Filename == "" {
+		return nil
+	}
+	if src == nil {
+		var err error
+		if src, err = ioutil.ReadFile(filename); err != nil {
+			return err
+		}
+	}
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	name, err := jumpsFile()
+	if err != nil {
+		return err
+	}
+	h, err := readJumps(name)
+	if err != nil {
+		return err
+	}
+	line, col := offsetPosition(src, off)
+	h.add(jsonPos{filename, line, col}, newJSONPos(to))
+	return h.write(name)
+}
+
+func backMain(ctx context.Context, args []string) error {
+	return jumpMain("back", -1, args)
+}
+
+func forwardMain(ctx context.Context, args []string) error {
+	return jumpMain("forward", 1, args)
+}
+
+// jumpMain moves dir places through the jump history
+// and prints the location reached.
+func jumpMain(name string, dir int, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: godef %s\n", name)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	filename, err := jumpsFile()
+	if err != nil {
+		return err
+	}
+	h, err := readJumps(filename)
+	if err != nil {
+		return err
+	}
+	i := h.Current + dir
+	if i < 0 || i >= len(h.Locs) {
+		return &queryError{exitNotFound, fmt.Errorf("no location to go %s to", name)}
+	}
+	h.Current = i
+	if err := h.write(filename); err != nil {
+		return err
+	}
+	loc := h.Locs[i]
+	fmt.Printf("%v\n", token.Position{
+		Filename: outputName(loc.Filename),
+		Line:     loc.Line,
+		Column:   loc.Column,
+	})
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestJumpHistory(t *testing.T) {
+	a, b, c, d := jsonPos{"a.go", 1, 1}, jsonPos{"b.go", 2, 1}, jsonPos{"c.go", 3, 1}, jsonPos{"d.go", 4, 1}
+	h := &jumpHistory{Current: -1}
+	h.add(a, b)
+	h.add(b, c)
+	if want := []jsonPos{a, b, c}; !reflect.DeepEqual(h.Locs, want) || h.Current != 2 {
+		t.Fatalf("after two jumps got %v at %d, want %v at 2", h.Locs, h.Current, want)
+	}
+	// Going back and jumping elsewhere discards the forward history.
+	h.Current = 1
+	h.add(b, d)
+	if want := []jsonPos{a, b, d}; !reflect.DeepEqual(h.Locs, want) || h.Current != 2 {
+		t.Fatalf("after jumping from history got %v at %d, want %v at 2", h.Locs, h.Current, want)
+	}
+	for i := 0; i < maxJumps; i++ {
+		h.add(a, b)
+	}
+	if len(h.Locs) != maxJumps || h.Current != maxJumps-1 {
+		t.Errorf("history has %d locations at %d, want %d", len(h.Locs), h.Current, maxJumps)
+	}
+}
+
+func TestOffsetPosition(t *testing.T) {
+	content := []byte("ab\ncd\n\nef")
+	for _, test := range []struct {
+		off, line, col int
+	}{
+		{0, 1, 1},
+		{2, 1, 3},
+		{3, 2, 1},
+		{4, 2, 2},
+		{6, 3, 1},
+		{8, 4, 2},
+		{100, 4, 3},
+	} {
+		line, col := offsetPosition(content, test.off)
+		if line != test.line || col != test.col {
+			t.Errorf("offsetPosition(%d) = %d:%d, want %d:%d", test.off, line, col, test.line, test.col)
+		}
+	}
+}
+
+func TestRecordJump(t *testing.T) {
+	defer func(j bool) { *jumpsFlag = j }(*jumpsFlag)
+	dir := writeTree(t, map[string]string{"x.go": "package x\n"})
+	defer os.Setenv("XDG_CACHE_HOME", os.Getenv("XDG_CACHE_HOME"))
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	os.Setenv("HOME", dir)
+	name, err := jumpsFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "x.go")
+	to := token.Position{Filename: filename, Line: 1, Column: 9}
+	for _, jumps := range []bool{false, true} {
+		*jumpsFlag = jumps
+		if err := recordJump(filename, nil, 8, to); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(name); err == nil != jumps {
+			t.Errorf("with -jumps=%v, history exists: %v", jumps, err == nil)
+		}
+	}
+}
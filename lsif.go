@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+func lsifMain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("lsif", flag.ExitOnError)
+	out := fs.String("o", "", "write the dump to this file rather than standard output")
+	tests := fs.Bool("tests", false, "include test files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: godef lsif [-o file] [-tests] [packages]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	idx, err := collectRefs(ctx, dir, patterns, *tests)
+	if err != nil {
+		return err
+	}
+	root := moduleRoot(dir)
+	if root == "" {
+		root = dir
+	}
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	if err := writeLSIF(bw, idx, root); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// lsifWriter emits LSIF vertices and edges as JSON lines.
+type lsifWriter struct {
+	enc *json.Encoder
+	id  int
+	err error
+}
+
+func (w *lsifWriter) emit(v map[string]interface{}) int {
+	w.id++
+	v["id"] = w.id
+	if w.err == nil {
+		w.err = w.enc.Encode(v)
+	}
+	return w.id
+}
+
+func (w *lsifWriter) vertex(label string, v map[string]interface{}) int {
+	if v == nil {
+		v = make(map[string]interface{})
+	}
+	v["type"] = "vertex"
+	v["label"] = label
+	return w.emit(v)
+}
+
+func (w *lsifWriter) edge(label string, outV int, inVs []int, extra map[string]interface{}) {
+	v := map[string]interface{}{
+		"type":  "edge",
+		"label": label,
+		"outV":  outV,
+	}
+	if len(inVs) == 1 && label != "contains" && label != "item" {
+		v["inV"] = inVs[0]
+	} else {
+		v["inVs"] = inVs
+	}
+	for k, x := range extra {
+		v[k] = x
+	}
+	w.emit(v)
+}
+
+// writeLSIF writes idx to w as an LSIF dump for the project at root.
+func writeLSIF(out io.Writer, idx *refIndex, root string) error {
+	w := &lsifWriter{enc: json.NewEncoder(out)}
+	w.vertex("metaData", map[string]interface{}{
+		"version":          "0.4.3",
+		"projectRoot":      filenameToURI(root),
+		"positionEncoding": "utf-16",
+		"toolInfo":         map[string]string{"name": "godef"},
+	})
+	project := w.vertex("project", map[string]interface{}{"kind": "go"})
+
+	// Ranges belonging to each symbol, keyed by document.
+	type docRanges struct {
+		doc    int
+		ranges []int
+	}
+	defs := make(map[*refSymbol]*docRanges)
+	refs := make(map[*refSymbol][]*docRanges)
+	resultSets := make(map[*refSymbol]int)
+
+	var docs []int
+	for _, f := range idx.Files {
+		doc := w.vertex("document", map[string]interface{}{
+			"uri":        filenameToURI(f.Filename),
+			"languageId": "go",
+		})
+		docs = append(docs, doc)
+		var ranges []int
+		symRanges := make(map[*refSymbol]*docRanges)
+		for _, occ := range f.Occs {
+			r := w.vertex("range", map[string]interface{}{
+				"start": occ.Start,
+				"end":   occ.End,
+			})
+			ranges = append(ranges, r)
+			rs, ok := resultSets[occ.Symbol]
+			if !ok {
+				rs = w.vertex("resultSet", nil)
+				resultSets[occ.Symbol] = rs
+			}
+			w.edge("next", r, []int{rs}, nil)
+			if occ.Def {
+				defs[occ.Symbol] = &docRanges{doc, []int{r}}
+				continue
+			}
+			dr := symRanges[occ.Symbol]
+			if dr == nil {
+				dr = &docRanges{doc: doc}
+				symRanges[occ.Symbol] = dr
+				refs[occ.Symbol] = append(refs[occ.Symbol], dr)
+			}
+			dr.ranges = append(dr.ranges, r)
+		}
+		if len(ranges) > 0 {
+			w.edge("contains", doc, ranges, nil)
+		}
+	}
+	if len(docs) > 0 {
+		w.edge("contains", project, docs, nil)
+	}
+
+	for _, sym := range idx.Symbols {
+		rs, ok := resultSets[sym]
+		if !ok {
+			continue
+		}
+		hover := w.vertex("hoverResult", map[string]interface{}{
+			"result": map[string]interface{}{
+				"contents": []map[string]string{{
+					"language": "go",
+					"value":    sym.Hover,
+				}},
+			},
+		})
+		w.edge("textDocument/hover", rs, []int{hover}, nil)
+		def := defs[sym]
+		if def != nil {
+			dr := w.vertex("definitionResult", nil)
+			w.edge("textDocument/definition", rs, []int{dr}, nil)
+			w.edge("item", dr, def.ranges, map[string]interface{}{"document": def.doc})
+		}
+		rr := w.vertex("referenceResult", nil)
+		w.edge("textDocument/references", rs, []int{rr}, nil)
+		if def != nil {
+			w.edge("item", rr, def.ranges, map[string]interface{}{
+				"document": def.doc,
+				"property": "definitions",
+			})
+		}
+		for _, r := range refs[sym] {
+			w.edge("item", rr, r.ranges, map[string]interface{}{
+				"document": r.doc,
+				"property": "references",
+			})
+		}
+	}
+	return w.err
+}
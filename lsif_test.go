@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteLSIF(t *testing.T) {
+	idx, dir := loadRefs(t)
+	var buf bytes.Buffer
+	if err := writeLSIF(&buf, idx, dir); err != nil {
+		t.Fatal(err)
+	}
+	type element struct {
+		ID       int
+		Type     string
+		Label    string
+		OutV     int
+		InV      int
+		InVs     []int
+		Property string
+		Start    lspPosition
+		Result   struct {
+			Contents []struct{ Value string }
+		}
+	}
+	elems := make(map[int]*element)
+	var edges []*element
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e element
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		elems[e.ID] = &e
+		if e.Type == "edge" {
+			if e.InV != 0 {
+				e.InVs = []int{e.InV}
+			}
+			edges = append(edges, &e)
+		}
+	}
+	// follow returns the vertices reached from v by edges with the label.
+	follow := func(v int, label, property string) []*element {
+		var to []*element
+		for _, e := range edges {
+			if e.OutV == v && e.Label == label && e.Property == property {
+				for _, id := range e.InVs {
+					to = append(to, elems[id])
+				}
+			}
+		}
+		return to
+	}
+	// Find the definition of T.M, at 0-based line 4, character 11.
+	var rs []*element
+	for _, e := range elems {
+		if e.Label == "range" && e.Start == (lspPosition{4, 11}) {
+			rs = follow(e.ID, "next", "")
+		}
+	}
+	if len(rs) != 1 {
+		t.Fatalf("got %d result sets for the definition of M, want 1", len(rs))
+	}
+	hover := follow(rs[0].ID, "textDocument/hover", "")
+	if len(hover) != 1 || len(hover[0].Result.Contents) != 1 || hover[0].Result.Contents[0].Value != "M func() int" {
+		t.Errorf("got hover %+v, want the type of M", hover)
+	}
+	for _, test := range []struct {
+		label, property string
+		want            lspPosition
+	}{
+		{"textDocument/definition", "", lspPosition{4, 11}},
+		{"textDocument/references", "definitions", lspPosition{4, 11}},
+		{"textDocument/references", "references", lspPosition{8, 10}},
+	} {
+		results := follow(rs[0].ID, test.label, "")
+		if len(results) != 1 {
+			t.Errorf("%s: got %d results, want 1", test.label, len(results))
+			continue
+		}
+		ranges := follow(results[0].ID, "item", test.property)
+		if len(ranges) != 1 || ranges[0].Start != test.want {
+			t.Errorf("%s %s: got ranges %+v, want one at %v", test.label, test.property, ranges, test.want)
+		}
+	}
+}
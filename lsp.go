@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/rogpeppe/godef/godef"
+	"golang.org/x/tools/go/packages"
+)
+
+// JSON-RPC error codes used by the language server.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+type rpcRequest struct {
+	ID     *json.RawMessage `json:"id"`
+	Method string           `json:"method"`
+	Params json.RawMessage  `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+type rpcResult struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result"`
+}
+
+type rpcFailure struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Error   *rpcError        `json:"error"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type textDocumentPositionParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+}
+
+type didOpenParams struct {
+	TextDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"textDocument"`
+}
+
+type didChangeParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type didCloseParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+}
+
+// lspServer is a minimal language server answering definition
+// and hover requests. Open documents are kept in memory and
+// used as overlays when loading packages.
+type lspServer struct {
+	ctx      context.Context
+	cache    *packageCache
+	docs     map[string][]byte
+	shutdown bool
+}
+
+// serveLSP runs a language server reading requests from r and
+// writing responses to w until the client sends "exit".
+func serveLSP(ctx context.Context, r io.Reader, w io.Writer) error {
+	s := &lspServer{
+		ctx:   ctx,
+		cache: newPackageCache(),
+		docs:  make(map[string][]byte),
+	}
+	in := bufio.NewReader(r)
+	for {
+		data, err := readMessage(in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req rpcRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			if err := writeMessage(w, rpcFailure{"2.0", nil, &rpcError{codeParseError, err.Error()}}); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit received before shutdown")
+			}
+			return nil
+		}
+		result, err := s.handle(req.Method, req.Params)
+		if req.ID == nil {
+			// Notifications get no response.
+			continue
+		}
+		var resp interface{} = rpcResult{"2.0", req.ID, result}
+		if err != nil {
+			rerr, ok := err.(*rpcError)
+			if !ok {
+				rerr = &rpcError{codeInternalError, err.Error()}
+			}
+			resp = rpcFailure{"2.0", req.ID, rerr}
+		}
+		if err := writeMessage(w, resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *lspServer) handle(method string, params json.RawMessage) (interface{}, error) {
+	if s.shutdown {
+		return nil, &rpcError{codeInvalidRequest, "server is shutting down"}
+	}
+	switch method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // full document sync
+				"definitionProvider": true,
+				"hoverProvider":      true,
+			},
+			"serverInfo": map[string]string{"name": "godef"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &rpcError{codeInvalidParams, err.Error()}
+		}
+		s.setDoc(p.TextDocument.URI, []byte(p.TextDocument.Text))
+		return nil, nil
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &rpcError{codeInvalidParams, err.Error()}
+		}
+		if n := len(p.ContentChanges); n > 0 {
+			s.setDoc(p.TextDocument.URI, []byte(p.ContentChanges[n-1].Text))
+		}
+		return nil, nil
+	case "textDocument/didSave":
+		s.cache.invalidate()
+		return nil, nil
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &rpcError{codeInvalidParams, err.Error()}
+		}
+		delete(s.docs, uriToFilename(p.TextDocument.URI))
+		s.cache.invalidate()
+		return nil, nil
+	case "textDocument/definition":
+		return s.definition(params)
+	case "textDocument/hover":
+		return s.hover(params)
+	}
+	if strings.HasPrefix(method, "$/") {
+		// Optional protocol notifications may be ignored.
+		return nil, nil
+	}
+	return nil, &rpcError{codeMethodNotFound, fmt.Sprintf("method %q not supported", method)}
+}
+
+func (s *lspServer) setDoc(uri string, text []byte) {
+	// The cache compares cached packages with the documents
+	// when they are next used, so that an edit to one file
+	// need only recheck that file.
+	s.docs[uriToFilename(uri)] = text
+}
+
+// resolve returns the object at the position described by params.
+func (s *lspServer) resolve(params json.RawMessage) (_ *lspObject, err error) {
+	var p textDocumentPositionParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpcError{codeInvalidParams, err.Error()}
+	}
+	filename := uriToFilename(p.TextDocument.URI)
+	content, err := s.content(filename)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := utf16Offset(content, p.Position.Line, p.Position.Character)
+	if err != nil {
+		return nil, &rpcError{codeInvalidParams, err.Error()}
+	}
+	defer godef.RecoverPanic(filename, offset, &err)
+	cfg := &packages.Config{
+		Context: s.ctx,
+		Overlay: s.docs,
+	}
+	pkg, err := s.cache.get(cfg, filename)
+	if err != nil {
+		return nil, err
+	}
+	fset, obj, err := lookupObject(cfg, pkg, filename, offset, false)
+	if err != nil {
+		return nil, err
+	}
+	return &lspObject{godef.Position(fset, obj), obj}, nil
+}
+
+// lspObject holds what the server needs to know about a resolved object.
+type lspObject struct {
+	pos token.Position
+	obj types.Object
+}
+
+// desc returns the description of the object shown on hover. It is
+// computed only when needed, as definition requests do not use it.
+func (o *lspObject) desc() string {
+	return godef.TypeString(o.obj, nil)
+}
+
+func (s *lspServer) definition(params json.RawMessage) (interface{}, error) {
+	obj, err := s.resolve(params)
+	if err != nil {
+		return nil, err
+	}
+	if !obj.pos.IsValid() {
+		return []lspLocation{}, nil
+	}
+	start, err := s.lspPos(obj.pos)
+	if err != nil {
+		return nil, err
+	}
+	return []lspLocation{{
+		URI:   filenameToURI(obj.pos.Filename),
+		Range: lspRange{start, start},
+	}}, nil
+}
+
+func (s *lspServer) hover(params json.RawMessage) (interface{}, error) {
+	obj, err := s.resolve(params)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"contents": map[string]string{
+			"kind":  "markdown",
+			"value": "```go\n" + obj.desc() + "\n```",
+		},
+	}, nil
+}
+
+// content returns the current contents of the file,
+// preferring an open document to the file on disk.
+func (s *lspServer) content(filename string) ([]byte, error) {
+	if data, ok := s.docs[filename]; ok {
+		return data, nil
+	}
+	return ioutil.ReadFile(filename)
+}
+
+// lspPos converts a token.Position into an LSP position,
+// counting the column in UTF-16 code units.
+func (s *lspServer) lspPos(pos token.Position) (lspPosition, error) {
+	p := lspPosition{Line: pos.Line - 1}
+	content, err := s.content(pos.Filename)
+	if err != nil {
+		// Fall back to the byte column.
+		p.Character = pos.Column - 1
+		return p, nil
+	}
+	line := lineAt(content, pos.Line)
+	col := pos.Column - 1
+	if col > len(line) {
+		col = len(line)
+	}
+	p.Character = utf16Len(line[:col])
+	return p, nil
+}
+
+// lineAt returns the contents of the given one-based line,
+// without its terminating newline.
+func lineAt(content []byte, line int) []byte {
+	for i := 1; i < line; i++ {
+		nl := bytes.IndexByte(content, '\n')
+		if nl < 0 {
+			return nil
+		}
+		content = content[nl+1:]
+	}
+	if nl := bytes.IndexByte(content, '\n'); nl >= 0 {
+		content = content[:nl]
+	}
+	return content
+}
+
+// utf16Offset returns the byte offset in content of the
+// zero-based line and UTF-16 character position.
+func utf16Offset(content []byte, line, char int) (int, error) {
+	offset := 0
+	for i := 0; i < line; i++ {
+		nl := bytes.IndexByte(content[offset:], '\n')
+		if nl < 0 {
+			return 0, fmt.Errorf("line %d is beyond end of file", line+1)
+		}
+		offset += nl + 1
+	}
+	for n := 0; n < char; {
+		if offset >= len(content) || content[offset] == '\n' {
+			return 0, fmt.Errorf("character %d is beyond end of line %d", char, line+1)
+		}
+		r, size := utf8.DecodeRune(content[offset:])
+		n += len(utf16.Encode([]rune{r}))
+		offset += size
+	}
+	return offset, nil
+}
+
+// utf16Len returns the number of UTF-16 code units needed to encode b.
+func utf16Len(b []byte) int {
+	n := 0
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		n += len(utf16.Encode([]rune{r}))
+		b = b[size:]
+	}
+	return n
+}
+
+func uriToFilename(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	path := u.Path
+	if runtime.GOOS == "windows" && len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		// file:///C:/foo has path /C:/foo
+		path = path[1:]
+	}
+	return filepath.FromSlash(path)
+}
+
+func filenameToURI(filename string) string {
+	path := filepath.ToSlash(filename)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// readMessage reads a single message framed by a Content-Length header.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && length == -1 {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("cannot read header: %v", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid header line %q", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(line[:i]), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(line[i+1:]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid Content-Length %q", line[i+1:])
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("missing Content-Length header")
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("cannot read message: %v", err)
+	}
+	return data, nil
+}
+
+// writeMessage writes msg as JSON framed by a Content-Length header.
+func writeMessage(w io.Writer, msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
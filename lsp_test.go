@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestUTF16Offset(t *testing.T) {
+	content := []byte("package p\n\nvar héllo, 𝒳y = 1, 2\n")
+	for _, test := range []struct {
+		line, char int
+		want       int
+	}{
+		{0, 0, 0},
+		{2, 4, 15},
+		{2, 7, 19},  // é is one UTF-16 unit but two bytes
+		{2, 13, 27}, // 𝒳 is two UTF-16 units and four bytes
+	} {
+		got, err := utf16Offset(content, test.line, test.char)
+		if err != nil {
+			t.Errorf("utf16Offset(%d, %d): %v", test.line, test.char, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("utf16Offset(%d, %d) = %d want %d", test.line, test.char, got, test.want)
+		}
+		line := lineAt(content, test.line+1)
+		lineStart := bytes.Index(content, line)
+		if n := utf16Len(content[lineStart:got]); n != test.char {
+			t.Errorf("utf16Len of %q = %d want %d", content[lineStart:got], n, test.char)
+		}
+	}
+	if _, err := utf16Offset(content, 5, 0); err == nil {
+		t.Errorf("expected error for line beyond end of file")
+	}
+}
+
+func TestMessageFraming(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeMessage(&buf, map[string]int{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := readMessage(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"id":1}` {
+		t.Errorf("unexpected message %q", data)
+	}
+}
+
+func TestServeLSP(t *testing.T) {
+	src := "package x\n\ntype T struct{ A int }\n\nvar v T\n"
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module x\n",
+		"x.go":   src,
+	})
+	uri := filenameToURI(filepath.Join(dir, "x.go"))
+	// The open document differs from the file on disk.
+	text := "package x\n\ntype T struct{ A int }\n\nvar v, w T\n"
+	pos := map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri},
+		"position":     lspPosition{4, 9},
+	}
+	var in bytes.Buffer
+	for i, req := range []struct {
+		method string
+		params interface{}
+	}{
+		{"initialize", map[string]interface{}{}},
+		{"textDocument/didOpen", map[string]interface{}{"textDocument": map[string]string{"uri": uri, "text": text}}},
+		{"textDocument/definition", pos},
+		{"textDocument/hover", pos},
+		{"shutdown", nil},
+		{"exit", nil},
+	} {
+		msg := map[string]interface{}{"jsonrpc": "2.0", "id": i, "method": req.method, "params": req.params}
+		if req.method == "textDocument/didOpen" || req.method == "exit" {
+			delete(msg, "id")
+		}
+		if err := writeMessage(&in, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var out bytes.Buffer
+	if err := serveLSP(context.Background(), &in, &out); err != nil {
+		t.Fatal(err)
+	}
+	responses := make(map[int]json.RawMessage)
+	r := bufio.NewReader(&out)
+	for {
+		data, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		var resp struct {
+			ID     int
+			Result json.RawMessage
+			Error  *rpcError
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Error != nil {
+			t.Errorf("request %d failed: %v", resp.ID, resp.Error)
+		}
+		responses[resp.ID] = resp.Result
+	}
+	var locs []lspLocation
+	if err := json.Unmarshal(responses[2], &locs); err != nil {
+		t.Fatal(err)
+	}
+	if len(locs) != 1 || locs[0].URI != uri || locs[0].Range.Start != (lspPosition{2, 5}) {
+		t.Errorf("got definition %+v, want T at 2:5 in %s", locs, uri)
+	}
+	var hover struct {
+		Contents struct{ Kind, Value string }
+	}
+	if err := json.Unmarshal(responses[3], &hover); err != nil {
+		t.Fatal(err)
+	}
+	if want := "```go\ntype T struct{A int}\n```"; hover.Contents.Value != want {
+		t.Errorf("got hover %q, want %q", hover.Contents.Value, want)
+	}
+}
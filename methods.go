@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"go/types"
+	"strings"
+
+	"github.com/rogpeppe/godef/godef"
+)
+
+var methodsFlag = flag.Bool("methods", false, "list the method set of the type at the offset, or of the value's type, showing where promoted methods come from")
+
+// methodsDefinition returns the definition of the type named at
+// the given offset of filename, or of the type of the value there,
+// with every method in its method set as members. For a type other
+// than an interface, that is the method set of a pointer to it, so
+// that methods with pointer receivers are included. Promoted methods
+// are marked with the path of embedded fields that they come through.
+func methodsDefinition(ctx context.Context, dir, filename string, src []byte, overlay map[string][]byte, offset int) (*definition, error) {
+	res, err := typedObject(ctx, dir, filename, src, overlay, offset)
+	if err != nil {
+		return nil, err
+	}
+	obj := res.Object
+	var t types.Type
+	var def *definition
+	if tn, ok := obj.(*types.TypeName); ok {
+		t = tn.Type()
+		def = describe(res.Fset, tn, resolution{engine: godef.EnginePackages}, true, false, false)
+	} else if obj.Type() != nil {
+		t = obj.Type()
+		if p, ok := t.(*types.Pointer); ok {
+			t = p.Elem()
+		}
+		def = describe(res.Fset, obj, resolution{engine: godef.EnginePackages}, true, false, false)
+		if named, ok := t.(*types.Named); ok {
+			def = describe(res.Fset, named.Obj(), resolution{engine: godef.EnginePackages}, true, false, false)
+		}
+	}
+	if t == nil {
+		return nil, &queryError{exitNotFound, fmt.Errorf("%s has no type", obj.Name())}
+	}
+	mt := t
+	if !types.IsInterface(t) {
+		mt = types.NewPointer(t)
+	}
+	mset := types.NewMethodSet(mt)
+	for i := 0; i < mset.Len(); i++ {
+		sel := mset.At(i)
+		m := sel.Obj()
+		text := godef.TypeString(m, qualifier)
+		if path := embeddingPath(t, sel.Index()); path != "" {
+			text += " // promoted through " + path
+		} else if from := declaringInterface(m); from != nil && !types.Identical(from, t) {
+			text += " // from " + types.TypeString(from, qualifier)
+		}
+		def.Members = append(def.Members, member{Type: text, Pos: godef.Position(res.Fset, m)})
+	}
+	return def, nil
+}
+
+// embeddingPath returns the names of the embedded fields, joined by
+// dots, through which the method at the given index path of t is
+// promoted, or the empty string if it is declared by t itself.
+func embeddingPath(t types.Type, index []int) string {
+	var names []string
+	for _, i := range index[:len(index)-1] {
+		if p, ok := t.(*types.Pointer); ok {
+			t = p.Elem()
+		}
+		st, ok := t.Underlying().(*types.Struct)
+		if !ok || i >= st.NumFields() {
+			break
+		}
+		f := st.Field(i)
+		names = append(names, f.Name())
+		t = f.Type()
+	}
+	return strings.Join(names, ".")
+}
+
+// declaringInterface returns the named interface type that declares
+// the interface method m, or nil if m is not such a method.
+func declaringInterface(m types.Object) types.Type {
+	sig, ok := m.Type().(*types.Signature)
+	if !ok || sig.Recv() == nil {
+		return nil
+	}
+	recv := sig.Recv().Type()
+	if _, ok := recv.(*types.Named); !ok || !types.IsInterface(recv) {
+		return nil
+	}
+	return recv
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMethodsDefinition(t *testing.T) {
+	xsrc := `package x
+
+type Inner struct{}
+
+func (Inner) A()  {}
+func (*Inner) B() {}
+
+type Middle struct{ Inner }
+
+type Outer struct{ *Middle }
+
+func (Outer) C() {}
+`
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module x\n",
+		"x.go":   xsrc,
+	})
+	def, err := methodsDefinition(context.Background(), dir, filepath.Join(dir, "x.go"), nil, nil, strings.Index(xsrc, "Outer struct"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range def.Members {
+		got = append(got, m.Type)
+	}
+	want := []string{
+		"A func() // promoted through Middle.Inner",
+		"B func() // promoted through Middle.Inner",
+		"C func()",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got methods\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
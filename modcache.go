@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/rogpeppe/godef/godef"
+)
+
+// queryDependency is like godef.Query, except that if the queried
+// file is in the module cache, and the current module does not build
+// that version of the file's module, it loads the file's package in
+// a synthetic module that requires just that version instead. Jumps
+// within and out of a dependency reached by an earlier jump then
+// resolve as they would when building it.
+func queryDependency(ctx context.Context, opts godef.Options) (*godef.Result, error) {
+	if opts.NoExec {
+		return godef.Query(ctx, opts)
+	}
+	env, err := goEnv(ctx, opts.Config.Dir)
+	if err != nil {
+		return godef.Query(ctx, opts)
+	}
+	modPath, version, ok := splitModCachePath(env["GOMODCACHE"], opts.Filename)
+	if !ok {
+		return godef.Query(ctx, opts)
+	}
+	if selectedVersion(ctx, opts.Config.Dir, modPath) == version {
+		return godef.Query(ctx, opts)
+	}
+	logf(levelDebug, "%s@%s is not in the current build list; loading it on its own", modPath, version)
+	dir, err := syntheticModule(modPath, version)
+	if err != nil {
+		logf(levelDebug, "%v", err)
+		return godef.Query(ctx, opts)
+	}
+	cfg := *opts.Config
+	cfg.Dir = dir
+	// With -mod=mod the go command fills in the synthetic
+	// module's requirements, and with GOWORK=off no workspace
+	// can take its place as the main module.
+	cfg.Env = append(os.Environ(), "GOFLAGS="+strings.TrimSpace(env["GOFLAGS"]+" -mod=mod"), "GOWORK=off")
+	opts.Config = &cfg
+	return godef.Query(ctx, opts)
+}
+
+// selectedVersion returns the version of modPath that the
+// module in dir builds, or the empty string if there is none,
+// or it is replaced by another module or a directory.
+func selectedVersion(ctx context.Context, dir, modPath string) string {
+	cmd := exec.CommandContext(ctx, "go", "list", "-m", "-f", "{{if not .Replace}}{{.Version}}{{end}}", modPath)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// splitModCachePath reports whether filename is within the module
+// cache directory modCache, returning the path and version of the
+// module holding it if so.
+func splitModCachePath(modCache, filename string) (modPath, version string, ok bool) {
+	if modCache == "" {
+		return "", "", false
+	}
+	rel, err := filepath.Rel(modCache, filename)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", "", false
+	}
+	elems := strings.Split(filepath.ToSlash(rel), "/")
+	for i, elem := range elems {
+		if i == 0 && elem == "cache" {
+			// The download cache holds no source files.
+			return "", "", false
+		}
+		if at := strings.Index(elem, "@"); at >= 0 {
+			escaped := strings.Join(append(elems[:i:i], elem[:at]), "/")
+			return unescapePath(escaped), unescapePath(elem[at+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// escapePath escapes a module path or version as the module cache
+// does, replacing each upper-case letter by ! and its lower case.
+func escapePath(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// unescapePath reverses the module cache's escaping of a module
+// path or version, in which each upper-case letter is replaced
+// by ! and its lower case.
+func unescapePath(s string) string {
+	var b strings.Builder
+	bang := false
+	for _, r := range s {
+		switch {
+		case r == '!':
+			bang = true
+			continue
+		case bang:
+			r = unicode.ToUpper(r)
+		}
+		bang = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// syntheticModule returns a directory under the user's cache
+// directory holding a main module that requires just the given
+// version of modPath, creating it if need be.
+func syntheticModule(modPath, version string) (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256([]byte(modPath + "@" + version))
+	dir := filepath.Join(cache, "godef", "modules", fmt.Sprintf("%x", h[:8]))
+	gomod := filepath.Join(dir, "go.mod")
+	if _, err := os.Stat(gomod); err == nil {
+		return dir, nil
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", fmt.Errorf("cannot create synthetic module: %v", err)
+	}
+	data := fmt.Sprintf("module godef.synthetic/%x\n\nrequire %s %s\n", h[:8], modPath, version)
+	if err := ioutil.WriteFile(gomod, []byte(data), 0666); err != nil {
+		return "", fmt.Errorf("cannot create synthetic module: %v", err)
+	}
+	return dir, nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitModCachePath(t *testing.T) {
+	modCache := filepath.FromSlash("/home/u/go/pkg/mod")
+	for _, test := range []struct {
+		filename         string
+		modPath, version string
+		ok               bool
+	}{
+		{"/home/u/go/pkg/mod/golang.org/x/tools@v0.1.0/go/packages/packages.go", "golang.org/x/tools", "v0.1.0", true},
+		{"/home/u/go/pkg/mod/github.com/!burnt!sushi/toml@v1.2.0/decode.go", "github.com/BurntSushi/toml", "v1.2.0", true},
+		{"/home/u/go/pkg/mod/cache/download/x@v1/x.go", "", "", false},
+		{"/home/u/src/x/x.go", "", "", false},
+	} {
+		modPath, version, ok := splitModCachePath(modCache, filepath.FromSlash(test.filename))
+		if modPath != test.modPath || version != test.version || ok != test.ok {
+			t.Errorf("splitModCachePath(%q) = %q, %q, %v, want %q, %q, %v", test.filename, modPath, version, ok, test.modPath, test.version, test.ok)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rogpeppe/godef/godef"
+)
+
+var pathMapFlag pathMap
+var symlinksFlag = flag.String("resolve-symlinks", "off", "whether to resolve symbolic links in printed file names: on or off")
+var slashFlag = flag.Bool("slash", false, "print file names with forward slashes, even on Windows")
+var relFlag = flag.String("rel", "", "print file names relative to this `dir`, or to the module root if \"module\"")
+
+func init() {
+	flag.Var(&pathMapFlag, "path-map", "map file names with prefix `host=local` on input, and back on output (may be repeated)")
+}
+
+// pathMap translates between the file names seen by the editor (the
+// host) and those seen by godef (local), as when godef runs in a
+// container with the source bind-mounted at a different path.
+type pathMap []pathMapping
+
+type pathMapping struct {
+	host, local string
+}
+
+func (m *pathMap) String() string {
+	var s []string
+	for _, p := range *m {
+		s = append(s, p.host+"="+p.local)
+	}
+	return strings.Join(s, ",")
+}
+
+func (m *pathMap) Set(v string) error {
+	i := strings.Index(v, "=")
+	if i <= 0 || i == len(v)-1 {
+		return fmt.Errorf("want hostprefix=localprefix")
+	}
+	*m = append(*m, pathMapping{v[:i], v[i+1:]})
+	return nil
+}
+
+// toLocal returns the local name of the host file name.
+func (m pathMap) toLocal(name string) string {
+	for _, p := range m {
+		if rest, ok := trimPathPrefix(name, p.host); ok {
+			return p.local + withSeparators(rest, p.local)
+		}
+	}
+	return name
+}
+
+// toHost returns the host name of the local file name.
+func (m pathMap) toHost(name string) string {
+	for _, p := range m {
+		if rest, ok := trimPathPrefix(name, p.local); ok {
+			return p.host + withSeparators(rest, p.host)
+		}
+	}
+	return name
+}
+
+// trimPathPrefix removes prefix from name if it is a whole
+// number of path elements, in either slash or backslash form.
+func trimPathPrefix(name, prefix string) (string, bool) {
+	if !strings.HasPrefix(name, prefix) {
+		return "", false
+	}
+	rest := name[len(prefix):]
+	if rest == "" || rest[0] == '/' || rest[0] == '\\' || strings.HasSuffix(prefix, "/") || strings.HasSuffix(prefix, "\\") {
+		return rest, true
+	}
+	return "", false
+}
+
+// withSeparators converts the path separators in rest to those
+// used by prefix, if it uses only one kind.
+func withSeparators(rest, prefix string) string {
+	slash, backslash := strings.Contains(prefix, "/"), strings.Contains(prefix, "\\")
+	switch {
+	case slash && !backslash:
+		return strings.Replace(rest, "\\", "/", -1)
+	case backslash && !slash:
+		return strings.Replace(rest, "/", "\\", -1)
+	}
+	return rest
+}
+
+// outputName returns the file name to print for the named file:
+// relative to the directory given by -rel if it is within it,
+// and otherwise normalized and mapped by -path-map, with forward
+// slashes if -slash is given. Symbolic links are resolved first
+// if -resolve-symlinks is on.
+func outputName(name string) string {
+	if *symlinksFlag == "on" {
+		if real, err := filepath.EvalSymlinks(name); err == nil {
+			name = real
+		}
+	}
+	if filepath.IsAbs(name) {
+		name = godef.NormalizePath(name)
+	}
+	if base := relBase(); base != "" {
+		if rel, err := filepath.Rel(base, name); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return slashName(rel)
+		}
+	}
+	return slashName(pathMapFlag.toHost(name))
+}
+
+func slashName(name string) string {
+	if *slashFlag {
+		return strings.Replace(name, "\\", "/", -1)
+	}
+	return name
+}
+
+// relBase returns the absolute directory named by -rel.
+func relBase() string {
+	if *relFlag == "" {
+		return ""
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	if *relFlag == "module" {
+		if root := moduleRoot(dir); root != "" {
+			return godef.NormalizePath(root)
+		}
+		return godef.NormalizePath(dir)
+	}
+	return godef.NormalizePath(abs(dir, *relFlag))
+}
+
+func checkSymlinksFlag() error {
+	switch *symlinksFlag {
+	case "on", "off":
+		return nil
+	}
+	return &queryError{exitUsage, fmt.Errorf("invalid -resolve-symlinks value %q (want on or off)", *symlinksFlag)}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPathMap(t *testing.T) {
+	var m pathMap
+	for _, v := range []string{"/home/me/src=/src", `C:\work=/work`} {
+		if err := m.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Set("nolocal="); err == nil {
+		t.Errorf("expected error for empty local prefix")
+	}
+	for _, test := range []struct {
+		host, local string
+	}{
+		{"/home/me/src/x/y.go", "/src/x/y.go"},
+		{`C:\work\x\y.go`, "/work/x/y.go"},
+		{"/home/me/srcother/y.go", "/home/me/srcother/y.go"},
+		{"/elsewhere/y.go", "/elsewhere/y.go"},
+	} {
+		if got := m.toLocal(test.host); got != test.local {
+			t.Errorf("toLocal(%q) = %q, want %q", test.host, got, test.local)
+		}
+		if got := m.toHost(test.local); got != test.host {
+			t.Errorf("toHost(%q) = %q, want %q", test.local, got, test.host)
+		}
+	}
+}
+
+func TestRelFlag(t *testing.T) {
+	src := "package sub\n\nfunc F() {}\n\nvar v = F\n"
+	dir := writeTree(t, map[string]string{
+		"go.mod":     "module x\n",
+		"sub/x.go":   src,
+		"other/o.go": "package other\n",
+	})
+	off := fmt.Sprint(strings.LastIndex(src, "F"))
+	for _, test := range []struct {
+		rel  string
+		want string
+	}{
+		{"", filepath.Join(dir, "sub", "x.go")},
+		{"module", filepath.Join("sub", "x.go")},
+		{".", "x.go"},
+		{dir, filepath.Join("sub", "x.go")},
+		// Names outside the directory stay absolute.
+		{filepath.Join(dir, "other"), filepath.Join(dir, "sub", "x.go")},
+	} {
+		stdout, stderr, code := runGodef(t, filepath.Join(dir, "sub"), "", nil, "-rel", test.rel, "-f", "x.go", "-o", off)
+		if code != 0 {
+			t.Errorf("-rel %q: exit status %d: %s", test.rel, code, stderr)
+			continue
+		}
+		if want := test.want + ":3:6\n"; stdout != want {
+			t.Errorf("-rel %q: got %q, want %q", test.rel, stdout, want)
+		}
+	}
+}
+
+func TestSlashFlag(t *testing.T) {
+	defer func(slash bool) { *slashFlag = slash }(*slashFlag)
+	name := `C:\work\x.go`
+	for _, slash := range []bool{false, true} {
+		*slashFlag = slash
+		want := name
+		if slash {
+			want = "C:/work/x.go"
+		}
+		if got := outputName(name); got != want {
+			t.Errorf("-slash=%v: outputName(%q) = %q, want %q", slash, name, got, want)
+		}
+	}
+}
+
+func TestResolveSymlinksFlag(t *testing.T) {
+	src := "package x\n\nfunc F() {}\n\nvar v = F\n"
+	dir := writeTree(t, map[string]string{
+		"real/go.mod": "module x\n",
+		"real/x.go":   src,
+	})
+	if err := os.Symlink(filepath.Join(dir, "real"), filepath.Join(dir, "link")); err != nil {
+		t.Skipf("cannot make symbolic link: %v", err)
+	}
+	off := fmt.Sprint(strings.LastIndex(src, "F"))
+	for _, test := range []struct {
+		value string
+		want  string
+		code  int
+	}{
+		{"off", filepath.Join(dir, "link", "x.go") + ":3:6\n", 0},
+		{"on", filepath.Join(dir, "real", "x.go") + ":3:6\n", 0},
+		{"sometimes", "", exitUsage},
+	} {
+		stdout, stderr, code := runGodef(t, dir, "", nil, "-resolve-symlinks", test.value, "-f", filepath.Join("link", "x.go"), "-o", off)
+		if code != test.code {
+			t.Errorf("-resolve-symlinks=%s: got exit status %d, want %d; stderr: %s", test.value, code, test.code, stderr)
+			continue
+		}
+		if code == 0 && stdout != test.want {
+			t.Errorf("-resolve-symlinks=%s: got %q, want %q", test.value, stdout, test.want)
+		}
+	}
+}
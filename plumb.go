@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// plumbDef sends the location of def to the plumber's edit port,
+// so that acme opens the file and selects the definition.
+func plumbDef(def *definition) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	w, err := openPlumb()
+	if err != nil {
+		return fmt.Errorf("cannot open plumber: %v", err)
+	}
+	defer w.Close()
+	if _, err := w.Write(plumbMessage(dir, def)); err != nil {
+		return fmt.Errorf("cannot plumb definition: %v", err)
+	}
+	return nil
+}
+
+// plumbMessage returns the plumb message for the location of def.
+// Acme addresses count runes, so the column is converted to
+// runes and reached from the start of the line.
+func plumbMessage(wdir string, def *definition) []byte {
+	pos := encodeColumn(def.Pos, encodingRunes)
+	attr := fmt.Sprintf("addr=%d", pos.Line)
+	if pos.Column > 1 {
+		attr += fmt.Sprintf("-#0+#%d", pos.Column-1)
+	}
+	// The message must reach the plumber in a single write.
+	return []byte(fmt.Sprintf("godef\nedit\n%s\ntext\n%s\n%d\n%s", wdir, attr, len(pos.Filename), pos.Filename))
+}
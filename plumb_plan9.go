@@ -0,0 +1,11 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// openPlumb opens the plumber's send file.
+func openPlumb() (io.WriteCloser, error) {
+	return os.OpenFile("/mnt/plumb/send", os.O_WRONLY, 0)
+}
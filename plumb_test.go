@@ -0,0 +1,38 @@
+package main
+
+import (
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestPlumbMessage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godef-plumb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "x.go")
+	if err := ioutil.WriteFile(filename, []byte("package x\n\nvar héllo, x int\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		line, col int
+		attr      string
+	}{
+		{3, 1, "addr=3"},
+		{3, 5, "addr=3-#0+#4"},
+		// The byte column of x is 13; its rune column is 12.
+		{3, 13, "addr=3-#0+#11"},
+	} {
+		def := &definition{Pos: token.Position{Filename: filename, Line: test.line, Column: test.col}}
+		got := string(plumbMessage("/wd", def))
+		want := "godef\nedit\n/wd\ntext\n" + test.attr + "\n" + strconv.Itoa(len(filename)) + "\n" + filename
+		if got != want {
+			t.Errorf("plumbMessage at %d:%d = %q, want %q", test.line, test.col, got, want)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !plan9
+// +build !plan9
+
+package main
+
+import (
+	"io"
+
+	"9fans.net/go/plan9"
+	"9fans.net/go/plan9/client"
+)
+
+// openPlumb opens the plumber's send file through plan9port.
+func openPlumb() (io.WriteCloser, error) {
+	if err := setNameSpace(); err != nil {
+		return nil, err
+	}
+	fsys, err := client.MountService("plumb")
+	if err != nil {
+		return nil, err
+	}
+	return fsys.Open("send", plan9.OWRITE)
+}
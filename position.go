@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Offset encodings, as named by the -offset-encoding flag.
+const (
+	encodingBytes = "bytes"
+	encodingRunes = "runes"
+	encodingUTF16 = "utf16"
+)
+
+func checkEncoding(enc string) error {
+	switch enc {
+	case encodingBytes, encodingRunes, encodingUTF16:
+		return nil
+	}
+	return fmt.Errorf("unknown offset encoding %q (want bytes, runes or utf16)", enc)
+}
+
+// unitLen returns the length of b counted in units of enc.
+func unitLen(b []byte, enc string) int {
+	switch enc {
+	case encodingRunes:
+		return utf8.RuneCount(b)
+	case encodingUTF16:
+		return utf16Len(b)
+	}
+	return len(b)
+}
+
+// byteOffset returns the byte offset in content of the given
+// number of units of enc, counted from the start of content.
+func byteOffset(content []byte, units int, enc string) (int, error) {
+	if enc == encodingBytes {
+		if units > len(content) {
+			return 0, fmt.Errorf("offset %d is beyond end of file", units)
+		}
+		return units, nil
+	}
+	offset := 0
+	for n := 0; n < units; {
+		if offset >= len(content) {
+			return 0, fmt.Errorf("offset %d is beyond end of file", units)
+		}
+		_, size := utf8.DecodeRune(content[offset:])
+		n += unitLen(content[offset:offset+size], enc)
+		offset += size
+	}
+	return offset, nil
+}
+
+// encodeColumn returns pos with its column counted in units of enc
+// rather than bytes. If the file cannot be read, pos is returned
+// unchanged.
+func encodeColumn(pos token.Position, enc string) token.Position {
+	if enc == encodingBytes || pos.Column <= 1 {
+		return pos
+	}
+	content, err := ioutil.ReadFile(pos.Filename)
+	if err != nil {
+		return pos
+	}
+	line := lineAt(content, pos.Line)
+	if pos.Column-1 > len(line) {
+		return pos
+	}
+	pos.Column = unitLen(line[:pos.Column-1], enc) + 1
+	return pos
+}
+
+// lineColOffset returns the byte offset in content of the
+// one-based line and column, with the column counted in units
+// of enc.
+func lineColOffset(content []byte, line, col int, enc string) (int, error) {
+	if line < 1 || col < 1 {
+		return 0, fmt.Errorf("invalid position %d:%d", line, col)
+	}
+	offset := 0
+	for i := 1; i < line; i++ {
+		nl := bytes.IndexByte(content[offset:], '\n')
+		if nl < 0 {
+			return 0, fmt.Errorf("line %d is beyond end of file", line)
+		}
+		offset += nl + 1
+	}
+	end := len(content)
+	if nl := bytes.IndexByte(content[offset:], '\n'); nl >= 0 {
+		end = offset + nl
+	}
+	n, err := byteOffset(content[offset:end], col-1, enc)
+	if err != nil {
+		return 0, fmt.Errorf("column %d is beyond end of line %d", col, line)
+	}
+	return offset + n, nil
+}
+
+// offsetPosition returns the one-based line and byte column
+// of the byte offset off in content.
+func offsetPosition(content []byte, off int) (line, col int) {
+	if off > len(content) {
+		off = len(content)
+	}
+	line = bytes.Count(content[:off], []byte("\n")) + 1
+	return line, off - (bytes.LastIndexByte(content[:off], '\n') + 1) + 1
+}
+
+// fileAddress is a position given as a single command line argument,
+// in one of the forms file:line, file:line:col or file:#offset.
+type fileAddress struct {
+	filename  string
+	line, col int // if line is zero, offset applies
+	offset    int
+}
+
+// parseFileAddress parses arg as a file address, reporting
+// whether it is one.
+func parseFileAddress(arg string) (fileAddress, bool) {
+	i := strings.LastIndex(arg, ":")
+	if i < 0 {
+		return fileAddress{}, false
+	}
+	file, last := arg[:i], arg[i+1:]
+	if strings.HasPrefix(last, "#") {
+		off, err := strconv.Atoi(last[1:])
+		if err != nil || off < 0 || file == "" {
+			return fileAddress{}, false
+		}
+		return fileAddress{filename: file, offset: off}, true
+	}
+	n, err := strconv.Atoi(last)
+	if err != nil || n < 1 {
+		return fileAddress{}, false
+	}
+	// Either file:line or file:line:col.
+	if j := strings.LastIndex(file, ":"); j >= 0 {
+		if line, err := strconv.Atoi(file[j+1:]); err == nil && line >= 1 && j > 0 {
+			return fileAddress{filename: file[:j], line: line, col: n}, true
+		}
+	}
+	if file == "" {
+		return fileAddress{}, false
+	}
+	return fileAddress{filename: file, line: n, col: 1}, true
+}
+
+// samAddress returns the byte offset in content of the identifier
+// denoted by a sam-style address. The address is a sequence of
+// the following, each applying from the position left by the last:
+//
+//	n	the start of line n
+//	n.c, n:c	rune column c of line n
+//	#n	rune offset n
+//	/re/	the end of the next match of re, wrapping around
+//	?re?	the end of the previous match of re
+//
+// The end of a match is its last character, so that /func Foo/
+// denotes the identifier Foo.
+func samAddress(content []byte, addr string) (int, error) {
+	// The next forward search starts at from, which is just
+	// after offset if offset is the end of a match.
+	offset, from := 0, 0
+	for addr != "" {
+		switch c := addr[0]; {
+		case c >= '0' && c <= '9':
+			line, rest := leadingInt(addr)
+			col := 1
+			if len(rest) > 1 && (rest[0] == '.' || rest[0] == ':') && rest[1] >= '0' && rest[1] <= '9' {
+				col, rest = leadingInt(rest[1:])
+			}
+			n, err := lineColOffset(content, line, col, encodingRunes)
+			if err != nil {
+				return 0, err
+			}
+			offset, from, addr = n, n, rest
+		case c == '#':
+			n, rest := leadingInt(addr[1:])
+			if len(rest) == len(addr)-1 {
+				return 0, fmt.Errorf("bad address %q: missing offset after #", addr)
+			}
+			n, err := byteOffset(content, n, encodingRunes)
+			if err != nil {
+				return 0, err
+			}
+			offset, from, addr = n, n, rest
+		case c == '/' || c == '?':
+			pat := addr[1:]
+			addr = ""
+			if end := strings.IndexByte(pat, c); end >= 0 {
+				pat, addr = pat[:end], pat[end+1:]
+			}
+			re, err := regexp.Compile(pat)
+			if err != nil {
+				return 0, fmt.Errorf("bad address: %v", err)
+			}
+			if offset, err = search(content, re, from, offset, c == '?'); err != nil {
+				return 0, err
+			}
+			from = offset + 1
+		default:
+			return 0, fmt.Errorf("bad address %q", addr)
+		}
+	}
+	return offset, nil
+}
+
+// search returns the offset of the last character of the first
+// match of re starting at or after from, or if backward is set, of
+// the last match ending at or before before. Like sam, it wraps
+// around the ends of content if there is no such match.
+func search(content []byte, re *regexp.Regexp, from, before int, backward bool) (int, error) {
+	var first, last, m []int
+	for _, loc := range re.FindAllIndex(content, -1) {
+		if loc[1] <= loc[0] {
+			continue
+		}
+		if first == nil {
+			first = loc
+		}
+		last = loc
+		if backward && loc[1] <= before {
+			m = loc
+		}
+		if !backward && m == nil && loc[0] >= from {
+			m = loc
+		}
+	}
+	if m == nil {
+		m = first
+		if backward {
+			m = last
+		}
+	}
+	if m == nil {
+		return 0, fmt.Errorf("no match for %s", re)
+	}
+	// The match may end with a multibyte character.
+	_, size := utf8.DecodeLastRune(content[m[0]:m[1]])
+	return m[1] - size, nil
+}
+
+// leadingInt returns the decimal number at the start of s
+// and the remainder of s.
+func leadingInt(s string) (int, string) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	n, _ := strconv.Atoi(s[:i])
+	return n, s[i:]
+}
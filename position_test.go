@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestLineColOffset(t *testing.T) {
+	content := []byte("package p\r\n\r\nvar héllo = 1\n")
+	for _, test := range []struct {
+		line, col int
+		enc       string
+		offset    int
+		err       bool
+	}{
+		{1, 1, encodingBytes, 0, false},
+		{1, 9, encodingBytes, 8, false},
+		{3, 5, encodingBytes, 17, false},
+		{3, 12, encodingBytes, 24, false}, // the é is two bytes
+		{3, 11, encodingRunes, 24, false},
+		{3, 11, encodingUTF16, 24, false},
+		{3, 30, encodingBytes, 0, true},
+		{9, 1, encodingBytes, 0, true},
+		{0, 1, encodingBytes, 0, true},
+	} {
+		offset, err := lineColOffset(content, test.line, test.col, test.enc)
+		if test.err {
+			if err == nil {
+				t.Errorf("%d:%d: expected error", test.line, test.col)
+			}
+			continue
+		}
+		if err != nil || offset != test.offset {
+			t.Errorf("%d:%d: got %d, %v; want %d", test.line, test.col, offset, err, test.offset)
+		}
+	}
+}
+
+func TestByteOffset(t *testing.T) {
+	content := []byte("a😀b")
+	for _, test := range []struct {
+		units  int
+		enc    string
+		offset int
+	}{
+		{2, encodingBytes, 2},
+		{2, encodingRunes, 5},
+		{3, encodingUTF16, 5},
+		{3, encodingRunes, 6},
+	} {
+		offset, err := byteOffset(content, test.units, test.enc)
+		if err != nil || offset != test.offset {
+			t.Errorf("%d %s: got %d, %v; want %d", test.units, test.enc, offset, err, test.offset)
+		}
+	}
+	if _, err := byteOffset(content, 9, encodingRunes); err == nil {
+		t.Errorf("expected error for offset beyond end of file")
+	}
+}
+
+func TestParseFileAddress(t *testing.T) {
+	for _, test := range []struct {
+		arg  string
+		addr fileAddress
+		ok   bool
+	}{
+		{"a.go:12:5", fileAddress{filename: "a.go", line: 12, col: 5}, true},
+		{"a.go:12", fileAddress{filename: "a.go", line: 12, col: 1}, true},
+		{"a.go:#345", fileAddress{filename: "a.go", offset: 345}, true},
+		{filepath.FromSlash("C:/x/a.go:3:4"), fileAddress{filename: filepath.FromSlash("C:/x/a.go"), line: 3, col: 4}, true},
+		{"a.go", fileAddress{}, false},
+		{"a.go:x", fileAddress{}, false},
+		{"fmt.Println", fileAddress{}, false},
+		{":12", fileAddress{}, false},
+	} {
+		addr, ok := parseFileAddress(test.arg)
+		if ok != test.ok || addr != test.addr {
+			t.Errorf("%q: got %+v, %v; want %+v, %v", test.arg, addr, ok, test.addr, test.ok)
+		}
+	}
+}
+
+func TestSAMAddress(t *testing.T) {
+	content := []byte("package p\n\nfunc Foo() {}\n\nfunc Bar() { Foo() }\n")
+	for _, test := range []struct {
+		addr   string
+		offset int
+		err    bool
+	}{
+		{"3", 11, false},
+		{"3.6", 16, false},
+		{"3:6", 16, false},
+		{"#16", 16, false},
+		{"/func Foo/", 18, false},
+		{"/Foo/", 18, false},
+		{"4/Foo/", 41, false},
+		{"$", 0, true},
+		{"/Baz/", 0, true},
+		{"?Foo?", 41, false},
+		{"5?Foo?", 18, false},
+		{"9", 0, true},
+	} {
+		offset, err := samAddress(content, test.addr)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected error", test.addr)
+			}
+			continue
+		}
+		if err != nil || offset != test.offset {
+			t.Errorf("%q: got %d, %v; want %d", test.addr, offset, err, test.offset)
+		}
+	}
+}
+
+func TestSAMAddressMultibyte(t *testing.T) {
+	// The match ends in a two-byte character, whose
+	// first byte is the offset of the character.
+	content := []byte("package p\n\nvar hé = 1\n")
+	offset, err := samAddress(content, "/hé/")
+	if want := bytes.Index(content, []byte("é")); err != nil || offset != want {
+		t.Errorf("got %d, %v; want %d", offset, err, want)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestProtoFields checks that the messages in proto/godef.proto
+// mirror the JSON query and reply that the daemon exchanges.
+func TestProtoFields(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("proto", "godef.proto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := make(map[string][]string)
+	msgRE := regexp.MustCompile(`(?s)message (\w+) \{(.*?)\n\}`)
+	fieldRE := regexp.MustCompile(`(?m)^\s+(?:repeated \w+|map<[^>]+>|\w+) (\w+) = \d+;`)
+	for _, m := range msgRE.FindAllStringSubmatch(string(data), -1) {
+		for _, f := range fieldRE.FindAllStringSubmatch(m[2], -1) {
+			messages[m[1]] = append(messages[m[1]], f[1])
+		}
+	}
+	for _, test := range []struct {
+		message string
+		typ     reflect.Type
+	}{
+		{"Query", reflect.TypeOf(query{})},
+		{"Reply", reflect.TypeOf(definition{})},
+		{"Member", reflect.TypeOf(member{})},
+	} {
+		fields := messages[test.message]
+		if len(fields) == 0 {
+			t.Errorf("no message %s in godef.proto", test.message)
+		}
+		for _, name := range fields {
+			if name == "has_src" {
+				// Proto3 bytes cannot tell nil from empty.
+				continue
+			}
+			if _, ok := test.typ.FieldByName(camelCase(name)); !ok {
+				t.Errorf("field %s of message %s has no counterpart in %v", name, test.message, test.typ)
+			}
+		}
+	}
+}
+
+// camelCase returns the Go field name for the proto field name.
+func camelCase(name string) string {
+	parts := strings.Split(name, "_")
+	for i, p := range parts {
+		parts[i] = strings.Title(p)
+	}
+	return strings.Join(parts, "")
+}
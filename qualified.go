@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rogpeppe/godef/godef"
+	"golang.org/x/tools/go/packages"
+)
+
+// splitQualified splits a qualified symbol such as net/http.Client.Do
+// into its package path and the names within the package.
+func splitQualified(sym string) (pkgPath string, names []string, ok bool) {
+	slash := strings.LastIndex(sym, "/")
+	dot := strings.Index(sym[slash+1:], ".")
+	if dot < 0 {
+		return "", nil, false
+	}
+	dot += slash + 1
+	names = strings.Split(sym[dot+1:], ".")
+	if sym[:dot] == "" || len(names) > 2 {
+		return "", nil, false
+	}
+	for _, name := range names {
+		if !token.IsIdentifier(name) {
+			return "", nil, false
+		}
+	}
+	return sym[:dot], names, true
+}
+
+// answerSymbol returns the definition of the symbol sym, as named
+// for resolveSymbol, or of the package sym if it is an import path,
+// as given by packageDefinition. When no type information is needed,
+// symbols in the standard library are found from a summary of their
+// package rather than by loading it.
+func answerSymbol(ctx context.Context, sym string) (*definition, error) {
+	if isPackagePath(sym) && strings.Contains(sym, "/") {
+		return packageDefinition(ctx, sym)
+	}
+	if !*tflag {
+		if def := stdlibDefinition(ctx, sym); def != nil {
+			return def, nil
+		}
+	}
+	fset, obj, err := resolveSymbol(ctx, sym)
+	if err != nil {
+		if isPackagePath(sym) {
+			// A single name not declared in the current
+			// package may be a package, such as fmt.
+			if def, perr := packageDefinition(ctx, sym); perr == nil {
+				return def, nil
+			}
+		}
+		return nil, err
+	}
+	return describe(fset, obj, resolution{engine: godef.EnginePackages}, *tflag, *aflag || *Aflag, *Aflag), nil
+}
+
+// resolveSymbol returns the object named by sym, which is either
+// a name declared in the package in the current directory, such as
+// Name or Type.Member, or a qualified symbol as accepted by
+// resolveQualified.
+func resolveSymbol(ctx context.Context, sym string) (*token.FileSet, types.Object, error) {
+	names := strings.Split(sym, ".")
+	local := len(names) <= 2
+	for _, name := range names {
+		local = local && token.IsIdentifier(name)
+	}
+	if local {
+		// The package in the current directory is likely being
+		// edited, so load it from source, tolerating errors.
+		pkg, err := loadSymbolPackage(ctx, ".", packages.LoadSyntax)
+		if err == nil && pkg.Types.Scope().Lookup(names[0]) != nil {
+			obj, err := lookupNames(pkg, names)
+			return pkg.Fset, obj, err
+		}
+		if !strings.Contains(sym, ".") {
+			if err != nil {
+				return nil, nil, err
+			}
+			return nil, nil, &queryError{exitNotFound, fmt.Errorf("no %s in package %s", sym, pkg.PkgPath)}
+		}
+	}
+	return resolveQualified(ctx, sym)
+}
+
+// resolveQualified returns the object named by a qualified symbol,
+// loading its package as seen from the current module.
+func resolveQualified(ctx context.Context, sym string) (*token.FileSet, types.Object, error) {
+	pkgPath, names, ok := splitQualified(sym)
+	if !ok {
+		return nil, nil, fmt.Errorf("cannot parse %q as a qualified symbol (want pkg.Name or pkg.Type.Member)", sym)
+	}
+	// Only package-level declarations are needed, and they can come
+	// from export data; the package is loaded from source only if
+	// that fails.
+	pkg, err := loadSymbolPackage(ctx, pkgPath, packages.LoadTypes)
+	if err != nil && ctx.Err() == nil {
+		pkg, err = loadSymbolPackage(ctx, pkgPath, packages.LoadSyntax)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	obj, err := lookupNames(pkg, names)
+	return pkg.Fset, obj, err
+}
+
+// loadSymbolPackage loads the package matching pattern in the given
+// mode, which is either LoadTypes, to read it from export data,
+// LoadSyntax, to type check it from source, or LoadFiles, to find
+// its files alone.
+func loadSymbolPackage(ctx context.Context, pattern string, mode packages.LoadMode) (*packages.Package, error) {
+	if *noExecFlag {
+		return nil, &queryError{exitLoad, errNoExec}
+	}
+	cfg := &packages.Config{
+		Context: ctx,
+		Mode:    mode,
+	}
+	lpkgs, err := packages.Load(cfg, pattern)
+	if err != nil {
+		return nil, &queryError{exitLoad, err}
+	}
+	if len(lpkgs) != 1 || mode != packages.LoadFiles && lpkgs[0].Types == nil {
+		return nil, &queryError{exitLoad, fmt.Errorf("cannot load package %q", pattern)}
+	}
+	pkg := lpkgs[0]
+	if len(pkg.Errors) > 0 && (mode == packages.LoadTypes || len(pkg.Syntax) == 0) {
+		return nil, &queryError{exitLoad, pkg.Errors[0]}
+	}
+	return pkg, nil
+}
+
+// lookupNames returns the package-level object named by names[0]
+// in pkg or, if there is a second name, its field or method.
+func lookupNames(pkg *packages.Package, names []string) (types.Object, error) {
+	obj := pkg.Types.Scope().Lookup(names[0])
+	if obj == nil {
+		return nil, &queryError{exitNotFound, fmt.Errorf("no %s in package %s", names[0], pkg.PkgPath)}
+	}
+	if len(names) == 2 {
+		if _, ok := obj.(*types.TypeName); !ok {
+			return nil, fmt.Errorf("%s.%s is not a type", pkg.PkgPath, names[0])
+		}
+		member, _, _ := types.LookupFieldOrMethod(obj.Type(), true, pkg.Types, names[1])
+		if member == nil {
+			return nil, &queryError{exitNotFound, fmt.Errorf("no field or method %s in %s.%s", names[1], pkg.PkgPath, names[0])}
+		}
+		obj = member
+	}
+	return obj, nil
+}
+
+// isPackagePath reports whether sym has the form of an import path
+// rather than a symbol: its last element holds no dot.
+func isPackagePath(sym string) bool {
+	elem := sym[strings.LastIndex(sym, "/")+1:]
+	return elem != "" && !strings.Contains(elem, ".") && !strings.HasPrefix(sym, "/")
+}
+
+// packageDefinition returns the definition of the package with the
+// given import path, as found from the current module: its directory.
+// With -t, the package clause follows, and with -a its exported
+// declarations, each type followed by its methods, with their types
+// and positions, or with -A all of them. Only -a and -A need the
+// package's type information, which comes from export data if
+// possible.
+func packageDefinition(ctx context.Context, pkgPath string) (*definition, error) {
+	mode := packages.LoadFiles
+	if *aflag || *Aflag {
+		mode = packages.LoadTypes
+	}
+	pkg, err := loadSymbolPackage(ctx, pkgPath, mode)
+	if err != nil && mode == packages.LoadTypes && ctx.Err() == nil {
+		pkg, err = loadSymbolPackage(ctx, pkgPath, packages.LoadSyntax)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(pkg.GoFiles) == 0 {
+		return nil, &queryError{exitNotFound, fmt.Errorf("package %s has no Go files", pkgPath)}
+	}
+	def := &definition{
+		Pos:    token.Position{Filename: filepath.Dir(pkg.GoFiles[0])},
+		Engine: godef.EnginePackages,
+		Type:   fmt.Sprintf("package %s %q", pkg.Name, pkg.PkgPath),
+	}
+	if pkg.Types == nil {
+		return def, nil
+	}
+	add := func(prefix string, obj types.Object) {
+		if *Aflag || obj.Exported() {
+			def.Members = append(def.Members, member{
+				Type: prefix + godef.TypeString(obj, types.RelativeTo(pkg.Types)),
+				Pos:  godef.Position(pkg.Fset, obj),
+			})
+		}
+	}
+	scope := pkg.Types.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		add("", obj)
+		if _, ok := obj.(*types.TypeName); !ok || !*Aflag && !obj.Exported() {
+			continue
+		}
+		named, ok := obj.Type().(*types.Named)
+		if !ok {
+			continue
+		}
+		var methods []types.Object
+		for i := 0; i < named.NumMethods(); i++ {
+			methods = append(methods, named.Method(i))
+		}
+		sort.Slice(methods, func(i, j int) bool {
+			return methods[i].Name() < methods[j].Name()
+		})
+		for _, m := range methods {
+			add(name+".", m)
+		}
+	}
+	return def, nil
+}
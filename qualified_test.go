@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rogpeppe/godef/godef"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestSplitQualified(t *testing.T) {
+	for _, test := range []struct {
+		sym     string
+		pkgPath string
+		names   []string
+		ok      bool
+	}{
+		{"fmt.Println", "fmt", []string{"Println"}, true},
+		{"net/http.Client.Do", "net/http", []string{"Client", "Do"}, true},
+		{"example.com/m/pkg.T", "example.com/m/pkg", []string{"T"}, true},
+		{"fmt", "", nil, false},
+		{"net/http.", "", nil, false},
+		{"a.b.c.d", "", nil, false},
+		{".Foo", "", nil, false},
+	} {
+		pkgPath, names, ok := splitQualified(test.sym)
+		if ok != test.ok || pkgPath != test.pkgPath || !reflect.DeepEqual(names, test.names) {
+			t.Errorf("%q: got %q, %q, %v; want %q, %q, %v", test.sym, pkgPath, names, ok, test.pkgPath, test.names, test.ok)
+		}
+	}
+}
+
+func TestIsPackagePath(t *testing.T) {
+	for sym, want := range map[string]bool{
+		"fmt":                   true,
+		"net/http":              true,
+		"example.com/m/pkg":     true,
+		"net/http.Client":       false,
+		"example.com/m/pkg.T.M": false,
+		"Println":               true,
+		"fmt.Println":           false,
+		"net/":                  false,
+		"/abs/dir":              false,
+	} {
+		if got := isPackagePath(sym); got != want {
+			t.Errorf("isPackagePath(%q) = %v want %v", sym, got, want)
+		}
+	}
+}
+
+// qualifiedTree is a module for queries of symbols by name.
+var qualifiedTree = map[string]string{
+	"go.mod":     "module example.com/m\n",
+	"x.go":       "package x\n\ntype T int\n\nfunc (T) M() {}\n\nfunc F() {}\n",
+	"sub/sub.go": "package sub\n\n// G is in another package.\nfunc G() {}\n",
+}
+
+func TestResolveSymbolCurrentDir(t *testing.T) {
+	dir := writeTree(t, qualifiedTree)
+	for _, test := range []struct {
+		sym  string
+		want string
+		code int
+	}{
+		{"F", "x.go:7:6", 0},
+		{"T", "x.go:3:6", 0},
+		{"T.M", "x.go:5:10", 0},
+		{"Missing", "", exitNotFound},
+	} {
+		stdout, stderr, code := runGodef(t, dir, "", nil, test.sym)
+		if code != test.code {
+			t.Errorf("%s: got exit status %d, want %d; stderr: %s", test.sym, code, test.code, stderr)
+			continue
+		}
+		if want := filepath.Join(dir, test.want); test.code == 0 && stdout != want+"\n" {
+			t.Errorf("%s: got %q, want %q", test.sym, stdout, want)
+		}
+	}
+}
+
+func TestResolveQualifiedExportData(t *testing.T) {
+	dir := writeTree(t, qualifiedTree)
+	stdout, stderr, code := runGodef(t, dir, "", nil, "example.com/m/sub.G")
+	if code != 0 {
+		t.Fatalf("exit status %d: %s", code, stderr)
+	}
+	if want := filepath.Join(dir, "sub", "sub.go") + ":4:6\n"; stdout != want {
+		t.Errorf("got %q, want %q", stdout, want)
+	}
+	// The package comes from export data, without its syntax,
+	// yet the position of G is exact.
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	pkg, err := loadSymbolPackage(context.Background(), "example.com/m/sub", packages.LoadTypes)
+	if err != nil {
+		// As when godef runs, the package is loaded from source
+		// when its export data cannot be read.
+		t.Skipf("cannot load from export data: %v", err)
+	}
+	if len(pkg.Syntax) != 0 {
+		t.Errorf("package loaded with %d files of syntax", len(pkg.Syntax))
+	}
+	obj := pkg.Types.Scope().Lookup("G")
+	if obj == nil {
+		t.Fatalf("no G in %s", pkg.PkgPath)
+	}
+	if pos := godef.Position(pkg.Fset, obj); pos.String() != filepath.Join(dir, "sub", "sub.go")+":4:6" {
+		t.Errorf("got position %v, want sub.go:4:6", pos)
+	}
+}
+
+func TestPackageArgument(t *testing.T) {
+	tree := map[string]string{"sub/unexported.go": "package sub\n\nfunc g() {}\n"}
+	for name, src := range qualifiedTree {
+		tree[name] = src
+	}
+	dir := writeTree(t, tree)
+	sub := filepath.Join(dir, "sub")
+	header := sub + "\npackage sub \"example.com/m/sub\"\n"
+	exported := "\tG func()\n\t\t" + filepath.Join(sub, "sub.go") + ":4:6\n"
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"example.com/m/sub"}, sub + "\n"},
+		{[]string{"-t", "example.com/m/sub"}, header},
+		{[]string{"-a", "example.com/m/sub"}, header + exported},
+		{[]string{"-A", "example.com/m/sub"}, header + exported + "\tg func()\n\t\t" + filepath.Join(sub, "unexported.go") + ":3:6\n"},
+	} {
+		stdout, stderr, code := runGodef(t, dir, "", nil, test.args...)
+		if code != 0 {
+			t.Errorf("%q: exit status %d: %s", test.args, code, stderr)
+			continue
+		}
+		if stdout != test.want {
+			t.Errorf("%q: got %q, want %q", test.args, stdout, test.want)
+		}
+	}
+}
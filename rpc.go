@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+)
+
+// rpcParams holds the parameters common to all -rpc methods.
+type rpcParams struct {
+	Filename string            `json:"filename"`
+	Offset   int               `json:"offset"`
+	Src      *string           `json:"src,omitempty"`
+	Overlay  map[string]string `json:"overlay,omitempty"`
+	All      bool              `json:"all,omitempty"`
+}
+
+// jsonPos is the JSON form of a position in -json and -rpc output.
+type jsonPos struct {
+	Filename string `json:"filename,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+}
+
+func newJSONPos(pos token.Position) jsonPos {
+	return jsonPos{
+		Filename: pos.Filename,
+		Line:     pos.Line,
+		Column:   pos.Column,
+	}
+}
+
+// newHostPos returns the JSON form of pos, with its file name
+// as the -path-map and -rel flags require.
+func newHostPos(pos token.Position) jsonPos {
+	pos.Filename = outputName(pos.Filename)
+	return newJSONPos(pos)
+}
+
+type rpcDefinition struct {
+	jsonPos
+	Type     string      `json:"type,omitempty"`
+	Members  []rpcMember `json:"members,omitempty"`
+	Engine   string      `json:"engine,omitempty"`
+	Fallback string      `json:"fallback,omitempty"`
+
+	Candidates []candidateJSON `json:"candidates,omitempty"`
+}
+
+type rpcMember struct {
+	jsonPos
+	Type string `json:"type"`
+}
+
+// serveRPC reads JSON-RPC requests, one JSON value at a time, from r and
+// writes a response for each to w, until r is exhausted. The methods
+// are "definition", "type" and "members"; all take the same parameters.
+// Loaded packages are cached between requests.
+func serveRPC(ctx context.Context, r io.Reader, w io.Writer) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	cache := newPackageCache()
+	dec := json.NewDecoder(r)
+	enc := json.NewEncoder(w)
+	for {
+		var req rpcRequest
+		if err := dec.Decode(&req); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			// The stream cannot be resynchronized after a syntax error.
+			enc.Encode(rpcFailure{"2.0", nil, &rpcError{codeParseError, err.Error()}})
+			return err
+		}
+		result, err := rpcCall(ctx, cache, dir, req.Method, req.Params)
+		if req.ID == nil {
+			continue
+		}
+		var resp interface{} = rpcResult{"2.0", req.ID, result}
+		if err != nil {
+			rerr, ok := err.(*rpcError)
+			if !ok {
+				rerr = &rpcError{codeInternalError, err.Error()}
+			}
+			resp = rpcFailure{"2.0", req.ID, rerr}
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func rpcCall(ctx context.Context, cache *packageCache, dir, method string, params json.RawMessage) (interface{}, error) {
+	var p rpcParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpcError{codeInvalidParams, err.Error()}
+	}
+	return rpcAnswer(ctx, cache, dir, method, &p)
+}
+
+// rpcAnswer answers a single call of the named method.
+func rpcAnswer(ctx context.Context, cache *packageCache, dir, method string, p *rpcParams) (*rpcDefinition, error) {
+	if p.Filename == "" {
+		return nil, &rpcError{codeInvalidParams, "no filename specified"}
+	}
+	q := p.query(dir)
+	switch method {
+	case "definition":
+	case "type":
+		q.Type = true
+	case "members":
+		q.Type, q.Members, q.AllMembers = true, true, p.All
+	default:
+		return nil, &rpcError{codeMethodNotFound, fmt.Sprintf("method %q not supported", method)}
+	}
+	def, err := cache.answer(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	result := &rpcDefinition{
+		jsonPos:  newHostPos(def.Pos),
+		Type:     def.Type,
+		Engine:   def.Engine,
+		Fallback: def.Fallback,
+	}
+	for _, m := range def.Members {
+		result.Members = append(result.Members, rpcMember{newHostPos(m.Pos), m.Type})
+	}
+	for _, c := range def.Candidates {
+		result.Candidates = append(result.Candidates, candidateJSON{newHostPos(c.Pos), c.Rank, c.Reason, c.Constraint})
+	}
+	return result, nil
+}
+
+// query returns the query described by p, with file names
+// made relative to dir.
+func (p *rpcParams) query(dir string) *query {
+	q := &query{
+		Dir:               dir,
+		Filename:          abs(dir, pathMapFlag.toLocal(p.Filename)),
+		Offset:            p.Offset,
+		Strict:            *strictFlag,
+		Guess:             *guessFlag,
+		Candidates:        *candidatesFlag,
+		PreferHandwritten: *preferHandwrittenFlag,
+		Variants:          *variantsFlag,
+		Exclude:           excludePatterns(),
+	}
+	if p.Src != nil {
+		q.Src = []byte(*p.Src)
+	}
+	if len(p.Overlay) > 0 {
+		q.Overlay = make(map[string][]byte)
+		for name, data := range p.Overlay {
+			q.Overlay[abs(dir, pathMapFlag.toLocal(name))] = []byte(data)
+		}
+	}
+	return q
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServeRPC(t *testing.T) {
+	src := "package x\n\ntype T struct{ A int }\n\nfunc F() T { return T{} }\n\nvar v = F()\n"
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module x\n",
+		"x.go":   src,
+	})
+	filename := filepath.Join(dir, "x.go")
+	var in bytes.Buffer
+	enc := json.NewEncoder(&in)
+	for i, call := range []struct {
+		method, filename, at string
+	}{
+		{"definition", filename, "F()"},
+		{"type", filename, "F()"},
+		{"members", filename, "v ="},
+		{"references", filename, "F()"},
+		{"definition", "", "F()"},
+	} {
+		enc.Encode(map[string]interface{}{
+			"id":     i,
+			"method": call.method,
+			"params": rpcParams{Filename: call.filename, Offset: strings.LastIndex(src, call.at)},
+		})
+	}
+	// A notification has no response.
+	enc.Encode(map[string]interface{}{"method": "definition", "params": rpcParams{Filename: filename}})
+	var out bytes.Buffer
+	if err := serveRPC(context.Background(), &in, &out); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var resp struct {
+			ID     int
+			Result *rpcDefinition
+			Error  *rpcError
+		}
+		if err := dec.Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		s := fmt.Sprint(resp.ID)
+		if resp.Error != nil {
+			s += fmt.Sprintf(" error %d", resp.Error.Code)
+		} else {
+			s += fmt.Sprintf(" %s:%d %s", filepath.Base(resp.Result.Filename), resp.Result.Line, resp.Result.Type)
+			for _, m := range resp.Result.Members {
+				s += fmt.Sprintf(" %s", m.Type)
+			}
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		"0 x.go:5 ",
+		"1 x.go:5 F func() T",
+		"2 x.go:7 v T A int",
+		fmt.Sprintf("3 error %d", codeMethodNotFound),
+		fmt.Sprintf("4 error %d", codeInvalidParams),
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got responses\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
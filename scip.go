@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func scipMain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("scip", flag.ExitOnError)
+	out := fs.String("o", "index.scip", "write the index to this file")
+	tests := fs.Bool("tests", false, "include test files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: godef scip [-o file] [-tests] [packages]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	idx, err := collectRefs(ctx, dir, patterns, *tests)
+	if err != nil {
+		return err
+	}
+	root := moduleRoot(dir)
+	if root == "" {
+		root = dir
+	}
+	return ioutil.WriteFile(*out, encodeSCIP(idx, root), 0666)
+}
+
+// SCIP protocol constants, from scip.proto.
+const (
+	scipUTF16Encoding  = 2 // TextEncoding.UTF16
+	scipUTF16Positions = 2 // PositionEncoding.UTF16CodeUnitOffsetFromLineStart
+	scipDefinitionRole = 1 // SymbolRole.Definition
+)
+
+// encodeSCIP returns idx encoded as a SCIP Index protocol buffer
+// for the project at root.
+func encodeSCIP(idx *refIndex, root string) []byte {
+	names := scipSymbolNames(idx)
+
+	var toolInfo protoBuf
+	toolInfo.str(1, "godef")
+	var metadata protoBuf
+	metadata.msg(2, toolInfo)
+	metadata.str(3, filenameToURI(root))
+	metadata.int(4, scipUTF16Encoding)
+
+	var index protoBuf
+	index.msg(1, metadata)
+	defined := make(map[*refSymbol]bool)
+	for _, f := range idx.Files {
+		var doc protoBuf
+		doc.str(1, relPath(root, f.Filename))
+		for _, occ := range f.Occs {
+			var o protoBuf
+			r := []int{occ.Start.Line, occ.Start.Character, occ.End.Character}
+			if occ.End.Line != occ.Start.Line {
+				r = []int{occ.Start.Line, occ.Start.Character, occ.End.Line, occ.End.Character}
+			}
+			o.packed(1, r)
+			o.str(2, names[occ.Symbol])
+			if occ.Def {
+				o.int(3, scipDefinitionRole)
+			}
+			doc.msg(2, o)
+		}
+		for _, occ := range f.Occs {
+			if occ.Def && !defined[occ.Symbol] {
+				defined[occ.Symbol] = true
+				doc.msg(3, scipSymbolInfo(occ.Symbol, names[occ.Symbol]))
+			}
+		}
+		doc.str(4, "go")
+		doc.int(6, scipUTF16Positions)
+		index.msg(2, doc)
+	}
+	for _, sym := range idx.Symbols {
+		if !defined[sym] && !sym.local {
+			index.msg(3, scipSymbolInfo(sym, names[sym]))
+		}
+	}
+	return index
+}
+
+func scipSymbolInfo(sym *refSymbol, name string) protoBuf {
+	var info protoBuf
+	info.str(1, name)
+	info.str(3, "```go\n"+sym.Hover+"\n```")
+	info.str(6, sym.Name)
+	return info
+}
+
+// scipSymbolNames returns the SCIP symbol name of each symbol.
+// Global symbols are named by package path and descriptors,
+// as in "godef . . . `net/http`/Client#Do().".
+func scipSymbolNames(idx *refIndex) map[*refSymbol]string {
+	names := make(map[*refSymbol]string)
+	locals := 0
+	for _, sym := range idx.Symbols {
+		if sym.local || sym.Kind == "label" {
+			names[sym] = fmt.Sprintf("local %d", locals)
+			locals++
+			continue
+		}
+		var d string
+		switch sym.Kind {
+		case "type":
+			d = scipEscape(sym.Name) + "#"
+		case "func":
+			d = scipEscape(sym.Name) + "()."
+		case "method":
+			if sym.Recv != "" {
+				d = scipEscape(sym.Recv) + "#"
+			}
+			d += scipEscape(sym.Name) + "()."
+		default:
+			d = scipEscape(sym.Name) + "."
+		}
+		names[sym] = "godef . . . `" + strings.Replace(sym.Pkg, "`", "``", -1) + "`/" + d
+	}
+	return names
+}
+
+// scipEscape returns name as a SCIP descriptor name, quoting
+// it with backticks if it is not a simple identifier.
+func scipEscape(name string) string {
+	for _, r := range name {
+		if !(r == '_' || r == '+' || r == '-' || r == '$' ||
+			'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			return "`" + strings.Replace(name, "`", "``", -1) + "`"
+		}
+	}
+	return name
+}
+
+// relPath returns filename relative to root, using forward
+// slashes, if it lies within root.
+func relPath(root, filename string) string {
+	rel, err := filepath.Rel(root, filename)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(filename)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// protoBuf accumulates a message in protocol buffer wire format.
+// Zero-valued fields are omitted, as in proto3.
+type protoBuf []byte
+
+func (b *protoBuf) varint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+	*b = append(*b, byte(v))
+}
+
+func (b *protoBuf) tag(field, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b *protoBuf) int(field, v int) {
+	if v != 0 {
+		b.tag(field, 0)
+		b.varint(uint64(v))
+	}
+}
+
+func (b *protoBuf) str(field int, s string) {
+	if s != "" {
+		b.tag(field, 2)
+		b.varint(uint64(len(s)))
+		*b = append(*b, s...)
+	}
+}
+
+func (b *protoBuf) msg(field int, m protoBuf) {
+	b.tag(field, 2)
+	b.varint(uint64(len(m)))
+	*b = append(*b, m...)
+}
+
+func (b *protoBuf) packed(field int, vs []int) {
+	var p protoBuf
+	for _, v := range vs {
+		p.varint(uint64(v))
+	}
+	b.msg(field, p)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestProtoBuf(t *testing.T) {
+	var m protoBuf
+	m.int(1, 300)
+	m.str(2, "hi")
+	m.str(3, "") // omitted
+	m.packed(4, []int{1, 2})
+	want := []byte{0x08, 0xac, 0x02, 0x12, 2, 'h', 'i', 0x22, 2, 1, 2}
+	if !bytes.Equal(m, want) {
+		t.Errorf("got % x want % x", []byte(m), want)
+	}
+}
+
+func TestSCIPEscape(t *testing.T) {
+	for name, want := range map[string]string{
+		"Foo":   "Foo",
+		"a_b$1": "a_b$1",
+		"héllo": "`héllo`",
+		"a`b":   "`a``b`",
+	} {
+		if got := scipEscape(name); got != want {
+			t.Errorf("scipEscape(%q) = %q want %q", name, got, want)
+		}
+	}
+}
+
+func TestEncodeSCIP(t *testing.T) {
+	idx, dir := loadRefs(t)
+	names := scipSymbolNames(idx)
+	var got []string
+	for _, name := range names {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+	want := []string{
+		"godef . . . `example.com/x`/A.",
+		"godef . . . `example.com/x`/F().",
+		"godef . . . `example.com/x`/T#",
+		"godef . . . `example.com/x`/T#M().",
+		"local 0",
+		"local 1",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got symbols\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	index := encodeSCIP(idx, dir)
+	var doc protoBuf
+	doc.str(1, "x.go")
+	if !bytes.Contains(index, doc) {
+		t.Errorf("index has no document for x.go relative to %s", dir)
+	}
+	for _, name := range want {
+		if !bytes.Contains(index, []byte(name)) {
+			t.Errorf("index has no symbol %q", name)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func serveMain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	lspFlag := fs.Bool("lsp", false, "speak the language server protocol on stdin and stdout")
+	httpFlag := fs.String("http", "", "serve JSON over HTTP on this address")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: godef serve -lsp\n")
+		fmt.Fprintf(os.Stderr, "       godef serve -http=[host]:port\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	switch {
+	case *lspFlag:
+		return serveLSP(ctx, os.Stdin, os.Stdout)
+	case *httpFlag != "":
+		return serveHTTP(ctx, *httpFlag)
+	}
+	fs.Usage()
+	os.Exit(2)
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/rogpeppe/godef/godef"
+)
+
+var statsFlag = flag.Bool("stats", false, "print a JSON summary of the work done by the query to stderr")
+
+// queryStats summarizes the work done by a single query, as
+// printed by -stats, so that changes in latency can be tracked.
+type queryStats struct {
+	mu       sync.Mutex
+	start    time.Time
+	fallback time.Time // when syntax-only resolution started
+
+	Packages  int   `json:"packages"`  // packages loaded, including dependencies
+	Files     int   `json:"files"`     // files parsed
+	Bytes     int64 `json:"bytes"`     // bytes of source parsed
+	CacheHits int   `json:"cacheHits"` // results taken from the -cache
+
+	// Phases holds the time spent in each phase of the query,
+	// in milliseconds. The parse phase is the total time spent
+	// parsing files, which may exceed the time spent loading,
+	// as files are parsed concurrently.
+	Phases map[string]float64 `json:"phasesMs"`
+}
+
+func newQueryStats() *queryStats {
+	return &queryStats{
+		start:  time.Now(),
+		Phases: make(map[string]float64),
+	}
+}
+
+// event logs e and records the work that it reports.
+func (s *queryStats) event(e godef.Event) {
+	logEvent(e)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch e.Kind {
+	case godef.EventParsed:
+		s.Files++
+		s.Bytes += int64(e.Count)
+		s.addPhase("parse", e.Duration)
+	case godef.EventLoaded:
+		s.Packages += e.Count
+		s.addPhase("load", e.Duration)
+	case godef.EventResolved:
+		s.addPhase("resolve", e.Duration)
+	case godef.EventFallback:
+		s.fallback = time.Now()
+	}
+}
+
+// endFallback records the time spent in syntax-only
+// resolution, if any, once the query has finished.
+func (s *queryStats) endFallback() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.fallback.IsZero() {
+		s.addPhase("fallback", time.Since(s.fallback))
+	}
+}
+
+// phase records that the named phase took d.
+func (s *queryStats) phase(name string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addPhase(name, d)
+}
+
+func (s *queryStats) addPhase(name string, d time.Duration) {
+	s.Phases[name] += float64(d) / float64(time.Millisecond)
+}
+
+// write writes the statistics to w as a line of JSON, with the
+// total time taken since the query started, and times rounded
+// to the microsecond.
+func (s *queryStats) write(w io.Writer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addPhase("total", time.Since(s.start))
+	for name, ms := range s.Phases {
+		s.Phases[name] = math.Round(ms*1000) / 1000
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
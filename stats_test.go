@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rogpeppe/godef/godef"
+)
+
+func TestQueryStats(t *testing.T) {
+	s := newQueryStats()
+	for _, e := range []godef.Event{
+		{Kind: godef.EventLoad},
+		{Kind: godef.EventParsed, Count: 100, Duration: time.Millisecond},
+		{Kind: godef.EventParsed, Count: 20, Duration: 2 * time.Millisecond},
+		{Kind: godef.EventLoaded, Count: 3, Duration: 5 * time.Millisecond},
+		{Kind: godef.EventResolved, Duration: time.Microsecond},
+	} {
+		s.event(e)
+	}
+	var buf bytes.Buffer
+	if err := s.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var got queryStats
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Packages != 3 || got.Files != 2 || got.Bytes != 120 {
+		t.Errorf("got %d packages, %d files, %d bytes; want 3, 2, 120", got.Packages, got.Files, got.Bytes)
+	}
+	for phase, want := range map[string]float64{"parse": 3, "load": 5, "resolve": 0.001} {
+		if got.Phases[phase] != want {
+			t.Errorf("got %vms for %s, want %vms", got.Phases[phase], phase, want)
+		}
+	}
+	if _, ok := got.Phases["total"]; !ok {
+		t.Errorf("no total time in %s", buf.Bytes())
+	}
+}
+
+func TestStatsFlag(t *testing.T) {
+	src := "package x\n\nfunc F() {}\n\nvar v = F\n"
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module x\n",
+		"x.go":   src,
+	})
+	stdout, stderr, code := runGodef(t, dir, "", nil, "-stats", "-f", "x.go", "-o", fmt.Sprint(strings.LastIndex(src, "F")))
+	if code != 0 {
+		t.Fatalf("exit status %d: %s", code, stderr)
+	}
+	// The statistics do not get in the way of the result.
+	if want := filepath.Join(dir, "x.go") + ":3:6\n"; stdout != want {
+		t.Errorf("got %q, want %q", stdout, want)
+	}
+	var stats queryStats
+	if err := json.Unmarshal([]byte(stderr), &stats); err != nil {
+		t.Fatalf("cannot decode statistics %q: %v", stderr, err)
+	}
+	if stats.Packages < 1 || stats.Files < 1 || stats.Bytes < int64(len(src)) {
+		t.Errorf("got %d packages, %d files, %d bytes", stats.Packages, stats.Files, stats.Bytes)
+	}
+	for _, phase := range []string{"read", "load", "parse", "resolve", "print", "total"} {
+		if _, ok := stats.Phases[phase]; !ok {
+			t.Errorf("no %s phase in %s", phase, stderr)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// engineSummary names the engine that answers queries from
+// a summary of a standard library package.
+const engineSummary = "summary"
+
+// stdlibSummary records the declarations in a standard library
+// package, so that symbols in it can be found without loading it.
+// Summaries are kept in the user's cache directory, keyed by the
+// Go version, GOROOT and environment, and are rebuilt if any of
+// their files change.
+type stdlibSummary struct {
+	Files map[string]*indexedFile // keyed by absolute file name
+}
+
+// stdlibDefinition returns the definition of sym, a qualified symbol
+// such as fmt.Println or net/http.Client.Do, from the summary of its
+// package, or nil if sym does not name a declaration in a standard
+// library package that the summary holds. As for resolveSymbol, a
+// declaration in the package in the current directory takes
+// precedence.
+func stdlibDefinition(ctx context.Context, sym string) *definition {
+	pkgPath, names, ok := splitQualified(sym)
+	if !ok || !isStdlib(pkgPath) {
+		return nil
+	}
+	if !strings.Contains(pkgPath, "/") && declaresLocally(names[0]) {
+		return nil
+	}
+	s, err := readStdlibSummary(ctx, pkgPath)
+	if err != nil {
+		logf(levelDebug, "no summary of %s: %v", pkgPath, err)
+		return nil
+	}
+	recv, name := "", names[0]
+	if len(names) == 2 {
+		recv, name = names[0], names[1]
+	}
+	for filename, f := range s.Files {
+		for _, d := range f.Decls {
+			if d.Name == name && d.Recv == recv {
+				return &definition{
+					Pos: token.Position{
+						Filename: filename,
+						Line:     d.Line,
+						Column:   d.Column,
+					},
+					Engine: engineSummary,
+				}
+			}
+		}
+	}
+	// Promoted fields and methods are not recorded,
+	// so leave them to a full load.
+	return nil
+}
+
+// isStdlib reports whether pkgPath looks like the path of a standard
+// library package, whose first element has no dot.
+func isStdlib(pkgPath string) bool {
+	first := strings.SplitN(pkgPath, "/", 2)[0]
+	return first != "" && !strings.Contains(first, ".")
+}
+
+// declaresLocally reports whether any Go file in the current
+// directory that matches the build constraints declares name
+// at package level.
+func declaresLocally(name string) bool {
+	files, _ := filepath.Glob("*.go")
+	for _, filename := range files {
+		if !matchFile(filename) {
+			continue
+		}
+		f, _ := parser.ParseFile(token.NewFileSet(), filename, nil, 0)
+		if f != nil && f.Scope.Lookup(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// readStdlibSummary returns the summary of the standard library
+// package pkgPath, building and storing it if it is missing or
+// out of date.
+func readStdlibSummary(ctx context.Context, pkgPath string) (*stdlibSummary, error) {
+	goroot, filename, err := stdlibSummaryFile(ctx, pkgPath)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := ioutil.ReadFile(filename); err == nil {
+		var s stdlibSummary
+		if err := json.Unmarshal(data, &s); err == nil && s.valid() {
+			return &s, nil
+		}
+	}
+	s, err := buildStdlibSummary(ctx, goroot, pkgPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(filename, s); err != nil {
+		// The summary is only an optimization.
+		logf(levelDebug, "cannot write summary of %s: %v", pkgPath, err)
+	}
+	return s, nil
+}
+
+// stdlibSummaryFile returns GOROOT and the name of the file
+// holding the summary of pkgPath.
+func stdlibSummaryFile(ctx context.Context, pkgPath string) (goroot, filename string, err error) {
+	env, err := goEnv(ctx, ".")
+	if err != nil {
+		return "", "", err
+	}
+	goroot = env["GOROOT"]
+	if goroot == "" {
+		return "", "", fmt.Errorf("no GOROOT")
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", goroot, env["GOVERSION"])
+	for _, v := range goEnvVars(ctx, ".") {
+		fmt.Fprintf(h, "%q\n", v)
+	}
+	fmt.Fprintf(h, "%s\n", pkgPath)
+	return goroot, filepath.Join(dir, "godef", "stdlib", fmt.Sprintf("%x.json", h.Sum(nil)[:16])), nil
+}
+
+// buildStdlibSummary lists the files of pkgPath, without parsing
+// or type checking its dependencies, and records their declarations.
+func buildStdlibSummary(ctx context.Context, goroot, pkgPath string) (*stdlibSummary, error) {
+	if *noExecFlag {
+		return nil, errNoExec
+	}
+	cfg := &packages.Config{
+		Context: ctx,
+		Mode:    packages.LoadFiles,
+	}
+	lpkgs, err := packages.Load(cfg, pkgPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(lpkgs) != 1 || len(lpkgs[0].GoFiles) == 0 {
+		return nil, fmt.Errorf("cannot load package %q", pkgPath)
+	}
+	s := &stdlibSummary{Files: make(map[string]*indexedFile)}
+	for _, name := range lpkgs[0].GoFiles {
+		if !strings.HasPrefix(name, filepath.Join(goroot, "src")+string(filepath.Separator)) {
+			return nil, fmt.Errorf("%s is not in GOROOT", pkgPath)
+		}
+		f, err := indexSourceFile(name, pkgPath)
+		if err != nil {
+			return nil, err
+		}
+		s.Files[name] = f
+	}
+	return s, nil
+}
+
+// valid reports whether none of the files of the summary
+// has changed since it was built.
+func (s *stdlibSummary) valid() bool {
+	if len(s.Files) == 0 {
+		return false
+	}
+	for name, f := range s.Files {
+		if stamp, ok := statFile(name); !ok || !stamp.same(f.Stamp) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeFileAtomic writes v as JSON to filename, replacing it
+// atomically so that concurrent invocations never see a
+// partially written file.
+func writeFileAtomic(filename string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(filename), "tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsStdlib(t *testing.T) {
+	for _, test := range []struct {
+		path string
+		want bool
+	}{
+		{"fmt", true},
+		{"net/http", true},
+		{"golang.org/x/tools/go/packages", false},
+		{"github.com/rogpeppe/godef", false},
+		{"", false},
+	} {
+		if got := isStdlib(test.path); got != test.want {
+			t.Errorf("isStdlib(%q) = %v, want %v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestStdlibDefinition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godef-stdlib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("XDG_CACHE_HOME", os.Getenv("XDG_CACHE_HOME"))
+	os.Setenv("XDG_CACHE_HOME", dir)
+	// The first lookup builds the summary, and the second reads it.
+	for i := 0; i < 2; i++ {
+		def := stdlibDefinition(context.Background(), "strings.Builder.Len")
+		if def == nil {
+			t.Fatalf("no definition of strings.Builder.Len")
+		}
+		if filepath.Base(def.Pos.Filename) != "builder.go" || def.Engine != engineSummary {
+			t.Errorf("got %s from %s engine, want builder.go from summary", def.Pos, def.Engine)
+		}
+	}
+	if def := stdlibDefinition(context.Background(), "strings.NoSuchThing"); def != nil {
+		t.Errorf("got definition %v of strings.NoSuchThing", def.Pos)
+	}
+	if def := stdlibDefinition(context.Background(), "golang.org/x/tools/go/packages.Load"); def != nil {
+		t.Errorf("got definition %v of a package outside the standard library", def.Pos)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// tag is a single entry in a tags file.
+type tag struct {
+	name     string
+	filename string // relative to the tags file
+	line     int
+	column   int
+	kind     string // universal-ctags Go kind name
+	scope    string // kind:name of the enclosing type, if any
+}
+
+func tagsMain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("tags", flag.ExitOnError)
+	out := fs.String("o", "", "write the tags to this file (default tags, or TAGS with -e)")
+	emacs := fs.Bool("e", false, "write an Emacs TAGS file")
+	addExcludeFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: godef tags [-e] [-o file] [-exclude glob] [packages]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *out == "" {
+		*out = "tags"
+		if *emacs {
+			*out = "TAGS"
+		}
+	}
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	idx, err := buildIndex(ctx, dir, patterns, *jobsFlag, excludePatterns())
+	if err != nil {
+		return err
+	}
+	tagsDir, err := filepath.Abs(filepath.Dir(*out))
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if *emacs {
+		err = writeEtags(w, idx.tags(tagsDir), tagsDir)
+	} else {
+		writeCtags(w, idx.tags(tagsDir))
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// tags returns the tags for all the declarations in the index,
+// with file names relative to dir.
+func (idx *symbolIndex) tags(dir string) []tag {
+	var tags []tag
+	for filename, f := range idx.Files {
+		rel := relPath(dir, filename)
+		for _, d := range f.Decls {
+			t := tag{
+				name:     d.Name,
+				filename: rel,
+				line:     d.Line,
+				column:   d.Column,
+			}
+			switch d.Kind {
+			case "func":
+				t.kind = "func"
+			case "method":
+				if d.Detail == "interface" {
+					t.kind = "methodSpec"
+					t.scope = "interface:" + d.Recv
+				} else {
+					t.kind = "func"
+					t.scope = "struct:" + d.Recv
+				}
+			case "type":
+				switch d.Detail {
+				case "struct", "interface":
+					t.kind = d.Detail
+				default:
+					t.kind = "type"
+				}
+			case "field":
+				t.kind = "member"
+				t.scope = "struct:" + d.Recv
+			case "var", "const":
+				t.kind = d.Kind
+			default:
+				t.kind = "unknown"
+			}
+			tags = append(tags, t)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		ti, tj := tags[i], tags[j]
+		if ti.name != tj.name {
+			return ti.name < tj.name
+		}
+		if ti.filename != tj.filename {
+			return ti.filename < tj.filename
+		}
+		return ti.line < tj.line
+	})
+	return tags
+}
+
+// ctagsKinds maps kind names to the single-letter kinds
+// used by universal-ctags for Go.
+var ctagsKinds = map[string]string{
+	"const":      "c",
+	"func":       "f",
+	"interface":  "i",
+	"member":     "m",
+	"methodSpec": "n",
+	"struct":     "s",
+	"type":       "t",
+	"unknown":    "u",
+	"var":        "v",
+}
+
+// writeCtags writes tags, which must be sorted by name,
+// in universal-ctags extended format.
+func writeCtags(w io.Writer, tags []tag) {
+	fmt.Fprintf(w, "!_TAG_FILE_FORMAT\t2\t/extended format/\n")
+	fmt.Fprintf(w, "!_TAG_FILE_SORTED\t1\t/0=unsorted, 1=sorted, 2=foldcase/\n")
+	fmt.Fprintf(w, "!_TAG_PROGRAM_NAME\tgodef\t//\n")
+	for _, t := range tags {
+		fmt.Fprintf(w, "%s\t%s\t%d;\"\t%s\tline:%d", t.name, t.filename, t.line, ctagsKinds[t.kind], t.line)
+		if t.scope != "" {
+			fmt.Fprintf(w, "\t%s", t.scope)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+// writeEtags writes tags in the format of an Emacs TAGS file,
+// reading the tagged lines from the files, whose names are
+// relative to dir.
+func writeEtags(w io.Writer, tags []tag, dir string) error {
+	byFile := make(map[string][]tag)
+	var filenames []string
+	for _, t := range tags {
+		if byFile[t.filename] == nil {
+			filenames = append(filenames, t.filename)
+		}
+		byFile[t.filename] = append(byFile[t.filename], t)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		ftags := byFile[filename]
+		sort.SliceStable(ftags, func(i, j int) bool {
+			return ftags[i].line < ftags[j].line
+		})
+		content, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(filename)))
+		if err != nil {
+			return err
+		}
+		lineStarts := []int{0}
+		for i, c := range content {
+			if c == '\n' {
+				lineStarts = append(lineStarts, i+1)
+			}
+		}
+		var section bytes.Buffer
+		for _, t := range ftags {
+			if t.line < 1 || t.line > len(lineStarts) {
+				continue
+			}
+			start := lineStarts[t.line-1]
+			line := lineAt(content[start:], 1)
+			end := t.column - 1 + len(t.name)
+			if end > len(line) {
+				end = len(line)
+			}
+			fmt.Fprintf(&section, "%s\x7f%s\x01%d,%d\n", line[:end], t.name, t.line, start)
+		}
+		fmt.Fprintf(w, "\x0c\n%s,%d\n", filename, section.Len())
+		if _, err := w.Write(section.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+)
+
+const tagsSrc = `package x
+
+type T struct{ A int }
+
+type I interface{ M() }
+
+func (t T) M() {}
+
+const C = 1
+`
+
+// loadTags returns the tags for a module holding tagsSrc as x.go,
+// and the module's directory.
+func loadTags(t *testing.T) ([]tag, string) {
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module example.com/x\n",
+		"x.go":   tagsSrc,
+	})
+	idx, err := buildIndex(context.Background(), dir, []string{"./..."}, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idx.tags(dir), dir
+}
+
+func TestWriteCtags(t *testing.T) {
+	tags, _ := loadTags(t)
+	var buf bytes.Buffer
+	writeCtags(&buf, tags)
+	want := "!_TAG_FILE_FORMAT\t2\t/extended format/\n" +
+		"!_TAG_FILE_SORTED\t1\t/0=unsorted, 1=sorted, 2=foldcase/\n" +
+		"!_TAG_PROGRAM_NAME\tgodef\t//\n" +
+		"A\tx.go\t3;\"\tm\tline:3\tstruct:T\n" +
+		"C\tx.go\t9;\"\tc\tline:9\n" +
+		"I\tx.go\t5;\"\ti\tline:5\n" +
+		"M\tx.go\t5;\"\tn\tline:5\tinterface:I\n" +
+		"M\tx.go\t7;\"\tf\tline:7\tstruct:T\n" +
+		"T\tx.go\t3;\"\ts\tline:3\n"
+	if buf.String() != want {
+		t.Errorf("got tags\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteEtags(t *testing.T) {
+	tags, dir := loadTags(t)
+	var buf bytes.Buffer
+	if err := writeEtags(&buf, tags, dir); err != nil {
+		t.Fatal(err)
+	}
+	section := "type T struct{ A\x7fA\x013,11\n" +
+		"type T\x7fT\x013,11\n" +
+		"type I\x7fI\x015,35\n" +
+		"type I interface{ M\x7fM\x015,35\n" +
+		"func (t T) M\x7fM\x017,60\n" +
+		"const C\x7fC\x019,79\n"
+	want := fmt.Sprintf("\x0c\nx.go,%d\n%s", len(section), section)
+	if buf.String() != want {
+		t.Errorf("got TAGS %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rogpeppe/godef/godef"
+)
+
+func unusedMain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("unused", flag.ExitOnError)
+	jsonOut := fs.Bool("json", false, "print each symbol as a JSON object on its own line")
+	methods := fs.Bool("methods", false, "include methods, which may be called through interfaces")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: godef unused [-json] [-methods] [packages]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	// References from tests count, but declarations in them do not.
+	idx, err := collectRefs(ctx, dir, patterns, true)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	for _, sym := range unusedSymbols(idx, *methods) {
+		if *jsonOut {
+			if err := enc.Encode(newXrefSymbol(sym)); err != nil {
+				return err
+			}
+			continue
+		}
+		name := sym.Pkg + "." + sym.Name
+		if sym.Recv != "" {
+			name = sym.Pkg + "." + sym.Recv + "." + sym.Name
+		}
+		fmt.Printf("%s %s %s\n", sym.Kind, name, relPos(dir, sym.Pos))
+	}
+	return nil
+}
+
+// unusedSymbols returns the exported package-level symbols defined
+// in idx, and with methods their methods, that nothing in idx refers
+// to from outside their own declarations, in order of position.
+// Fields, which are often used only through reflection, and symbols
+// defined in test files, main packages or generated files are left
+// out.
+func unusedSymbols(idx *refIndex, methods bool) []*refSymbol {
+	skip := make(map[string]bool)
+	skipFile := func(filename string) bool {
+		s, ok := skip[filename]
+		if !ok {
+			s = strings.HasSuffix(filename, "_test.go") || isMainFile(filename) || godef.IsGenerated(filename)
+			skip[filename] = s
+		}
+		return s
+	}
+	var unused []*refSymbol
+	for _, sym := range idx.Symbols {
+		if sym.Def == nil || sym.local || !token.IsExported(sym.Name) {
+			continue
+		}
+		switch sym.Kind {
+		case "func", "type", "var", "const":
+		case "method":
+			if !methods {
+				continue
+			}
+		default:
+			continue
+		}
+		if skipFile(sym.Pos.Filename) {
+			continue
+		}
+		used := false
+		for _, ref := range sym.Refs {
+			// A reference from within the symbol's own
+			// declaration, as by a recursive call, is no use.
+			if ref.Scope != sym.Def.Scope {
+				used = true
+				break
+			}
+		}
+		if !used {
+			unused = append(unused, sym)
+		}
+	}
+	sort.SliceStable(unused, func(i, j int) bool {
+		pi, pj := unused[i].Pos, unused[j].Pos
+		if pi.Filename != pj.Filename {
+			return pi.Filename < pj.Filename
+		}
+		return pi.Offset < pj.Offset
+	})
+	return unused
+}
+
+// isMainFile reports whether filename belongs to package main.
+func isMainFile(filename string) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), filename, nil, parser.PackageClauseOnly)
+	return err == nil && f.Name.Name == "main"
+}
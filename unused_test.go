@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestUnusedSymbols(t *testing.T) {
+	files := map[string]string{
+		"go.mod": "module x\n",
+		"lib/lib.go": `package lib
+
+type Used struct{ Field int }
+
+type Unused struct{ next *Unused }
+
+func (Used) Method() {}
+
+func Recurse(n int) int {
+	if n == 0 {
+		return 0
+	}
+	return Recurse(n - 1)
+}
+
+const Tested = 1
+
+var unexported = 2
+`,
+		"lib/lib_test.go": `package lib
+
+import "testing"
+
+func TestTested(t *testing.T) { _ = Tested }
+`,
+		"lib/gen.go": `// Code generated by hand. DO NOT EDIT.
+
+package lib
+
+func Generated() {}
+`,
+		"cmd/c/main.go": `package main
+
+import "x/lib"
+
+func Exported() {}
+
+func main() { _ = lib.Used{} }
+`,
+	}
+	dir := writeTree(t, files)
+	idx, err := collectRefs(context.Background(), dir, []string{"./..."}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		methods bool
+		want    []string
+	}{
+		{false, []string{"Unused", "Recurse"}},
+		{true, []string{"Unused", "Method", "Recurse"}},
+	} {
+		var got []string
+		for _, sym := range unusedSymbols(idx, test.methods) {
+			got = append(got, sym.Name)
+		}
+		if strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("with methods %v, got unused %v want %v", test.methods, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+)
+
+func warmMain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("warm", flag.ExitOnError)
+	fs.StringVar(remoteFlag, "remote", *remoteFlag, "load the packages into the daemon at this address (\"auto\" for the default)")
+	fs.BoolVar(cacheFlag, "cache", *cacheFlag, "also keep the output of go env on disk, for queries made with -cache")
+	fs.IntVar(jobsFlag, "jobs", *jobsFlag, "maximum number of standard library packages to summarize concurrently")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: godef warm [-remote addr] [-cache] [-jobs n] [packages]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if *remoteFlag != "" {
+		network, addr, err := daemonAddr(*remoteFlag, dir)
+		if err != nil {
+			return err
+		}
+		r, err := callDaemon(network, addr, &query{Dir: dir, Warm: patterns})
+		if err != nil {
+			return err
+		}
+		logf(levelInfo, "the daemon cached %d packages", r.Warmed)
+		return nil
+	}
+	n, err := warmLocal(ctx, dir, patterns, *jobsFlag)
+	if err != nil {
+		return err
+	}
+	logf(levelInfo, "warmed %d packages", n)
+	return nil
+}
+
+// warmLocal prepares the caches used by one-shot queries on
+// the packages matching patterns: the go command's build cache,
+// which holds the export data of their dependencies, the output
+// of go env, and the summaries of the standard library packages
+// they import, building up to jobs summaries concurrently. It
+// returns the number of packages loaded.
+func warmLocal(ctx context.Context, dir string, patterns []string, jobs int) (int, error) {
+	if _, err := goEnv(ctx, dir); err != nil {
+		return 0, err
+	}
+	cfg := &packages.Config{
+		Context: ctx,
+		Dir:     dir,
+		Mode:    packages.LoadTypes,
+		Tests:   true,
+	}
+	lpkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	stdlib := make(map[string]bool)
+	packages.Visit(lpkgs, nil, func(pkg *packages.Package) {
+		n++
+		if isStdlib(pkg.PkgPath) && pkg.PkgPath != "unsafe" {
+			stdlib[pkg.PkgPath] = true
+		}
+	})
+	var paths []string
+	for path := range stdlib {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	runJobs(len(paths), jobs, func(i int) {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := readStdlibSummary(ctx, paths[i]); err != nil {
+			logf(levelDebug, "cannot summarize %s: %v", paths[i], err)
+		}
+	})
+	return n, ctx.Err()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/godef/godef"
+)
+
+// watchInterval is the least time between the daemon's scans of
+// the files it watches, when it cannot be notified of changes.
+var watchInterval = 2 * time.Second
+
+// notifyDelay is how long the daemon waits after being notified of
+// a change for any more before reporting them, so that a burst of
+// changes, such as a checkout makes, is reported at once.
+var notifyDelay = 50 * time.Millisecond
+
+// fileStamp records enough about a file to tell when it changes.
+type fileStamp struct {
+	ModTime time.Time
+	Size    int64
+
+	// Sum, if not nil, holds a hash of the file's contents,
+	// for files modified too recently for their modification
+	// times to be trusted; see addStamp.
+	Sum []byte `json:",omitempty"`
+}
+
+func (s fileStamp) same(t fileStamp) bool {
+	return s.Size == t.Size && s.ModTime.Equal(t.ModTime)
+}
+
+// watchTree calls changed with the names of any Go source or module
+// files under root that are added, removed or modified, until ctx is
+// done. It relies on the operating system to report changes, and
+// polls only where it cannot. Files that match the exclude patterns
+// are not watched.
+func watchTree(ctx context.Context, root string, exclude []string, changed func(names []string)) {
+	n, err := newTreeNotifier(root, exclude)
+	if err != nil {
+		logf(levelInfo, "cannot be notified of changes under %s, so polling instead: %v", root, err)
+		pollTree(ctx, root, exclude, changed)
+		return
+	}
+	n.run(ctx, changed)
+}
+
+// pollTree is like watchTree, but scans the tree for changes. It
+// waits twenty times as long as each scan took before the next, and
+// at least watchInterval, so that a large tree is not scanned
+// continually.
+func pollTree(ctx context.Context, root string, exclude []string, changed func(names []string)) {
+	start := time.Now()
+	stamps := scanTree(root, exclude)
+	took := time.Since(start)
+	for {
+		delay := 20 * took
+		if delay < watchInterval {
+			delay = watchInterval
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		start := time.Now()
+		next := scanTree(root, exclude)
+		took = time.Since(start)
+		var names []string
+		for name, s := range next {
+			if old, ok := stamps[name]; !ok || !old.same(s) {
+				names = append(names, name)
+			}
+		}
+		for name := range stamps {
+			if _, ok := next[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		stamps = next
+		if len(names) > 0 {
+			changed(names)
+		}
+	}
+}
+
+// scanTree returns the stamps of all relevant files under root. It
+// skips the directories that the go command ignores, those whose names
+// begin with a period or underscore, and those that godef.CommonExcludes
+// matches, such as testdata and node_modules, along with any files and
+// directories that the exclude patterns match.
+func scanTree(root string, exclude []string) map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if !watchedDir(root, path, exclude) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if watchedFile(root, path, exclude) {
+			stamps[path] = fileStamp{ModTime: info.ModTime(), Size: info.Size()}
+		}
+		return nil
+	})
+	return stamps
+}
+
+// watchedDir reports whether the directory at path, which is root or
+// a directory under it, is watched, as scanTree describes.
+func watchedDir(root, path string, exclude []string) bool {
+	if path == root {
+		return true
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	name := filepath.Base(path)
+	return !strings.HasPrefix(name, ".") && !strings.HasPrefix(name, "_") && !godef.Excluded(rel, godef.CommonExcludes) && !godef.Excluded(rel, exclude)
+}
+
+// watchedFile reports whether the file at path, in a watched
+// directory under root, is watched: whether it is a Go source
+// or module file that the exclude patterns do not match.
+func watchedFile(root, path string, exclude []string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	name := filepath.Base(path)
+	return (strings.HasSuffix(name, ".go") || name == "go.mod" || name == "go.sum") && !godef.Excluded(rel, exclude)
+}
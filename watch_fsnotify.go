@@ -0,0 +1,157 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows
+// +build darwin dragonfly freebsd linux netbsd openbsd windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// treeNotifier reports the changes to the files under a directory
+// tree that the operating system notifies it of.
+type treeNotifier struct {
+	root    string
+	exclude []string
+	w       *fsnotify.Watcher
+	files   map[string]bool // the watched files
+}
+
+// newTreeNotifier returns a notifier watching the directories under
+// root, as scanTree would scan them. It fails if the operating system
+// cannot watch them all, such as when there are more than the limit
+// on inotify watches on Linux.
+func newTreeNotifier(root string, exclude []string) (*treeNotifier, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	n := &treeNotifier{
+		root:    root,
+		exclude: exclude,
+		w:       w,
+		files:   make(map[string]bool),
+	}
+	if _, err := n.addDir(root); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return n, nil
+}
+
+// addDir watches dir and the watched directories under it, and
+// returns the names of the watched files in them.
+func (n *treeNotifier) addDir(dir string) ([]string, error) {
+	var names []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if info.IsDir() {
+			if !watchedDir(n.root, path, n.exclude) {
+				return filepath.SkipDir
+			}
+			return n.w.Add(path)
+		}
+		if watchedFile(n.root, path, n.exclude) {
+			n.files[path] = true
+			names = append(names, path)
+		}
+		return nil
+	})
+	return names, err
+}
+
+// run calls changed with the names of the files that have changed,
+// as watchTree does, until ctx is done.
+func (n *treeNotifier) run(ctx context.Context, changed func(names []string)) {
+	defer n.w.Close()
+	pending := make(map[string]bool)
+	var flush <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-n.w.Events:
+			if !ok {
+				return
+			}
+			for _, name := range n.event(ev) {
+				pending[name] = true
+			}
+		case err, ok := <-n.w.Errors:
+			if !ok {
+				return
+			}
+			// Changes may have gone unreported,
+			// so report every file.
+			logf(levelWarn, "watching %s: %v", n.root, err)
+			for name := range n.files {
+				pending[name] = true
+			}
+		case <-flush:
+			flush = nil
+			names := make([]string, 0, len(pending))
+			for name := range pending {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			pending = make(map[string]bool)
+			changed(names)
+			continue
+		}
+		if flush == nil && len(pending) > 0 {
+			flush = time.After(notifyDelay)
+		}
+	}
+}
+
+// event returns the names of the watched files that
+// ev reports changed, watching any new directory.
+func (n *treeNotifier) event(ev fsnotify.Event) []string {
+	name := ev.Name
+	if ev.Op&fsnotify.Create != 0 {
+		if info, err := os.Lstat(name); err == nil && info.IsDir() {
+			if !watchedDir(n.root, name, n.exclude) {
+				return nil
+			}
+			// Files may have been added to the directory
+			// before it was watched.
+			names, err := n.addDir(name)
+			if err != nil {
+				logf(levelWarn, "cannot watch %s: %v", name, err)
+			}
+			return names
+		}
+	}
+	var names []string
+	if ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		// A directory that is removed or renamed
+		// takes its files with it.
+		prefix := name + string(filepath.Separator)
+		for f := range n.files {
+			if strings.HasPrefix(f, prefix) {
+				delete(n.files, f)
+				names = append(names, f)
+			}
+		}
+	}
+	if !watchedFile(n.root, name, n.exclude) {
+		return names
+	}
+	if ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		delete(n.files, name)
+	} else {
+		n.files[name] = true
+	}
+	return append(names, name)
+}
@@ -0,0 +1,20 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+)
+
+// treeNotifier is not implemented on this system,
+// so the daemon polls for changes instead.
+type treeNotifier struct{}
+
+func newTreeNotifier(root string, exclude []string) (*treeNotifier, error) {
+	return nil, fmt.Errorf("file change notification is not supported on %s", runtime.GOOS)
+}
+
+func (n *treeNotifier) run(ctx context.Context, changed func(names []string)) {}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/go/packages"
+)
+
+func TestWatchInvalidates(t *testing.T) {
+	defer func(d time.Duration) { watchInterval = d }(watchInterval)
+	watchInterval = 10 * time.Millisecond
+	for _, watch := range []struct {
+		name string
+		f    func(ctx context.Context, root string, exclude []string, changed func(names []string))
+	}{
+		{"notify", watchTree},
+		{"poll", pollTree},
+	} {
+		t.Run(watch.name, func(t *testing.T) {
+			dir := writeTree(t, map[string]string{
+				"go.mod":              "module x\n",
+				"x.go":                "package x\n\nvar v = C\n",
+				"c.go":                "package x\n\nconst C = 1\n",
+				"testdata/t.go":       "package t\n",
+				"node_modules/m/m.go": "package m\n",
+				"gen/skip/skip.go":    "package skip\n",
+				".hidden/h.go":        "package h\n",
+			})
+			if got := scanTree(dir, []string{"gen/skip"}); len(got) != 3 {
+				t.Errorf("got %d watched files, want go.mod, x.go and c.go", len(got))
+			}
+			c := newPackageCache()
+			cfg := &packages.Config{Dir: dir, Overlay: map[string][]byte{}}
+			x := filepath.Join(dir, "x.go")
+			if _, err := c.get(cfg, x); err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			changed := make(chan []string, 10)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				watch.f(ctx, dir, []string{"gen/skip"}, func(names []string) {
+					c.invalidateFiles(names)
+					changed <- names
+				})
+			}()
+			// The watcher must stop before watchInterval is restored.
+			defer func() {
+				cancel()
+				<-done
+			}()
+			// Let the watcher take its first scan before adding
+			// a file to the package.
+			time.Sleep(50 * time.Millisecond)
+			// Changes to files that are not watched go unreported.
+			for _, name := range []string{"testdata/u.go", "gen/skip/other.go", "x.txt"} {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("package x\n"), 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+			d := filepath.Join(dir, "d.go")
+			if err := ioutil.WriteFile(d, []byte("package x\n\nconst D = 1\n"), 0666); err != nil {
+				t.Fatal(err)
+			}
+			wantChanged(t, changed, d)
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.pkgs[x] != nil {
+				t.Errorf("package x was not discarded after a file was added to it")
+			}
+		})
+	}
+}
+
+func TestWatchNewDir(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module x\n",
+	})
+	n, err := newTreeNotifier(dir, nil)
+	if err != nil {
+		t.Skipf("cannot be notified of changes: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan []string, 10)
+	go n.run(ctx, func(names []string) {
+		changed <- names
+	})
+	// A directory made with a file already in it is
+	// watched, and its file reported.
+	sub := filepath.Join(dir, "sub")
+	if err := os.MkdirAll(filepath.Join(sub, "inner"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	s := filepath.Join(sub, "inner", "s.go")
+	if err := ioutil.WriteFile(s, []byte("package inner\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	wantChanged(t, changed, s)
+	// Files are reported when the directory holding
+	// them is moved away.
+	if err := os.Rename(sub, filepath.Join(dir, "_moved")); err != nil {
+		t.Fatal(err)
+	}
+	wantChanged(t, changed, s)
+}
+
+// wantChanged checks that the next names sent on
+// changed are those given.
+func wantChanged(t *testing.T, changed <-chan []string, want ...string) {
+	t.Helper()
+	select {
+	case names := <-changed:
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("got changed files %q, want %q", names, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no change seen")
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/rogpeppe/godef/godef"
+	"golang.org/x/tools/go/packages"
+)
+
+// refIndex holds the definitions of, and references to, all
+// the named objects used in a set of packages.
+type refIndex struct {
+	Files   []*refFile
+	Symbols []*refSymbol // in order of first appearance
+}
+
+// refFile holds the occurrences of objects in a single file.
+type refFile struct {
+	Filename string
+	Pkg      string
+	Occs     []*refOcc // in file order
+	FuncEnds []int     // lines holding the end of each function declaration
+}
+
+// refOcc is a single occurrence of an identifier denoting an object.
+// Its range is given in zero-based lines and UTF-16 characters,
+// as used by LSP-derived formats; Pos holds the usual byte-based
+// position.
+type refOcc struct {
+	Pos        token.Position
+	Start, End lspPosition
+	Symbol     *refSymbol
+	Def        bool
+	Scope      string // name of the enclosing top-level declaration
+}
+
+// refSymbol is a named object defined or used by the indexed packages.
+type refSymbol struct {
+	Name  string
+	Kind  string // as reported by objKind
+	Pkg   string // import path of the defining package
+	Recv  string // name of the receiver or enclosing type, if any
+	Hover string // type information, as printed by godef -t
+	Pos   token.Position
+	Def   *refOcc   // nil if defined outside the indexed packages
+	Refs  []*refOcc // uses, in order of appearance
+	local bool      // not visible outside its defining function
+}
+
+func xrefMain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("xref", flag.ExitOnError)
+	jsonOut := fs.Bool("json", false, "print each symbol as a JSON object on its own line")
+	tests := fs.Bool("tests", false, "include test files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: godef xref [-json] [-tests] [packages]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	idx, err := collectRefs(ctx, dir, patterns, *tests)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	for _, sym := range idx.Symbols {
+		if sym.local {
+			continue
+		}
+		if *jsonOut {
+			if err := enc.Encode(newXrefSymbol(sym)); err != nil {
+				return err
+			}
+			continue
+		}
+		name := sym.Pkg + "." + sym.Name
+		if sym.Recv != "" {
+			name = sym.Pkg + "." + sym.Recv + "." + sym.Name
+		}
+		fmt.Printf("%s %s %s\n", sym.Kind, name, relPos(dir, sym.Pos))
+		for _, ref := range sym.Refs {
+			fmt.Printf("\t%s\t%s\n", relPos(dir, ref.Pos), ref.Scope)
+		}
+	}
+	return nil
+}
+
+// xrefSymbol is the JSON form of a symbol printed by godef xref -json.
+type xrefSymbol struct {
+	Name       string    `json:"name"`
+	Kind       string    `json:"kind"`
+	Pkg        string    `json:"pkg"`
+	Recv       string    `json:"recv,omitempty"`
+	Definition jsonPos   `json:"definition"`
+	Scope      string    `json:"scope,omitempty"`
+	Refs       []xrefRef `json:"refs,omitempty"`
+}
+
+type xrefRef struct {
+	jsonPos
+	Scope string `json:"scope,omitempty"`
+}
+
+func newXrefSymbol(sym *refSymbol) *xrefSymbol {
+	x := &xrefSymbol{
+		Name:       sym.Name,
+		Kind:       sym.Kind,
+		Pkg:        sym.Pkg,
+		Recv:       sym.Recv,
+		Definition: newJSONPos(sym.Pos),
+	}
+	if sym.Def != nil {
+		x.Scope = sym.Def.Scope
+	}
+	for _, ref := range sym.Refs {
+		x.Refs = append(x.Refs, xrefRef{newJSONPos(ref.Pos), ref.Scope})
+	}
+	return x
+}
+
+// relPos formats pos with its file name relative to dir where possible.
+func relPos(dir string, pos token.Position) string {
+	pos.Filename = relPath(dir, pos.Filename)
+	return pos.String()
+}
+
+// collectRefs loads the packages matching patterns and records
+// every definition and use of a named object within them.
+func collectRefs(ctx context.Context, dir string, patterns []string, tests bool) (*refIndex, error) {
+	cfg := &packages.Config{
+		Context: ctx,
+		Dir:     dir,
+		Mode:    packages.LoadSyntax,
+		Tests:   tests,
+	}
+	lpkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	idx := &refIndex{}
+	syms := make(map[string]*refSymbol)
+	seen := make(map[string]bool)
+	for _, pkg := range lpkgs {
+		for _, file := range pkg.Syntax {
+			tf := pkg.Fset.File(file.Pos())
+			if tf == nil || seen[tf.Name()] {
+				// Test variants repeat the files of the package under test.
+				continue
+			}
+			seen[tf.Name()] = true
+			idx.Files = append(idx.Files, collectFileRefs(idx, syms, pkg, file, tf.Name()))
+		}
+	}
+	return idx, nil
+}
+
+func collectFileRefs(idx *refIndex, syms map[string]*refSymbol, pkg *packages.Package, file *ast.File, filename string) *refFile {
+	content, _ := ioutil.ReadFile(filename)
+	rf := &refFile{
+		Filename: filename,
+		Pkg:      pkg.PkgPath,
+	}
+	var scope string
+	visit := func(n ast.Node) bool {
+		if fd, ok := n.(*ast.FuncDecl); ok && fd.Body != nil {
+			rf.FuncEnds = append(rf.FuncEnds, pkg.Fset.Position(fd.Body.Rbrace).Line)
+		}
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		obj, def := pkg.TypesInfo.Defs[id], true
+		if obj == nil {
+			obj, def = pkg.TypesInfo.Uses[id], false
+		}
+		if obj == nil || obj.Pkg() == nil || !obj.Pos().IsValid() {
+			// Universe objects and package names have no useful definition.
+			return true
+		}
+		if _, ok := obj.(*types.PkgName); ok {
+			return true
+		}
+		objPos := pkg.Fset.Position(obj.Pos())
+		key := objPos.String() + " " + obj.Name()
+		sym := syms[key]
+		if sym == nil {
+			sym = &refSymbol{
+				Name:  obj.Name(),
+				Kind:  objKind(obj),
+				Pkg:   obj.Pkg().Path(),
+				Recv:  recvOf(obj),
+				Hover: godef.TypeString(obj, qualifier),
+				Pos:   objPos,
+				local: obj.Parent() != nil && obj.Parent() != obj.Pkg().Scope(),
+			}
+			syms[key] = sym
+			idx.Symbols = append(idx.Symbols, sym)
+		}
+		pos := pkg.Fset.Position(id.Pos())
+		occ := &refOcc{
+			Pos:    pos,
+			Start:  lspPosAt(content, pos),
+			Symbol: sym,
+			Def:    def,
+			Scope:  scope,
+		}
+		occ.End = lspPosition{occ.Start.Line, occ.Start.Character + utf16Len([]byte(id.Name))}
+		if def {
+			sym.Def = occ
+		} else {
+			sym.Refs = append(sym.Refs, occ)
+		}
+		rf.Occs = append(rf.Occs, occ)
+		return true
+	}
+	for _, decl := range file.Decls {
+		if gd, ok := decl.(*ast.GenDecl); ok {
+			for _, spec := range gd.Specs {
+				scope = specName(spec)
+				ast.Inspect(spec, visit)
+			}
+			continue
+		}
+		scope = funcName(decl.(*ast.FuncDecl))
+		ast.Inspect(decl, visit)
+	}
+	sort.SliceStable(rf.Occs, func(i, j int) bool {
+		return rf.Occs[i].Pos.Offset < rf.Occs[j].Pos.Offset
+	})
+	return rf
+}
+
+// funcName returns the name of a function declaration,
+// qualified by its receiver type if it is a method.
+func funcName(fd *ast.FuncDecl) string {
+	if fd.Recv == nil || len(fd.Recv.List) == 0 {
+		return fd.Name.Name
+	}
+	t := fd.Recv.List[0].Type
+	if star, ok := t.(*ast.StarExpr); ok {
+		t = star.X
+	}
+	if id, ok := t.(*ast.Ident); ok {
+		return id.Name + "." + fd.Name.Name
+	}
+	return fd.Name.Name
+}
+
+// specName returns the first name declared by spec.
+func specName(spec ast.Spec) string {
+	switch spec := spec.(type) {
+	case *ast.TypeSpec:
+		return spec.Name.Name
+	case *ast.ValueSpec:
+		if len(spec.Names) > 0 {
+			return spec.Names[0].Name
+		}
+	}
+	return ""
+}
+
+// lspPosAt returns the LSP position of pos within content.
+func lspPosAt(content []byte, pos token.Position) lspPosition {
+	line := lineAt(content, pos.Line)
+	col := pos.Column - 1
+	if col > len(line) {
+		col = len(line)
+	}
+	return lspPosition{pos.Line - 1, utf16Len(line[:col])}
+}
+
+// objKind returns a short description of the kind of obj.
+func objKind(obj types.Object) string {
+	switch obj := obj.(type) {
+	case *types.Func:
+		if recvOf(obj) != "" {
+			return "method"
+		}
+		return "func"
+	case *types.Var:
+		if obj.IsField() {
+			return "field"
+		}
+		return "var"
+	case *types.Const:
+		return "const"
+	case *types.TypeName:
+		return "type"
+	case *types.Label:
+		return "label"
+	case *types.PkgName:
+		return "package"
+	}
+	return "unknown"
+}
+
+// recvOf returns the name of the receiver type of a method,
+// or the empty string for other objects.
+func recvOf(obj types.Object) string {
+	f, ok := obj.(*types.Func)
+	if !ok {
+		return ""
+	}
+	sig, ok := f.Type().(*types.Signature)
+	if !ok || sig.Recv() == nil {
+		return ""
+	}
+	t := sig.Recv().Type()
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	if n, ok := t.(*types.Named); ok {
+		return n.Obj().Name()
+	}
+	return ""
+}
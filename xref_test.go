@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const refsSrc = `package x
+
+type T struct{ A int }
+
+func (t T) M() int { return t.A }
+
+func F() int {
+	var t T
+	return t.M()
+}
+`
+
+// loadRefs returns the references in a module holding refsSrc
+// as x.go, and the module's directory.
+func loadRefs(t *testing.T) (*refIndex, string) {
+	dir := writeTree(t, map[string]string{
+		"go.mod": "module example.com/x\n",
+		"x.go":   refsSrc,
+	})
+	idx, err := collectRefs(context.Background(), dir, []string{"./..."}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idx, dir
+}
+
+func TestCollectRefs(t *testing.T) {
+	idx, dir := loadRefs(t)
+	var got []string
+	for _, sym := range idx.Symbols {
+		if sym.local {
+			continue
+		}
+		s := fmt.Sprintf("%s %s.%s %s", sym.Kind, sym.Recv, sym.Name, relPos(dir, sym.Pos))
+		for _, ref := range sym.Refs {
+			s += fmt.Sprintf(" %d:%d(%s)", ref.Pos.Line, ref.Pos.Column, ref.Scope)
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		"type .T x.go:3:6 5:9(T.M) 8:8(F)",
+		"field .A x.go:3:16 5:31(T.M)",
+		"method T.M x.go:5:12 9:11(F)",
+		"func .F x.go:7:6",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got symbols\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if len(idx.Files) != 1 || len(idx.Files[0].FuncEnds) != 2 {
+		t.Errorf("got files %+v, want x.go with two functions", idx.Files)
+	}
+}